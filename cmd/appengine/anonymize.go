@@ -0,0 +1,110 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/spf13/cobra"
+)
+
+const anonymizeDoc = `Anonymize the output, so that it can be shared without exposing fleet identities. It is a list of:
+devices - Device IDs are replaced with hashes, consistent only within the same run.
+aliases - Device aliases and attributes are removed.
+ips - IP addresses are removed.`
+
+// outputAnonymizer anonymizes the output of the running command. When nil, the output is left untouched.
+var outputAnonymizer *anonymizer
+
+// anonymizer hashes Device IDs with a per-run random salt, and strips identifying device details
+type anonymizer struct {
+	salt    []byte
+	devices bool
+	aliases bool
+	ips     bool
+}
+
+// setupAnonymizer reads --anonymize from command and sets up outputAnonymizer accordingly
+func setupAnonymizer(command *cobra.Command) error {
+	options, err := command.Flags().GetStringSlice("anonymize")
+	if err != nil {
+		return err
+	}
+	if len(options) == 0 {
+		return nil
+	}
+
+	a := &anonymizer{salt: make([]byte, 32)}
+	for _, option := range options {
+		switch option {
+		case "devices":
+			a.devices = true
+		case "aliases":
+			a.aliases = true
+		case "ips":
+			a.ips = true
+		default:
+			return fmt.Errorf("%s is not a valid --anonymize option. Valid options are devices, aliases and ips", option)
+		}
+	}
+	if _, err := rand.Read(a.salt); err != nil {
+		return err
+	}
+
+	outputAnonymizer = a
+	return nil
+}
+
+// deviceID returns a hash of deviceID, shaped like a Device ID
+func (a *anonymizer) deviceID(deviceID string) string {
+	if a == nil || !a.devices {
+		return deviceID
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(deviceID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (a *anonymizer) deviceIDs(deviceIDs []string) []string {
+	if a == nil || !a.devices {
+		return deviceIDs
+	}
+	ret := make([]string, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		ret = append(ret, a.deviceID(deviceID))
+	}
+	return ret
+}
+
+func (a *anonymizer) deviceDetails(deviceDetails client.DeviceDetails) client.DeviceDetails {
+	if a == nil {
+		return deviceDetails
+	}
+	deviceDetails.DeviceID = a.deviceID(deviceDetails.DeviceID)
+	if a.aliases {
+		deviceDetails.Aliases = nil
+		deviceDetails.Attributes = nil
+	}
+	if a.ips {
+		deviceDetails.LastSeenIP = nil
+		deviceDetails.LastCredentialsRequestIP = nil
+	}
+	return deviceDetails
+}
@@ -49,12 +49,20 @@ func init() {
 		"Realm Management API base URL. Defaults to <astarte-url>/realmmanagement.")
 	AppEngineCmd.PersistentFlags().StringP("realm-name", "r", "",
 		"The name of the realm that will be queried")
+	_ = AppEngineCmd.RegisterFlagCompletionFunc("realm-name", utils.RealmNamesCompletion)
 	AppEngineCmd.PersistentFlags().Bool("to-curl", false,
 		"When set, display a command-line equivalent instead of running the command.")
 	_ = viper.BindPFlag("appengine-to-curl", AppEngineCmd.PersistentFlags().Lookup("to-curl"))
 }
 
 func appEnginePersistentPreRunE(cmd *cobra.Command, args []string) error {
+	// Invalid go-template and jsonpath outputs are reported before calling Astarte, rather than when rendering
+	if output := cmd.Flags().Lookup("output"); output != nil && utils.IsTemplateOutput(output.Value.String()) {
+		if _, err := utils.NewTemplateOutput(output.Value.String()); err != nil {
+			return err
+		}
+	}
+
 	appEngineURLOverride := viper.GetString("individual-urls.appengine")
 	_ = viper.BindPFlag("individual-urls.realm-management", cmd.Flags().Lookup("realm-management-url"))
 	realmManagementURLOverride := viper.GetString("individual-urls.realm-management")
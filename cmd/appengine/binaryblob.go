@@ -0,0 +1,174 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+)
+
+// binaryBlobWriter decodes binaryblob values and writes them to files in a directory, as their
+// base64 representation is of no use when shown in a table. A nil binaryBlobWriter leaves values untouched.
+type binaryBlobWriter struct {
+	dir string
+}
+
+func newBinaryBlobWriter(dir string) (*binaryBlobWriter, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &binaryBlobWriter{dir: dir}, nil
+}
+
+// replace returns value as is, unless candidatePaths resolve to a binaryblob or binaryblobarray mapping
+// of iface. In that case, value is decoded and written to <dir>/<interface>/<path>/<timestamp>_<hash>.bin,
+// where hash is taken from the content, so that samples sharing a timestamp do not overwrite each other,
+// and the name of the file (or the names of the files, for arrays) is returned instead. As paths returned by
+// AppEngine might be relative to the queried path, the first candidate path matching a mapping is used.
+func (w *binaryBlobWriter) replace(iface interfaces.AstarteInterface, candidatePaths []string, timestamp time.Time, value interface{}) interface{} {
+	if w == nil || value == nil {
+		return value
+	}
+	var mapping interfaces.AstarteInterfaceMapping
+	var valuePath string
+	found := false
+	for _, p := range candidatePaths {
+		if m, err := interfaces.InterfaceMappingFromPath(iface, p); err == nil {
+			mapping, valuePath, found = m, p, true
+			break
+		}
+	}
+	if !found || (mapping.Type != interfaces.BinaryBlob && mapping.Type != interfaces.BinaryBlobArray) {
+		return value
+	}
+
+	baseName := "latest"
+	if !timestamp.IsZero() {
+		// Colons are not allowed in file names on some platforms
+		baseName = strings.ReplaceAll(timestamp.UTC().Format(time.RFC3339Nano), ":", "-")
+	}
+	fileDir := filepath.Join(w.dir, iface.Name, filepath.FromSlash(strings.TrimPrefix(path.Clean(valuePath), "/")))
+
+	switch v := value.(type) {
+	case string:
+		fileName, err := w.write(fileDir, baseName, v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Could not decode binaryblob at %s: %s\n", valuePath, err)
+			return value
+		}
+		return fileName
+	case []interface{}:
+		fileNames := []string{}
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "warn: Could not decode binaryblob at %s: unexpected value %v\n", valuePath, item)
+				return value
+			}
+			fileName, err := w.write(fileDir, fmt.Sprintf("%s_%d", baseName, i), s)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warn: Could not decode binaryblob at %s: %s\n", valuePath, err)
+				return value
+			}
+			fileNames = append(fileNames, fileName)
+		}
+		return fileNames
+	}
+	return value
+}
+
+// replaceSnapshot is replace for all values of an interface snapshot, updating both values and
+// their JSON representation as returned by interfaceSnapshot.
+func (w *binaryBlobWriter) replaceSnapshot(iface interfaces.AstarteInterface, values []snapshotValue, jsonRepresentation interface{}) {
+	if w == nil {
+		return
+	}
+	replaced := map[string]interface{}{}
+	for i, v := range values {
+		if v.Value == nullSnapshotValue {
+			continue
+		}
+		values[i].Value = w.replace(iface, []string{v.Path}, v.Timestamp, v.Value)
+		replaced[v.Path] = values[i].Value
+	}
+
+	switch j := jsonRepresentation.(type) {
+	case map[string]client.DatastreamObjectValue:
+		for basePath, aggregate := range j {
+			for _, k := range aggregate.Values.Keys() {
+				if r, ok := replaced[fmt.Sprintf("%s/%s", basePath, k)]; ok {
+					// Values share the underlying map, setting an existing key updates the snapshot
+					aggregate.Values.Set(k, r)
+				}
+			}
+		}
+	case map[string]interface{}:
+		for k, v := range j {
+			r, ok := replaced[k]
+			if !ok {
+				continue
+			}
+			if item, ok := v.(client.DatastreamIndividualValue); ok {
+				item.Value = r
+				j[k] = item
+			} else {
+				j[k] = r
+			}
+		}
+	}
+}
+
+// replaceObjectBinaryBlobs is replace for all values of an aggregate sampled at basePath
+func replaceObjectBinaryBlobs(w *binaryBlobWriter, iface interfaces.AstarteInterface, basePath string, aggregate client.DatastreamObjectValue) {
+	if w == nil {
+		return
+	}
+	for _, k := range aggregate.Values.Keys() {
+		v, _ := aggregate.Values.Get(k)
+		if r := w.replace(iface, []string{path.Join(basePath, k), path.Join("/", k)}, aggregate.Timestamp, v); r != nil {
+			// Values share the underlying map, setting an existing key updates the aggregate
+			aggregate.Values.Set(k, r)
+		}
+	}
+}
+
+// write decodes encoded to a file in dir, named after baseName and a hash of its content
+func (w *binaryBlobWriter) write(dir, baseName, encoded string) (string, error) {
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	fileName := filepath.Join(dir, fmt.Sprintf("%s_%x.bin", baseName, sum[:4]))
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
@@ -0,0 +1,171 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"golang.org/x/term"
+)
+
+const (
+	chartHeight       = 10
+	chartDefaultWidth = 80
+	// chartAxisWidth is the width of the y axis labels, including the axis itself
+	chartAxisWidth = 12
+)
+
+var chartBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// chartPoint is a numeric sample to be charted
+type chartPoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// numericValue returns the value of a numeric sample
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// renderChart prints a chart of points in the terminal, followed by a summary of their values.
+// skipped is the number of non numeric samples which could not be charted.
+func renderChart(points []chartPoint, skipped int) error {
+	if len(points) == 0 {
+		return errors.New("No numeric samples to chart")
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+
+	width := chartDefaultWidth
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > chartAxisWidth+10 {
+		width = w
+	}
+	columns := bucketChartPoints(points, width-chartAxisWidth)
+
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, p := range points {
+		min = math.Min(min, p.Value)
+		max = math.Max(max, p.Value)
+		sum += p.Value
+	}
+	// A flat line is drawn in the middle of the chart
+	bottom, valueRange := min, max-min
+	if valueRange == 0 {
+		bottom, valueRange = min-0.5, 1
+	}
+
+	// Each row holds a level for each block
+	blockLevels := len(chartBlocks) - 1
+	for row := chartHeight - 1; row >= 0; row-- {
+		label := ""
+		switch row {
+		case chartHeight - 1:
+			label = formatChartValue(bottom + valueRange)
+		case 0:
+			label = formatChartValue(bottom)
+		}
+		line := strings.Builder{}
+		fmt.Fprintf(&line, "%*s ┤", chartAxisWidth-2, label)
+		for _, c := range columns {
+			level := int(math.Round((c - bottom) / valueRange * float64(chartHeight*blockLevels)))
+			cell := level - row*blockLevels
+			switch {
+			case cell <= 0:
+				line.WriteRune(chartBlocks[0])
+			case cell >= blockLevels:
+				line.WriteRune(chartBlocks[blockLevels])
+			default:
+				line.WriteRune(chartBlocks[cell])
+			}
+		}
+		fmt.Println(strings.TrimRight(line.String(), " "))
+	}
+
+	first, last := points[0].Timestamp, points[len(points)-1].Timestamp
+	fmt.Printf("%*s └%s\n", chartAxisWidth-2, "", strings.Repeat("─", len(columns)))
+	fmt.Printf("%*s  %s → %s\n\n", chartAxisWidth-2, "", utils.FormatTimestamp(first, time.RFC3339), utils.FormatTimestamp(last, time.RFC3339))
+
+	fmt.Printf("Samples: %d  Min: %s  Max: %s  Avg: %s\n", len(points), formatChartValue(min), formatChartValue(max),
+		formatChartValue(sum/float64(len(points))))
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warn: %d non numeric samples were not charted\n", skipped)
+	}
+	return nil
+}
+
+// bucketChartPoints averages chronologically sorted points into at most width columns, each one
+// spanning the same time interval. Empty intervals take the value of the previous one.
+func bucketChartPoints(points []chartPoint, width int) []float64 {
+	if len(points) <= width {
+		ret := make([]float64, len(points))
+		for i, p := range points {
+			ret[i] = p.Value
+		}
+		return ret
+	}
+
+	first, last := points[0].Timestamp, points[len(points)-1].Timestamp
+	span := last.Sub(first)
+	sums := make([]float64, width)
+	counts := make([]int, width)
+	for _, p := range points {
+		column := 0
+		if span > 0 {
+			column = int(float64(p.Timestamp.Sub(first)) / float64(span) * float64(width-1))
+		}
+		sums[column] += p.Value
+		counts[column]++
+	}
+
+	ret := make([]float64, width)
+	for i := range ret {
+		switch {
+		case counts[i] > 0:
+			ret[i] = sums[i] / float64(counts[i])
+		case i > 0:
+			ret[i] = ret[i-1]
+		default:
+			ret[i] = points[0].Value
+		}
+	}
+	return ret
+}
+
+func formatChartValue(value float64) string {
+	return fmt.Sprintf("%.4g", value)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+// Realms might have millions of devices, don't go further than this when completing
+const maxCompletedDevices = 1000
+
+// PersistentPreRunE is not run when completing, hence the client has to be set up explicitly
+func completionSetup(cmd *cobra.Command) bool {
+	return appEnginePersistentPreRunE(cmd, nil) == nil
+}
+
+func deviceIDsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("devices", func() ([]string, error) {
+		paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, client.DeviceIDFormat)
+		if err != nil {
+			return nil, err
+		}
+		deviceIDs := []string{}
+		for paginator.HasNextPage() && len(deviceIDs) < maxCompletedDevices {
+			nextPageCall, err := paginator.GetNextPage()
+			if err != nil {
+				return nil, err
+			}
+			deviceListRes, err := nextPageCall.Run(astarteAPIClient)
+			if err != nil {
+				return nil, err
+			}
+			rawPage, _ := deviceListRes.Parse()
+			page, _ := rawPage.([]string)
+			deviceIDs = append(deviceIDs, page...)
+		}
+		return deviceIDs, nil
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
+// deviceIDAndInterfaceCompletion completes a device ID, followed by an interface in its introspection
+func deviceIDAndInterfaceCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 1 {
+		return deviceIDsCompletion(cmd, args, toComplete)
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("introspection/"+args[0], func() ([]string, error) {
+		deviceIdentifierType, err := deviceIdentifierTypeFromFlags(args[0], "")
+		if err != nil {
+			return nil, err
+		}
+		details, err := deviceDetails(realm, args[0], deviceIdentifierType)
+		if err != nil {
+			return nil, err
+		}
+		interfaceNames := []string{}
+		for name := range details.Introspection {
+			interfaceNames = append(interfaceNames, name)
+		}
+		return interfaceNames, nil
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
+func groupNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("groups", func() ([]string, error) {
+		groupsListCall, err := astarteAPIClient.ListGroups(realm)
+		if err != nil {
+			return nil, err
+		}
+		groupsListRes, err := groupsListCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, err
+		}
+		rawGroups, _ := groupsListRes.Parse()
+		groups, _ := rawGroups.([]string)
+		return groups, nil
+	}), cobra.ShellCompDirectiveNoFileComp
+}
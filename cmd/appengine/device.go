@@ -19,11 +19,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -40,17 +45,12 @@ import (
 	"github.com/spf13/cobra"
 )
 
-const (
-	dataSnapshotCurl = `curl -X GET -H "Accept: application/json" -H "Content-Type: application/json" \
-	-H "User-Agent: astarte-go" \
-	-H "Authorization: Bearer $TOKEN" \
-	"https://$ASTARTE_BASE_URL/appengine/v1/$REALM/devices/$DEVICE_ID/interfaces/$INTERFACE/$INTERFACE_PATH?limit=1`
+// partialResultExitCode is the exit status of commands which could render only part of their result
+const partialResultExitCode = 3
 
-	getSamplesCurl = `curl -X GET -H "Accept: application/json" -H "Content-Type: application/json" \
-	-H "User-Agent: astarte-go" \
-	-H "Authorization: Bearer $TOKEN" \
-	"https://$ASTARTE_BASE_URL/appengine/v1/$REALM/devices/$DEVICE_ID/interfaces/$INTERFACE/$INTERFACE_PATH`
+var errSnapshotTimeout = errors.New("timed out")
 
+const (
 	setPropertyCurl = `curl -X PUT -H "Accept: application/json" -H "Content-Type: application/json" \
 	-H "User-Agent: astarte-go" \
 	-H "Authorization: Bearer $TOKEN" \
@@ -73,10 +73,23 @@ var devicesCmd = &cobra.Command{
 }
 
 var devicesListCmd = &cobra.Command{
-	Use:     "list",
-	Short:   "List devices",
-	Long:    `List all devices in the realm.`,
-	Example: `  astartectl appengine devices list`,
+	Use:   "list",
+	Short: "List devices",
+	Long: `List all devices in the realm.
+With --output table (or csv, json), a row is printed for each device, with the columns given by --columns,
+optionally sorted with --sort-by.
+With --output ndjson, the whole DeviceDetails of each device (introspection, stats, aliases, attributes...) are
+printed as a JSON document per line while pages are fetched, which is handy to snapshot the fleet inventory.
+--output-file writes them to a file rather than stdout, and --compress gzip compresses them.
+With --to-curl, the calls needed to fetch all the pages of the list are printed as a shell script.
+
+Huge realms can be listed in bounded chunks across separate invocations: with --page-size, a single page is
+listed, and the token of the next page is printed on stderr as next-page-token, which can be passed back
+with --page-token. Filters are applied to the devices of each page, hence pages can list fewer devices.`,
+	Example: `  astartectl appengine devices list
+  astartectl appengine devices list --page-size 1000 --page-token <next-page-token>
+  astartectl appengine devices list -o table --columns id,connected,last-seen,ip --sort-by -last-seen
+  astartectl appengine devices list --details -o ndjson --output-file inventory.ndjson.gz --compress gzip`,
 	RunE:    devicesListF,
 	Aliases: []string{"ls"},
 }
@@ -88,9 +101,10 @@ var devicesShowCmd = &cobra.Command{
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices show 2TBn-jNESuuHamE2Zo1anA`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    devicesShowF,
+	Example:           `  astartectl appengine devices show 2TBn-jNESuuHamE2Zo1anA`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: deviceIDsCompletion,
+	RunE:              devicesShowF,
 }
 
 var devicesDataSnapshotCmd = &cobra.Command{
@@ -100,31 +114,64 @@ var devicesDataSnapshotCmd = &cobra.Command{
 (if it is a Datastream), or the currently known value (if it is a property).
 If <interface_name> is specified, the snapshot is returned only for that specific interface,
 otherwise it's returned for all Interfaces in the Device's introspection.
+When a Device declared several majors of an Interface across its current and previous introspection,
+the highest major which exchanged data is queried. Use --interface-major to query a specific one.
+Each interface is given --interface-timeout to be fetched, and the whole snapshot --snapshot-timeout. When any
+of them expires, whatever was fetched is rendered as a partial result, and the command exits with status 3.
+With --to-curl, all the calls needed to build the snapshot are printed as a shell script.
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices data-snapshot 2TBn-jNESuuHamE2Zo1anA`,
-	Args:    cobra.RangeArgs(1, 2),
-	RunE:    devicesDataSnapshotF,
+	Example:           `  astartectl appengine devices data-snapshot 2TBn-jNESuuHamE2Zo1anA --interface-timeout 10s --snapshot-timeout 1m`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesDataSnapshotF,
 }
 
 var devicesGetSamplesCmd = &cobra.Command{
-	Use:   "get-samples <device_id_or_alias> <interface_name> [path]",
+	Use:   "get-samples <device_id_or_alias> <interface_name> [path...]",
 	Short: "Retrieves samples for a given Datastream path",
 	Long: `Retrieves and prints samples for a given device. By default, the first 10000 samples
 are returned. You can tweak this behavior by using --count.
 By default, samples are returned in descending order (starting from most recent). You can use --ascending to
 change this behavior.
 
+--since and --to accept either absolute dates or times relative to now, such as -2h or -7d (units are
+ms, s, m, h, d and w). --last 15m is a shorthand for --since -15m.
+
+With --output chart, samples of a numeric path are charted in the terminal, along with their minimum, maximum
+and average value.
+
+Large exports can be written with --output-file, which writes csv or json samples to a file as they are fetched,
+without collecting them in memory. --output-file - streams them to stdout, and --compress gzip compresses them.
+
+When --count is reached on a single path, the token of the next page is printed on stderr as next-page-token:
+passing it back with --page-token continues with the following samples, allowing to process huge result sets
+in bounded chunks across separate invocations. The token holds the time window, hence it cannot be used together
+with --since, --last or --to.
+
 When dealing with an aggregate, non parametric interface, path can be omitted. It is compulsory for
 all other cases.
 
+On individual datastreams, several paths can be queried at once, or all the paths with data with --all-paths.
+With --devices, the same query is run across several devices, which are then omitted from the arguments
+(e.g. get-samples --devices id1,id2 <interface_name> <path>...). Devices are queried concurrently, and their
+samples are merged by timestamp, with a device column. --count applies to each device and path.
+
+When the Device declared several majors of <interface_name> across its current and previous introspection,
+the highest major which exchanged data is queried, unless --interface-major is specified. The queried major
+is printed on stderr.
+
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices get-samples 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path`,
-	Args:    cobra.RangeArgs(2, 3),
-	RunE:    devicesGetSamplesF,
+	Example: `  astartectl appengine devices get-samples 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path
+  astartectl appengine devices get-samples 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path --last 15m
+  astartectl appengine devices get-samples 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path -c 0 -o csv --output-file samples.csv.gz --compress gzip
+  astartectl appengine devices get-samples --devices 2TBn-jNESuuHamE2Zo1anA,ogzVwMx-RMeSSfJPLNDYsQ com.my.interface /a /b`,
+	Args:              getSamplesArgs,
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesGetSamplesF,
 }
 
 var devicesSendDataCmd = &cobra.Command{
@@ -135,14 +182,39 @@ var devicesSendDataCmd = &cobra.Command{
 When dealing with an aggregate, non parametric interface, path must still be provided, adhering to the
 interface structure. In that case, <data> should be a JSON string which contains a key/value dictionary,
 with key bearing the name (without trailing slashes) of the tip of the endpoint, and value being the
-value of that specific endpoint, correctly typed.
+value of that specific endpoint, correctly typed. Arrays are given as JSON arrays, with binaryblobs encoded
+in base64. Unless --partial is specified, the dictionary must hold a value for each mapping of the interface.
+With parametric aggregates, nested dictionaries stand for the further levels of the path: e.g.
+{"kitchen": {"temperature": 21.5}} on /home publishes {"temperature": 21.5} on /home/kitchen. All the
+resulting objects are validated against the interface mappings before any of them is published. They
+are then published one by one, reporting the outcome for each path: should any of them fail, the others
+are published anyway, and the command exits with a non-zero status.
+
+Datastream mappings with explicit_timestamp are sent with the current time as their timestamp, unless
+--timestamp is specified: this allows backfilling historical data.
+
+Values are converted to the type of their mapping when no precision is lost, e.g. "3" or 3.0 for an integer,
+while --strict-types refuses any implicit conversion. Doubles are always sent with a decimal point, and
+longintegers too large to be exact as JSON numbers are sent as strings.
+
+When <data> is -, it is read from stdin. With --stream, <path> and <data> are not given: each line of stdin
+is a record in the form <path> <value> [timestamp], and records are sent to the device in order, until stdin
+is closed. <value> is either a single word or a JSON document, such as an aggregate or a quoted string with
+spaces, and the optional timestamp takes the place of --timestamp for that record. Empty lines and lines
+starting with # are skipped. The first record which can't be sent stops the stream.
+
+With --dry-run, the data is validated and converted as usual, but rather than being sent, the method, URL and
+JSON body of the request which would send it are printed.
 
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices send-data 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"`,
-	Args:    cobra.ExactArgs(4),
-	RunE:    devicesSendDataF,
+	Example: `  astartectl appengine devices send-data 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"
+  echo '{"temperature": 21.5}' | astartectl appengine devices send-data 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path -
+  some-tool | astartectl appengine devices send-data 2TBn-jNESuuHamE2Zo1anA com.my.interface --stream`,
+	Args:              sendDataArgs,
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesSendDataF,
 }
 var devicesPublishDatastreamCmd = &cobra.Command{
 	Use:   "publish-datastream <device_id_or_alias> <interface_name> <path> <data>",
@@ -152,26 +224,49 @@ var devicesPublishDatastreamCmd = &cobra.Command{
 When dealing with an aggregate, non parametric interface, path must still be provided, adhering to the
 interface structure. In that case, <data> should be a JSON string which contains a key/value dictionary,
 with key bearing the name (without trailing slashes) of the tip of the endpoint, and value being the
-value of that specific endpoint, correctly typed.
+value of that specific endpoint, correctly typed. Arrays are given as JSON arrays, with binaryblobs encoded
+in base64. Unless --partial is specified, the dictionary must hold a value for each mapping of the interface.
+With parametric aggregates, nested dictionaries stand for the further levels of the path: e.g.
+{"kitchen": {"temperature": 21.5}} on /home publishes {"temperature": 21.5} on /home/kitchen. All the
+resulting objects are validated against the interface mappings before any of them is published. They
+are then published one by one, reporting the outcome for each path: should any of them fail, the others
+are published anyway, and the command exits with a non-zero status.
+
+Datastream mappings with explicit_timestamp are sent with the current time as their timestamp, unless
+--timestamp is specified: this allows backfilling historical data.
+
+Values are converted to the type of their mapping when no precision is lost, e.g. "3" or 3.0 for an integer,
+while --strict-types refuses any implicit conversion. Doubles are always sent with a decimal point, and
+longintegers too large to be exact as JSON numbers are sent as strings. When <data> is -, it is read from stdin.
+With --dry-run, the request which would publish the data is printed rather than performed.
+
+For test environments, --advanced enables advanced send options: --reception-timestamp sets the reception
+timestamp of the data (in RFC3339 format), and --metadata key=value (which can be repeated) attaches metadata
+fields to it. They require Astarte 1.2 or newer, and they are refused on clusters not supporting them.
 
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices publish-datastream 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"`,
-	Args:    cobra.ExactArgs(4),
-	RunE:    devicesPublishDataStreamF,
+	Example: `  astartectl appengine devices publish-datastream 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"
+  astartectl appengine devices publish-datastream 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value" \
+    --advanced --reception-timestamp 2024-01-01T00:00:00Z --metadata source=test`,
+	Args:              cobra.ExactArgs(4),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesPublishDataStreamF,
 }
 var devicesSetPropertyCmd = &cobra.Command{
 	Use:   "set-property <device_id_or_alias> <interface_name> <path> <data>",
 	Short: "Set property on a given interface path",
-	Long: `Set property on a given interface path. This works only for properties.
+	Long: `Set property on a given interface path. This works only for properties. When <data> is -, it is read from stdin.
+With --dry-run, the request which would set the property is printed rather than performed.
 
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices set-property 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"`,
-	Args:    cobra.ExactArgs(4),
-	RunE:    devicesSetPropertyF,
+	Example:           `  astartectl appengine devices set-property 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path "value"`,
+	Args:              cobra.ExactArgs(4),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesSetPropertyF,
 }
 var devicesUnSetPropertyCmd = &cobra.Command{
 	Use:   "unset-property <device_id_or_alias> <interface_name> <path>",
@@ -181,12 +276,38 @@ var devicesUnSetPropertyCmd = &cobra.Command{
 <device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
 this is automatically determined - however, you can tweak this behavior by using --force-device-id or
 --force-id-type={device-id,alias}.`,
-	Example: `  astartectl appengine devices unset-property 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path `,
-	Args:    cobra.ExactArgs(3),
-	RunE:    devicesUnSetPropertyF,
+	Example:           `  astartectl appengine devices unset-property 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path `,
+	Args:              cobra.ExactArgs(3),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesUnSetPropertyF,
 }
 
-var supportedOutputTypes = []string{"default", "csv", "json"}
+var supportedOutputTypes = append([]string{"default", "csv", "json"}, utils.TemplateOutputTypes...)
+
+const apiParamsDoc = `Additional query parameter to be passed verbatim to AppEngine API, in the form <key>=<value>. Can be specified multiple times.
+This allows using server-side query capabilities (e.g. new filters or downsampling parameters) which are not yet explicitly supported by astartectl.
+Parameters are not validated, and a warning is printed if they override one of the parameters set by astartectl. Usage example: --api-param downsample_to=100`
+
+const interfaceMajorDoc = `The major version of the interface to be queried. It must have been declared in the current or previous device introspection.
+When not set, the highest major which exchanged data is used, and it is printed on stderr.`
+
+var (
+	// Query parameters astartectl sets on device list requests
+	devicesListManagedAPIParams = []string{"details", "limit", "from_token"}
+	// Query parameters astartectl sets on samples requests
+	getSamplesManagedAPIParams = []string{"since", "since_after", "to", "limit", "format"}
+
+	devicesListPathRegexp = regexp.MustCompile(`/devices$`)
+	getSamplesPathRegexp  = regexp.MustCompile(`/devices(-by-alias)?/[^/]+/interfaces/[^/]+`)
+)
+
+// devicesListPaging holds the paging requested to devices list with --page-size and --page-token
+type devicesListPaging struct {
+	pageSize  int
+	fromToken string
+}
+
+var devicesPaging devicesListPaging
 
 // DeviceFilterType represents the possible filter types for the device list
 type DeviceFilterType string
@@ -216,7 +337,17 @@ func isASupportedOutputType(outputType string) bool {
 			return true
 		}
 	}
-	return false
+	return utils.IsTemplateOutput(outputType)
+}
+
+// templateOutputForType parses the template of a go-template or jsonpath output type, exiting when it is invalid
+func templateOutputForType(outputType string) *utils.TemplateOutput {
+	out, err := utils.NewTemplateOutput(outputType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+	return out
 }
 
 func init() {
@@ -230,40 +361,78 @@ active-since: allows to filter devices that connected at least once since a spec
 connected: allows filtering devices that are currently connected/disconnected. Its filter value must be a string that can be parsed as a boolean. Usage example: -f connected=true`
 
 	devicesListCmd.Flags().StringSliceP("filter", "f", []string{}, filtersDoc)
+	devicesListCmd.Flags().StringArray("api-param", []string{}, apiParamsDoc)
+	devicesListCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+	devicesListCmd.Flags().StringP("output", "o", "default", "The type of output (default,table,csv,json,ndjson,go-template=<template>,jsonpath=<expression>). With table, csv and json, a row is printed for each device, with the given --columns. With ndjson, the DeviceDetails of each device are printed on a line. With go-template and jsonpath, the template is applied to the DeviceDetails of each device, e.g. --output go-template='{{.DeviceID}} {{.LastConnection}}'.")
+	devicesListCmd.Flags().StringSlice("columns", defaultDeviceListColumns, fmt.Sprintf("The columns of table, csv and json output. Supported columns are %s.", strings.Join(deviceListColumnNames(), ",")))
+	devicesListCmd.Flags().String("sort-by", "", "The column to sort table, csv and json output by. Prefix it with - to sort in descending order (e.g. -last-connection).")
+	devicesListCmd.Flags().String("output-file", "", "When set, devices are written to the given file as they are fetched. Use - to stream them to stdout. Requires ndjson output.")
+	devicesListCmd.Flags().String("compress", "", "When set to gzip, devices are compressed while being written. Requires ndjson output.")
+	devicesListCmd.Flags().Int("page-size", 0, "When set, only a page of the given number of devices is listed, and the token of the next page is printed on stderr as next-page-token.")
+	devicesListCmd.Flags().String("page-token", "", "When set, the list continues from the page of the given next-page-token.")
 
 	devicesGetSamplesCmd.Flags().IntP("count", "c", 10000, "Number of samples to be retrieved. Defaults to 10000. Setting this to 0 retrieves all samples.")
 	devicesGetSamplesCmd.Flags().Bool("ascending", false, "When set, returns samples in ascending order rather than descending.")
-	devicesGetSamplesCmd.Flags().String("since", "", "When set, returns only samples newer than the provided date.")
-	devicesGetSamplesCmd.Flags().String("to", "", "When set, returns only samples older than the provided date.")
-	devicesGetSamplesCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json)")
+	devicesGetSamplesCmd.Flags().String("since", "", "When set, returns only samples newer than the provided date. Relative times such as -2h or -7d are accepted too.")
+	devicesGetSamplesCmd.Flags().String("to", "", "When set, returns only samples older than the provided date. Relative times such as -2h or -7d are accepted too.")
+	devicesGetSamplesCmd.Flags().String("last", "", "When set, returns only samples of the provided last period, such as 15m or 7d. Shorthand for --since -<period>.")
+	devicesGetSamplesCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,chart,go-template=<template>,jsonpath=<expression>)")
 	devicesGetSamplesCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesGetSamplesCmd.Flags().Bool("aggregate", false, "When set, if Realm Management checks are disabled, it forces resolution of the interface as an aggregate datastream.")
 	devicesGetSamplesCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors.")
-
-	devicesDataSnapshotCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json)")
+	devicesGetSamplesCmd.Flags().StringArray("api-param", []string{}, apiParamsDoc)
+	devicesGetSamplesCmd.Flags().Int("interface-major", 0, interfaceMajorDoc)
+	devicesGetSamplesCmd.Flags().StringSlice("devices", []string{}, "When set, the query is run on each of the given comma-separated devices, rather than on <device_id_or_alias>.")
+	devicesGetSamplesCmd.Flags().Bool("all-paths", false, "When set, all the paths with data of an individual datastream are queried.")
+	devicesGetSamplesCmd.Flags().Int("concurrency", 8, "The maximum number of devices queried at the same time, when using --devices.")
+	devicesGetSamplesCmd.Flags().String("page-token", "", "When set, samples continue from the next-page-token printed on stderr by a previous invocation which reached --count.")
+	devicesGetSamplesCmd.Flags().String("output-file", "", "When set, samples are written to the given file as they are fetched. Use - to stream them to stdout. Requires csv or json output.")
+	devicesGetSamplesCmd.Flags().String("compress", "", "When set to gzip, samples are compressed while being written. Requires csv or json output.")
+	devicesGetSamplesCmd.Flags().String("decode-binaryblob", "", "When set, binaryblob values are decoded and written to files in the given directory, named after their interface, path, timestamp and a hash of their content. The table shows the names of the files rather than base64 data.")
+
+	devicesDataSnapshotCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,prometheus,go-template=<template>,jsonpath=<expression>)")
+	devicesDataSnapshotCmd.Flags().String("listen", "", "When set together with --output prometheus, serves the snapshot as Prometheus metrics over HTTP on the given address (e.g. :9100) rather than printing it. The snapshot is refreshed at each scrape.")
 	devicesDataSnapshotCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesDataSnapshotCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors. This has effect only if data-snapshot is invoked for a specific interface.")
+	devicesDataSnapshotCmd.Flags().Int("interface-major", 0, interfaceMajorDoc+" This has effect only if data-snapshot is invoked for a specific interface.")
 	devicesDataSnapshotCmd.Flags().String("interface-type", "", "When set, if Realm Management checks are disabled, it forces resolution of the interface as the specified type. Valid options are: properties, individual-datastream, aggregate-datastream, individual-parametric-datastream, aggregate-parametric-datastream.")
+	devicesDataSnapshotCmd.Flags().Duration("interface-timeout", 30*time.Second, "The maximum time to fetch the snapshot of a single interface. 0 means no timeout.")
+	devicesDataSnapshotCmd.Flags().Duration("snapshot-timeout", 0, "The maximum time to fetch the whole snapshot. 0 means no timeout.")
+	devicesDataSnapshotCmd.Flags().Int("concurrency", 8, "The maximum number of interfaces queried at the same time.")
+	devicesDataSnapshotCmd.Flags().String("decode-binaryblob", "", "When set, binaryblob values are decoded and written to files in the given directory, named after their interface, path, timestamp and a hash of their content. The table shows the names of the files rather than base64 data.")
 
 	devicesSendDataCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesSendDataCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors. This has effect only if data-snapshot is invoked for a specific interface.")
 	devicesSendDataCmd.Flags().String("interface-type", "", "When set, if Realm Management checks are disabled, it forces resolution of the interface as the specified type. Valid options are: properties, individual-datastream, aggregate-datastream, individual-parametric-datastream, aggregate-parametric-datastream.")
 	devicesSendDataCmd.Flags().String("payload-type", "", "When set, forces the conversion of the given payload into the given type. Valid values are any value in Astarte interfaces.")
+	devicesSendDataCmd.Flags().Bool("strict-types", false, "When set, refuse any implicit conversion of the payload, such as numbers in strings, integers as doubles or a --payload-type other than the type of the mapping.")
+	devicesSendDataCmd.Flags().Bool("partial", false, "When set, allows sending an object aggregate which does not hold a value for all the mappings of the interface.")
+	devicesSendDataCmd.Flags().Bool("stream", false, "When set, reads records from stdin, one per line in the form <path> <value> [timestamp], and sends them in order. <path> and <data> must not be given.")
+	addAdvancedSendFlags(devicesSendDataCmd)
+	addDryRunFlag(devicesSendDataCmd)
 
 	devicesPublishDatastreamCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesPublishDatastreamCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors. This has effect only if data-snapshot is invoked for a specific interface.")
 	devicesPublishDatastreamCmd.Flags().String("interface-type", "", "When set, if Realm Management checks are disabled, it forces resolution of the interface as the specified type. Valid options are: individual-datastream, aggregate-datastream, individual-parametric-datastream, aggregate-parametric-datastream.")
 	devicesPublishDatastreamCmd.Flags().String("payload-type", "", "When set, forces the conversion of the given payload into the given type. Valid values are any value in Astarte interfaces.")
+	devicesPublishDatastreamCmd.Flags().Bool("strict-types", false, "When set, refuse any implicit conversion of the payload, such as numbers in strings, integers as doubles or a --payload-type other than the type of the mapping.")
+	devicesPublishDatastreamCmd.Flags().Bool("partial", false, "When set, allows sending an object aggregate which does not hold a value for all the mappings of the interface.")
+	addAdvancedSendFlags(devicesPublishDatastreamCmd)
+	addDryRunFlag(devicesPublishDatastreamCmd)
 
 	devicesSetPropertyCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesSetPropertyCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors. This has effect only if data-snapshot is invoked for a specific interface.")
 	devicesSetPropertyCmd.Flags().String("payload-type", "", "When set, forces the conversion of the given payload into the given type. Valid values are any value in Astarte interfaces.")
+	devicesSetPropertyCmd.Flags().Bool("strict-types", false, "When set, refuse any implicit conversion of the payload, such as numbers in strings, integers as doubles or a --payload-type other than the type of the mapping.")
+	addDryRunFlag(devicesSetPropertyCmd)
 
 	devicesUnSetPropertyCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 	devicesUnSetPropertyCmd.Flags().Bool("skip-realm-management-checks", false, "When set, it skips any consistency checks on Realm Management before performing the Query. This might lead to unexpected errors. This has effect only if data-snapshot is invoked for a specific interface.")
 	devicesUnSetPropertyCmd.Flags().String("payload-type", "", "When set, forces the conversion of the given payload into the given type. Valid values are any value in Astarte interfaces.")
 
 	devicesShowCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+	devicesShowCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+	devicesShowCmd.Flags().StringP("output", "o", "default", "The type of output (default,json,go-template=<template>,jsonpath=<expression>). Templates are applied to the DeviceDetails of the device.")
 
 	devicesCmd.AddCommand(
 		devicesListCmd,
@@ -293,7 +462,72 @@ func devicesListF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	if !details && len(deviceFiltersMap) == 0 {
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	columns, err := command.Flags().GetStringSlice("columns")
+	if err != nil {
+		return err
+	}
+	sortBy, err := command.Flags().GetString("sort-by")
+	if err != nil {
+		return err
+	}
+	if err := validateDevicesTableFlags(outputType, details, columns, command.Flags().Changed("columns"), sortBy); err != nil {
+		return err
+	}
+	outputFile, err := command.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	compress, err := command.Flags().GetString("compress")
+	if err != nil {
+		return err
+	}
+	if compress != "" && compress != "gzip" {
+		return fmt.Errorf("%s is not a supported compression. Supported compressions are [gzip]", compress)
+	}
+	if (outputFile != "" || compress != "") && outputType != "ndjson" {
+		return errors.New("--output-file and --compress require ndjson output")
+	}
+
+	if err := setupAPIParams(command, devicesListManagedAPIParams, devicesListPathRegexp); err != nil {
+		return err
+	}
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
+	if devicesPaging.pageSize, err = command.Flags().GetInt("page-size"); err != nil {
+		return err
+	}
+	if devicesPaging.pageSize < 0 {
+		return errors.New("--page-size must not be negative")
+	}
+	rawPageToken, err := command.Flags().GetString("page-token")
+	if err != nil {
+		return err
+	}
+	if rawPageToken != "" {
+		token, err := decodePageToken(rawPageToken, devicesPageTokenKind)
+		if err != nil {
+			return err
+		}
+		devicesPaging.fromToken = token.FromToken
+	}
+
+	// Listing devices takes a call per page
+	utils.StartCurlScript()
+	if outputType == "ndjson" {
+		// Exports go straight to their destination, with no pager in between
+		return printDevicesNDJSON(realm, deviceFiltersMap, outputFile, compress)
+	}
+	utils.StartPager()
+	if utils.IsTemplateOutput(outputType) {
+		printDevicesTemplate(realm, deviceFiltersMap, outputType)
+	} else if outputType != "default" {
+		printDevicesTable(realm, deviceFiltersMap, columns, sortBy, outputType)
+	} else if !details && len(deviceFiltersMap) == 0 {
 		printSimpleDevicesList(realm)
 	} else {
 		printDevicesList(realm, details, deviceFiltersMap)
@@ -304,87 +538,146 @@ func devicesListF(command *cobra.Command, args []string) error {
 }
 
 func printSimpleDevicesList(realm string) {
-	paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, client.DeviceIDFormat)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	deviceIDList := []string{}
+
+	forEachDeviceListPage(realm, client.DeviceIDFormat, func(rawPage interface{}) {
+		page, _ := rawPage.([]string)
+		deviceIDList = append(deviceIDList, page...)
+	})
+
+	utils.PrintList(outputAnonymizer.deviceIDs(deviceIDList))
+}
 
+func printDevicesList(realm string, details bool, deviceFilters map[DeviceFilterType]interface{}) {
+	// This will be used only if details is false
 	deviceIDList := []string{}
 
-	for paginator.HasNextPage() {
-		nextPageCall, err := paginator.GetNextPage()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+	forEachListedDevice(realm, deviceFilters, func(deviceDetails client.DeviceDetails) {
+		if details {
+			// If we want details, we print the list as we go
+			prettyPrintDeviceDetails(outputAnonymizer.deviceDetails(deviceDetails))
+			fmt.Println()
+		} else {
+			// Otherwise, we populate the deviceIDList
+			deviceIDList = append(deviceIDList, outputAnonymizer.deviceID(deviceDetails.DeviceID))
 		}
+	})
 
-		utils.MaybeCurlAndExit(nextPageCall, astarteAPIClient)
+	if !details {
+		utils.PrintList(deviceIDList)
+	}
+}
 
-		deviceListRes, err := nextPageCall.Run(astarteAPIClient)
-		if err != nil {
+// printDevicesTemplate renders the details of each device matching deviceFilters with the go-template
+// or jsonpath of outputType, as devices are fetched
+func printDevicesTemplate(realm string, deviceFilters map[DeviceFilterType]interface{}, outputType string) {
+	out := templateOutputForType(outputType)
+	forEachListedDevice(realm, deviceFilters, func(deviceDetails client.DeviceDetails) {
+		if err := out.Write(os.Stdout, outputAnonymizer.deviceDetails(deviceDetails)); err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
+	})
+}
 
-		rawPage, _ := deviceListRes.Parse()
-		page, _ := rawPage.([]string)
-
-		deviceIDList = append(deviceIDList, page...)
+// printDevicesNDJSON writes the details of each device matching deviceFilters as a JSON document per line,
+// page by page, to outputFile (stdout when empty or "-")
+func printDevicesNDJSON(realm string, deviceFilters map[DeviceFilterType]interface{}, outputFile, compress string) error {
+	w, closeExport, err := openExport(outputFile, compress)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	forEachListedDevice(realm, deviceFilters, func(deviceDetails client.DeviceDetails) {
+		if err := encoder.Encode(outputAnonymizer.deviceDetails(deviceDetails)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		}
+	})
+	if err := closeExport(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
 	}
+	return nil
+}
 
-	fmt.Println(deviceIDList)
+// forEachListedDevice calls f with the details of each device in the realm matching deviceFilters,
+// page by page
+func forEachListedDevice(realm string, deviceFilters map[DeviceFilterType]interface{}, f func(client.DeviceDetails)) {
+	hasFilters := len(deviceFilters) > 0
+
+	forEachDeviceListPage(realm, client.DeviceDetailsFormat, func(rawPage interface{}) {
+		page, _ := rawPage.([]client.DeviceDetails)
+		for _, deviceDetails := range page {
+			if hasFilters && !deviceShouldBeIncluded(deviceDetails, deviceFilters) {
+				continue
+			}
+			f(deviceDetails)
+		}
+	})
 }
 
-func printDevicesList(realm string, details bool, deviceFilters map[DeviceFilterType]interface{}) {
-	paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, client.DeviceDetailsFormat)
+// forEachDeviceListPage calls f with each page of the device list of realm in format. When --page-size
+// is set, a single page is fetched, and the token to fetch the next one is printed.
+func forEachDeviceListPage(realm string, format client.DeviceResultFormat, f func(page interface{})) {
+	paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, format)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
 	}
-
-	// This will be used only if details is false
-	deviceIDList := []string{}
-
-	hasFilters := len(deviceFilters) > 0
+	// The paginator does not set the first page, the following ones are linked by Astarte
+	firstPageParams := url.Values{}
+	if devicesPaging.pageSize > 0 {
+		firstPageParams.Set("limit", strconv.Itoa(devicesPaging.pageSize))
+	}
+	if devicesPaging.fromToken != "" {
+		firstPageParams.Set("from_token", devicesPaging.fromToken)
+	}
+	utils.SetNextRequestAPIParams(firstPageParams, devicesListPathRegexp)
 
 	for paginator.HasNextPage() {
 		nextPageCall, err := paginator.GetNextPage()
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
 		}
 
 		utils.MaybeCurlAndExit(nextPageCall, astarteAPIClient)
 
-		deviceListRes, err := nextPageCall.Run(astarteAPIClient)
+		page, nextToken, err := runDeviceListPage(nextPageCall, format)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
+		f(page)
 
-		rawPage, _ := deviceListRes.Parse()
-		page, _ := rawPage.([]client.DeviceDetails)
-
-		for _, deviceDetails := range page {
-			if hasFilters && !deviceShouldBeIncluded(deviceDetails, deviceFilters) {
-				continue
-			}
-
-			if details {
-				// If we want details, we print the list as we go
-				prettyPrintDeviceDetails(deviceDetails)
-				fmt.Println()
-			} else {
-				// Otherwise, we populate the deviceIDList
-				deviceIDList = append(deviceIDList, deviceDetails.DeviceID)
+		if devicesPaging.pageSize > 0 {
+			if nextToken != "" {
+				printNextPageToken(pageToken{Kind: devicesPageTokenKind, FromToken: nextToken})
 			}
+			return
 		}
 	}
+}
 
-	if !details {
-		fmt.Println(deviceIDList)
+// setupAPIParams reads --api-param from command and makes Astarte API requests whose path matches
+// pathMatch carry the given parameters.
+func setupAPIParams(command *cobra.Command, managedParams []string, pathMatch *regexp.Regexp) error {
+	rawAPIParams, err := command.Flags().GetStringArray("api-param")
+	if err != nil {
+		return err
 	}
+	if len(rawAPIParams) == 0 {
+		return nil
+	}
+
+	params, err := utils.ParseAPIParams(rawAPIParams, managedParams)
+	if err != nil {
+		return err
+	}
+	utils.SetAPIParams(params, pathMatch)
+
+	return nil
 }
 
 func deviceShouldBeIncluded(device client.DeviceDetails, deviceFilters map[DeviceFilterType]interface{}) bool {
@@ -471,8 +764,8 @@ func prettyPrintDeviceDetails(deviceDetails client.DeviceDetails) {
 	}
 	fmt.Fprintf(w, "Device ID:\t%v\n", deviceDetails.DeviceID)
 	fmt.Fprintf(w, "Connected:\t%v\n", deviceDetails.Connected)
-	fmt.Fprintf(w, "Last Connection:\t%v\n", deviceDetails.LastConnection)
-	fmt.Fprintf(w, "Last Disconnection:\t%v\n", deviceDetails.LastDisconnection)
+	fmt.Fprintf(w, "Last Connection:\t%v\n", utils.FormatTimestamp(deviceDetails.LastConnection, ""))
+	fmt.Fprintf(w, "Last Disconnection:\t%v\n", utils.FormatTimestamp(deviceDetails.LastDisconnection, ""))
 	if len(deviceDetails.Introspection) > 0 {
 		fmt.Fprintf(w, "Introspection:")
 		// Iterate the introspection
@@ -512,8 +805,8 @@ func prettyPrintDeviceDetails(deviceDetails client.DeviceDetails) {
 	}
 	fmt.Fprintf(w, "Last Seen IP:\t%v\n", deviceDetails.LastSeenIP)
 	fmt.Fprintf(w, "Last Credentials Request IP:\t%v\n", deviceDetails.LastCredentialsRequestIP)
-	fmt.Fprintf(w, "First Registration:\t%v\n", deviceDetails.FirstRegistration)
-	fmt.Fprintf(w, "First Credentials Request:\t%v\n", deviceDetails.FirstCredentialsRequest)
+	fmt.Fprintf(w, "First Registration:\t%v\n", utils.FormatTimestamp(deviceDetails.FirstRegistration, ""))
+	fmt.Fprintf(w, "First Credentials Request:\t%v\n", utils.FormatTimestamp(deviceDetails.FirstCredentialsRequest, ""))
 	w.Flush()
 }
 
@@ -527,14 +820,42 @@ func devicesShowF(command *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	var templateOutput *utils.TemplateOutput
+	switch {
+	case outputType == "default", outputType == "json":
+	case utils.IsTemplateOutput(outputType):
+		if templateOutput, err = utils.NewTemplateOutput(outputType); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, append([]string{"default", "json"}, utils.TemplateOutputTypes...))
+	}
 
 	deviceDetails, err := deviceDetails(realm, deviceID, deviceIdentifierType)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
-	prettyPrintDeviceDetails(deviceDetails)
+	deviceDetails = outputAnonymizer.deviceDetails(deviceDetails)
+	switch {
+	case templateOutput != nil:
+		if err := templateOutput.Write(os.Stdout, deviceDetails); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		}
+	case outputType == "json":
+		renderOutput(nil, deviceDetails, outputType)
+	default:
+		prettyPrintDeviceDetails(deviceDetails)
+	}
 	return nil
 }
 
@@ -558,13 +879,17 @@ func deviceDetails(realm, deviceID string, deviceIdentifierType client.DeviceIde
 
 func tableWriterForOutputType(outputType string) table.Writer {
 	t := table.NewWriter()
+	if utils.IsTemplateOutput(outputType) {
+		// Rows are not rendered, the template is applied to the accumulated items
+		return t
+	}
 	switch outputType {
 	case "default":
 		t.SetOutputMirror(os.Stdout)
 		t.SetStyle(table.StyleLight)
 	case "csv":
 		t.SetOutputMirror(os.Stdout)
-	case "json":
+	case "json", "prometheus":
 	default:
 		return nil
 	}
@@ -572,11 +897,6 @@ func tableWriterForOutputType(outputType string) table.Writer {
 }
 
 func devicesDataSnapshotF(command *cobra.Command, args []string) error {
-	if utils.ShouldCurl() {
-		fmt.Println(dataSnapshotCurl)
-		os.Exit(0)
-	}
-
 	deviceID := args[0]
 	forceIDType, err := command.Flags().GetString("force-id-type")
 	if err != nil {
@@ -606,16 +926,78 @@ func devicesDataSnapshotF(command *cobra.Command, args []string) error {
 		return fmt.Errorf("When not using Realm Management checks, --interface-type should always be specified")
 	}
 
+	interfaceMajor, err := interfaceMajorFromFlags(command)
+	if err != nil {
+		return err
+	}
+	if interfaceMajor != autoInterfaceMajor && snapshotInterface == "" {
+		return fmt.Errorf("--interface-major can be used only when an interface is specified")
+	}
+
 	outputType, err := command.Flags().GetString("output")
 	if err != nil {
 		return err
 	}
-	if !isASupportedOutputType(outputType) {
-		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	if !isASupportedOutputType(outputType) && outputType != "prometheus" {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, append(supportedOutputTypes, "prometheus"))
+	}
+	interfaceTimeout, err := command.Flags().GetDuration("interface-timeout")
+	if err != nil {
+		return err
+	}
+	timeout, err := command.Flags().GetDuration("snapshot-timeout")
+	if err != nil {
+		return err
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	if utils.ShouldCurl() {
+		// The script lists the calls in order
+		concurrency = 1
+	}
+	listenAddress, err := command.Flags().GetString("listen")
+	if err != nil {
+		return err
+	}
+	if listenAddress != "" && outputType != "prometheus" {
+		return fmt.Errorf("--listen can be used only with --output prometheus")
+	}
+	if listenAddress != "" && utils.ShouldCurl() {
+		return fmt.Errorf("--listen does not support the --to-curl option")
+	}
+	decodeBinaryBlobDir, err := command.Flags().GetString("decode-binaryblob")
+	if err != nil {
+		return err
+	}
+	if decodeBinaryBlobDir != "" && listenAddress != "" {
+		return fmt.Errorf("--decode-binaryblob cannot be used together with --listen")
+	}
+	if decodeBinaryBlobDir != "" && skipRealmManagementChecks {
+		return fmt.Errorf("--decode-binaryblob requires Realm Management checks, to find binaryblob mappings")
+	}
+	blobs, err := newBinaryBlobWriter(decodeBinaryBlobDir)
+	if err != nil {
+		return err
 	}
 
+	// The snapshot needs the introspection of the device, and a call per interface
+	utils.StartCurlScript()
+
 	interfacesToFetch := []interfaces.AstarteInterface{}
 
+	if listenAddress == "" {
+		utils.StartPager()
+	}
+
 	// Go with the table header
 	t := tableWriterForOutputType(outputType)
 
@@ -626,25 +1008,68 @@ func devicesDataSnapshotF(command *cobra.Command, args []string) error {
 		deviceDetails, err := deviceDetails(realm, deviceID, deviceIdentifierType)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 
-		for astarteInterface, interfaceIntrospection := range deviceDetails.Introspection {
-			// Query Realm Management to get details on the interface
-			interfaceDescription, err := getInterfaceDefinition(realm, astarteInterface, interfaceIntrospection.Major)
+		interfaceNames := []string{}
+		for astarteInterface := range deviceDetails.Introspection {
+			interfaceNames = append(interfaceNames, astarteInterface)
+		}
+		sort.Strings(interfaceNames)
+		majors := map[string]int{}
+		for _, astarteInterface := range interfaceNames {
+			interfaceIntrospection := deviceDetails.Introspection[astarteInterface]
+			major, err := resolveInterfaceMajor(deviceDetails, astarteInterface, autoInterfaceMajor)
 			if err != nil {
-				// If we're requesting a full snapshot, do not fail but just warn the user
-				fmt.Fprintf(os.Stderr, "warn: Could not fetch details for interface %s\n", astarteInterface)
+				fmt.Fprintf(os.Stderr, "warn: %s\n", err)
 				continue
 			}
-			interfacesToFetch = append(interfacesToFetch, interfaceDescription)
+			if major != interfaceIntrospection.Major {
+				fmt.Fprintf(os.Stderr, "Querying interface %s v%d rather than v%d from the current introspection, as only the former has data\n",
+					astarteInterface, major, interfaceIntrospection.Major)
+			}
+			majors[astarteInterface] = major
+		}
+
+		// Query Realm Management to get details on the interfaces
+		descriptions := make([]*interfaces.AstarteInterface, len(interfaceNames))
+		progress := utils.NewProgress("Fetching interface definitions", len(majors))
+		semaphore := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, astarteInterface := range interfaceNames {
+			major, ok := majors[astarteInterface]
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int, astarteInterface string, major int) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				defer progress.Increment()
+				interfaceDescription, err := getInterfaceDefinition(realm, astarteInterface, major)
+				if err != nil {
+					// If we're requesting a full snapshot, do not fail but just warn the user
+					fmt.Fprintf(os.Stderr, "warn: Could not fetch details for interface %s\n", astarteInterface)
+					return
+				}
+				descriptions[i] = &interfaceDescription
+			}(i, astarteInterface, major)
+		}
+		wg.Wait()
+		progress.Done()
+		for _, d := range descriptions {
+			if d != nil {
+				interfacesToFetch = append(interfacesToFetch, *d)
+			}
 		}
 	} else {
 		// Get the proto interface
-		iface, err := getProtoInterface(deviceID, deviceIdentifierType, snapshotInterface, interfaceTypeString, skipRealmManagementChecks)
+		iface, err := getProtoInterface(deviceID, deviceIdentifierType, snapshotInterface, interfaceTypeString,
+			skipRealmManagementChecks, interfaceMajor)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 
 		// We're dealing with only one interface, so let's be as smart as possible.
@@ -656,110 +1081,235 @@ func devicesDataSnapshotF(command *cobra.Command, args []string) error {
 		}
 		interfacesToFetch = append(interfacesToFetch, iface)
 	}
-	jsonOutput := make(map[string]interface{})
 
-	for _, i := range interfacesToFetch {
-		switch i.Type {
-		case interfaces.DatastreamType:
-			if i.Aggregation == interfaces.ObjectAggregation {
-				snapshotCall, err := astarteAPIClient.GetDatastreamObjectSnapshot(realm, deviceID, deviceIdentifierType, i.Name)
-				if err != nil {
-					warnOrFail(snapshotInterface, i.Name, err)
-				}
+	if listenAddress != "" {
+		return serveSnapshotMetrics(listenAddress, deviceID, deviceIdentifierType, interfacesToFetch)
+	}
 
-				snapshotRes, err := snapshotCall.Run(astarteAPIClient)
-				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
-					os.Exit(1)
-				}
-				rawVal, _ := snapshotRes.Parse()
-				val, _ := rawVal.(map[string]client.DatastreamObjectValue)
-				for path, aggregate := range val {
-					if outputType == "json" {
-						jsonOutput[i.Name] = val
-					} else {
-						for _, k := range aggregate.Values.Keys() {
-							v, _ := aggregate.Values.Get(k)
-							// object aggregated values are the only ones that can have unset paths
-							if v == nil {
-								v = "(null)"
-							}
-							if snapshotInterface == "" {
-								t.AppendRow([]interface{}{i.Name, fmt.Sprintf("%s/%s", path, k), v, i.Ownership,
-									timestampForOutput(aggregate.Timestamp, outputType)})
-							} else {
-								t.AppendRow([]interface{}{i.Name, fmt.Sprintf("%s/%s", path, k), v,
-									timestampForOutput(aggregate.Timestamp, outputType)})
-							}
-						}
-					}
-				}
+	jsonOutput := make(map[string]interface{})
+	metricsValues := []snapshotValue{}
+	timedOut := []string{}
+
+	snapshots := fetchInterfaceSnapshots(deviceID, deviceIdentifierType, interfacesToFetch, concurrency, interfaceTimeout, deadline)
+	for n, i := range interfacesToFetch {
+		values, jsonRepresentation, err := snapshots[n].values, snapshots[n].jsonRepresentation, snapshots[n].err
+		if errors.Is(err, errSnapshotTimeout) {
+			timedOut = append(timedOut, i.Name)
+			continue
+		} else if err != nil {
+			warnOrFail(snapshotInterface, i.Name, err)
+			continue
+		}
+		blobs.replaceSnapshot(i, values, jsonRepresentation)
+		jsonOutput[i.Name] = jsonRepresentation
+		metricsValues = append(metricsValues, values...)
 
+		for _, v := range values {
+			if snapshotInterface == "" {
+				t.AppendRow([]interface{}{v.Interface, v.Path, v.Value, v.Ownership, v.timestampForOutput(outputType)})
 			} else {
-				snapshotCall, err := astarteAPIClient.GetDatastreamIndividualSnapshot(realm, deviceID, deviceIdentifierType, i.Name)
-				if err != nil {
-					warnOrFail(snapshotInterface, i.Name, err)
-				}
+				t.AppendRow([]interface{}{v.Interface, v.Path, v.Value, v.timestampForOutput(outputType)})
+			}
+		}
+	}
 
-				snapshotRes, err := snapshotCall.Run(astarteAPIClient)
-				if err != nil {
-					warnOrFail(snapshotInterface, i.Name, err)
+	// Done
+	if outputType == "prometheus" {
+		fmt.Print(snapshotMetrics(deviceID, metricsValues))
+	} else {
+		renderOutput(t, jsonOutput, outputType)
+	}
+
+	if len(timedOut) > 0 {
+		fmt.Fprintf(os.Stderr, "Partial result, %d interfaces timed out: %s\n", len(timedOut), strings.Join(timedOut, ", "))
+		utils.StopPager()
+		utils.Exit(partialResultExitCode)
+	}
+
+	return nil
+}
+
+// interfaceSnapshotResult is the snapshot of an interface fetched by fetchInterfaceSnapshots
+type interfaceSnapshotResult struct {
+	values             []snapshotValue
+	jsonRepresentation interface{}
+	err                error
+}
+
+// fetchInterfaceSnapshots fetches the snapshot of each interface in ifaces, concurrency at a time. Each
+// fetch takes at most interfaceTimeout, and fetches still pending when deadline expires fail with
+// errSnapshotTimeout. A zero timeout or deadline means no limit. Results are in the same order as ifaces.
+func fetchInterfaceSnapshots(deviceID string, deviceIdentifierType client.DeviceIdentifierType, ifaces []interfaces.AstarteInterface,
+	concurrency int, interfaceTimeout time.Duration, deadline time.Time) []interfaceSnapshotResult {
+	results := make([]interfaceSnapshotResult, len(ifaces))
+	var progress *utils.Progress
+	if len(ifaces) > 1 {
+		progress = utils.NewProgress("Fetching interfaces", len(ifaces))
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for n, i := range ifaces {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(n int, i interfaces.AstarteInterface) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if progress != nil {
+				defer progress.Increment()
+			}
+			fetchTimeout := interfaceTimeout
+			if !deadline.IsZero() {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					results[n].err = errSnapshotTimeout
+					return
 				}
-				rawVal, _ := snapshotRes.Parse()
-				val, _ := rawVal.(map[string]interface{})
-				jsonRepresentation := make(map[string]interface{})
-				for k, v := range val {
-					item, _ := v.(client.DatastreamIndividualValue)
-					jsonRepresentation[k] = v
-					if snapshotInterface == "" {
-						t.AppendRow([]interface{}{i.Name, k, item.Value, i.Ownership,
-							timestampForOutput(item.Timestamp, outputType)})
-					} else {
-						t.AppendRow([]interface{}{i.Name, k, item.Value,
-							timestampForOutput(item.Timestamp, outputType)})
-					}
+				if fetchTimeout <= 0 || remaining < fetchTimeout {
+					fetchTimeout = remaining
 				}
-				jsonOutput[i.Name] = jsonRepresentation
-			}
-		case interfaces.PropertiesType:
-			snapshotCall, err := astarteAPIClient.GetAllProperties(realm, deviceID, deviceIdentifierType, i.Name)
-			if err != nil {
-				warnOrFail(snapshotInterface, i.Name, err)
 			}
+			values, jsonRepresentation, err := interfaceSnapshotWithTimeout(deviceID, deviceIdentifierType, i, fetchTimeout)
+			results[n] = interfaceSnapshotResult{values, jsonRepresentation, err}
+		}(n, i)
+	}
+	wg.Wait()
+	if progress != nil {
+		progress.Done()
+	}
+	return results
+}
 
-			snapshotRes, err := snapshotCall.Run(astarteAPIClient)
-			if err != nil {
-				warnOrFail(snapshotInterface, i.Name, err)
-			}
-			rawVal, _ := snapshotRes.Parse()
-			val, _ := rawVal.(map[string]client.PropertyValue)
-			if err != nil {
-				warnOrFail(snapshotInterface, i.Name, err)
-			}
-			jsonRepresentation := make(map[string]interface{})
-			for k, v := range val {
-				jsonRepresentation[k] = v
-				if snapshotInterface == "" {
-					t.AppendRow([]interface{}{i.Name, k, v, i.Ownership, ""})
-				} else {
-					t.AppendRow([]interface{}{i.Name, k, v, ""})
+// interfaceSnapshotWithTimeout is interfaceSnapshot, failing with errSnapshotTimeout if it does not
+// complete within timeout. A timeout of 0 means no timeout.
+func interfaceSnapshotWithTimeout(deviceID string, deviceIdentifierType client.DeviceIdentifierType,
+	iface interfaces.AstarteInterface, timeout time.Duration) ([]snapshotValue, interface{}, error) {
+	if timeout <= 0 {
+		return interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+	}
+
+	// Buffered, so that the goroutine does not leak blocked when timing out
+	result := make(chan interfaceSnapshotResult, 1)
+	go func() {
+		values, jsonRepresentation, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+		result <- interfaceSnapshotResult{values, jsonRepresentation, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.values, r.jsonRepresentation, r.err
+	case <-time.After(timeout):
+		return nil, nil, errSnapshotTimeout
+	}
+}
+
+// nullSnapshotValue is the snapshot value of unset paths of object aggregated interfaces
+const nullSnapshotValue = "(null)"
+
+// snapshotValue is a single value of a Device data snapshot
+type snapshotValue struct {
+	Interface string
+	Path      string
+	Value     interface{}
+	Ownership interfaces.AstarteInterfaceOwnership
+	// Timestamp is set only for Datastream values
+	Timestamp time.Time
+}
+
+func (v snapshotValue) timestampForOutput(outputType string) string {
+	if v.Timestamp.IsZero() {
+		return ""
+	}
+	return timestampForOutput(v.Timestamp, outputType)
+}
+
+// interfaceSnapshot retrieves the last known values of iface for the given Device. It returns
+// both the flattened values and the JSON representation of the snapshot.
+func interfaceSnapshot(deviceID string, deviceIdentifierType client.DeviceIdentifierType,
+	iface interfaces.AstarteInterface) ([]snapshotValue, interface{}, error) {
+	values := []snapshotValue{}
+
+	switch {
+	case iface.Type == interfaces.DatastreamType && iface.Aggregation == interfaces.ObjectAggregation:
+		snapshotCall, err := astarteAPIClient.GetDatastreamObjectSnapshot(realm, deviceID, deviceIdentifierType, iface.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		utils.MaybeCurlAndExit(snapshotCall, astarteAPIClient)
+		snapshotRes, err := snapshotCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		rawVal, err := snapshotRes.Parse()
+		if err != nil {
+			return nil, nil, err
+		}
+		val, _ := rawVal.(map[string]client.DatastreamObjectValue)
+		for path, aggregate := range val {
+			for _, k := range aggregate.Values.Keys() {
+				v, _ := aggregate.Values.Get(k)
+				// object aggregated values are the only ones that can have unset paths
+				if v == nil {
+					v = nullSnapshotValue
 				}
+				values = append(values, snapshotValue{iface.Name, fmt.Sprintf("%s/%s", path, k), v, iface.Ownership, aggregate.Timestamp})
 			}
-			jsonOutput[i.Name] = jsonRepresentation
 		}
-	}
+		return values, val, nil
 
-	// Done
-	renderOutput(t, jsonOutput, outputType)
+	case iface.Type == interfaces.DatastreamType:
+		snapshotCall, err := astarteAPIClient.GetDatastreamIndividualSnapshot(realm, deviceID, deviceIdentifierType, iface.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		utils.MaybeCurlAndExit(snapshotCall, astarteAPIClient)
+		snapshotRes, err := snapshotCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		rawVal, err := snapshotRes.Parse()
+		if err != nil {
+			return nil, nil, err
+		}
+		val, _ := rawVal.(map[string]interface{})
+		jsonRepresentation := make(map[string]interface{})
+		for k, v := range val {
+			item, _ := v.(client.DatastreamIndividualValue)
+			jsonRepresentation[k] = v
+			values = append(values, snapshotValue{iface.Name, k, item.Value, iface.Ownership, item.Timestamp})
+		}
+		return values, jsonRepresentation, nil
 
-	return nil
+	case iface.Type == interfaces.PropertiesType:
+		snapshotCall, err := astarteAPIClient.GetAllProperties(realm, deviceID, deviceIdentifierType, iface.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		utils.MaybeCurlAndExit(snapshotCall, astarteAPIClient)
+		snapshotRes, err := snapshotCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		rawVal, err := snapshotRes.Parse()
+		if err != nil {
+			return nil, nil, err
+		}
+		val, _ := rawVal.(map[string]client.PropertyValue)
+		jsonRepresentation := make(map[string]interface{})
+		for k, v := range val {
+			jsonRepresentation[k] = v
+			values = append(values, snapshotValue{iface.Name, k, v, iface.Ownership, time.Time{}})
+		}
+		return values, jsonRepresentation, nil
+	}
+
+	return nil, nil, fmt.Errorf("%s has an unsupported interface type", iface.Name)
 }
 
 func warnOrFail(snapshotInterface, interfaceName string, err error) {
 	if snapshotInterface != "" {
 		// Fail only if we're parsing a single interface
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	// Just warn
@@ -767,17 +1317,27 @@ func warnOrFail(snapshotInterface, interfaceName string, err error) {
 }
 
 func devicesGetSamplesF(command *cobra.Command, args []string) error {
-	if utils.ShouldCurl() {
-		fmt.Println(getSamplesCurl)
-		os.Exit(0)
+	fanOutDevices, err := command.Flags().GetStringSlice("devices")
+	if err != nil {
+		return err
 	}
-
-	deviceID := args[0]
-	interfaceName := args[1]
+	allPaths, err := command.Flags().GetBool("all-paths")
+	if err != nil {
+		return err
+	}
+	deviceIDs, interfaceName, paths := []string{args[0]}, args[1], args[2:]
+	if len(fanOutDevices) > 0 {
+		deviceIDs, interfaceName, paths = fanOutDevices, args[0], args[1:]
+	}
+	if allPaths && len(paths) > 0 {
+		return errors.New("--all-paths and paths are mutually exclusive")
+	}
+	deviceID := deviceIDs[0]
 	var interfacePath string
-	if len(args) == 3 {
-		interfacePath = args[2]
+	if len(paths) == 1 {
+		interfacePath = paths[0]
 	}
+	fanOut := len(fanOutDevices) > 0 || allPaths || len(paths) > 1
 	forceIDType, err := command.Flags().GetString("force-id-type")
 	if err != nil {
 		return err
@@ -807,273 +1367,436 @@ func devicesGetSamplesF(command *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	// Relative times are all evaluated against the same instant
+	now := time.Now()
 	since, err := command.Flags().GetString("since")
 	if err != nil {
 		return err
 	}
+	last, err := command.Flags().GetString("last")
+	if err != nil {
+		return err
+	}
+	if since != "" && last != "" {
+		return errors.New("--since and --last are mutually exclusive")
+	}
+	if last != "" {
+		since = "-" + last
+	}
 	sinceTime := time.Time{}
 	if since != "" {
-		sinceTime, err = dateparse.ParseLocal(since)
+		sinceTime, err = parseTimeExpression(since, now)
 		if err != nil {
 			return err
 		}
 	}
-	to, err := command.Flags().GetString("to")
-	if err != nil {
-		return err
+	to, err := command.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	toTime := now
+	if to != "" {
+		toTime, err = parseTimeExpression(to, now)
+		if err != nil {
+			return err
+		}
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) && outputType != "chart" {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, append(supportedOutputTypes, "chart"))
+	}
+	if err := setupAPIParams(command, getSamplesManagedAPIParams, getSamplesPathRegexp); err != nil {
+		return err
+	}
+	interfaceMajor, err := interfaceMajorFromFlags(command)
+	if err != nil {
+		return err
+	}
+
+	decodeBinaryBlobDir, err := command.Flags().GetString("decode-binaryblob")
+	if err != nil {
+		return err
+	}
+	if decodeBinaryBlobDir != "" && skipRealmManagementChecks {
+		return errors.New("--decode-binaryblob requires Realm Management checks, to find binaryblob mappings")
+	}
+	if decodeBinaryBlobDir != "" && outputType == "chart" {
+		return errors.New("--decode-binaryblob cannot be used together with chart output")
+	}
+	blobs, err := newBinaryBlobWriter(decodeBinaryBlobDir)
+	if err != nil {
+		return err
+	}
+	outputFile, err := command.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	compress, err := command.Flags().GetString("compress")
+	if err != nil {
+		return err
+	}
+	if compress != "" && compress != "gzip" {
+		return fmt.Errorf("%s is not a supported compression. Supported compressions are [gzip]", compress)
+	}
+	exporting := outputFile != "" || compress != ""
+	if exporting && outputType != "csv" && outputType != "json" {
+		return errors.New("--output-file and --compress require csv or json output")
+	}
+	rawPageToken, err := command.Flags().GetString("page-token")
+	if err != nil {
+		return err
+	}
+	var resumeToken *pageToken
+	if rawPageToken != "" {
+		if fanOut {
+			return errors.New("--page-token is not supported when querying several paths or devices")
+		}
+		if since != "" || to != "" {
+			return errors.New("--since, --last and --to cannot be used together with --page-token")
+		}
+		token, err := decodePageToken(rawPageToken, samplesPageTokenKind)
+		if err != nil {
+			return err
+		}
+		if token.Timestamp == nil {
+			return fmt.Errorf("%s is not a valid page token for this command", rawPageToken)
+		}
+		if token.Ascending != ascending {
+			return errors.New("--ascending must be the same as in the invocation which printed the page token")
+		}
+		// Samples are fetched from the page token timestamp, included, and the ones already
+		// returned at that timestamp are skipped
+		if resultSetOrder == client.AscendingOrder {
+			sinceTime = *token.Timestamp
+		} else {
+			// to is exclusive, and Astarte timestamps have millisecond precision
+			toTime = token.Timestamp.Add(time.Millisecond)
+		}
+		resumeToken = &token
+	}
+	if exporting && fanOut {
+		return errors.New("--output-file and --compress are not supported when querying several paths or devices")
 	}
-	toTime := time.Now()
-	if to != "" {
-		toTime, err = dateparse.ParseLocal(to)
-		if err != nil {
+
+	concurrency := 0
+	if fanOut {
+		if skipRealmManagementChecks {
+			return errors.New("Querying several paths or devices requires Realm Management checks")
+		}
+		if outputType == "chart" {
+			return errors.New("chart output is not supported when querying several paths or devices")
+		}
+		if concurrency, err = command.Flags().GetInt("concurrency"); err != nil {
 			return err
 		}
+		if concurrency < 1 {
+			return fmt.Errorf("--concurrency must be greater than 0")
+		}
 	}
-	outputType, err := command.Flags().GetString("output")
-	if err != nil {
-		return err
-	}
-	if !isASupportedOutputType(outputType) {
-		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+
+	// Getting samples takes a call per page, after checking the device and the interface
+	utils.StartCurlScript()
+	if fanOut {
+		query := samplesQuery{interfaceName: interfaceName, interfaceMajor: interfaceMajor, paths: paths, allPaths: allPaths,
+			since: sinceTime, to: toTime, order: resultSetOrder, limit: limit}
+		return getSamplesFanOut(deviceIDs, forceIDType, query, outputType, concurrency, len(fanOutDevices) > 0, blobs)
 	}
 
 	var isAggregate bool
+	var interfaceDescription interfaces.AstarteInterface
 	if !skipRealmManagementChecks {
 		// Get the device introspection
-		interfaceFound := false
 		deviceDetails, err := deviceDetails(realm, deviceID, deviceIdentifierType)
 		if err != nil {
 			return err
 		}
-		for astarteInterface, interfaceIntrospection := range deviceDetails.Introspection {
-			if astarteInterface != interfaceName {
-				continue
-			}
-
-			// Query Realm Management to get details on the interface
-			interfaceDescription, err := getInterfaceDefinition(realm, astarteInterface, interfaceIntrospection.Major)
-			if err != nil {
-				return err
-			}
+		major, err := resolveInterfaceMajor(deviceDetails, interfaceName, interfaceMajor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Device %s: %s\n", deviceID, err)
+			utils.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Querying interface %s v%d\n", interfaceName, major)
 
-			if interfaceDescription.Type != interfaces.DatastreamType {
-				fmt.Fprintf(os.Stderr, "%s is not a Datastream interface. get-samples works only on Datastream interfaces\n", interfaceName)
-				os.Exit(1)
-			}
+		// Query Realm Management to get details on the interface
+		interfaceDescription, err = getInterfaceDefinition(realm, interfaceName, major)
+		if err != nil {
+			return err
+		}
 
-			interfaceFound = true
-			isAggregate = interfaceDescription.Aggregation == interfaces.ObjectAggregation
-
-			switch {
-			case isAggregate && interfaceDescription.IsParametric() && interfacePath == "":
-				fmt.Fprintf(os.Stderr, "%s is an aggregate parametric interface, a valid path should be specified\n", interfaceName)
-				os.Exit(1)
-			case !isAggregate && interfacePath == "":
-				fmt.Fprintf(os.Stderr, "You need to specify a valid path for interface %s\n", interfaceName)
-				os.Exit(1)
-			default:
-				if err := interfaces.ValidateQuery(interfaceDescription, interfacePath); err != nil {
-					fmt.Fprintln(os.Stderr, err)
-					os.Exit(1)
-				}
-			}
+		if interfaceDescription.Type != interfaces.DatastreamType {
+			fmt.Fprintf(os.Stderr, "%s is not a Datastream interface. get-samples works only on Datastream interfaces\n", interfaceName)
+			utils.Exit(1)
 		}
 
-		if !interfaceFound {
-			fmt.Fprintf(os.Stderr, "Device %s has no interface named %s\n", deviceID, interfaceName)
-			os.Exit(1)
+		isAggregate = interfaceDescription.Aggregation == interfaces.ObjectAggregation
+
+		switch {
+		case isAggregate && interfaceDescription.IsParametric() && interfacePath == "":
+			fmt.Fprintf(os.Stderr, "%s is an aggregate parametric interface, a valid path should be specified\n", interfaceName)
+			utils.Exit(1)
+		case !isAggregate && interfacePath == "":
+			fmt.Fprintf(os.Stderr, "You need to specify a valid path for interface %s\n", interfaceName)
+			utils.Exit(1)
+		default:
+			if err := interfaces.ValidateQuery(interfaceDescription, interfacePath); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
 		}
 	} else {
 		isAggregate = forceAggregate
 	}
+	if isAggregate && outputType == "chart" {
+		return errors.New("chart output is supported only by interfaces with individual aggregation")
+	}
 
 	// prepare some helper variables, they will come handy for data visualization
-	sliceAcc := []any{}
-	mapAcc := map[string]any{}
+	chartPoints := []chartPoint{}
+	nonNumericSamples := 0
+	// the token to continue from, when --count is reached on a single path
+	var nextPage *pageToken
+	cursor := newSamplesCursor(resumeToken)
 
 	// We are good to go.
-	t := tableWriterForOutputType(outputType)
+	var out samplesOutput
+	switch {
+	case exporting:
+		w, closeExport, err := openExport(outputFile, compress)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := closeExport(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+		}()
+		if out, err = newStreamSamplesOutput(w, outputType); err != nil {
+			return err
+		}
+	case outputType == "json":
+		utils.StartPager()
+		// JSON samples are printed as they are fetched, keeping memory flat on large queries
+		if out, err = newStreamSamplesOutput(os.Stdout, outputType); err != nil {
+			return err
+		}
+	case utils.IsTemplateOutput(outputType):
+		utils.StartPager()
+		if out, err = newTemplateSamplesOutput(os.Stdout, outputType); err != nil {
+			return err
+		}
+	default:
+		utils.StartPager()
+		out = newTableSamplesOutput(outputType)
+	}
 	if !isAggregate {
 		printedValues := 0
 		datastreamPaginator, err := astarteAPIClient.GetDatastreamIndividualTimeWindowPaginator(realm, deviceID,
 			deviceIdentifierType, interfaceName, interfacePath, sinceTime, toTime, resultSetOrder, 100)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
+	individualPages:
 		for datastreamPaginator.HasNextPage() {
 			nextPageCall, err := datastreamPaginator.GetNextPage()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
+			utils.MaybeCurlAndExit(nextPageCall, astarteAPIClient)
 			nextPageRes, err := nextPageCall.Run(astarteAPIClient)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 
 			rawPage, err := nextPageRes.Parse()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 
 			switch page := rawPage.(type) {
 			case []client.DatastreamIndividualValue:
 				// Go with the table header regardless of the requested output type
-				t.AppendHeader(table.Row{"Timestamp", "Value"})
+				if err := out.header(table.Row{"Timestamp", "Value"}); err != nil {
+					return err
+				}
 
 				// and start appending values
 				for _, v := range page {
-					if outputType != "json" {
-						if v.Value != nil {
-							t.AppendRow([]interface{}{timestampForOutput(v.Timestamp, outputType), v.Value})
+					if cursor.skip(v.Timestamp) {
+						continue
+					}
+					v.Value = blobs.replace(interfaceDescription, []string{interfacePath}, v.Timestamp, v.Value)
+					if outputType == "chart" {
+						if value, ok := numericValue(v.Value); ok {
+							chartPoints = append(chartPoints, chartPoint{v.Timestamp, value})
 						} else {
-							t.AppendRow([]interface{}{timestampForOutput(v.Timestamp, outputType), []string{}})
+							nonNumericSamples++
 						}
-
 					} else {
-						sliceAcc = append(sliceAcc, v)
+						var value interface{} = []string{}
+						if v.Value != nil {
+							value = v.Value
+						}
+						if err := out.sample(v, table.Row{timestampForOutput(v.Timestamp, outputType), value}); err != nil {
+							return err
+						}
 					}
 					printedValues++
+					cursor.advance(v.Timestamp)
 					if printedValues >= limit && limit > 0 {
-						renderOutput(t, sliceAcc, outputType)
-						return nil
+						nextPage = cursor.pageToken(ascending)
+						break individualPages
 					}
 				}
-				renderOutput(t, sliceAcc, outputType)
 
 			case map[string]client.DatastreamIndividualValue:
+				if outputType == "chart" {
+					fmt.Fprintf(os.Stderr, "chart output requires the path of a single value, %s is not\n", interfacePath)
+					utils.Exit(1)
+				}
 				// Go with the table header regardless of the requested output type
-				t.AppendHeader(table.Row{"Path", "Timestamp", "Value"})
+				if err := out.header(table.Row{"Path", "Timestamp", "Value"}); err != nil {
+					return err
+				}
 
 				// and start appending values
-
 				for k, v := range page {
-					if outputType != "json" {
-						if v.Value != nil {
-							t.AppendRow([]interface{}{k, timestampForOutput(v.Timestamp, outputType), v.Value})
-						} else {
-							t.AppendRow([]interface{}{k, timestampForOutput(v.Timestamp, outputType), []string{}})
-						}
-
-					} else {
-						mapAcc[k] = v
+					v.Value = blobs.replace(interfaceDescription, []string{path.Join(interfacePath, k), k}, v.Timestamp, v.Value)
+					var value interface{} = []string{}
+					if v.Value != nil {
+						value = v.Value
+					}
+					if err := out.keyedSample(k, v, table.Row{k, timestampForOutput(v.Timestamp, outputType), value}); err != nil {
+						return err
 					}
 					printedValues++
 					if printedValues >= limit && limit > 0 {
-						renderOutput(t, mapAcc, outputType)
-						return nil
+						break individualPages
 					}
 				}
-				renderOutput(t, mapAcc, outputType)
 			}
 		}
+		if outputType == "chart" {
+			if err := renderChart(chartPoints, nonNumericSamples); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+			return nil
+		}
 	} else {
 		printedValues := 0
 		datastreamPaginator, err := astarteAPIClient.GetDatastreamObjectTimeWindowPaginator(realm, deviceID, deviceIdentifierType, interfaceName, interfacePath,
 			sinceTime, toTime, resultSetOrder, 100)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
+	objectPages:
 		for datastreamPaginator.HasNextPage() {
 			nextPageCall, err := datastreamPaginator.GetNextPage()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
+			utils.MaybeCurlAndExit(nextPageCall, astarteAPIClient)
 			nextPageRes, err := nextPageCall.Run(astarteAPIClient)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 			rawPage, err := nextPageRes.Parse()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 
 			switch page := rawPage.(type) {
 			case []client.DatastreamObjectValue:
-				headerRow := table.Row{"Timestamp"}
-				headerPrinted := false
-
 				for _, v := range page {
-					if outputType != "json" {
-						// Iterate the aggregate
-						line := []interface{}{}
-						line = append(line, timestampForOutput(v.Timestamp, outputType))
-						for _, path := range v.Values.Keys() {
-							value, _ := v.Values.Get(path)
-							if !headerPrinted {
-								headerRow = append(headerRow, path)
-							}
-							if value != nil {
-								line = append(line, value)
-							} else {
-								line = append(line, "(null)")
-							}
-						}
-						if !headerPrinted {
-							t.AppendHeader(headerRow)
-							headerPrinted = true
+					if cursor.skip(v.Timestamp) {
+						continue
+					}
+					replaceObjectBinaryBlobs(blobs, interfaceDescription, interfacePath, v)
+					// Iterate the aggregate
+					headerRow := table.Row{"Timestamp"}
+					line := table.Row{timestampForOutput(v.Timestamp, outputType)}
+					for _, path := range v.Values.Keys() {
+						value, _ := v.Values.Get(path)
+						headerRow = append(headerRow, path)
+						if value != nil {
+							line = append(line, value)
+						} else {
+							line = append(line, "(null)")
 						}
-						t.AppendRow(line)
-					} else {
-						sliceAcc = append(sliceAcc, v)
+					}
+					if err := out.header(headerRow); err != nil {
+						return err
+					}
+					if err := out.sample(v, line); err != nil {
+						return err
 					}
 					printedValues++
+					cursor.advance(v.Timestamp)
 					if printedValues >= limit && limit > 0 {
-						renderOutput(t, sliceAcc, outputType)
-						return nil
+						nextPage = cursor.pageToken(ascending)
+						break objectPages
 					}
 				}
-				renderOutput(t, sliceAcc, outputType)
 
 			case map[string][]client.DatastreamObjectValue:
-				headerRow := table.Row{"Base path", "Timestamp"}
-				headerPrinted := false
-
 				keys := []string{}
 				for k, v := range page {
-					for _, item := range v {
-						if outputType != "json" {
-							line := []interface{}{}
-							if !headerPrinted {
-								for _, path := range item.Values.Keys() {
-									keys = append(keys, path)
-									headerRow = append(headerRow, path)
-								}
-								t.AppendHeader(headerRow)
-								headerPrinted = true
+					lines := []table.Row{}
+					for i, item := range v {
+						replaceObjectBinaryBlobs(blobs, interfaceDescription, path.Join(interfacePath, k), item)
+						if len(keys) == 0 {
+							headerRow := table.Row{"Base path", "Timestamp"}
+							for _, path := range item.Values.Keys() {
+								keys = append(keys, path)
+								headerRow = append(headerRow, path)
 							}
-							line = append(line, k)
-							line = append(line, timestampForOutput(item.Timestamp, outputType))
-							for _, key := range keys {
-								value, _ := item.Values.Get(key)
-								if value != nil {
-									line = append(line, value)
-								} else {
-									line = append(line, "(null)")
-								}
+							if err := out.header(headerRow); err != nil {
+								return err
+							}
+						}
+						line := table.Row{k, timestampForOutput(item.Timestamp, outputType)}
+						for _, key := range keys {
+							value, _ := item.Values.Get(key)
+							if value != nil {
+								line = append(line, value)
+							} else {
+								line = append(line, "(null)")
 							}
-							t.AppendRow(line)
-						} else {
-							mapAcc[k] = v
 						}
+						lines = append(lines, line)
 						printedValues++
 						if printedValues >= limit && limit > 0 {
-							renderOutput(t, mapAcc, outputType)
-							return nil
+							if err := out.keyedSample(k, v[:i+1], lines...); err != nil {
+								return err
+							}
+							break objectPages
 						}
 					}
+					if err := out.keyedSample(k, v, lines...); err != nil {
+						return err
+					}
 				}
-				renderOutput(t, mapAcc, outputType)
 			}
 		}
 	}
+	if err := out.close(); err != nil {
+		return err
+	}
+	if nextPage != nil && outputType != "chart" {
+		printNextPageToken(*nextPage)
+	}
 	return nil
 }
 
@@ -1086,7 +1809,7 @@ func devicesSendDataF(command *cobra.Command, args []string) error {
 		fmt.Println(setPropertyCurl)
 		fmt.Println("Use the following curl command to publish into a datastream")
 		fmt.Println(sendDataStreamCurl)
-		os.Exit(0)
+		utils.Exit(0)
 	}
 
 	deviceID := args[0]
@@ -1114,12 +1837,23 @@ func devicesSendDataF(command *cobra.Command, args []string) error {
 		return fmt.Errorf("When not using Realm Management checks, --interface-type should always be specified")
 	}
 
-	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, interfaceTypeString, skipRealmManagementChecks)
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, interfaceTypeString, skipRealmManagementChecks, currentInterfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	// redirecting to right function
+	if iface.Type == interfaces.PropertiesType {
+		if advanced, _ := command.Flags().GetBool("advanced"); advanced {
+			return fmt.Errorf("Advanced send options are supported only by datastreams")
+		}
+		if timestamp, _ := command.Flags().GetString("timestamp"); timestamp != "" {
+			return fmt.Errorf("--timestamp is supported only by datastreams")
+		}
+	}
+	if stream, _ := command.Flags().GetBool("stream"); stream {
+		return devicesSendDataStreamF(command, args, iface)
+	}
 	if iface.Type == interfaces.PropertiesType {
 		return devicesSetPropertyF(command, args)
 	} else {
@@ -1131,13 +1865,16 @@ func devicesSendDataF(command *cobra.Command, args []string) error {
 func devicesPublishDataStreamF(command *cobra.Command, args []string) error {
 	if utils.ShouldCurl() {
 		fmt.Println(sendDataStreamCurl)
-		os.Exit(0)
+		utils.Exit(0)
 	}
 
 	deviceID := args[0]
 	interfaceName := args[1]
 	interfacePath := args[2]
-	payloadData := args[3]
+	payloadData, err := readDataArgument(args[3])
+	if err != nil {
+		return err
+	}
 	forceIDType, err := command.Flags().GetString("force-id-type")
 	if err != nil {
 		return err
@@ -1161,19 +1898,28 @@ func devicesPublishDataStreamF(command *cobra.Command, args []string) error {
 		return fmt.Errorf("Invalid command, use set-property or unset-property")
 	}
 
+	advancedOptions, err := advancedSendOptionsFromFlags(command)
+	if err != nil {
+		return err
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
 	if skipRealmManagementChecks && interfaceTypeString == "" {
 		return fmt.Errorf("When not using Realm Management checks, --interface-type should always be specified")
 	}
 
-	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, interfaceTypeString, skipRealmManagementChecks)
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, interfaceTypeString, skipRealmManagementChecks, currentInterfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	if !skipRealmManagementChecks {
 		if iface.Ownership != interfaces.ServerOwnership {
 			fmt.Fprintln(os.Stderr, "publish-datastream makes sense only for server-owned interfaces")
-			os.Exit(1)
+			utils.Exit(1)
 		}
 	}
 
@@ -1196,6 +1942,11 @@ func devicesPublishDataStreamF(command *cobra.Command, args []string) error {
 		}
 	}
 
+	strictTypes, err := command.Flags().GetBool("strict-types")
+	if err != nil {
+		return err
+	}
+
 	// Assign a payload Type only if it's not an aggregate
 	var payloadType interfaces.AstarteMappingType
 	if payloadTypeString != "" {
@@ -1204,142 +1955,176 @@ func devicesPublishDataStreamF(command *cobra.Command, args []string) error {
 			// It's an input error, so return err
 			return err
 		}
+		if strictTypes && !skipRealmManagementChecks && iface.Aggregation == interfaces.IndividualAggregation {
+			if err := checkStrictPayloadType(iface, interfacePath, payloadType); err != nil {
+				return err
+			}
+		}
 	} else if !skipRealmManagementChecks && iface.Aggregation == interfaces.IndividualAggregation {
 		if payloadType == "" {
 			mapping, err := interfaces.InterfaceMappingFromPath(iface, interfacePath)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 			payloadType = mapping.Type
 		}
 	}
 
+	// Aggregates with nested objects are published as a message for each path
+	messages := []aggregateMessage{}
 	var parsedPayloadData interface{}
 	if err := payloadType.IsValid(); err == nil {
-		if parsedPayloadData, err = parseSendDataPayload(payloadData, payloadType); err != nil {
+		if parsedPayloadData, err = parseSendDataPayload(payloadData, payloadType, strictTypes); err != nil {
 			return err
 		}
 	} else {
 		// We have to treat it as an aggregate.
 		aggrPayload := map[string]interface{}{}
-		if err := json.Unmarshal([]byte(payloadData), &aggrPayload); err != nil {
+		decoder := json.NewDecoder(strings.NewReader(payloadData))
+		decoder.UseNumber()
+		if err := decoder.Decode(&aggrPayload); err != nil {
+			return err
+		}
+		allowPartial, err := command.Flags().GetBool("partial")
+		if err != nil {
 			return err
 		}
 
-		// The json module parses all numbers into float64. To ensure Astarte will validate our payloads
-		// correctly, we should convert to int every payload for which an integer conversion does not lose
-		// in precision
-		for k, v := range aggrPayload {
-			// since we're dealing with object aggregation, we need to reconstruct
-			// the full path to get the mapping and its type
-			fullPath := fmt.Sprintf("%s/%s", interfacePath, k)
-			mapping, err := interfaces.InterfaceMappingFromPath(iface, fullPath)
-			if err != nil {
-				return err
-			}
-
-			// now we have a mapping type
-			payloadType = mapping.Type
-
-			switch val := v.(type) {
-			case float64:
-				if val == math.Trunc(val) {
-					aggrPayload[k] = int(val)
+		// Validate all messages before publishing any of them
+		messages = splitAggregatePayload(interfacePath, aggrPayload)
+		if len(messages) == 0 {
+			return fmt.Errorf("The payload has no value to be published on %s", iface.Name)
+		}
+		for _, m := range messages {
+			if !skipRealmManagementChecks {
+				if err := validateAggregatePayloadKeys(iface, m.path, m.payload, allowPartial); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					utils.Exit(1)
 				}
-			case string:
-				// in case the type is binaryblob, we want the value as []byte
-				if payloadType == interfaces.BinaryBlob {
-					decoded, err := base64.StdEncoding.DecodeString(string(val))
-					if err != nil {
-						fmt.Fprintln(os.Stderr, "Input string is not base64 encoded.", err)
-						os.Exit(1)
-					}
-					aggrPayload[k] = decoded
+			}
+			if err := convertAggregatePayload(iface, m.path, m.payload, !skipRealmManagementChecks, strictTypes); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+			if !skipRealmManagementChecks {
+				err := interfaces.ValidateAggregateMessage(iface, m.path, m.payload)
+				if err == nil {
+					err = checkExplicitTimestamp(iface, m.path, advancedOptions)
 				}
-			case []interface{}:
-				// in case the type is binaryblobarray, we want the values as [][]byte
-				if payloadType == interfaces.BinaryBlobArray {
-					acc := [][]byte{}
-					for _, item := range val {
-						theString, ok := item.(string)
-						if !ok {
-							fmt.Fprintf(os.Stderr, "Invalid item while handling endpoint %s\n", mapping.Endpoint)
-							os.Exit(1)
-						}
-						decoded, err := base64.StdEncoding.DecodeString(theString)
-						if err != nil {
-							fmt.Fprintln(os.Stderr, "Input string is not base64 encoded.")
-							os.Exit(1)
-						}
-
-						acc = append(acc, decoded)
-					}
-					aggrPayload[k] = acc
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					utils.Exit(1)
 				}
-				if payloadType == interfaces.IntegerArray {
-					acc := make([]int32, 0)
+				encodeAggregatePayload(iface, m.path, m.payload)
+			}
+		}
+	}
 
-					for _, item := range val {
-						acc = append(acc, int32(item.(float64)))
-					}
-					aggrPayload[k] = acc
-				}
-				if payloadType == interfaces.LongIntegerArray {
-					acc := make([]int64, 0)
-					for _, item := range val {
-						acc = append(acc, int64(item.(float64)))
-					}
-					aggrPayload[k] = acc
-				}
+	if len(messages) == 0 {
+		if !skipRealmManagementChecks {
+			err := interfaces.ValidateIndividualMessage(iface, interfacePath, parsedPayloadData)
+			if err == nil {
+				err = checkExplicitTimestamp(iface, interfacePath, advancedOptions)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+		}
+		parsedPayloadData = encodeTypedValue(parsedPayloadData, payloadType)
+		if dryRun {
+			err = printSendDryRun(http.MethodPost, deviceID, deviceIdentifierType, iface.Name, interfacePath, parsedPayloadData, advancedOptions)
+		} else {
+			err = publishDatastream(deviceID, deviceIdentifierType, iface, interfaceTypeString, interfacePath, parsedPayloadData,
+				skipRealmManagementChecks, advancedOptions)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		}
+	}
+	failures := 0
+	for _, m := range messages {
+		if dryRun {
+			if err := printSendDryRun(http.MethodPost, deviceID, deviceIdentifierType, iface.Name, m.path, m.payload, advancedOptions); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
 			}
+			continue
+		}
+		err := publishDatastream(deviceID, deviceIdentifierType, iface, interfaceTypeString, m.path, m.payload,
+			skipRealmManagementChecks, advancedOptions)
+		switch {
+		case len(messages) == 1 && err != nil:
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Publishing on %s failed: %s\n", m.path, err)
+			failures++
+		case len(messages) > 1:
+			fmt.Printf("Published on %s\n", m.path)
 		}
-		parsedPayloadData = aggrPayload
+	}
+	if failures > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d messages could not be published\n", failures, len(messages))
+		utils.Exit(1)
 	}
 
-	var sendDataCall client.AstarteRequest
+	// Done
+	if !dryRun {
+		fmt.Println("ok")
+	}
+	return nil
+}
+
+// publishDatastream publishes payload on interfacePath of iface, along with advancedOptions when not nil.
+// Unless Realm Management checks are skipped, payload has already been validated and encoded.
+func publishDatastream(deviceID string, deviceIdentifierType client.DeviceIdentifierType, iface interfaces.AstarteInterface,
+	interfaceTypeString, interfacePath string, payload interface{}, skipRealmManagementChecks bool, advancedOptions *advancedSendOptions) error {
+	if advancedOptions != nil {
+		return publishDatastreamAdvanced(deviceID, deviceIdentifierType, iface.Name, interfacePath, payload, advancedOptions)
+	}
 
+	var sendDataCall client.AstarteRequest
+	var err error
 	if !skipRealmManagementChecks {
-		// We can delegate the entirety of this to astarte-go
-		sendDataCall, err = astarteAPIClient.SendData(realm, deviceID, deviceIdentifierType, iface, interfacePath, parsedPayloadData)
+		sendDataCall, err = astarteAPIClient.SendDatastream(realm, deviceID, deviceIdentifierType, iface.Name, interfacePath, payload)
 	} else {
 		// Don't risk it. Use raw functions and trust the server to fail, in case.
 		switch interfaceTypeString {
-		case "individual-datastream", "individual-parametric-datastream":
-			sendDataCall, err = astarteAPIClient.SendDatastream(realm, deviceID, deviceIdentifierType, interfaceName, interfacePath, parsedPayloadData)
-		case "aggregate-datastream", "aggregate-parametric-datastream":
-			sendDataCall, err = astarteAPIClient.SendDatastream(realm, deviceID, deviceIdentifierType, interfaceName, interfacePath, parsedPayloadData)
+		case "individual-datastream", "individual-parametric-datastream",
+			"aggregate-datastream", "aggregate-parametric-datastream":
+			sendDataCall, err = astarteAPIClient.SendDatastream(realm, deviceID, deviceIdentifierType, iface.Name, interfacePath, payload)
 		default:
 			err = fmt.Errorf("%s is not a valid Interface Type. Valid interface types are: individual-datastream, aggregate-datastream, individual-parametric-datastream, aggregate-parametric-datastream", interfaceTypeString)
 		}
 	}
-
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
 
 	sendDataRes, err := sendDataCall.Run(astarteAPIClient)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
 	_, _ = sendDataRes.Parse()
-	// Done
-	fmt.Println("ok")
 	return nil
 }
 
 func devicesSetPropertyF(command *cobra.Command, args []string) error {
 	if utils.ShouldCurl() {
 		fmt.Println(setPropertyCurl)
-		os.Exit(0)
+		utils.Exit(0)
 	}
 
 	deviceID := args[0]
 	interfaceName := args[1]
 	interfacePath := args[2]
-	payloadData := args[3]
+	payloadData, err := readDataArgument(args[3])
+	if err != nil {
+		return err
+	}
 	forceIDType, err := command.Flags().GetString("force-id-type")
 	if err != nil {
 		return err
@@ -1353,10 +2138,10 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "properties", skipRealmManagementChecks)
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "properties", skipRealmManagementChecks, currentInterfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	// exclusion of datastream
@@ -1367,7 +2152,7 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 	if !skipRealmManagementChecks {
 		if iface.Ownership != interfaces.ServerOwnership {
 			fmt.Fprintln(os.Stderr, "set-property makes sense only for server-owned interfaces")
-			os.Exit(1)
+			utils.Exit(1)
 		}
 	}
 
@@ -1376,6 +2161,14 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	strictTypes, err := command.Flags().GetBool("strict-types")
+	if err != nil {
+		return err
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
 
 	// Assign a payload Type only if it's not an aggregate
 	var payloadType interfaces.AstarteMappingType
@@ -1385,12 +2178,17 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 			// It's an input error, so return err
 			return err
 		}
+		if strictTypes && !skipRealmManagementChecks {
+			if err := checkStrictPayloadType(iface, interfacePath, payloadType); err != nil {
+				return err
+			}
+		}
 	} else if !skipRealmManagementChecks && iface.Aggregation == interfaces.IndividualAggregation {
 		if payloadType == "" {
 			mapping, err := interfaces.InterfaceMappingFromPath(iface, interfacePath)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				utils.Exit(1)
 			}
 			payloadType = mapping.Type
 		}
@@ -1398,7 +2196,7 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 
 	var parsedPayloadData interface{}
 	if err := payloadType.IsValid(); err == nil {
-		if parsedPayloadData, err = parseSendDataPayload(payloadData, payloadType); err != nil {
+		if parsedPayloadData, err = parseSendDataPayload(payloadData, payloadType, strictTypes); err != nil {
 			return err
 		}
 	}
@@ -1406,25 +2204,35 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 	var sendDataCall client.AstarteRequest
 	if iface.Type == interfaces.PropertiesType {
 		if !skipRealmManagementChecks {
-			// We can delegate the entirety of this to astarte-go
-			sendDataCall, err = astarteAPIClient.SendData(realm, deviceID, deviceIdentifierType, iface, interfacePath, parsedPayloadData)
-		} else {
-			// Don't risk it. Use raw functions and trust the server to fail, in case.
-			sendDataCall, err = astarteAPIClient.SetProperty(realm, deviceID, deviceIdentifierType, interfaceName, interfacePath, parsedPayloadData)
+			if err := interfaces.ValidateIndividualMessage(iface, interfacePath, parsedPayloadData); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
 		}
+		if dryRun {
+			if err := printSendDryRun(http.MethodPut, deviceID, deviceIdentifierType, interfaceName, interfacePath,
+				encodeTypedValue(parsedPayloadData, payloadType), nil); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+			return nil
+		}
+		// Without Realm Management checks, don't risk it and trust the server to fail, in case.
+		sendDataCall, err = astarteAPIClient.SetProperty(realm, deviceID, deviceIdentifierType, interfaceName, interfacePath,
+			encodeTypedValue(parsedPayloadData, payloadType))
 	} else {
 		err = fmt.Errorf("The provided interface type is not 'properties'. If you want to send data to a 'datastream' interface, please use publish-datastream.")
 	}
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	sendDataRes, err := sendDataCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	_, _ = sendDataRes.Parse()
 
@@ -1436,7 +2244,7 @@ func devicesSetPropertyF(command *cobra.Command, args []string) error {
 func devicesUnSetPropertyF(command *cobra.Command, args []string) error {
 	if utils.ShouldCurl() {
 		fmt.Println(setPropertyCurl)
-		os.Exit(0)
+		utils.Exit(0)
 	}
 
 	deviceID := args[0]
@@ -1455,10 +2263,10 @@ func devicesUnSetPropertyF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "properties", skipRealmManagementChecks)
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "properties", skipRealmManagementChecks, currentInterfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	if iface.Type != interfaces.PropertiesType {
@@ -1468,7 +2276,7 @@ func devicesUnSetPropertyF(command *cobra.Command, args []string) error {
 	if !skipRealmManagementChecks {
 		if iface.Ownership != interfaces.ServerOwnership {
 			fmt.Fprintln(os.Stderr, "unset-property makes sense only for server-owned interfaces")
-			os.Exit(1)
+			utils.Exit(1)
 		}
 	}
 
@@ -1481,13 +2289,13 @@ func devicesUnSetPropertyF(command *cobra.Command, args []string) error {
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	sendDataRes, err := sendDataCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	_, _ = sendDataRes.Parse()
 
@@ -1526,8 +2334,19 @@ func shouldSkipRealmManagementChecks(cmd cobra.Command) (bool, error) {
 	}
 }
 
+// protoInterfaces caches the interfaces resolved by getProtoInterface, as send-data --stream
+// resolves the same interface for each record
+var protoInterfaces = map[string]interfaces.AstarteInterface{}
+
+// getProtoInterface returns the definition of interfaceName for a Device. interfaceMajor is resolved with
+// resolveInterfaceMajor, and it is ignored when Realm Management checks are skipped.
 func getProtoInterface(deviceID string, deviceIdentifierType client.DeviceIdentifierType,
-	interfaceName, interfaceTypeString string, skipRealmManagementChecks bool) (interfaces.AstarteInterface, error) {
+	interfaceName, interfaceTypeString string, skipRealmManagementChecks bool, interfaceMajor int) (interfaces.AstarteInterface, error) {
+	cacheKey := fmt.Sprintf("%s/%v/%s/%s/%t/%d", deviceID, deviceIdentifierType, interfaceName, interfaceTypeString,
+		skipRealmManagementChecks, interfaceMajor)
+	if iface, ok := protoInterfaces[cacheKey]; ok {
+		return iface, nil
+	}
 	iface := interfaces.AstarteInterface{}
 
 	if skipRealmManagementChecks {
@@ -1568,35 +2387,102 @@ func getProtoInterface(deviceID string, deviceIdentifierType client.DeviceIdenti
 			return iface, err
 		}
 
-		found := false
-		for astarteInterface, interfaceIntrospection := range deviceDetails.Introspection {
-			if astarteInterface != interfaceName {
-				continue
-			}
+		major, err := resolveInterfaceMajor(deviceDetails, interfaceName, interfaceMajor)
+		if err != nil {
+			return iface, err
+		}
+		if interfaceMajor != currentInterfaceMajor {
+			fmt.Fprintf(os.Stderr, "Querying interface %s v%d\n", interfaceName, major)
+		}
 
-			// Query Realm Management to get details on the interface
-			iface, err = getInterfaceDefinition(realm, astarteInterface,
-				interfaceIntrospection.Major)
-			if err != nil {
-				// Die here, given we really can't recover further
-				return iface, err
+		// Query Realm Management to get details on the interface
+		iface, err = getInterfaceDefinition(realm, interfaceName, major)
+		if err != nil {
+			// Die here, given we really can't recover further
+			return iface, err
+		}
+	}
+	protoInterfaces[cacheKey] = iface
+	return iface, nil
+}
+
+const (
+	// currentInterfaceMajor resolves an interface to the major in the current Device introspection
+	currentInterfaceMajor = -1
+	// autoInterfaceMajor resolves an interface to the highest major with data, see resolveInterfaceMajor
+	autoInterfaceMajor = -2
+)
+
+func interfaceMajorFromFlags(command *cobra.Command) (int, error) {
+	if !command.Flags().Changed("interface-major") {
+		return autoInterfaceMajor, nil
+	}
+	interfaceMajor, err := command.Flags().GetInt("interface-major")
+	if err != nil {
+		return 0, err
+	}
+	if interfaceMajor < 0 {
+		return 0, fmt.Errorf("--interface-major must be a non-negative integer")
+	}
+	return interfaceMajor, nil
+}
+
+// resolveInterfaceMajor returns the major version of interfaceName to be used for a Device, looking at both
+// its current and previous introspection. interfaceMajor can be either an explicit major, which must have been
+// declared by the Device, currentInterfaceMajor or autoInterfaceMajor. In the latter case, the highest major
+// which exchanged messages is picked, falling back to the highest declared major if none did: after a firmware
+// upgrade, the current introspection might hold a new major which holds no data yet.
+func resolveInterfaceMajor(deviceDetails client.DeviceDetails, interfaceName string, interfaceMajor int) (int, error) {
+	declared := []client.DeviceInterfaceIntrospection{}
+	if current, ok := deviceDetails.Introspection[interfaceName]; ok {
+		declared = append(declared, current)
+	}
+	switch {
+	case interfaceMajor == currentInterfaceMajor && len(declared) == 0:
+		return 0, fmt.Errorf("interface %s not found in device introspection", interfaceName)
+	case interfaceMajor == currentInterfaceMajor:
+		return declared[0].Major, nil
+	}
+
+	for _, previous := range deviceDetails.PreviousInterfaces {
+		if previous.Name == interfaceName {
+			declared = append(declared, previous)
+		}
+	}
+	if len(declared) == 0 {
+		return 0, fmt.Errorf("interface %s not found in device introspection", interfaceName)
+	}
+
+	if interfaceMajor != autoInterfaceMajor {
+		for _, d := range declared {
+			if d.Major == interfaceMajor {
+				return interfaceMajor, nil
 			}
-			found = true
-			break
 		}
-		if !found {
-			return iface, fmt.Errorf("interface %s not found in device introspection", interfaceName)
+		return 0, fmt.Errorf("major version %d of interface %s was never declared in device introspection", interfaceMajor, interfaceName)
+	}
+
+	highestMajor, highestMajorWithData := -1, -1
+	for _, d := range declared {
+		if d.Major > highestMajor {
+			highestMajor = d.Major
+		}
+		if d.ExchangedMessages > 0 && d.Major > highestMajorWithData {
+			highestMajorWithData = d.Major
 		}
 	}
-	return iface, nil
+	if highestMajorWithData >= 0 {
+		return highestMajorWithData, nil
+	}
+	return highestMajor, nil
 }
 
 func timestampForOutput(timestamp time.Time, outputType string) string {
 	switch outputType {
 	case "default":
-		return timestamp.String()
+		return utils.FormatTimestamp(timestamp, "")
 	case "csv":
-		return timestamp.Format(time.RFC3339Nano)
+		return utils.FormatTimestamp(timestamp, time.RFC3339Nano)
 	case "json":
 	}
 
@@ -1610,28 +2496,87 @@ func renderOutput(t table.Writer, accumulator interface{}, outputType string) {
 	case "csv":
 		t.RenderCSV()
 	case "json":
+		// Slices are written an element at a time, rather than marshaling all of them at once
+		if v := reflect.ValueOf(accumulator); v.Kind() == reflect.Slice {
+			j := newJSONStreamWriter(os.Stdout)
+			for i := 0; i < v.Len(); i++ {
+				if err := j.writeElement(v.Index(i).Interface()); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					utils.Exit(1)
+				}
+			}
+			_ = j.close()
+			return
+		}
 		marshaledOutput, _ := json.MarshalIndent(accumulator, "", "    ")
 		fmt.Println(string(marshaledOutput))
+	default:
+		if utils.IsTemplateOutput(outputType) {
+			if err := templateOutputForType(outputType).WriteAll(os.Stdout, accumulator); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+		}
+	}
+}
+
+// validateAggregatePayloadKeys checks that payload holds a value for each mapping of the object aggregated
+// iface, unless allowPartial is true, and that all of its keys match a mapping.
+func validateAggregatePayloadKeys(iface interfaces.AstarteInterface, interfacePath string, payload map[string]interface{}, allowPartial bool) error {
+	unknown := []string{}
+	for k := range payload {
+		if _, err := interfaces.InterfaceMappingFromPath(iface, fmt.Sprintf("%s/%s", interfacePath, k)); err != nil {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("The payload contains %s, which are not mappings of %s at %s",
+			strings.Join(unknown, ", "), iface.Name, interfacePath)
+	}
+
+	missing := []string{}
+	for _, m := range iface.Mappings {
+		key := m.Endpoint[strings.LastIndex(m.Endpoint, "/")+1:]
+		if _, ok := payload[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 && !allowPartial {
+		return fmt.Errorf("The payload is missing %s, which are required by %s. Use --partial to send a partial object anyway",
+			strings.Join(missing, ", "), iface.Name)
 	}
+	if len(payload) == 0 {
+		return fmt.Errorf("The payload has no value for %s", iface.Name)
+	}
+	return nil
 }
 
-func parseSendDataPayload(payload string, mappingType interfaces.AstarteMappingType) (interface{}, error) {
+// parseSendDataPayload parses payload as a value of mappingType. With strict, only the canonical
+// representation of each type is accepted: doubles need a decimal point or an exponent, booleans are
+// either true or false, and datetimes are in RFC3339 format.
+func parseSendDataPayload(payload string, mappingType interfaces.AstarteMappingType, strict bool) (interface{}, error) {
 	// Default to string, as it will be ok for most cases
 	var ret interface{} = payload
 	var err error
+	if strict {
+		if err := checkStrictPayload(payload, mappingType); err != nil {
+			return nil, err
+		}
+	}
 	switch mappingType {
 	case interfaces.Double:
 		if ret, err = strconv.ParseFloat(payload, 64); err != nil {
 			return nil, err
 		}
 	case interfaces.Integer:
-		val, err := strconv.ParseInt(payload, 10, 32)
+		val, err := parseInteger(payload, 32, strict)
 		if err != nil {
 			return nil, err
 		}
 		ret = int32(val)
 	case interfaces.LongInteger:
-		if ret, err = strconv.ParseInt(payload, 10, 64); err != nil {
+		if ret, err = parseInteger(payload, 64, strict); err != nil {
 			return nil, err
 		}
 	case interfaces.Boolean:
@@ -1669,7 +2614,7 @@ func parseSendDataPayload(payload string, mappingType interfaces.AstarteMappingT
 			}
 			// Do a smarter conversion here.
 			for _, v := range jsonOut {
-				p, err := parseSendDataPayload(strings.TrimSpace(v.(string)), interfaces.AstarteMappingType(strings.TrimSuffix(string(mappingType), "array")))
+				p, err := parseSendDataPayload(strings.TrimSpace(v.(string)), interfaces.AstarteMappingType(strings.TrimSuffix(string(mappingType), "array")), strict)
 				if err != nil {
 					return nil, err
 				}
@@ -1687,6 +2632,8 @@ func getInterfaceDefinition(realm, interfaceName string, interfaceMajor int) (in
 		return interfaces.AstarteInterface{}, err
 	}
 
+	utils.MaybeCurlAndExit(getInterfaceCall, astarteAPIClient)
+
 	getInterfaceRes, err := getInterfaceCall.Run(astarteAPIClient)
 	if err != nil {
 		return interfaces.AstarteInterface{}, err
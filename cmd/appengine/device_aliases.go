@@ -15,13 +15,21 @@
 package appengine
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/astarte-platform/astarte-go/client"
 	"github.com/astarte-platform/astarte-go/deviceid"
 	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
 	"github.com/spf13/cobra"
 )
 
@@ -62,13 +70,31 @@ var aliasesRemoveCmd = &cobra.Command{
 	Aliases: []string{"rm"},
 }
 
+var aliasesImportCmd = &cobra.Command{
+	Use:   "import <csv_file>",
+	Short: "Add or update Aliases in bulk from a CSV file",
+	Long: `Adds or updates Aliases in bulk, reading them from a CSV file with columns device_id, tag, alias.
+A header row with these column names is allowed, and skipped.
+
+Each row is reported with its result: added, updated (the tag already had another alias on the
+Device), unchanged, conflict (the alias is already assigned to another Device, or to another row
+of the file) or failed. Rows in conflict are never applied. If any row is in conflict or fails,
+the command exits with a non-zero status.`,
+	Example: `  astartectl appengine devices aliases import aliases.csv`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    aliasesImportF,
+}
+
 func init() {
+	aliasesImportCmd.Flags().Bool("dry-run", false, "When set, only report what would be done, without modifying any alias.")
+
 	devicesCmd.AddCommand(aliasesCmd)
 
 	aliasesCmd.AddCommand(
 		aliasesListCmd,
 		aliasesAddCmd,
 		aliasesRemoveCmd,
+		aliasesImportCmd,
 	)
 }
 
@@ -155,3 +181,177 @@ func aliasesRemoveF(command *cobra.Command, args []string) error {
 	fmt.Println("ok")
 	return nil
 }
+
+type aliasImportRow struct {
+	line     int
+	deviceID string
+	tag      string
+	alias    string
+}
+
+func aliasesImportF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'aliases import' does not support the --to-curl option. Use 'aliases add' for each alias.`)
+		os.Exit(1)
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	rows, err := readAliasImportFile(args[0])
+	if err != nil {
+		return err
+	}
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	appEngineURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return err
+	}
+
+	// Find aliases assigned to more than one device in the file itself
+	aliasOwners := map[string]string{}
+	conflictingAliases := map[string]bool{}
+	for _, r := range rows {
+		if owner, ok := aliasOwners[r.alias]; ok && owner != r.deviceID {
+			conflictingAliases[r.alias] = true
+		}
+		aliasOwners[r.alias] = r.deviceID
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Line", "Device ID", "Tag", "Alias", "Result"})
+
+	failed := false
+	currentAliases := map[string]map[string]string{}
+	for _, r := range rows {
+		result, ok := importAlias(rawClient, appEngineURL, r, conflictingAliases[r.alias], currentAliases, dryRun)
+		if !ok {
+			failed = true
+		}
+		t.AppendRow(table.Row{r.line, r.deviceID, r.tag, r.alias, result})
+	}
+	t.Render()
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// importAlias applies a single row of an alias import, returning its result and whether it succeeded.
+// currentAliases caches the aliases of the devices which have already been queried.
+func importAlias(rawClient *utils.RawAPIClient, appEngineURL *url.URL, r aliasImportRow, conflictInFile bool,
+	currentAliases map[string]map[string]string, dryRun bool) (string, bool) {
+	if !deviceid.IsValid(r.deviceID) {
+		return "failed: not a valid Astarte Device ID", false
+	}
+	if conflictInFile {
+		return "conflict: alias assigned to more than one device in the file", false
+	}
+
+	// Is the alias already taken by another device?
+	owner, err := aliasOwner(rawClient, appEngineURL, r.alias)
+	if err != nil {
+		return fmt.Sprintf("failed: %s", err), false
+	}
+	if owner != "" && owner != r.deviceID {
+		return fmt.Sprintf("conflict: alias already assigned to %s", owner), false
+	}
+
+	aliases, ok := currentAliases[r.deviceID]
+	if !ok {
+		details, err := deviceDetails(realm, r.deviceID, client.AstarteDeviceID)
+		if err != nil {
+			return fmt.Sprintf("failed: %s", err), false
+		}
+		aliases = details.Aliases
+		if aliases == nil {
+			aliases = map[string]string{}
+		}
+		currentAliases[r.deviceID] = aliases
+	}
+
+	result := "added"
+	if current, ok := aliases[r.tag]; ok {
+		if current == r.alias {
+			return "unchanged", true
+		}
+		result = fmt.Sprintf("updated (was %s)", current)
+	}
+	if dryRun {
+		return result + " (dry run)", true
+	}
+
+	addAliasCall, err := astarteAPIClient.AddDeviceAlias(realm, r.deviceID, r.tag, r.alias)
+	if err != nil {
+		return fmt.Sprintf("failed: %s", err), false
+	}
+	addAliasRes, err := addAliasCall.Run(astarteAPIClient)
+	if err != nil {
+		return fmt.Sprintf("failed: %s", err), false
+	}
+	_, _ = addAliasRes.Parse()
+
+	aliases[r.tag] = r.alias
+	return result, true
+}
+
+// aliasOwner returns the ID of the device alias is assigned to, or an empty string when no device has it
+func aliasOwner(rawClient *utils.RawAPIClient, appEngineURL *url.URL, alias string) (string, error) {
+	aliasURL := *appEngineURL
+	aliasURL.Path = path.Join(aliasURL.Path, "v1", realm, "devices-by-alias", alias)
+	data, err := rawClient.Do(http.MethodGet, &aliasURL, nil, http.StatusOK)
+	var apiErr *utils.RawAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	details := client.DeviceDetails{}
+	if err := json.Unmarshal(data, &details); err != nil {
+		return "", err
+	}
+	return details.DeviceID, nil
+}
+
+func readAliasImportFile(fileName string) ([]aliasImportRow, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	rows := []aliasImportRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if line == 1 && strings.EqualFold(record[0], "device_id") {
+			// Skip the header
+			continue
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if record[1] == "" || record[2] == "" {
+			return nil, fmt.Errorf("%s:%d: tag and alias must not be empty", fileName, line)
+		}
+		rows = append(rows, aliasImportRow{line: line, deviceID: record[0], tag: record[1], alias: record[2]})
+	}
+
+	return rows, nil
+}
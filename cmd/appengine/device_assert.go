@@ -0,0 +1,139 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var devicesAssertCmd = &cobra.Command{
+	Use:   "assert <device_id_or_alias> <interface_name> <path> --equals <value>",
+	Short: "Waits until a path holds a value",
+	Long: `Polls the latest value of a path until it equals the expected value, or until --within expires. This
+allows using astartectl as the assertion engine of end-to-end test suites running against real Astarte instances.
+
+The latest value is compared with --equals in the same format printed by get-value --format raw. Numbers are
+compared by value, hence e.g. 1 equals 1.0.
+
+Exit status is 0 when the assertion holds, 2 when it does not hold within the given time, and 1 on errors.
+API errors while polling are retried until --within expires.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example:           `  astartectl appengine devices assert 2TBn-jNESuuHamE2Zo1anA com.my.Switch /state --equals on --within 60s`,
+	Args:              cobra.ExactArgs(3),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesAssertF,
+}
+
+// assertionFailedExitCode is the exit status of assert when the assertion does not hold in time
+const assertionFailedExitCode = 2
+
+func init() {
+	devicesAssertCmd.Flags().String("equals", "", "The expected value.")
+	_ = devicesAssertCmd.MarkFlagRequired("equals")
+	devicesAssertCmd.Flags().Duration("within", time.Minute, "How long to wait for the assertion to hold.")
+	devicesAssertCmd.Flags().Duration("interval", 2*time.Second, "How often the value is polled.")
+	devicesAssertCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+
+	devicesCmd.AddCommand(devicesAssertCmd)
+}
+
+func devicesAssertF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	interfaceName := args[1]
+	interfacePath := args[2]
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	expected, err := command.Flags().GetString("equals")
+	if err != nil {
+		return err
+	}
+	within, err := command.Flags().GetDuration("within")
+	if err != nil {
+		return err
+	}
+	interval, err := command.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "", false, currentInterfaceMajor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	deadline := time.Now().Add(within)
+	lastSeen := "(unset)"
+	var lastErr error
+	for {
+		value, err := latestValue(deviceID, deviceIdentifierType, iface, interfacePath)
+		lastErr = err
+		if err == nil && value != nil {
+			if lastSeen, err = formatValue(value, "raw"); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if valuesEqual(lastSeen, expected) {
+				fmt.Println("ok")
+				return nil
+			}
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	fmt.Fprintf(os.Stderr, "Assertion failed: %s%s is %s, expected %s\n", interfaceName, interfacePath, lastSeen, expected)
+	if lastErr != nil {
+		fmt.Fprintf(os.Stderr, "Last error: %s\n", lastErr)
+	}
+	os.Exit(assertionFailedExitCode)
+	return nil
+}
+
+// valuesEqual compares a raw value with the expected one, comparing numbers by value
+func valuesEqual(actual, expected string) bool {
+	if actual == expected {
+		return true
+	}
+	actualNumber, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+	expectedNumber, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	return actualNumber == expectedNumber
+}
@@ -0,0 +1,222 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var devicesCheckIntrospectionCmd = &cobra.Command{
+	Use:   "check-introspection <device_id_or_alias>",
+	Short: "Check the introspection of a device against the interfaces installed in the realm",
+	Long: `Check each interface in the introspection of a device against the interfaces installed in the realm,
+flagging the ones Astarte can't handle, a common cause of silent data loss after firmware updates:
+- missing: the interface is not installed in the realm at all
+- major-not-installed: the major version declared by the device is not installed in the realm
+- minor-not-installed: the device declares a newer minor version than the installed one, hence data
+  on the mappings added since is discarded
+- outdated-minor: the device declares an older minor version than the installed one. This is not an
+  error, as minor versions are backward compatible
+
+Interfaces whose declared version is installed are ok, and a newer major version installed in the realm
+is reported as a note. The command exits with status 1 when any interface is missing, or its version
+is not installed.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example:           `  astartectl appengine devices check-introspection 2TBn-jNESuuHamE2Zo1anA`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: deviceIDsCompletion,
+	RunE:              devicesCheckIntrospectionF,
+}
+
+const (
+	introspectionOk                = "ok"
+	introspectionMissing           = "missing"
+	introspectionMajorNotInstalled = "major-not-installed"
+	introspectionMinorNotInstalled = "minor-not-installed"
+	introspectionOutdatedMinor     = "outdated-minor"
+)
+
+// introspectionCheck is the outcome of the check of an interface in the introspection of a device
+type introspectionCheck struct {
+	Interface string `json:"interface"`
+	Device    string `json:"device"`
+	Realm     string `json:"realm,omitempty"`
+	Status    string `json:"status"`
+	Note      string `json:"note,omitempty"`
+}
+
+func init() {
+	devicesCheckIntrospectionCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	devicesCheckIntrospectionCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+
+	devicesCmd.AddCommand(devicesCheckIntrospectionCmd)
+}
+
+func devicesCheckIntrospectionF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+
+	deviceDetails, err := deviceDetails(realm, deviceID, deviceIdentifierType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	checks, err := checkIntrospection(deviceDetails.Introspection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Interface", "Device", "Realm", "Status", "Note"})
+	failed := false
+	for _, c := range checks {
+		t.AppendRow(table.Row{c.Interface, c.Device, c.Realm, c.Status, c.Note})
+		if c.Status != introspectionOk && c.Status != introspectionOutdatedMinor {
+			failed = true
+		}
+	}
+	renderOutput(t, checks, outputType)
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// checkIntrospection checks the interfaces of introspection against the ones installed in the realm,
+// returning the outcomes sorted by interface name
+func checkIntrospection(introspection map[string]client.DeviceInterfaceIntrospection) ([]introspectionCheck, error) {
+	realmInterfaces, err := listRealmInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	installed := map[string]bool{}
+	for _, name := range realmInterfaces {
+		installed[name] = true
+	}
+
+	checks := []introspectionCheck{}
+	for name, declared := range introspection {
+		check, err := checkIntrospectionInterface(name, declared, installed[name])
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Interface < checks[j].Interface })
+	return checks, nil
+}
+
+// checkIntrospectionInterface checks an interface declared by a device against the realm
+func checkIntrospectionInterface(name string, declared client.DeviceInterfaceIntrospection, installed bool) (introspectionCheck, error) {
+	check := introspectionCheck{Interface: name, Device: fmt.Sprintf("v%d.%d", declared.Major, declared.Minor), Status: introspectionOk}
+	if !installed {
+		check.Status = introspectionMissing
+		return check, nil
+	}
+
+	majors, err := listRealmInterfaceMajors(name)
+	if err != nil {
+		return introspectionCheck{}, err
+	}
+	if len(majors) == 0 {
+		check.Status = introspectionMissing
+		return check, nil
+	}
+	sort.Ints(majors)
+	if latest := majors[len(majors)-1]; latest > declared.Major {
+		check.Note = fmt.Sprintf("major %d is installed in the realm", latest)
+	}
+	majorInstalled := false
+	for _, m := range majors {
+		majorInstalled = majorInstalled || m == declared.Major
+	}
+	if !majorInstalled {
+		check.Status = introspectionMajorNotInstalled
+		check.Realm = fmt.Sprintf("majors %v", majors)
+		return check, nil
+	}
+
+	iface, err := getInterfaceDefinition(realm, name, declared.Major)
+	if err != nil {
+		return introspectionCheck{}, err
+	}
+	check.Realm = fmt.Sprintf("v%d.%d", iface.MajorVersion, iface.MinorVersion)
+	switch {
+	case declared.Minor > iface.MinorVersion:
+		check.Status = introspectionMinorNotInstalled
+	case declared.Minor < iface.MinorVersion:
+		check.Status = introspectionOutdatedMinor
+	}
+	return check, nil
+}
+
+func listRealmInterfaces() ([]string, error) {
+	listInterfacesCall, err := astarteAPIClient.ListInterfaces(realm)
+	if err != nil {
+		return nil, err
+	}
+	listInterfacesRes, err := listInterfacesCall.Run(astarteAPIClient)
+	if err != nil {
+		return nil, err
+	}
+	rawInterfaces, err := listInterfacesRes.Parse()
+	if err != nil {
+		return nil, err
+	}
+	interfaceNames, _ := rawInterfaces.([]string)
+	return interfaceNames, nil
+}
+
+func listRealmInterfaceMajors(interfaceName string) ([]int, error) {
+	majorsCall, err := astarteAPIClient.ListInterfaceMajorVersions(realm, interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	majorsRes, err := majorsCall.Run(astarteAPIClient)
+	if err != nil {
+		return nil, err
+	}
+	rawMajors, err := majorsRes.Parse()
+	if err != nil {
+		return nil, err
+	}
+	majors, _ := rawMajors.([]int)
+	return majors, nil
+}
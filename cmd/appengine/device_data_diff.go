@@ -0,0 +1,370 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var devicesDataDiffCmd = &cobra.Command{
+	Use:   "data-diff <device_id_or_alias> [<interface_name>]",
+	Short: "Compare the data of a device between two points in time",
+	Long: `Compare the latest datastream values of a device at two points in time, printing the paths which were
+added, removed or modified in between. This is useful, for example, to verify that a configuration rollout
+actually took effect on the device. When <interface_name> is given, only that interface is compared.
+
+--since and --to accept either absolute dates or times relative to now, such as -2h or -7d. --to defaults to now.
+
+Astarte does not keep the history of properties, hence properties can be compared only with a baseline: pass
+the output of "data-snapshot -o json", saved before the rollout, with --properties-baseline to compare the
+properties in the baseline with their current values.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example: `  astartectl appengine devices data-diff 2TBn-jNESuuHamE2Zo1anA --since -1h
+  astartectl appengine devices data-diff 2TBn-jNESuuHamE2Zo1anA --since -1d --properties-baseline before.json`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesDataDiffF,
+}
+
+// dataChange is a path which changed between two points in time
+type dataChange struct {
+	Interface string      `json:"interface"`
+	Path      string      `json:"path"`
+	Change    string      `json:"change"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+}
+
+func init() {
+	devicesDataDiffCmd.Flags().String("since", "", "The first point in time to compare.")
+	devicesDataDiffCmd.Flags().String("to", "", "The second point in time to compare. Defaults to now.")
+	devicesDataDiffCmd.Flags().String("properties-baseline", "", "The output of data-snapshot -o json to compare current properties with.")
+	devicesDataDiffCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	devicesDataDiffCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+	_ = devicesDataDiffCmd.MarkFlagRequired("since")
+
+	devicesCmd.AddCommand(devicesDataDiffCmd)
+}
+
+func devicesDataDiffF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	var diffInterface string
+	if len(args) == 2 {
+		diffInterface = args[1]
+	}
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	since, err := command.Flags().GetString("since")
+	if err != nil {
+		return err
+	}
+	sinceTime, err := parseTimeExpression(since, now)
+	if err != nil {
+		return err
+	}
+	to, err := command.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	toTime := now
+	if to != "" {
+		if toTime, err = parseTimeExpression(to, now); err != nil {
+			return err
+		}
+	}
+	if !sinceTime.Before(toTime) {
+		return fmt.Errorf("--since must be before --to")
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+	baselineFile, err := command.Flags().GetString("properties-baseline")
+	if err != nil {
+		return err
+	}
+	baseline := map[string]map[string]interface{}{}
+	if baselineFile != "" {
+		content, err := os.ReadFile(baselineFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(content, &baseline); err != nil {
+			return fmt.Errorf("%s is not the JSON output of data-snapshot: %w", baselineFile, err)
+		}
+	}
+
+	details, err := deviceDetails(realm, deviceID, deviceIdentifierType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+	if diffInterface != "" {
+		if _, ok := details.Introspection[diffInterface]; !ok {
+			fmt.Fprintf(os.Stderr, "Device %s: interface %s not found in device introspection\n", deviceID, diffInterface)
+			utils.Exit(1)
+		}
+	}
+
+	changes := []dataChange{}
+	skippedProperties := false
+	for interfaceName, introspection := range details.Introspection {
+		if diffInterface != "" && interfaceName != diffInterface {
+			continue
+		}
+		iface, err := getInterfaceDefinition(realm, interfaceName, introspection.Major)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Could not fetch details for interface %s\n", interfaceName)
+			continue
+		}
+
+		var interfaceChanges []dataChange
+		if iface.Type == interfaces.PropertiesType {
+			interfaceBaseline, ok := baseline[interfaceName]
+			if !ok {
+				skippedProperties = true
+				continue
+			}
+			interfaceChanges, err = propertiesChanges(deviceID, deviceIdentifierType, iface, interfaceBaseline)
+		} else {
+			interfaceChanges, err = datastreamChanges(deviceID, deviceIdentifierType, iface, sinceTime, toTime)
+		}
+		if err != nil {
+			warnOrFail(diffInterface, interfaceName, err)
+			continue
+		}
+		changes = append(changes, interfaceChanges...)
+	}
+	if skippedProperties {
+		fmt.Fprintln(os.Stderr, "warn: Properties were not compared, as they have no history. Use --properties-baseline to compare them.")
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Interface != changes[j].Interface {
+			return changes[i].Interface < changes[j].Interface
+		}
+		return changes[i].Path < changes[j].Path
+	})
+
+	utils.StartPager()
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Interface", "Path", "Change", "Before", "After"})
+	for _, c := range changes {
+		t.AppendRow(table.Row{c.Interface, c.Path, c.Change, valueOrEmpty(c.Before), valueOrEmpty(c.After)})
+	}
+	renderOutput(t, changes, outputType)
+	return nil
+}
+
+func valueOrEmpty(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// compareValues returns the change between before and after, or an empty string if there is none
+func compareValues(before, after interface{}, foundBefore, foundAfter bool) string {
+	switch {
+	case !foundBefore && foundAfter:
+		return "added"
+	case foundBefore && !foundAfter:
+		return "removed"
+	case foundBefore && foundAfter && !reflect.DeepEqual(before, after):
+		return "modified"
+	}
+	return ""
+}
+
+// propertiesChanges compares the current properties of iface with baseline, which maps paths to values
+func propertiesChanges(deviceID string, deviceIdentifierType client.DeviceIdentifierType, iface interfaces.AstarteInterface,
+	baseline map[string]interface{}) ([]dataChange, error) {
+	values, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]interface{}{}
+	for _, v := range values {
+		current[v.Path] = normalizeJSONValue(v.Value)
+	}
+
+	ret := []dataChange{}
+	for p, after := range current {
+		before, found := baseline[p]
+		if change := compareValues(before, after, found, true); change != "" {
+			ret = append(ret, dataChange{iface.Name, p, change, before, after})
+		}
+	}
+	for p, before := range baseline {
+		if _, found := current[p]; !found {
+			ret = append(ret, dataChange{iface.Name, p, "removed", before, nil})
+		}
+	}
+	return ret, nil
+}
+
+// datastreamChanges compares the latest values of all the paths of iface at since and at to
+func datastreamChanges(deviceID string, deviceIdentifierType client.DeviceIdentifierType, iface interfaces.AstarteInterface,
+	since, to time.Time) ([]dataChange, error) {
+	// The snapshot holds all the paths which ever received data
+	values, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []dataChange{}
+	if iface.Aggregation == interfaces.ObjectAggregation {
+		basePaths := map[string]bool{}
+		for _, v := range values {
+			basePaths[path.Dir(v.Path)] = true
+		}
+		for basePath := range basePaths {
+			before, err := latestObjectValueAt(deviceID, deviceIdentifierType, iface.Name, basePath, since)
+			if err != nil {
+				return nil, err
+			}
+			after, err := latestObjectValueAt(deviceID, deviceIdentifierType, iface.Name, basePath, to)
+			if err != nil {
+				return nil, err
+			}
+			keys := map[string]bool{}
+			for k := range before {
+				keys[k] = true
+			}
+			for k := range after {
+				keys[k] = true
+			}
+			for k := range keys {
+				b, foundBefore := before[k]
+				a, foundAfter := after[k]
+				if change := compareValues(b, a, foundBefore, foundAfter); change != "" {
+					ret = append(ret, dataChange{iface.Name, basePath + "/" + k, change, b, a})
+				}
+			}
+		}
+		return ret, nil
+	}
+
+	for _, v := range values {
+		before, foundBefore, err := latestIndividualValueAt(deviceID, deviceIdentifierType, iface.Name, v.Path, since)
+		if err != nil {
+			return nil, err
+		}
+		after, foundAfter, err := latestIndividualValueAt(deviceID, deviceIdentifierType, iface.Name, v.Path, to)
+		if err != nil {
+			return nil, err
+		}
+		if change := compareValues(before, after, foundBefore, foundAfter); change != "" {
+			ret = append(ret, dataChange{iface.Name, v.Path, change, before, after})
+		}
+	}
+	return ret, nil
+}
+
+// latestIndividualValueAt returns the latest value of interfacePath received not after at
+func latestIndividualValueAt(deviceID string, deviceIdentifierType client.DeviceIdentifierType, interfaceName, interfacePath string,
+	at time.Time) (interface{}, bool, error) {
+	paginator, err := astarteAPIClient.GetDatastreamIndividualTimeWindowPaginator(realm, deviceID, deviceIdentifierType,
+		interfaceName, interfacePath, time.Time{}, at, client.DescendingOrder, 1)
+	if err != nil {
+		return nil, false, err
+	}
+	page, err := firstPage(paginator)
+	if err != nil {
+		return nil, false, err
+	}
+	samples, _ := page.([]client.DatastreamIndividualValue)
+	if len(samples) == 0 {
+		return nil, false, nil
+	}
+	return normalizeJSONValue(samples[0].Value), true, nil
+}
+
+// latestObjectValueAt returns the latest aggregate received at basePath not after at
+func latestObjectValueAt(deviceID string, deviceIdentifierType client.DeviceIdentifierType, interfaceName, basePath string,
+	at time.Time) (map[string]interface{}, error) {
+	paginator, err := astarteAPIClient.GetDatastreamObjectTimeWindowPaginator(realm, deviceID, deviceIdentifierType,
+		interfaceName, basePath, time.Time{}, at, client.DescendingOrder, 1)
+	if err != nil {
+		return nil, err
+	}
+	page, err := firstPage(paginator)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]interface{}{}
+	samples, _ := page.([]client.DatastreamObjectValue)
+	if len(samples) == 0 {
+		return ret, nil
+	}
+	for _, k := range samples[0].Values.Keys() {
+		v, _ := samples[0].Values.Get(k)
+		ret[k] = normalizeJSONValue(v)
+	}
+	return ret, nil
+}
+
+func firstPage(paginator client.Paginator) (interface{}, error) {
+	if !paginator.HasNextPage() {
+		return nil, nil
+	}
+	call, err := paginator.GetNextPage()
+	if err != nil {
+		return nil, err
+	}
+	res, err := call.Run(astarteAPIClient)
+	if err != nil {
+		return nil, err
+	}
+	return res.Parse()
+}
+
+// normalizeJSONValue returns value as it would be decoded from JSON, so that values coming from Astarte
+// and from a baseline file can be compared
+func normalizeJSONValue(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var ret interface{}
+	if err := json.Unmarshal(encoded, &ret); err != nil {
+		return value
+	}
+	return ret
+}
@@ -0,0 +1,194 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+// How often --wait checks whether a deletion completed
+const deletionPollInterval = 2 * time.Second
+
+var devicesDeleteCmd = &cobra.Command{
+	Use:   "delete <device_id>... | -",
+	Short: "Delete devices",
+	Long: `Delete one or more devices from the realm, together with all of their data.
+
+This operation cannot be undone. Unless --yes is set, you are asked to type the Device ID
+(or the realm name, when deleting more than one device) to confirm.
+
+Astarte deletes devices asynchronously. With --wait, astartectl waits until the deletion of each device
+is completed, up to --wait-timeout.
+
+When "-" is given as the only argument, Device IDs are read from stdin, one per line. Empty lines and
+lines starting with # are ignored. As stdin is not available for confirmation, --yes is required.
+Deletion goes on even if some devices fail, and the command exits with a non-zero code if any of them did.`,
+	Example: `  astartectl appengine devices delete 2TBn-jNESuuHamE2Zo1anA --wait
+  cat devices.txt | astartectl appengine devices delete - -y`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: deviceIDsCompletion,
+	RunE:              devicesDeleteF,
+}
+
+func init() {
+	utils.AddNonInteractiveFlag(devicesDeleteCmd.Flags())
+	devicesDeleteCmd.Flags().Bool("wait", false, "When set, wait until the deletion of each device is completed.")
+	devicesDeleteCmd.Flags().Duration("wait-timeout", 5*time.Minute, "How long to wait for the deletion of each device, when --wait is set.")
+
+	devicesCmd.AddCommand(devicesDeleteCmd)
+}
+
+func devicesDeleteF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'devices delete' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+	nonInteractive := utils.NonInteractive(command)
+	wait, err := command.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+	waitTimeout, err := command.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+
+	deviceIDs := args
+	if len(args) == 1 && args[0] == "-" {
+		if !nonInteractive {
+			return errors.New("Reading Device IDs from stdin requires --yes")
+		}
+		if deviceIDs, err = readDeviceIDs(os.Stdin); err != nil {
+			return err
+		}
+		if len(deviceIDs) == 0 {
+			return errors.New("No Device IDs were read from stdin")
+		}
+	}
+	for _, deviceID := range deviceIDs {
+		if !deviceid.IsValid(deviceID) {
+			return fmt.Errorf("%s is not a valid Astarte Device ID", deviceID)
+		}
+	}
+
+	if !nonInteractive {
+		question, expected := fmt.Sprintf("Device %s and all of its data will be deleted. Type the Device ID to confirm:", deviceIDs[0]), deviceIDs[0]
+		if len(deviceIDs) > 1 {
+			question = fmt.Sprintf("%d devices and all of their data will be deleted from realm %s. Type the realm name to confirm:", len(deviceIDs), realm)
+			expected = realm
+		}
+		answer, err := utils.PromptChoice(question, "", false, false)
+		if err != nil {
+			return err
+		}
+		if answer != expected {
+			fmt.Fprintln(os.Stderr, "Confirmation does not match, nothing was deleted.")
+			os.Exit(1)
+		}
+	}
+
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	appEngineURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, deviceID := range deviceIDs {
+		deviceURL := *appEngineURL
+		deviceURL.Path = path.Join(deviceURL.Path, "v1", realm, "devices", deviceID)
+		if _, err := rawClient.Do(http.MethodDelete, &deviceURL, nil, http.StatusNoContent); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not delete device %s: %s\n", deviceID, err)
+			failed = true
+			continue
+		}
+		if wait {
+			if err := waitForDeviceDeletion(rawClient, &deviceURL, waitTimeout); err != nil {
+				fmt.Fprintf(os.Stderr, "Deletion of device %s was requested, but did not complete: %s\n", deviceID, err)
+				failed = true
+				continue
+			}
+		}
+		if len(deviceIDs) > 1 {
+			fmt.Printf("%s: ok\n", deviceID)
+		} else {
+			fmt.Println("ok")
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// readDeviceIDs reads a Device ID per line, skipping empty lines and comments
+func readDeviceIDs(f *os.File) ([]string, error) {
+	deviceIDs := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		deviceIDs = append(deviceIDs, line)
+	}
+	return deviceIDs, scanner.Err()
+}
+
+// waitForDeviceDeletion polls a device until it is gone or it is no longer marked as being deleted
+func waitForDeviceDeletion(rawClient *utils.RawAPIClient, deviceURL *url.URL, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := rawClient.Do(http.MethodGet, deviceURL, nil, http.StatusOK)
+		var apiErr *utils.RawAPIError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			return nil
+		case err != nil:
+			return err
+		}
+		var details struct {
+			DeletionInProgress bool `json:"deletion_in_progress"`
+		}
+		if err := json.Unmarshal(data, &details); err != nil {
+			return err
+		}
+		if !details.DeletionInProgress {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		time.Sleep(deletionPollInterval)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+// getSamplesArgs validates get-samples arguments: the device is omitted from them when --devices is set
+func getSamplesArgs(command *cobra.Command, args []string) error {
+	if devices, _ := command.Flags().GetStringSlice("devices"); len(devices) > 0 {
+		return cobra.MinimumNArgs(1)(command, args)
+	}
+	return cobra.MinimumNArgs(2)(command, args)
+}
+
+// samplesQuery is a get-samples query on an individual datastream, run on each device by getSamplesFanOut
+type samplesQuery struct {
+	interfaceName  string
+	interfaceMajor int
+	paths          []string
+	allPaths       bool
+	since          time.Time
+	to             time.Time
+	order          client.ResultSetOrder
+	limit          int
+}
+
+// fanOutSample is a sample retrieved by getSamplesFanOut
+type fanOutSample struct {
+	DeviceID  string      `json:"device_id,omitempty"`
+	Path      string      `json:"path"`
+	Timestamp time.Time   `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+// getSamplesFanOut runs query on each of deviceIDs concurrently, and renders their samples merged by timestamp.
+// When showDevices is true, the device of each sample is shown.
+func getSamplesFanOut(deviceIDs []string, forceIDType string, query samplesQuery, outputType string, concurrency int,
+	showDevices bool, blobs *binaryBlobWriter) error {
+	results := make([][]fanOutSample, len(deviceIDs))
+	errs := make([]error, len(deviceIDs))
+	cache := newInterfaceDefinitionsCache()
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, deviceID := range deviceIDs {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, deviceID string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i], errs[i] = deviceSamples(deviceID, forceIDType, query, cache, blobs)
+		}(i, deviceID)
+	}
+	wg.Wait()
+
+	samples := []fanOutSample{}
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Device %s: %s\n", deviceIDs[i], err)
+			failed++
+			continue
+		}
+		for _, s := range results[i] {
+			if !showDevices {
+				s.DeviceID = ""
+			}
+			samples = append(samples, s)
+		}
+	}
+	if failed == len(deviceIDs) {
+		utils.Exit(1)
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		if !samples[i].Timestamp.Equal(samples[j].Timestamp) {
+			if query.order == client.AscendingOrder {
+				return samples[i].Timestamp.Before(samples[j].Timestamp)
+			}
+			return samples[i].Timestamp.After(samples[j].Timestamp)
+		}
+		if samples[i].DeviceID != samples[j].DeviceID {
+			return samples[i].DeviceID < samples[j].DeviceID
+		}
+		return samples[i].Path < samples[j].Path
+	})
+
+	utils.StartPager()
+	t := tableWriterForOutputType(outputType)
+	if showDevices {
+		t.AppendHeader(table.Row{"Device", "Path", "Timestamp", "Value"})
+	} else {
+		t.AppendHeader(table.Row{"Path", "Timestamp", "Value"})
+	}
+	for _, s := range samples {
+		row := table.Row{s.Path, timestampForOutput(s.Timestamp, outputType), s.Value}
+		if showDevices {
+			row = append(table.Row{s.DeviceID}, row...)
+		}
+		t.AppendRow(row)
+	}
+	renderOutput(t, samples, outputType)
+
+	if failed > 0 {
+		utils.StopPager()
+		utils.Exit(partialResultExitCode)
+	}
+	return nil
+}
+
+// deviceSamples runs query on a single device
+func deviceSamples(deviceID, forceIDType string, query samplesQuery, cache *interfaceDefinitionsCache, blobs *binaryBlobWriter) ([]fanOutSample, error) {
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return nil, err
+	}
+	details, err := deviceDetails(realm, deviceID, deviceIdentifierType)
+	if err != nil {
+		return nil, err
+	}
+	major, err := resolveInterfaceMajor(details, query.interfaceName, query.interfaceMajor)
+	if err != nil {
+		return nil, err
+	}
+	iface, err := cache.get(query.interfaceName, major)
+	if err != nil {
+		return nil, err
+	}
+	if iface.Type != interfaces.DatastreamType || iface.Aggregation == interfaces.ObjectAggregation {
+		return nil, fmt.Errorf("%s is not an individual Datastream interface, only a single path of a single device can be queried", query.interfaceName)
+	}
+
+	paths := query.paths
+	if query.allPaths {
+		// The snapshot holds all the paths which received data
+		values, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+		if err != nil {
+			return nil, err
+		}
+		paths = []string{}
+		for _, v := range values {
+			paths = append(paths, v.Path)
+		}
+		sort.Strings(paths)
+	}
+
+	ret := []fanOutSample{}
+	for _, p := range paths {
+		if err := interfaces.ValidateInterfacePath(iface, p); err != nil {
+			return nil, err
+		}
+		values, err := individualSamples(deviceID, deviceIdentifierType, query, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			value := blobs.replace(iface, []string{p}, v.Timestamp, v.Value)
+			ret = append(ret, fanOutSample{DeviceID: deviceID, Path: p, Timestamp: v.Timestamp, Value: value})
+		}
+	}
+	return ret, nil
+}
+
+// individualSamples retrieves up to query.limit samples of interfacePath
+func individualSamples(deviceID string, deviceIdentifierType client.DeviceIdentifierType, query samplesQuery,
+	interfacePath string) ([]client.DatastreamIndividualValue, error) {
+	paginator, err := astarteAPIClient.GetDatastreamIndividualTimeWindowPaginator(realm, deviceID, deviceIdentifierType,
+		query.interfaceName, interfacePath, query.since, query.to, query.order, 100)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []client.DatastreamIndividualValue{}
+	for paginator.HasNextPage() {
+		nextPageCall, err := paginator.GetNextPage()
+		if err != nil {
+			return nil, err
+		}
+		utils.MaybeCurlAndExit(nextPageCall, astarteAPIClient)
+		nextPageRes, err := nextPageCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, err
+		}
+		rawPage, err := nextPageRes.Parse()
+		if err != nil {
+			return nil, err
+		}
+		page, ok := rawPage.([]client.DatastreamIndividualValue)
+		if !ok {
+			return nil, fmt.Errorf("%s is not the path of a single value", interfacePath)
+		}
+		for _, v := range page {
+			ret = append(ret, v)
+			if query.limit > 0 && len(ret) >= query.limit {
+				return ret, nil
+			}
+		}
+	}
+	return ret, nil
+}
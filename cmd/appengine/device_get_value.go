@@ -0,0 +1,153 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/spf13/cobra"
+)
+
+var devicesGetValueCmd = &cobra.Command{
+	Use:   "get-value <device_id_or_alias> <interface_name> <path>",
+	Short: "Prints the latest value of a path",
+	Long: `Prints exactly the latest value of a path of an interface, and nothing else, making it easy to use in scripts.
+
+With --format raw (the default), scalars are printed as they are, and arrays and objects as JSON. With --format json,
+the value is always printed as JSON. For object aggregated interfaces, path can either be the path of the whole
+object or of one of its values.
+
+When the path has no value, nothing is printed and the command exits with status 3.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example: `  astartectl appengine devices get-value 2TBn-jNESuuHamE2Zo1anA com.my.interface /my/path
+  if [ "$(astartectl appengine devices get-value 2TBn-jNESuuHamE2Zo1anA com.my.Switch /state)" = "on" ]; then ...`,
+	Args:              cobra.ExactArgs(3),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesGetValueF,
+}
+
+// unsetValueExitCode is the exit status of get-value when the path has no value
+const unsetValueExitCode = 3
+
+func init() {
+	devicesGetValueCmd.Flags().String("format", "raw", "The format of the value (raw,json)")
+	devicesGetValueCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+
+	devicesCmd.AddCommand(devicesGetValueCmd)
+}
+
+func devicesGetValueF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	interfaceName := args[1]
+	interfacePath := args[2]
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	format, err := command.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "raw" && format != "json" {
+		return fmt.Errorf("%s is not a supported format. Supported formats are raw and json", format)
+	}
+
+	iface, err := getProtoInterface(deviceID, deviceIdentifierType, interfaceName, "", false, currentInterfaceMajor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	value, err := latestValue(deviceID, deviceIdentifierType, iface, interfacePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if value == nil {
+		os.Exit(unsetValueExitCode)
+	}
+
+	output, err := formatValue(value, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(output)
+	return nil
+}
+
+// latestValue returns the latest value of a path of iface, or nil if it has no value. When the path
+// is the path of an object, the object holding its values is returned.
+func latestValue(deviceID string, deviceIdentifierType client.DeviceIdentifierType,
+	iface interfaces.AstarteInterface, interfacePath string) (interface{}, error) {
+	values, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+	if err != nil {
+		return nil, err
+	}
+
+	interfacePath = "/" + strings.Trim(interfacePath, "/")
+	var value interface{}
+	object := map[string]interface{}{}
+	for _, v := range values {
+		if v.Value == nullSnapshotValue {
+			continue
+		}
+		valuePath := "/" + strings.Trim(v.Path, "/")
+		switch {
+		case valuePath == interfacePath:
+			value = v.Value
+		case strings.HasPrefix(valuePath, interfacePath+"/") && !strings.Contains(valuePath[len(interfacePath)+1:], "/"):
+			object[valuePath[len(interfacePath)+1:]] = v.Value
+		}
+	}
+	if value == nil && len(object) > 0 {
+		return object, nil
+	}
+	return value, nil
+}
+
+// formatValue formats a value either as JSON or, with the raw format, as a plain scalar
+func formatValue(value interface{}, format string) (string, error) {
+	if format == "raw" {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return base64.StdEncoding.EncodeToString(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		case bool, int, int32, int64, float32, float64, json.Number:
+			return fmt.Sprint(v), nil
+		}
+	}
+
+	output, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,171 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var devicesIntrospectionCmd = &cobra.Command{
+	Use:   "introspection <device_id_or_alias>",
+	Short: "Show the introspection of a device",
+	Long: `Show the interfaces in the current introspection of a device.
+
+With --compare-previous, the current introspection is compared to the previous interfaces of the device,
+marking each interface as upgraded or downgraded (when its major changed), removed, or current. This is
+handy to verify whether a firmware rollout landed on the device. --json is a shorthand for --output json.
+Astarte keeps track only of the interfaces which left the introspection: interfaces marked as current have
+no previous version, hence they were either added or left untouched by the latest introspection changes.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example:           `  astartectl appengine devices introspection 2TBn-jNESuuHamE2Zo1anA --compare-previous --json`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: deviceIDsCompletion,
+	RunE:              devicesIntrospectionF,
+}
+
+// introspectionChange is the comparison of an interface between the current and the previous introspection
+type introspectionChange struct {
+	Interface string   `json:"interface"`
+	Current   string   `json:"current,omitempty"`
+	Previous  []string `json:"previous,omitempty"`
+	Change    string   `json:"change"`
+}
+
+func init() {
+	devicesIntrospectionCmd.Flags().Bool("compare-previous", false, "When set, compare the current introspection with the previous one.")
+	devicesIntrospectionCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	devicesIntrospectionCmd.Flags().Bool("json", false, "When set, output JSON. Shorthand for --output json.")
+	devicesIntrospectionCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+
+	devicesCmd.AddCommand(devicesIntrospectionCmd)
+}
+
+func devicesIntrospectionF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	comparePrevious, err := command.Flags().GetBool("compare-previous")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	jsonOutput, err := command.Flags().GetBool("json")
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		if command.Flags().Changed("output") && outputType != "json" {
+			return fmt.Errorf("--json can't be used together with --output %s", outputType)
+		}
+		outputType = "json"
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+
+	deviceDetails, err := deviceDetails(realm, deviceID, deviceIdentifierType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	t := tableWriterForOutputType(outputType)
+	if !comparePrevious {
+		t.AppendHeader(table.Row{"Interface", "Major", "Minor", "Exchanged Messages", "Exchanged Bytes"})
+		introspection := []client.DeviceInterfaceIntrospection{}
+		for name, i := range deviceDetails.Introspection {
+			i.Name = name
+			introspection = append(introspection, i)
+			t.AppendRow(table.Row{name, i.Major, i.Minor, i.ExchangedMessages, i.ExchangedBytes})
+		}
+		sort.Slice(introspection, func(i, j int) bool { return introspection[i].Name < introspection[j].Name })
+		t.SortBy([]table.SortBy{{Name: "Interface", Mode: table.Asc}})
+		renderOutput(t, introspection, outputType)
+		return nil
+	}
+
+	changes := compareIntrospection(deviceDetails)
+	t.AppendHeader(table.Row{"Interface", "Current", "Previous", "Change"})
+	for _, c := range changes {
+		t.AppendRow(table.Row{c.Interface, c.Current, strings.Join(c.Previous, ", "), c.Change})
+	}
+	renderOutput(t, changes, outputType)
+	return nil
+}
+
+// compareIntrospection compares the current introspection of a device with its previous interfaces,
+// returning the changes sorted by interface name
+func compareIntrospection(deviceDetails client.DeviceDetails) []introspectionChange {
+	previousByName := map[string][]client.DeviceInterfaceIntrospection{}
+	for _, p := range deviceDetails.PreviousInterfaces {
+		previousByName[p.Name] = append(previousByName[p.Name], p)
+	}
+
+	changes := []introspectionChange{}
+	for name, current := range deviceDetails.Introspection {
+		change := introspectionChange{Interface: name, Current: fmt.Sprintf("v%d.%d", current.Major, current.Minor), Change: "current"}
+		previous, ok := previousByName[name]
+		if ok {
+			highestPreviousMajor := previous[0].Major
+			for _, p := range previous {
+				change.Previous = append(change.Previous, fmt.Sprintf("v%d.%d", p.Major, p.Minor))
+				if p.Major > highestPreviousMajor {
+					highestPreviousMajor = p.Major
+				}
+			}
+			switch {
+			case current.Major > highestPreviousMajor:
+				change.Change = "upgraded"
+			case current.Major < highestPreviousMajor:
+				change.Change = "downgraded"
+			default:
+				change.Change = "unchanged"
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for name, previous := range previousByName {
+		if _, ok := deviceDetails.Introspection[name]; ok {
+			continue
+		}
+		change := introspectionChange{Interface: name, Change: "removed"}
+		for _, p := range previous {
+			change.Previous = append(change.Previous, fmt.Sprintf("v%d.%d", p.Major, p.Minor))
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Interface < changes[j].Interface })
+	return changes
+}
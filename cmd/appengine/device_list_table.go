@@ -0,0 +1,204 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+)
+
+// deviceListColumn is a column of the device list in table, csv and json output
+type deviceListColumn struct {
+	name  string
+	value func(d client.DeviceDetails) interface{}
+}
+
+var deviceListColumns = []deviceListColumn{
+	{"id", func(d client.DeviceDetails) interface{} { return d.DeviceID }},
+	{"aliases", func(d client.DeviceDetails) interface{} { return joinedMap(d.Aliases) }},
+	{"attributes", func(d client.DeviceDetails) interface{} { return joinedMap(d.Attributes) }},
+	{"connected", func(d client.DeviceDetails) interface{} { return d.Connected }},
+	{"last-seen", func(d client.DeviceDetails) interface{} { return lastSeen(d) }},
+	{"last-connection", func(d client.DeviceDetails) interface{} { return d.LastConnection }},
+	{"last-disconnection", func(d client.DeviceDetails) interface{} { return d.LastDisconnection }},
+	{"first-registration", func(d client.DeviceDetails) interface{} { return d.FirstRegistration }},
+	{"first-credentials-request", func(d client.DeviceDetails) interface{} { return d.FirstCredentialsRequest }},
+	{"ip", func(d client.DeviceDetails) interface{} { return ipString(d.LastSeenIP) }},
+	{"credentials-ip", func(d client.DeviceDetails) interface{} { return ipString(d.LastCredentialsRequestIP) }},
+	{"interfaces-count", func(d client.DeviceDetails) interface{} { return int64(len(d.Introspection)) }},
+	{"received-messages", func(d client.DeviceDetails) interface{} { return d.TotalReceivedMessages }},
+	{"received-bytes", func(d client.DeviceDetails) interface{} { return int64(d.TotalReceivedBytes) }},
+	{"credentials-inhibited", func(d client.DeviceDetails) interface{} { return d.CredentialsInhibited }},
+}
+
+var defaultDeviceListColumns = []string{"id", "connected", "last-seen", "ip", "interfaces-count"}
+
+func deviceListColumnNames() []string {
+	ret := []string{}
+	for _, c := range deviceListColumns {
+		ret = append(ret, c.name)
+	}
+	return ret
+}
+
+func findDeviceListColumn(name string) (deviceListColumn, bool) {
+	for _, c := range deviceListColumns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return deviceListColumn{}, false
+}
+
+func validateDevicesTableFlags(outputType string, details bool, columns []string, columnsChanged bool, sortBy string) error {
+	switch outputType {
+	case "default":
+		return nil
+	case "ndjson":
+		// Each line is the whole DeviceDetails, which can't be restricted or sorted while streaming
+		if columnsChanged || sortBy != "" {
+			return errors.New("--columns and --sort-by can't be used with --output ndjson")
+		}
+		return nil
+	case "table", "csv", "json":
+	default:
+		if !utils.IsTemplateOutput(outputType) {
+			return fmt.Errorf("%v is not a supported output type. Supported output types are default,table,csv,json,ndjson,%s", outputType, strings.Join(utils.TemplateOutputTypes, ","))
+		}
+		// As with ndjson, templates are applied to the whole DeviceDetails
+		if columnsChanged || sortBy != "" {
+			return errors.New("--columns and --sort-by can't be used with go-template or jsonpath output")
+		}
+		return nil
+	}
+	if details {
+		return fmt.Errorf("--details can't be used with --output %s, use --columns instead", outputType)
+	}
+	for _, c := range columns {
+		if _, ok := findDeviceListColumn(c); !ok {
+			return fmt.Errorf("%s is not a supported column. Supported columns are %s", c, strings.Join(deviceListColumnNames(), ","))
+		}
+	}
+	if _, ok := findDeviceListColumn(strings.TrimPrefix(sortBy, "-")); sortBy != "" && !ok {
+		return fmt.Errorf("Can't sort by %s. Supported columns are %s", sortBy, strings.Join(deviceListColumnNames(), ","))
+	}
+	return nil
+}
+
+// printDevicesTable prints a row for each device, with the given columns
+func printDevicesTable(realm string, deviceFilters map[DeviceFilterType]interface{}, columnNames []string, sortBy, outputType string) {
+	devices := []client.DeviceDetails{}
+	forEachListedDevice(realm, deviceFilters, func(deviceDetails client.DeviceDetails) {
+		devices = append(devices, outputAnonymizer.deviceDetails(deviceDetails))
+	})
+
+	if sortBy != "" {
+		sortColumn, _ := findDeviceListColumn(strings.TrimPrefix(sortBy, "-"))
+		descending := strings.HasPrefix(sortBy, "-")
+		sort.SliceStable(devices, func(i, j int) bool {
+			a, b := sortColumn.value(devices[i]), sortColumn.value(devices[j])
+			if descending {
+				return deviceListValueLess(b, a)
+			}
+			return deviceListValueLess(a, b)
+		})
+	}
+
+	columns := []deviceListColumn{}
+	header := table.Row{}
+	for _, name := range columnNames {
+		c, _ := findDeviceListColumn(name)
+		columns = append(columns, c)
+		header = append(header, name)
+	}
+
+	// In this context, default output is the regular list, and the table has its own name
+	if outputType == "table" {
+		outputType = "default"
+	}
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(header)
+	rows := []map[string]interface{}{}
+	for _, d := range devices {
+		row := table.Row{}
+		jsonRow := map[string]interface{}{}
+		for _, c := range columns {
+			v := c.value(d)
+			if ts, ok := v.(time.Time); ok && ts.IsZero() {
+				v = nil
+			}
+			jsonRow[c.name] = v
+			if ts, ok := v.(time.Time); ok {
+				row = append(row, utils.FormatTimestamp(ts, time.RFC3339))
+			} else if v == nil {
+				row = append(row, "")
+			} else {
+				row = append(row, v)
+			}
+		}
+		t.AppendRow(row)
+		rows = append(rows, jsonRow)
+	}
+
+	renderOutput(t, rows, outputType)
+}
+
+// deviceListValueLess compares values of the same column. Empty values come first
+func deviceListValueLess(a, b interface{}) bool {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Before(b.(time.Time))
+	case bool:
+		return !a && b.(bool)
+	case int64:
+		return a < b.(int64)
+	case string:
+		return a < b.(string)
+	}
+	return false
+}
+
+// lastSeen is the last time the device connected or disconnected, whichever is the latest
+func lastSeen(d client.DeviceDetails) time.Time {
+	if d.LastConnection.After(d.LastDisconnection) {
+		return d.LastConnection
+	}
+	return d.LastDisconnection
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// joinedMap returns the entries of m as key=value, sorted by key
+func joinedMap(m map[string]string) string {
+	entries := []string{}
+	for k, v := range m {
+		entries = append(entries, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,227 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+// The page size used when counting the samples to be purged
+const purgeDataPageSize = 1000
+
+var devicesPurgeDataCmd = &cobra.Command{
+	Use:   "purge-data <device_id_or_alias> <interface_name> --before <date>",
+	Short: "Purge the datastream samples of a device older than a date",
+	Long: `Purge the samples received by a device on a datastream interface before a given date, to manage the
+storage growth of a realm.
+
+The command always performs a dry run first, showing how many samples would be removed from each path
+of the interface. Samples are removed only when --execute is set.
+
+The AppEngine API of current Astarte versions does not allow to delete datastream samples: on these
+versions, --execute fails after the dry run. To have Astarte expire old samples on its own, set
+database_retention_policy and database_retention_ttl in the mappings of the interface.
+
+--before accepts either an absolute date or a time relative to now, such as -30d.
+
+<device_id_or_alias> can be either a valid Astarte Device ID, or a Device Alias. In most cases,
+this is automatically determined - however, you can tweak this behavior by using --force-id-type={device-id,alias}.`,
+	Example:           `  astartectl appengine devices purge-data 2TBn-jNESuuHamE2Zo1anA com.my.Telemetry --before -90d`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: deviceIDAndInterfaceCompletion,
+	RunE:              devicesPurgeDataF,
+}
+
+// purgeDataPath is the outcome of the dry run of purge-data for a path
+type purgeDataPath struct {
+	Path    string    `json:"path"`
+	Samples int       `json:"samples"`
+	Oldest  time.Time `json:"oldest"`
+	Newest  time.Time `json:"newest"`
+}
+
+func init() {
+	devicesPurgeDataCmd.Flags().String("before", "", "Samples with a timestamp before this date are purged.")
+	devicesPurgeDataCmd.Flags().Bool("execute", false, "When set, samples are removed after the dry run, rather than only counted.")
+	devicesPurgeDataCmd.Flags().StringP("output", "o", "default", "The type of output of the dry run (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	devicesPurgeDataCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
+	_ = devicesPurgeDataCmd.MarkFlagRequired("before")
+
+	devicesCmd.AddCommand(devicesPurgeDataCmd)
+}
+
+func devicesPurgeDataF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	interfaceName := args[1]
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	deviceIdentifierType, err := deviceIdentifierTypeFromFlags(deviceID, forceIDType)
+	if err != nil {
+		return err
+	}
+	before, err := command.Flags().GetString("before")
+	if err != nil {
+		return err
+	}
+	beforeTime, err := parseTimeExpression(before, time.Now())
+	if err != nil {
+		return err
+	}
+	execute, err := command.Flags().GetBool("execute")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+
+	details, err := deviceDetails(realm, deviceID, deviceIdentifierType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	introspection, ok := details.Introspection[interfaceName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Device %s: interface %s not found in device introspection\n", deviceID, interfaceName)
+		os.Exit(1)
+	}
+	iface, err := getInterfaceDefinition(realm, interfaceName, introspection.Major)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if iface.Type != interfaces.DatastreamType {
+		return fmt.Errorf("%s is a properties interface, which has no history: use unset-property to remove its values", interfaceName)
+	}
+
+	paths, err := purgeDataDryRun(deviceID, deviceIdentifierType, iface, beforeTime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Path", "Samples", "Oldest", "Newest"})
+	totalSamples := 0
+	for _, p := range paths {
+		totalSamples += p.Samples
+		t.AppendRow(table.Row{p.Path, p.Samples, timestampForOutput(p.Oldest, outputType), timestampForOutput(p.Newest, outputType)})
+	}
+	renderOutput(t, paths, outputType)
+	fmt.Fprintf(os.Stderr, "%d samples on %d paths of %s were received before %s.\n", totalSamples, len(paths), interfaceName,
+		beforeTime.UTC().Format(time.RFC3339))
+
+	if !execute {
+		fmt.Fprintln(os.Stderr, "This was a dry run, nothing was removed. Use --execute to remove these samples.")
+		return nil
+	}
+	if totalSamples == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "The AppEngine API of this Astarte version does not allow to delete datastream samples. "+
+		"Set database_retention_policy and database_retention_ttl in the mappings of %s to have Astarte expire them.\n", interfaceName)
+	os.Exit(1)
+	return nil
+}
+
+// purgeDataDryRun counts, for each path of iface which received data, the samples received before before
+func purgeDataDryRun(deviceID string, deviceIdentifierType client.DeviceIdentifierType, iface interfaces.AstarteInterface,
+	before time.Time) ([]purgeDataPath, error) {
+	// The snapshot holds all the paths which ever received data
+	values, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, iface)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]bool{}
+	for _, v := range values {
+		if iface.Aggregation == interfaces.ObjectAggregation {
+			paths[path.Dir(v.Path)] = true
+		} else {
+			paths[v.Path] = true
+		}
+	}
+
+	ret := []purgeDataPath{}
+	for interfacePath := range paths {
+		var paginator client.Paginator
+		if iface.Aggregation == interfaces.ObjectAggregation {
+			paginator, err = astarteAPIClient.GetDatastreamObjectTimeWindowPaginator(realm, deviceID, deviceIdentifierType,
+				iface.Name, interfacePath, time.Time{}, before, client.AscendingOrder, purgeDataPageSize)
+		} else {
+			paginator, err = astarteAPIClient.GetDatastreamIndividualTimeWindowPaginator(realm, deviceID, deviceIdentifierType,
+				iface.Name, interfacePath, time.Time{}, before, client.AscendingOrder, purgeDataPageSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p := purgeDataPath{Path: interfacePath}
+		for paginator.HasNextPage() {
+			call, err := paginator.GetNextPage()
+			if err != nil {
+				return nil, err
+			}
+			res, err := call.Run(astarteAPIClient)
+			if err != nil {
+				return nil, err
+			}
+			page, err := res.Parse()
+			if err != nil {
+				return nil, err
+			}
+			timestamps := []time.Time{}
+			switch samples := page.(type) {
+			case []client.DatastreamIndividualValue:
+				for _, s := range samples {
+					timestamps = append(timestamps, s.Timestamp)
+				}
+			case []client.DatastreamObjectValue:
+				for _, s := range samples {
+					timestamps = append(timestamps, s.Timestamp)
+				}
+			}
+			if len(timestamps) == 0 {
+				break
+			}
+			if p.Samples == 0 {
+				p.Oldest = timestamps[0]
+			}
+			p.Newest = timestamps[len(timestamps)-1]
+			p.Samples += len(timestamps)
+		}
+		if p.Samples > 0 {
+			ret = append(ret, p)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret, nil
+}
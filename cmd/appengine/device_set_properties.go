@@ -0,0 +1,280 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var devicesSetPropertiesCmd = &cobra.Command{
+	Use:   "set-properties",
+	Short: "Set the same properties on many devices",
+	Long: `Set the same values of a server-owned properties interface on a list of devices, e.g. to push a new
+configuration to a fleet.
+
+--from-file is a JSON object mapping each path to its value, such as {"/config/rate": 10, "/config/name": "x"}.
+A null value unsets the property. Values are converted to the type of their mapping, in the interface major
+which is in the introspection of each device.
+--devices-file lists a device per line, either as Device ID or alias. Empty lines and lines starting with #
+are ignored. When it is "-", devices are read from stdin.
+
+Devices are updated concurrently, use --concurrency to tweak how many Devices are updated at the same time.
+The result for each device is printed, and the command exits with a non-zero code if any device failed.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl appengine devices set-properties --interface com.my.Config --from-file props.json --devices-file ids.txt`,
+	Args:    cobra.NoArgs,
+	RunE:    devicesSetPropertiesF,
+}
+
+// devicePropertiesResult is the outcome of setting properties on a device
+type devicePropertiesResult struct {
+	DeviceID string `json:"device_id"`
+	Result   string `json:"result"`
+	ok       bool
+}
+
+func init() {
+	devicesSetPropertiesCmd.Flags().String("interface", "", "The server-owned properties interface to be set.")
+	_ = devicesSetPropertiesCmd.MarkFlagRequired("interface")
+	devicesSetPropertiesCmd.Flags().String("from-file", "", "Path to a JSON file mapping each path to its value.")
+	_ = devicesSetPropertiesCmd.MarkFlagRequired("from-file")
+	_ = devicesSetPropertiesCmd.MarkFlagFilename("from-file", "json")
+	devicesSetPropertiesCmd.Flags().String("devices-file", "", "Path to a file listing a device per line, or - for stdin.")
+	_ = devicesSetPropertiesCmd.MarkFlagRequired("devices-file")
+	devicesSetPropertiesCmd.Flags().Int("concurrency", 8, "The maximum number of Devices updated at the same time.")
+	devicesSetPropertiesCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device IDs to be evaluated as a (device-id,alias).")
+	devicesSetPropertiesCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+
+	devicesCmd.AddCommand(devicesSetPropertiesCmd)
+}
+
+func devicesSetPropertiesF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'devices set-properties' does not support the --to-curl option. Use 'devices set-property' for each property.`)
+		os.Exit(1)
+	}
+	interfaceName, err := command.Flags().GetString("interface")
+	if err != nil {
+		return err
+	}
+	fromFile, err := command.Flags().GetString("from-file")
+	if err != nil {
+		return err
+	}
+	devicesFile, err := command.Flags().GetString("devices-file")
+	if err != nil {
+		return err
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+
+	properties, err := readPropertiesFile(fromFile)
+	if err != nil {
+		return err
+	}
+	devices, err := readDevicesFile(devicesFile)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		if _, err := deviceIdentifierTypeFromFlags(d, forceIDType); err != nil {
+			return err
+		}
+	}
+
+	results := make([]devicePropertiesResult, len(devices))
+	cache := newInterfaceDefinitionsCache()
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, device string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			deviceIdentifierType, _ := deviceIdentifierTypeFromFlags(device, forceIDType)
+			results[i] = setDeviceProperties(device, deviceIdentifierType, interfaceName, properties, cache)
+		}(i, device)
+	}
+	wg.Wait()
+
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Device", "Result"})
+	failed := 0
+	for _, r := range results {
+		if !r.ok {
+			failed++
+		}
+		t.AppendRow(table.Row{r.DeviceID, r.Result})
+	}
+	renderOutput(t, results, outputType)
+	fmt.Fprintf(os.Stderr, "%d of %d devices updated\n", len(results)-failed, len(results))
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// setDeviceProperties sets properties of interfaceName on a device, in the interface major in its introspection
+func setDeviceProperties(device string, deviceIdentifierType client.DeviceIdentifierType, interfaceName string,
+	properties map[string]interface{}, cache *interfaceDefinitionsCache) devicePropertiesResult {
+	ret := devicePropertiesResult{DeviceID: device}
+
+	details, err := deviceDetails(realm, device, deviceIdentifierType)
+	if err != nil {
+		ret.Result = fmt.Sprintf("failed: %s", err)
+		return ret
+	}
+	introspection, ok := details.Introspection[interfaceName]
+	if !ok {
+		ret.Result = fmt.Sprintf("failed: %s is not in the device introspection", interfaceName)
+		return ret
+	}
+	iface, err := cache.get(interfaceName, introspection.Major)
+	if err != nil {
+		ret.Result = fmt.Sprintf("failed: %s", err)
+		return ret
+	}
+	if iface.Type != interfaces.PropertiesType || iface.Ownership != interfaces.ServerOwnership {
+		ret.Result = fmt.Sprintf("failed: %s v%d is not a server-owned properties interface", interfaceName, introspection.Major)
+		return ret
+	}
+
+	paths := []string{}
+	for p := range properties {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := setDeviceProperty(device, deviceIdentifierType, iface, p, properties[p]); err != nil {
+			ret.Result = fmt.Sprintf("failed: %s: %s", p, err)
+			return ret
+		}
+	}
+
+	ret.Result = "ok"
+	ret.ok = true
+	return ret
+}
+
+func setDeviceProperty(device string, deviceIdentifierType client.DeviceIdentifierType, iface interfaces.AstarteInterface,
+	interfacePath string, value interface{}) error {
+	mapping, err := interfaces.InterfaceMappingFromPath(iface, interfacePath)
+	if err != nil {
+		return err
+	}
+
+	var call client.AstarteRequest
+	if value == nil {
+		if !mapping.AllowUnset {
+			return fmt.Errorf("it can't be unset")
+		}
+		call, err = astarteAPIClient.UnsetProperty(realm, device, deviceIdentifierType, iface.Name, interfacePath)
+	} else {
+		var payload interface{}
+		if payload, err = jsonValueForMapping(value, mapping.Type, false); err != nil {
+			return err
+		}
+		if err := interfaces.ValidateIndividualMessage(iface, interfacePath, payload); err != nil {
+			return err
+		}
+		call, err = astarteAPIClient.SetProperty(realm, device, deviceIdentifierType, iface.Name, interfacePath,
+			encodeTypedValue(payload, mapping.Type))
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := call.Run(astarteAPIClient)
+	if err != nil {
+		return err
+	}
+	_, _ = res.Parse()
+	return nil
+}
+
+// readPropertiesFile reads a JSON object mapping paths to values
+func readPropertiesFile(fileName string) (map[string]interface{}, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	// Keep numbers as they are, they are converted according to their mapping
+	decoder.UseNumber()
+	properties := map[string]interface{}{}
+	if err := decoder.Decode(&properties); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if len(properties) == 0 {
+		return nil, fmt.Errorf("%s: no properties to be set", fileName)
+	}
+	for p := range properties {
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("%s: %s is not a valid path, it must start with /", fileName, p)
+		}
+	}
+	return properties, nil
+}
+
+// readDevicesFile reads a device per line from fileName, or from stdin when it is "-"
+func readDevicesFile(fileName string) ([]string, error) {
+	file := os.Stdin
+	if fileName != "-" {
+		var err error
+		if file, err = os.Open(fileName); err != nil {
+			return nil, err
+		}
+		defer file.Close()
+	}
+	devices, err := readDeviceIDs(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("No devices were read from %s", fileName)
+	}
+	return devices, nil
+}
@@ -0,0 +1,109 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+)
+
+const (
+	snapshotValueMetric          = "astarte_device_value"
+	snapshotValueTimestampMetric = "astarte_device_value_timestamp_seconds"
+)
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// snapshotMetrics renders the numeric values of a data snapshot in Prometheus text exposition format.
+// Non-numeric values are skipped, booleans are rendered as 0 or 1.
+func snapshotMetrics(deviceID string, values []snapshotValue) string {
+	var b strings.Builder
+	var timestamps strings.Builder
+
+	fmt.Fprintf(&b, "# HELP %s Last known value of an Astarte interface path.\n", snapshotValueMetric)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", snapshotValueMetric)
+	fmt.Fprintf(&timestamps, "# HELP %s Timestamp of the last known value of an Astarte Datastream path.\n", snapshotValueTimestampMetric)
+	fmt.Fprintf(&timestamps, "# TYPE %s gauge\n", snapshotValueTimestampMetric)
+
+	for _, v := range values {
+		value, ok := metricValue(v.Value)
+		if !ok {
+			continue
+		}
+		labels := fmt.Sprintf(`device_id="%s",interface="%s",path="%s"`, prometheusLabelValueReplacer.Replace(deviceID),
+			prometheusLabelValueReplacer.Replace(v.Interface), prometheusLabelValueReplacer.Replace(v.Path))
+		fmt.Fprintf(&b, "%s{%s} %s\n", snapshotValueMetric, labels, strconv.FormatFloat(value, 'g', -1, 64))
+		if !v.Timestamp.IsZero() {
+			fmt.Fprintf(&timestamps, "%s{%s} %s\n", snapshotValueTimestampMetric, labels,
+				strconv.FormatFloat(float64(v.Timestamp.UnixNano())/1e9, 'f', -1, 64))
+		}
+	}
+
+	return b.String() + timestamps.String()
+}
+
+func metricValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// serveSnapshotMetrics serves the data snapshot of the given interfaces as Prometheus metrics on
+// listenAddress. The snapshot is fetched again at every scrape.
+func serveSnapshotMetrics(listenAddress, deviceID string, deviceIdentifierType client.DeviceIdentifierType,
+	interfacesToFetch []interfaces.AstarteInterface) error {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		values := []snapshotValue{}
+		for _, i := range interfacesToFetch {
+			interfaceValues, _, err := interfaceSnapshot(deviceID, deviceIdentifierType, i)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warn: Could not parse results for interface %s: %s\n", i.Name, err)
+				continue
+			}
+			values = append(values, interfaceValues...)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fmt.Fprint(w, snapshotMetrics(deviceID, values))
+	})
+
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", listenAddress)
+	return http.ListenAndServe(listenAddress, nil)
+}
@@ -0,0 +1,265 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var devicesWatchConnectivityCmd = &cobra.Command{
+	Use:   "watch-connectivity",
+	Short: "Watch the connectivity of the devices of a realm",
+	Long: `Periodically list the devices of a realm, showing a live summary of how many of them are connected,
+and their recent connections and disconnections. This is handy to follow large OTA rollouts or broker
+maintenance windows.
+
+Transitions are detected by comparing each listing with the previous one: devices which disconnected and
+connected again between two listings are reported as reconnected. As the whole device list is fetched at
+each --interval, avoid short intervals on realms with many devices.
+
+When stdout is not a terminal, a line is printed for each listing, followed by its transitions.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl appengine devices watch-connectivity --interval 1m`,
+	Args:    cobra.NoArgs,
+	RunE:    devicesWatchConnectivityF,
+}
+
+const (
+	transitionConnected    = "connected"
+	transitionDisconnected = "disconnected"
+	transitionReconnected  = "reconnected"
+)
+
+// connectivityTransition is a change in the connectivity of a device
+type connectivityTransition struct {
+	Timestamp time.Time
+	DeviceID  string
+	Event     string
+}
+
+// connectivityState is the connectivity of a device, as of the last listing
+type connectivityState struct {
+	connected      bool
+	lastConnection time.Time
+}
+
+// connectivityWatcher keeps track of the connectivity of the devices of a realm across listings
+type connectivityWatcher struct {
+	devices          map[string]connectivityState
+	transitions      []connectivityTransition
+	maxTransitions   int
+	connections      int
+	disconnections   int
+	connectedCount   int
+	totalCount       int
+	started, updated time.Time
+}
+
+func init() {
+	devicesWatchConnectivityCmd.Flags().Duration("interval", 30*time.Second, "The interval between device listings.")
+	devicesWatchConnectivityCmd.Flags().Int("count", 0, "The number of listings before exiting. 0 means until interrupted.")
+	devicesWatchConnectivityCmd.Flags().Int("transitions", 10, "The number of recent transitions to show.")
+
+	devicesCmd.AddCommand(devicesWatchConnectivityCmd)
+}
+
+func devicesWatchConnectivityF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'devices watch-connectivity' does not support the --to-curl option.
+Use 'devices list' to get the list of devices.`)
+		os.Exit(1)
+	}
+	interval, err := command.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	count, err := command.Flags().GetInt("count")
+	if err != nil {
+		return err
+	}
+	maxTransitions, err := command.Flags().GetInt("transitions")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be a positive interval")
+	}
+	if maxTransitions < 0 {
+		return fmt.Errorf("--transitions must not be negative")
+	}
+
+	live := term.IsTerminal(int(os.Stdout.Fd()))
+	watcher := &connectivityWatcher{devices: map[string]connectivityState{}, maxTransitions: maxTransitions, started: time.Now()}
+
+	// Stop watching gracefully on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(interval):
+			}
+		}
+		devices, err := listAllDeviceDetails(realm)
+		if err != nil {
+			// A failed listing doesn't stop watching, transitions will be detected at the next one
+			fmt.Fprintf(os.Stderr, "warn: %s\n", err)
+			continue
+		}
+		newTransitions := watcher.update(devices, time.Now())
+		if live {
+			watcher.render(interval)
+		} else {
+			watcher.printLine(newTransitions)
+		}
+	}
+	return nil
+}
+
+// listAllDeviceDetails returns the details of all devices of realm. Unlike forEachListedDevice, errors
+// are returned rather than exiting.
+func listAllDeviceDetails(realm string) ([]client.DeviceDetails, error) {
+	paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, client.DeviceDetailsFormat)
+	if err != nil {
+		return nil, err
+	}
+	ret := []client.DeviceDetails{}
+	for paginator.HasNextPage() {
+		nextPageCall, err := paginator.GetNextPage()
+		if err != nil {
+			return nil, err
+		}
+		rawPage, _, err := runDeviceListPage(nextPageCall, client.DeviceDetailsFormat)
+		if err != nil {
+			return nil, err
+		}
+		page, _ := rawPage.([]client.DeviceDetails)
+		ret = append(ret, page...)
+	}
+	return ret, nil
+}
+
+// update compares devices with the previous listing, and returns the transitions which happened since.
+// The first listing is the baseline, and it has no transitions.
+func (w *connectivityWatcher) update(devices []client.DeviceDetails, now time.Time) []connectivityTransition {
+	first := w.updated.IsZero()
+	w.updated = now
+	w.connectedCount, w.totalCount = 0, len(devices)
+
+	newTransitions := []connectivityTransition{}
+	for _, d := range devices {
+		current := connectivityState{connected: d.Connected, lastConnection: d.LastConnection}
+		if d.Connected {
+			w.connectedCount++
+		}
+		previous, known := w.devices[d.DeviceID]
+		w.devices[d.DeviceID] = current
+		if first || (!known && !d.Connected) {
+			continue
+		}
+
+		switch {
+		case d.Connected && (!known || !previous.connected):
+			newTransitions = append(newTransitions, connectivityTransition{transitionTimestamp(d.LastConnection, now), d.DeviceID, transitionConnected})
+			w.connections++
+		case !d.Connected && previous.connected:
+			newTransitions = append(newTransitions, connectivityTransition{transitionTimestamp(d.LastDisconnection, now), d.DeviceID, transitionDisconnected})
+			w.disconnections++
+		case d.Connected && d.LastConnection.After(previous.lastConnection):
+			newTransitions = append(newTransitions, connectivityTransition{transitionTimestamp(d.LastConnection, now), d.DeviceID, transitionReconnected})
+			w.connections++
+			w.disconnections++
+		}
+	}
+
+	// Keep the most recent transitions first
+	for i := len(newTransitions) - 1; i >= 0; i-- {
+		w.transitions = append([]connectivityTransition{newTransitions[i]}, w.transitions...)
+	}
+	if len(w.transitions) > w.maxTransitions {
+		w.transitions = w.transitions[:w.maxTransitions]
+	}
+	return newTransitions
+}
+
+// transitionTimestamp returns the timestamp reported by Astarte for a transition, or now when missing
+func transitionTimestamp(t time.Time, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
+
+func (w *connectivityWatcher) connectedPercentage() float64 {
+	if w.totalCount == 0 {
+		return 0
+	}
+	return float64(w.connectedCount) * 100 / float64(w.totalCount)
+}
+
+// render clears the terminal and draws the summary
+func (w *connectivityWatcher) render(interval time.Duration) {
+	// Move the cursor home and clear the screen
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("Realm %s, updated at %s, every %s. Press Ctrl-C to exit.\n\n", realm,
+		utils.FormatTimestamp(w.updated, time.RFC3339), interval)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Connected", "Disconnected", "Total", "Connected %", "Connections", "Disconnections"})
+	t.AppendRow(table.Row{w.connectedCount, w.totalCount - w.connectedCount, w.totalCount,
+		fmt.Sprintf("%.1f", w.connectedPercentage()), w.connections, w.disconnections})
+	t.Render()
+	fmt.Printf("Connections and disconnections since %s.\n", utils.FormatTimestamp(w.started, time.RFC3339))
+
+	if w.maxTransitions == 0 {
+		return
+	}
+	fmt.Println("\nRecent transitions:")
+	if len(w.transitions) == 0 {
+		fmt.Println("  None yet")
+		return
+	}
+	tt := table.NewWriter()
+	tt.SetOutputMirror(os.Stdout)
+	tt.SetStyle(table.StyleLight)
+	tt.AppendHeader(table.Row{"Timestamp", "Device ID", "Event"})
+	for _, transition := range w.transitions {
+		tt.AppendRow(table.Row{utils.FormatTimestamp(transition.Timestamp, time.RFC3339), transition.DeviceID, transition.Event})
+	}
+	tt.Render()
+}
+
+// printLine prints the summary of a listing on a line, followed by its transitions
+func (w *connectivityWatcher) printLine(newTransitions []connectivityTransition) {
+	fmt.Printf("%s connected=%d disconnected=%d total=%d connected%%=%.1f\n", utils.FormatTimestamp(w.updated, time.RFC3339),
+		w.connectedCount, w.totalCount-w.connectedCount, w.totalCount, w.connectedPercentage())
+	for _, transition := range newTransitions {
+		fmt.Printf("  %s %s %s\n", utils.FormatTimestamp(transition.Timestamp, time.RFC3339), transition.DeviceID, transition.Event)
+	}
+}
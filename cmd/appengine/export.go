@@ -0,0 +1,569 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Bulk exports of device data",
+	Long:  `Export the data of many devices to files, to be loaded in analytics tools.`,
+}
+
+var exportSamplesCmd = &cobra.Command{
+	Use:   "samples",
+	Short: "Export the samples of an interface from many devices",
+	Long: `Export the samples of an individual Datastream interface from a list of devices, to files which can
+be loaded by e.g. Spark or duckdb.
+
+--devices-file lists a device per line, either as Device ID or alias. Empty lines and lines starting with #
+are ignored, and devices listed more than once are exported once. Devices can't contain path separators
+or "..". When it is "-", devices are read from stdin. All the paths which received data are exported,
+unless --path is given. Samples are exported from the same interface major for all devices: --interface-major,
+or the one picked for the first device in --devices-file.
+
+--format is either parquet, csv or json. Each file has a path, timestamp and value column, and a device_id
+column unless partitioned by device. In Parquet files, timestamps are in milliseconds, and the value column
+has the type of the mappings of the interface when they all have the same type, otherwise it holds the value
+encoded as JSON. Arrays are always encoded as JSON.
+
+--partition-by splits the export in a directory per device (device_id=<device>) and/or per UTC day of the
+samples (date=<yyyy-mm-dd>), in this order, as expected by Hive partitioning. Each directory holds a
+samples.<format> file. Without --partition-by, a single samples.<format> file is written to --output-dir.
+
+Devices are queried concurrently, use --concurrency to tweak how many Devices are queried at the same time.
+The samples of each device are held in memory until they are written. Devices which could not be exported are
+reported, and the command exits with status 3 when only some devices were exported.
+With --anonymize devices, the device_id column and directories hold hashes of the devices rather than their IDs.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl appengine export samples --interface com.my.Sensor --devices-file ids.txt --since -7d --format parquet --partition-by device,date --output-dir export`,
+	Args:    cobra.NoArgs,
+	RunE:    exportSamplesF,
+}
+
+// exportRow is a sample being exported
+type exportRow struct {
+	DeviceID  string      `json:"device_id,omitempty"`
+	Path      string      `json:"path"`
+	Timestamp time.Time   `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+// exportPartitionWriter writes the samples of a partition to its file
+type exportPartitionWriter interface {
+	write(rows []exportRow) error
+	close() error
+}
+
+// samplesExporter writes exported samples to their partitions, keeping their files open until
+// they are complete. It is safe for concurrent use.
+type samplesExporter struct {
+	sync.Mutex
+	outputDir      string
+	format         string
+	byDevice       bool
+	byDate         bool
+	valueType      string
+	iface          interfaces.AstarteInterface
+	partitions     map[string]exportPartitionWriter
+	writtenFiles   int
+	writtenSamples int
+}
+
+func init() {
+	exportSamplesCmd.Flags().String("interface", "", "The individual Datastream interface to export.")
+	_ = exportSamplesCmd.MarkFlagRequired("interface")
+	exportSamplesCmd.Flags().Int("interface-major", 0, "The major version of the interface to export. Defaults to the one of the first device.")
+	exportSamplesCmd.Flags().String("devices-file", "", "Path to a file listing a device per line, or - for stdin.")
+	_ = exportSamplesCmd.MarkFlagRequired("devices-file")
+	exportSamplesCmd.Flags().StringSlice("path", []string{}, "The paths to export, comma separated. Defaults to all the paths which received data.")
+	exportSamplesCmd.Flags().String("since", "", "When set, exports only samples newer than the provided date. Relative times such as -2h or -7d are accepted too.")
+	exportSamplesCmd.Flags().String("to", "", "When set, exports only samples older than the provided date. Relative times such as -2h or -7d are accepted too.")
+	exportSamplesCmd.Flags().String("format", "parquet", "The format of exported files (parquet,csv,json)")
+	exportSamplesCmd.Flags().StringSlice("partition-by", []string{}, "How to partition exported files (device,date), comma separated.")
+	exportSamplesCmd.Flags().String("output-dir", ".", "The directory exported files are written to.")
+	exportSamplesCmd.Flags().Int("concurrency", 8, "The maximum number of Devices queried at the same time.")
+	exportSamplesCmd.Flags().String("force-id-type", "", "When set, rather than autodetecting, it forces the device IDs to be evaluated as a (device-id,alias).")
+	exportSamplesCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+
+	exportCmd.AddCommand(exportSamplesCmd)
+
+	AppEngineCmd.AddCommand(exportCmd)
+}
+
+func exportSamplesF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'export samples' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+	interfaceName, err := command.Flags().GetString("interface")
+	if err != nil {
+		return err
+	}
+	interfaceMajor, err := interfaceMajorFromFlags(command)
+	if err != nil {
+		return err
+	}
+	devicesFile, err := command.Flags().GetString("devices-file")
+	if err != nil {
+		return err
+	}
+	paths, err := command.Flags().GetStringSlice("path")
+	if err != nil {
+		return err
+	}
+	format, err := command.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if format != "parquet" && format != "csv" && format != "json" {
+		return fmt.Errorf("%s is not a supported format. Supported formats are parquet, csv and json", format)
+	}
+	partitionBy, err := command.Flags().GetStringSlice("partition-by")
+	if err != nil {
+		return err
+	}
+	exporter := &samplesExporter{format: format, partitions: map[string]exportPartitionWriter{}}
+	for _, p := range partitionBy {
+		switch p {
+		case "device":
+			exporter.byDevice = true
+		case "date":
+			exporter.byDate = true
+		default:
+			return fmt.Errorf("%s is not a supported partitioning. Supported partitionings are device and date", p)
+		}
+	}
+	exporter.outputDir, err = command.Flags().GetString("output-dir")
+	if err != nil {
+		return err
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	forceIDType, err := command.Flags().GetString("force-id-type")
+	if err != nil {
+		return err
+	}
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
+
+	// Relative times are all evaluated against the same instant
+	now := time.Now()
+	query := samplesQuery{interfaceName: interfaceName, paths: paths, allPaths: len(paths) == 0, to: now, order: client.AscendingOrder}
+	since, err := command.Flags().GetString("since")
+	if err != nil {
+		return err
+	}
+	if since != "" {
+		if query.since, err = parseTimeExpression(since, now); err != nil {
+			return err
+		}
+	}
+	to, err := command.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	if to != "" {
+		if query.to, err = parseTimeExpression(to, now); err != nil {
+			return err
+		}
+	}
+
+	devices, err := readDevicesFile(devicesFile)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errors.New("no devices found in --devices-file")
+	}
+	// Devices name the directories of their partitions, hence they must be unique and they must not
+	// point outside of --output-dir
+	seen := map[string]bool{}
+	uniqueDevices := []string{}
+	for _, d := range devices {
+		if _, err := deviceIdentifierTypeFromFlags(d, forceIDType); err != nil {
+			return err
+		}
+		if strings.ContainsAny(d, `/\`) || strings.Contains(d, "..") {
+			return fmt.Errorf("%s is not a valid device: devices can't contain path separators or \"..\"", d)
+		}
+		if seen[d] {
+			fmt.Fprintf(os.Stderr, "warn: %s is listed more than once in --devices-file, exporting it once\n", d)
+			continue
+		}
+		seen[d] = true
+		uniqueDevices = append(uniqueDevices, d)
+	}
+	devices = uniqueDevices
+
+	// All devices are exported from the same major, so that files have the same schema
+	if interfaceMajor == autoInterfaceMajor {
+		deviceIdentifierType, _ := deviceIdentifierTypeFromFlags(devices[0], forceIDType)
+		details, err := deviceDetails(realm, devices[0], deviceIdentifierType)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if interfaceMajor, err = resolveInterfaceMajor(details, interfaceName, autoInterfaceMajor); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	query.interfaceMajor = interfaceMajor
+	cache := newInterfaceDefinitionsCache()
+	exporter.iface, err = cache.get(interfaceName, interfaceMajor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if exporter.iface.Type != interfaces.DatastreamType || exporter.iface.Aggregation == interfaces.ObjectAggregation {
+		return fmt.Errorf("%s is not an individual Datastream interface", interfaceName)
+	}
+	exporter.valueType = exportValueType(exporter.iface)
+	if err := os.MkdirAll(exporter.outputDir, 0755); err != nil {
+		return err
+	}
+
+	errs := make([]error, len(devices))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, device string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			samples, err := deviceSamples(device, forceIDType, query, cache, nil)
+			if err == nil {
+				err = exporter.export(device, samples)
+			}
+			errs[i] = err
+		}(i, device)
+	}
+	wg.Wait()
+	closeErr := exporter.closeAll()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Device %s: %s\n", devices[i], err)
+			failed++
+		}
+	}
+	if closeErr != nil {
+		fmt.Fprintln(os.Stderr, closeErr)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d samples of %d devices to %d files in %s\n", exporter.writtenSamples,
+		len(devices)-failed, exporter.writtenFiles, exporter.outputDir)
+	switch {
+	case failed == len(devices):
+		os.Exit(1)
+	case failed > 0:
+		os.Exit(partialResultExitCode)
+	}
+	return nil
+}
+
+// export writes the samples of a device to their partitions. When partitioning by device, the partitions
+// of the device are complete and they are closed.
+func (e *samplesExporter) export(deviceID string, samples []fanOutSample) error {
+	deviceID = outputAnonymizer.deviceID(deviceID)
+	byPartition := map[string][]exportRow{}
+	partitions := []string{}
+	for _, s := range samples {
+		partition := e.partition(deviceID, s.Timestamp)
+		if _, ok := byPartition[partition]; !ok {
+			partitions = append(partitions, partition)
+		}
+		row := exportRow{Path: s.Path, Timestamp: s.Timestamp, Value: s.Value}
+		if !e.byDevice {
+			row.DeviceID = deviceID
+		}
+		byPartition[partition] = append(byPartition[partition], row)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	for _, partition := range partitions {
+		w, ok := e.partitions[partition]
+		if !ok {
+			var err error
+			if w, err = e.open(partition); err != nil {
+				return err
+			}
+			e.partitions[partition] = w
+			e.writtenFiles++
+		}
+		if err := w.write(byPartition[partition]); err != nil {
+			return err
+		}
+		e.writtenSamples += len(byPartition[partition])
+	}
+	if e.byDevice {
+		for _, partition := range partitions {
+			err := e.partitions[partition].close()
+			delete(e.partitions, partition)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// partition returns the directory, relative to the output directory, of a sample
+func (e *samplesExporter) partition(deviceID string, timestamp time.Time) string {
+	elements := []string{}
+	if e.byDevice {
+		elements = append(elements, "device_id="+deviceID)
+	}
+	if e.byDate {
+		elements = append(elements, "date="+timestamp.UTC().Format("2006-01-02"))
+	}
+	return filepath.Join(elements...)
+}
+
+func (e *samplesExporter) open(partition string) (exportPartitionWriter, error) {
+	dir := filepath.Join(e.outputDir, partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, "samples."+e.format))
+	if err != nil {
+		return nil, err
+	}
+	if e.format == "parquet" {
+		return newParquetPartitionWriter(f, e.valueType, !e.byDevice)
+	}
+
+	out, err := newStreamSamplesOutput(f, e.format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &streamPartitionWriter{f: f, out: out, withDevice: !e.byDevice}
+	columns := table.Row{"Path", "Timestamp", "Value"}
+	if w.withDevice {
+		columns = append(table.Row{"Device"}, columns...)
+	}
+	if err := out.header(columns); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (e *samplesExporter) closeAll() error {
+	var ret error
+	for partition, w := range e.partitions {
+		if err := w.close(); err != nil && ret == nil {
+			ret = err
+		}
+		delete(e.partitions, partition)
+	}
+	return ret
+}
+
+// streamPartitionWriter writes a partition as csv or json
+type streamPartitionWriter struct {
+	f          *os.File
+	out        *streamSamplesOutput
+	withDevice bool
+}
+
+func (w *streamPartitionWriter) write(rows []exportRow) error {
+	for _, r := range rows {
+		row := table.Row{r.Path, timestampForOutput(r.Timestamp, w.out.outputType), r.Value}
+		if w.withDevice {
+			row = append(table.Row{r.DeviceID}, row...)
+		}
+		if err := w.out.sample(r, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *streamPartitionWriter) close() error {
+	if err := w.out.close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// parquetPartitionWriter writes a partition as a Parquet file
+type parquetPartitionWriter struct {
+	f          *os.File
+	pw         *writer.JSONWriter
+	valueType  string
+	withDevice bool
+}
+
+func newParquetPartitionWriter(f *os.File, valueType string, withDevice bool) (*parquetPartitionWriter, error) {
+	fields := []string{}
+	if withDevice {
+		fields = append(fields, `{"Tag": "name=device_id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}`)
+	}
+	fields = append(fields,
+		`{"Tag": "name=path, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=REQUIRED"}`,
+		`{"Tag": "name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=REQUIRED"}`,
+		fmt.Sprintf(`{"Tag": "name=value, %s, repetitiontype=OPTIONAL"}`, parquetValueTypes[valueType]))
+	schema := fmt.Sprintf(`{"Tag": "name=samples, repetitiontype=REQUIRED", "Fields": [%s]}`, strings.Join(fields, ", "))
+
+	pw, err := writer.NewJSONWriterFromWriter(schema, f, 1)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &parquetPartitionWriter{f: f, pw: pw, valueType: valueType, withDevice: withDevice}, nil
+}
+
+// parquetValueTypes maps the types of the value column to their Parquet type
+var parquetValueTypes = map[string]string{
+	"double":    "type=DOUBLE",
+	"integer":   "type=INT32",
+	"long":      "type=INT64",
+	"boolean":   "type=BOOLEAN",
+	"string":    "type=BYTE_ARRAY, convertedtype=UTF8",
+	"timestamp": "type=INT64, convertedtype=TIMESTAMP_MILLIS",
+	"json":      "type=BYTE_ARRAY, convertedtype=UTF8",
+}
+
+// exportValueType returns the type of the value column for iface, which is the type of its mappings
+// when they all have the same scalar type, or json otherwise
+func exportValueType(iface interfaces.AstarteInterface) string {
+	valueType := ""
+	for _, m := range iface.Mappings {
+		t := "json"
+		switch m.Type {
+		case interfaces.Double:
+			t = "double"
+		case interfaces.Integer:
+			t = "integer"
+		case interfaces.LongInteger:
+			t = "long"
+		case interfaces.Boolean:
+			t = "boolean"
+		case interfaces.String, interfaces.BinaryBlob:
+			t = "string"
+		case interfaces.DateTime:
+			t = "timestamp"
+		}
+		if valueType != "" && valueType != t {
+			return "json"
+		}
+		valueType = t
+	}
+	if valueType == "" {
+		return "json"
+	}
+	return valueType
+}
+
+func (w *parquetPartitionWriter) write(rows []exportRow) error {
+	for _, r := range rows {
+		record := map[string]interface{}{"path": r.Path, "timestamp": r.Timestamp.UnixMilli()}
+		if w.withDevice {
+			record["device_id"] = r.DeviceID
+		}
+		if r.Value != nil {
+			value, err := parquetValue(r.Value, w.valueType)
+			if err != nil {
+				return fmt.Errorf("%s at %s: %w", r.Path, r.Timestamp.Format(time.RFC3339Nano), err)
+			}
+			record["value"] = value
+		}
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := w.pw.Write(string(encoded)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *parquetPartitionWriter) close() error {
+	if err := w.pw.WriteStop(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// parquetValue converts a value returned by AppEngine API to the type of the value column
+func parquetValue(value interface{}, valueType string) (interface{}, error) {
+	switch valueType {
+	case "double", "boolean":
+		return value, nil
+	case "integer", "long":
+		switch v := value.(type) {
+		case float64:
+			return int64(v), nil
+		case json.Number:
+			return v.Int64()
+		case string:
+			// longintegers might be returned as strings, not to lose precision
+			return strconv.ParseInt(v, 10, 64)
+		}
+		return nil, fmt.Errorf("%v is not an integer", value)
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(value), nil
+	case "timestamp":
+		switch v := value.(type) {
+		case time.Time:
+			return v.UnixMilli(), nil
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, err
+			}
+			return t.UnixMilli(), nil
+		}
+		return nil, fmt.Errorf("%v is not a datetime", value)
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
 	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
 	"github.com/spf13/cobra"
 )
 
@@ -59,33 +62,59 @@ var groupsDevicesCmd = &cobra.Command{
 }
 
 var groupsDevicesListCmd = &cobra.Command{
-	Use:     "list <group_name>",
-	Short:   "List devices in a group",
-	Long:    `List devices in a group`,
-	Example: `  astartectl appengine groups devices list mygroup`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    groupsDevicesListF,
+	Use:               "list <group_name>",
+	Short:             "List devices in a group",
+	Long:              `List devices in a group`,
+	Example:           `  astartectl appengine groups devices list mygroup`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: groupNamesCompletion,
+	RunE:              groupsDevicesListF,
 }
 
 var groupsDevicesAddCmd = &cobra.Command{
-	Use:     "add <group_name> <device_id_or_alias>",
-	Short:   "Add a device to a group",
-	Long:    `Add a device to a group`,
-	Example: `  astartectl appengine groups devices add mygroup 7O1hqtg0TSyKpNXr_AqEJA`,
-	Args:    cobra.ExactArgs(2),
-	RunE:    groupsDevicesAddF,
+	Use:               "add <group_name> <device_id_or_alias>",
+	Short:             "Add a device to a group",
+	Long:              `Add a device to a group`,
+	Example:           `  astartectl appengine groups devices add mygroup 7O1hqtg0TSyKpNXr_AqEJA`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: groupNamesCompletion,
+	RunE:              groupsDevicesAddF,
 }
 
 var groupsDevicesRemoveCmd = &cobra.Command{
-	Use:     "remove <group_name> <device_id_or_alias>",
-	Short:   "Remove a device from a group",
-	Long:    `Remove a device from a group`,
-	Example: `  astartectl appengine groups devices remove mygroup y3QgB6BAST2BGGK8GtNSmQ`,
-	Args:    cobra.ExactArgs(2),
-	RunE:    groupsDevicesRemoveF,
+	Use:               "remove <group_name> <device_id_or_alias>",
+	Short:             "Remove a device from a group",
+	Long:              `Remove a device from a group`,
+	Example:           `  astartectl appengine groups devices remove mygroup y3QgB6BAST2BGGK8GtNSmQ`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: groupNamesCompletion,
+	RunE:              groupsDevicesRemoveF,
+}
+
+var groupsDataSnapshotCmd = &cobra.Command{
+	Use:   "data-snapshot <group_name> [<interface_name>]",
+	Short: "Outputs a Data Snapshot of all Devices in a group",
+	Long: `data-snapshot retrieves the last received sample (if it is a Datastream), or the currently
+known value (if it is a property) for each Device in the group, and renders them in a single table
+keyed by Device ID.
+If <interface_name> is specified, the snapshot is returned only for that specific interface,
+otherwise it's returned for all Interfaces in each Device's introspection. Devices which do not have
+<interface_name> in their introspection are skipped.
+Devices are queried concurrently, use --concurrency to tweak how many Devices are queried at the same time.
+This command does not support the --to-curl flag.`,
+	Example:           `  astartectl appengine groups data-snapshot mygroup -o json`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: groupNamesCompletion,
+	RunE:              groupsDataSnapshotF,
 }
 
 func init() {
+	groupsDataSnapshotCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	groupsDataSnapshotCmd.Flags().Int("concurrency", 8, "The maximum number of Devices queried at the same time.")
+	groupsDataSnapshotCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+
+	groupsDevicesListCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+
 	groupsCreateCmd.Flags().String("force-id-type", "",
 		"When set, rather than autodetecting, it forces the device ID to be evaluated as a (device-id,alias).")
 
@@ -105,6 +134,7 @@ func init() {
 		groupsListCmd,
 		groupsCreateCmd,
 		groupsDevicesCmd,
+		groupsDataSnapshotCmd,
 	)
 
 	AppEngineCmd.AddCommand(groupsCmd)
@@ -114,7 +144,7 @@ func groupsListF(command *cobra.Command, args []string) error {
 	groupsListCall, err := astarteAPIClient.ListGroups(realm)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(groupsListCall, astarteAPIClient)
@@ -122,12 +152,13 @@ func groupsListF(command *cobra.Command, args []string) error {
 	groupsListRes, err := groupsListCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
-	groupsList, _ := groupsListRes.Parse()
+	rawGroupsList, _ := groupsListRes.Parse()
+	groupsList, _ := rawGroupsList.([]string)
 
-	fmt.Println(groupsList)
+	utils.PrintList(groupsList)
 	return nil
 }
 
@@ -163,7 +194,7 @@ func groupsCreateF(command *cobra.Command, args []string) error {
 	createGroupCall, err := astarteAPIClient.CreateGroup(realm, groupName, deviceIdentifiers)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(createGroupCall, astarteAPIClient)
@@ -171,7 +202,7 @@ func groupsCreateF(command *cobra.Command, args []string) error {
 	createGroupRes, err := createGroupCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	_, _ = createGroupRes.Parse()
 
@@ -181,27 +212,38 @@ func groupsCreateF(command *cobra.Command, args []string) error {
 
 func groupsDevicesListF(command *cobra.Command, args []string) error {
 	groupName := args[0]
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
 
-	deviceListPaginator, err := astarteAPIClient.ListGroupDevices(realm, groupName, 100, client.DeviceIDFormat)
+	deviceList, err := listGroupDevices(groupName)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
+	}
+
+	utils.PrintList(outputAnonymizer.deviceIDs(deviceList))
+	return nil
+}
+
+func listGroupDevices(groupName string) ([]string, error) {
+	deviceListPaginator, err := astarteAPIClient.ListGroupDevices(realm, groupName, 100, client.DeviceIDFormat)
+	if err != nil {
+		return nil, err
 	}
 
 	deviceList := []string{}
 	for deviceListPaginator.HasNextPage() {
 		deviceListCall, err := deviceListPaginator.GetNextPage()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			return nil, err
 		}
 
 		utils.MaybeCurlAndExit(deviceListCall, astarteAPIClient)
 
 		deviceListRes, err := deviceListCall.Run(astarteAPIClient)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			return nil, err
 		}
 
 		rawDevices, _ := deviceListRes.Parse()
@@ -209,8 +251,7 @@ func groupsDevicesListF(command *cobra.Command, args []string) error {
 		deviceList = append(deviceList, devices...)
 	}
 
-	fmt.Println(deviceList)
-	return nil
+	return deviceList, nil
 }
 
 func groupsDevicesAddF(command *cobra.Command, args []string) error {
@@ -223,7 +264,7 @@ func groupsDevicesAddF(command *cobra.Command, args []string) error {
 	addDeviceCall, err := astarteAPIClient.AddDeviceToGroup(realm, groupName, deviceIdentifier)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(addDeviceCall, astarteAPIClient)
@@ -231,7 +272,7 @@ func groupsDevicesAddF(command *cobra.Command, args []string) error {
 	addDeviceRes, err := addDeviceCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	_, _ = addDeviceRes.Parse()
@@ -250,7 +291,7 @@ func groupsDevicesRemoveF(command *cobra.Command, args []string) error {
 	removeDeviceCall, err := astarteAPIClient.RemoveDeviceFromGroup(realm, groupName, deviceIdentifier)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(removeDeviceCall, astarteAPIClient)
@@ -258,7 +299,7 @@ func groupsDevicesRemoveF(command *cobra.Command, args []string) error {
 	removeDeviceRes, err := removeDeviceCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	_, _ = removeDeviceRes.Parse()
@@ -303,3 +344,151 @@ func getDeviceIDfromAlias(alias string) (string, error) {
 	deviceID, _ := rawDeviceID.(string)
 	return deviceID, nil
 }
+
+func groupsDataSnapshotF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'groups data-snapshot' does not support the --to-curl option. Use 'groups devices list' to get the devices in the group, and 'devices data-snapshot' to get the snapshot of each of them.`)
+		utils.Exit(1)
+	}
+
+	groupName := args[0]
+	var snapshotInterface string
+	if len(args) == 2 {
+		snapshotInterface = args[1]
+	}
+
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
+
+	deviceIDs, err := listGroupDevices(groupName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+
+	snapshots := make([]deviceSnapshot, len(deviceIDs))
+	cache := newInterfaceDefinitionsCache()
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, deviceID := range deviceIDs {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, deviceID string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			snapshots[i] = fetchDeviceSnapshot(deviceID, snapshotInterface, cache)
+		}(i, deviceID)
+	}
+	wg.Wait()
+
+	utils.StartPager()
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Device ID", "Interface", "Path", "Value", "Ownership", "Timestamp (Datastream only)"})
+	jsonOutput := make(map[string]interface{})
+	for _, snapshot := range snapshots {
+		for _, err := range snapshot.errors {
+			fmt.Fprintf(os.Stderr, "warn: %s\n", err)
+		}
+		if snapshot.json == nil {
+			continue
+		}
+		deviceID := outputAnonymizer.deviceID(snapshot.deviceID)
+		jsonOutput[deviceID] = snapshot.json
+		for _, v := range snapshot.values {
+			t.AppendRow([]interface{}{deviceID, v.Interface, v.Path, v.Value, v.Ownership, v.timestampForOutput(outputType)})
+		}
+	}
+
+	renderOutput(t, jsonOutput, outputType)
+
+	return nil
+}
+
+// deviceSnapshot is the data snapshot of a single Device. errors contains all the errors
+// encountered while building the snapshot, json is nil if no snapshot could be built at all.
+type deviceSnapshot struct {
+	deviceID string
+	values   []snapshotValue
+	json     map[string]interface{}
+	errors   []error
+}
+
+func fetchDeviceSnapshot(deviceID, snapshotInterface string, cache *interfaceDefinitionsCache) deviceSnapshot {
+	ret := deviceSnapshot{deviceID: deviceID}
+
+	details, err := deviceDetails(realm, deviceID, client.AstarteDeviceID)
+	if err != nil {
+		ret.errors = append(ret.errors, fmt.Errorf("Could not fetch details for device %s: %w", deviceID, err))
+		return ret
+	}
+
+	ret.json = make(map[string]interface{})
+	for interfaceName, interfaceIntrospection := range details.Introspection {
+		if snapshotInterface != "" && interfaceName != snapshotInterface {
+			continue
+		}
+
+		iface, err := cache.get(interfaceName, interfaceIntrospection.Major)
+		if err != nil {
+			ret.errors = append(ret.errors, fmt.Errorf("Could not fetch details for interface %s: %w", interfaceName, err))
+			continue
+		}
+
+		values, jsonRepresentation, err := interfaceSnapshot(deviceID, client.AstarteDeviceID, iface)
+		if err != nil {
+			ret.errors = append(ret.errors, fmt.Errorf("Could not parse results for interface %s of device %s: %w", interfaceName, deviceID, err))
+			continue
+		}
+		ret.values = append(ret.values, values...)
+		ret.json[interfaceName] = jsonRepresentation
+	}
+
+	return ret
+}
+
+// interfaceDefinitionsCache caches interface definitions retrieved from Realm Management,
+// so that they are fetched only once even when they are shared among many Devices.
+type interfaceDefinitionsCache struct {
+	sync.Mutex
+	definitions map[string]interfaces.AstarteInterface
+}
+
+func newInterfaceDefinitionsCache() *interfaceDefinitionsCache {
+	return &interfaceDefinitionsCache{definitions: map[string]interfaces.AstarteInterface{}}
+}
+
+func (c *interfaceDefinitionsCache) get(interfaceName string, interfaceMajor int) (interfaces.AstarteInterface, error) {
+	key := fmt.Sprintf("%s_v%d", interfaceName, interfaceMajor)
+
+	c.Lock()
+	iface, ok := c.definitions[key]
+	c.Unlock()
+	if ok {
+		return iface, nil
+	}
+
+	iface, err := getInterfaceDefinition(realm, interfaceName, interfaceMajor)
+	if err != nil {
+		return interfaces.AstarteInterface{}, err
+	}
+
+	c.Lock()
+	c.definitions[key] = iface
+	c.Unlock()
+	return iface, nil
+}
@@ -0,0 +1,71 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonStreamWriter writes a JSON array or object one element at a time, with the same indentation
+// used by renderOutput, so that JSON outputs do not need to be collected and marshaled at once.
+type jsonStreamWriter struct {
+	w io.Writer
+	// closing is the closing bracket of the array or object being written, if any
+	closing string
+}
+
+func newJSONStreamWriter(w io.Writer) *jsonStreamWriter {
+	return &jsonStreamWriter{w: w}
+}
+
+// writeElement writes element as the next item of a JSON array
+func (j *jsonStreamWriter) writeElement(element interface{}) error {
+	return j.write("[", "]", "", element)
+}
+
+// writeField writes element as the key field of a JSON object
+func (j *jsonStreamWriter) writeField(key string, element interface{}) error {
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return j.write("{", "}", string(encodedKey)+": ", element)
+}
+
+func (j *jsonStreamWriter) write(opening, closing, prefix string, element interface{}) error {
+	encoded, err := json.MarshalIndent(element, "    ", "    ")
+	if err != nil {
+		return err
+	}
+	separator := ",\n    "
+	if j.closing == "" {
+		separator = opening + "\n    "
+		j.closing = closing
+	}
+	_, err = fmt.Fprint(j.w, separator, prefix, string(encoded))
+	return err
+}
+
+// close terminates the array or object being written. When nothing was written, an empty array is written.
+func (j *jsonStreamWriter) close() error {
+	if j.closing == "" {
+		_, err := fmt.Fprintln(j.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintf(j.w, "\n%s\n", j.closing)
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+)
+
+const (
+	devicesPageTokenKind = "devices"
+	samplesPageTokenKind = "samples"
+)
+
+// pageToken allows to continue a paginated command in a separate invocation. It is printed on stderr
+// as next-page-token, and passed back with --page-token.
+type pageToken struct {
+	Kind string `json:"k"`
+	// FromToken is the continuation token of the device list returned by Astarte
+	FromToken string `json:"f,omitempty"`
+	// Timestamp and Ascending are the timestamp of the last returned sample, and the order of samples
+	Timestamp *time.Time `json:"t,omitempty"`
+	Ascending bool       `json:"a,omitempty"`
+	// Returned is the number of samples at Timestamp which have already been returned
+	Returned int `json:"r,omitempty"`
+}
+
+func (t pageToken) encode() string {
+	content, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// decodePageToken decodes a token printed by a command of the given kind
+func decodePageToken(token, kind string) (pageToken, error) {
+	ret := pageToken{}
+	content, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(content, &ret)
+	}
+	if err != nil || ret.Kind != kind {
+		return pageToken{}, fmt.Errorf("%s is not a valid page token for this command", token)
+	}
+	return ret, nil
+}
+
+// samplesCursor tracks the last returned sample, so that a page token can continue right after it even
+// when other samples share its timestamp
+type samplesCursor struct {
+	timestamp time.Time
+	returned  int
+	// toSkip is the number of samples at timestamp returned by the invocation which printed the page token
+	toSkip int
+}
+
+func newSamplesCursor(token *pageToken) samplesCursor {
+	if token == nil || token.Timestamp == nil {
+		return samplesCursor{}
+	}
+	return samplesCursor{timestamp: *token.Timestamp, returned: token.Returned, toSkip: token.Returned}
+}
+
+// skip reports whether a sample at timestamp was already returned by a previous invocation
+func (c *samplesCursor) skip(timestamp time.Time) bool {
+	if c.toSkip > 0 && timestamp.Equal(c.timestamp) {
+		c.toSkip--
+		return true
+	}
+	c.toSkip = 0
+	return false
+}
+
+// advance records that a sample at timestamp has been returned
+func (c *samplesCursor) advance(timestamp time.Time) {
+	if timestamp.Equal(c.timestamp) {
+		c.returned++
+		return
+	}
+	c.timestamp = timestamp
+	c.returned = 1
+}
+
+func (c samplesCursor) pageToken(ascending bool) *pageToken {
+	timestamp := c.timestamp
+	return &pageToken{Kind: samplesPageTokenKind, Timestamp: &timestamp, Ascending: ascending, Returned: c.returned}
+}
+
+func printNextPageToken(t pageToken) {
+	fmt.Fprintf(os.Stderr, "next-page-token: %s\n", t.encode())
+}
+
+// runDeviceListPage runs call, a request for a page of the device list in format, and returns the page
+// along with the Astarte continuation token of the next page, which is empty on the last page
+func runDeviceListPage(call client.AstarteRequest, format client.DeviceResultFormat) (interface{}, string, error) {
+	res, err := call.Run(astarteAPIClient)
+	if err != nil {
+		return nil, "", err
+	}
+	var body []byte
+	// Raw updates the paginator too, so that it can be used to fetch the next page
+	res.Raw(func(r *http.Response) any {
+		body, err = io.ReadAll(r.Body)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var page struct {
+		Data  []json.RawMessage `json:"data"`
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, "", err
+	}
+	nextToken := ""
+	if page.Links.Next != "" {
+		nextURL, err := url.Parse(page.Links.Next)
+		if err != nil {
+			return nil, "", err
+		}
+		nextToken = nextURL.Query().Get("from_token")
+	}
+
+	if format == client.DeviceIDFormat {
+		ids := []string{}
+		for _, d := range page.Data {
+			var id string
+			if err := json.Unmarshal(d, &id); err != nil {
+				return nil, "", err
+			}
+			ids = append(ids, id)
+		}
+		return ids, nextToken, nil
+	}
+	details := []client.DeviceDetails{}
+	for _, d := range page.Data {
+		deviceDetails := client.DeviceDetails{}
+		if err := json.Unmarshal(d, &deviceDetails); err != nil {
+			return nil, "", err
+		}
+		details = append(details, deviceDetails)
+	}
+	return details, nextToken, nil
+}
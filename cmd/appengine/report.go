@@ -0,0 +1,269 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Fleet-wide reports",
+	Long:  `Reports aggregating data from all the devices in a realm.`,
+}
+
+var reportFreshnessCmd = &cobra.Command{
+	Use:   "freshness",
+	Short: "Report how fresh the data of an interface is across devices",
+	Long: `Check, for each device exposing a Datastream interface in its introspection, how old the latest
+sample of the interface is. Devices which did not send any sample in the last --max-age, or which never
+sent any sample at all, are reported as stale. Devices whose data could not be fetched are reported with
+an error status, also with --stale-only, and make the command fail.
+
+Devices are queried concurrently, use --concurrency to tweak how many Devices are queried at the same time.`,
+	Example: `  astartectl appengine report freshness --interface com.my.Sensor --max-age 1h -o csv`,
+	Args:    cobra.NoArgs,
+	RunE:    reportFreshnessF,
+}
+
+// deviceFreshness is the freshness of the data of an interface for a single device
+type deviceFreshness struct {
+	DeviceID   string     `json:"device_id"`
+	LastSample *time.Time `json:"last_sample,omitempty"`
+	Age        string     `json:"age,omitempty"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	age        time.Duration
+	err        error
+}
+
+func init() {
+	reportFreshnessCmd.Flags().String("interface", "", "The Datastream interface whose data is checked.")
+	_ = reportFreshnessCmd.MarkFlagRequired("interface")
+	reportFreshnessCmd.Flags().Duration("max-age", time.Hour, "The maximum age of the latest sample before data is considered stale.")
+	reportFreshnessCmd.Flags().Bool("stale-only", false, "When set, report only devices with stale data.")
+	reportFreshnessCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	reportFreshnessCmd.Flags().Int("concurrency", 8, "The maximum number of Devices queried at the same time.")
+	reportFreshnessCmd.Flags().StringSlice("anonymize", []string{}, anonymizeDoc)
+
+	reportCmd.AddCommand(reportFreshnessCmd)
+
+	AppEngineCmd.AddCommand(reportCmd)
+}
+
+func reportFreshnessF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'report freshness' does not support the --to-curl option. Use 'devices data-snapshot' to get the latest samples of each device.`)
+		utils.Exit(1)
+	}
+
+	interfaceName, err := command.Flags().GetString("interface")
+	if err != nil {
+		return err
+	}
+	maxAge, err := command.Flags().GetDuration("max-age")
+	if err != nil {
+		return err
+	}
+	if maxAge <= 0 {
+		return errors.New("--max-age must be greater than 0")
+	}
+	staleOnly, err := command.Flags().GetBool("stale-only")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	if err := setupAnonymizer(command); err != nil {
+		return err
+	}
+
+	devices, err := listDevicesWithInterface(interfaceName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+	if len(devices) == 0 {
+		fmt.Fprintf(os.Stderr, "warn: No device has %s in its introspection\n", interfaceName)
+	}
+
+	now := time.Now()
+	results := make([]deviceFreshness, len(devices))
+	cache := newInterfaceDefinitionsCache()
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, device client.DeviceDetails) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = fetchDeviceFreshness(device, interfaceName, maxAge, now, cache)
+		}(i, device)
+	}
+	wg.Wait()
+
+	// Devices which could not be checked first, then stalest first: devices without data, then by decreasing age
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].err != nil) != (results[j].err != nil) {
+			return results[i].err != nil
+		}
+		if (results[i].LastSample == nil) != (results[j].LastSample == nil) {
+			return results[i].LastSample == nil
+		}
+		if results[i].age != results[j].age {
+			return results[i].age > results[j].age
+		}
+		return results[i].DeviceID < results[j].DeviceID
+	})
+
+	utils.StartPager()
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Device ID", "Last Sample", "Age", "Status"})
+	jsonOutput := []deviceFreshness{}
+	stale := 0
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintln(os.Stderr, r.err)
+			r.Error = r.err.Error()
+			failed++
+		}
+		switch r.Status {
+		case "stale", "no data":
+			stale++
+		case "fresh":
+			if staleOnly {
+				continue
+			}
+		}
+		lastSample := ""
+		if r.LastSample != nil {
+			lastSample = timestampForOutput(*r.LastSample, outputType)
+		}
+		r.DeviceID = outputAnonymizer.deviceID(r.DeviceID)
+		t.AppendRow(table.Row{r.DeviceID, lastSample, r.Age, r.Status})
+		jsonOutput = append(jsonOutput, r)
+	}
+	renderOutput(t, jsonOutput, outputType)
+	fmt.Fprintf(os.Stderr, "%d of %d devices have stale %s data\n", stale, len(results), interfaceName)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d devices could not be checked\n", failed, len(results))
+		utils.Exit(1)
+	}
+
+	return nil
+}
+
+// listDevicesWithInterface returns the details of all devices having interfaceName in their introspection
+func listDevicesWithInterface(interfaceName string) ([]client.DeviceDetails, error) {
+	return listDeviceDetails(func(device client.DeviceDetails) bool {
+		_, ok := device.Introspection[interfaceName]
+		return ok
+	})
+}
+
+// listDeviceDetails returns the details of all devices in the realm for which keep returns true
+func listDeviceDetails(keep func(client.DeviceDetails) bool) ([]client.DeviceDetails, error) {
+	paginator, err := astarteAPIClient.GetDeviceListPaginator(realm, 100, client.DeviceDetailsFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []client.DeviceDetails{}
+	for paginator.HasNextPage() {
+		nextPageCall, err := paginator.GetNextPage()
+		if err != nil {
+			return nil, err
+		}
+		deviceListRes, err := nextPageCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, err
+		}
+		rawPage, _ := deviceListRes.Parse()
+		page, _ := rawPage.([]client.DeviceDetails)
+		for _, device := range page {
+			if keep(device) {
+				devices = append(devices, device)
+			}
+		}
+	}
+	return devices, nil
+}
+
+func fetchDeviceFreshness(device client.DeviceDetails, interfaceName string, maxAge time.Duration, now time.Time,
+	cache *interfaceDefinitionsCache) deviceFreshness {
+	ret := deviceFreshness{DeviceID: device.DeviceID, Status: "error"}
+
+	iface, err := cache.get(interfaceName, device.Introspection[interfaceName].Major)
+	if err != nil {
+		ret.err = fmt.Errorf("Could not fetch details for interface %s: %w", interfaceName, err)
+		return ret
+	}
+	if iface.Type != interfaces.DatastreamType {
+		ret.err = fmt.Errorf("%s is not a Datastream interface, its samples have no timestamp", interfaceName)
+		return ret
+	}
+
+	values, _, err := interfaceSnapshot(device.DeviceID, client.AstarteDeviceID, iface)
+	if err != nil {
+		ret.err = fmt.Errorf("Could not fetch the latest samples of %s for device %s: %w", interfaceName, device.DeviceID, err)
+		return ret
+	}
+
+	for _, v := range values {
+		if ret.LastSample == nil || v.Timestamp.After(*ret.LastSample) {
+			timestamp := v.Timestamp
+			ret.LastSample = &timestamp
+		}
+	}
+	if ret.LastSample == nil {
+		ret.Status = "no data"
+		return ret
+	}
+
+	ret.age = now.Sub(*ret.LastSample)
+	ret.Age = ret.age.Truncate(time.Second).String()
+	if ret.age > maxAge {
+		ret.Status = "stale"
+	} else {
+		ret.Status = "fresh"
+	}
+	return ret
+}
@@ -0,0 +1,183 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var reportLastSeenCmd = &cobra.Command{
+	Use:   "last-seen",
+	Short: "Report devices by last seen subnet and connection recency",
+	Long: `Aggregate all devices in the realm by the subnet of the IP address they were last seen from, and
+count, for each subnet, how many devices are connected, and how many were last connected within the
+last 24 hours, within the last 7 days, earlier, or never.
+
+Subnets are computed with the prefix lengths given by --ipv4-prefix and --ipv6-prefix. Devices which
+were never seen are reported in the "unknown" subnet. Subnets are sorted by number of devices, and a
+TOTAL row is added to default and csv output.
+
+This helps spotting connectivity regressions after network changes, e.g. a subnet whose devices
+stopped connecting.`,
+	Example: `  astartectl appengine report last-seen
+  astartectl appengine report last-seen --ipv4-prefix 16 -o csv`,
+	Args:    cobra.NoArgs,
+	Aliases: []string{"lastseen"},
+	RunE:    reportLastSeenF,
+}
+
+// lastSeenSubnet counts the devices last seen from a subnet, by connection recency
+type lastSeenSubnet struct {
+	Subnet    string `json:"subnet"`
+	Devices   int    `json:"devices"`
+	Connected int    `json:"connected"`
+	Last24h   int    `json:"last_24h"`
+	Last7d    int    `json:"last_7d"`
+	Older     int    `json:"older"`
+	Never     int    `json:"never"`
+}
+
+const unknownSubnet = "unknown"
+
+func init() {
+	reportLastSeenCmd.Flags().Int("ipv4-prefix", 24, "The prefix length of the subnets IPv4 addresses are grouped by.")
+	reportLastSeenCmd.Flags().Int("ipv6-prefix", 64, "The prefix length of the subnets IPv6 addresses are grouped by.")
+	reportLastSeenCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+
+	reportCmd.AddCommand(reportLastSeenCmd)
+}
+
+func reportLastSeenF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'report last-seen' does not support the --to-curl option. Use 'devices list --details' to get the details of all devices.`)
+		utils.Exit(1)
+	}
+
+	ipv4Prefix, err := command.Flags().GetInt("ipv4-prefix")
+	if err != nil {
+		return err
+	}
+	if ipv4Prefix < 0 || ipv4Prefix > 32 {
+		return fmt.Errorf("--ipv4-prefix must be between 0 and 32")
+	}
+	ipv6Prefix, err := command.Flags().GetInt("ipv6-prefix")
+	if err != nil {
+		return err
+	}
+	if ipv6Prefix < 0 || ipv6Prefix > 128 {
+		return fmt.Errorf("--ipv6-prefix must be between 0 and 128")
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+
+	devices, err := listDeviceDetails(func(client.DeviceDetails) bool { return true })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+
+	subnets := aggregateLastSeen(devices, ipv4Prefix, ipv6Prefix, time.Now())
+	total := lastSeenSubnet{Subnet: "TOTAL"}
+	for _, s := range subnets {
+		total.Devices += s.Devices
+		total.Connected += s.Connected
+		total.Last24h += s.Last24h
+		total.Last7d += s.Last7d
+		total.Older += s.Older
+		total.Never += s.Never
+	}
+
+	utils.StartPager()
+	t := tableWriterForOutputType(outputType)
+	t.AppendHeader(table.Row{"Subnet", "Devices", "Connected", "< 24h", "< 7d", "Older", "Never"})
+	for _, s := range subnets {
+		t.AppendRow(table.Row{s.Subnet, s.Devices, s.Connected, s.Last24h, s.Last7d, s.Older, s.Never})
+	}
+	if outputType != "json" {
+		t.AppendFooter(table.Row{total.Subnet, total.Devices, total.Connected, total.Last24h, total.Last7d, total.Older, total.Never})
+	}
+	renderOutput(t, subnets, outputType)
+	return nil
+}
+
+// aggregateLastSeen groups devices by the subnet of their last seen IP, sorted by decreasing number of devices
+func aggregateLastSeen(devices []client.DeviceDetails, ipv4Prefix, ipv6Prefix int, now time.Time) []lastSeenSubnet {
+	bySubnet := map[string]*lastSeenSubnet{}
+	for _, device := range devices {
+		subnet := lastSeenSubnetOf(device.LastSeenIP, ipv4Prefix, ipv6Prefix)
+		s, ok := bySubnet[subnet]
+		if !ok {
+			s = &lastSeenSubnet{Subnet: subnet}
+			bySubnet[subnet] = s
+		}
+		s.Devices++
+
+		// Disconnected devices were last seen when they disconnected
+		lastSeen := device.LastDisconnection
+		if device.LastConnection.After(lastSeen) {
+			lastSeen = device.LastConnection
+		}
+		switch {
+		case device.Connected:
+			s.Connected++
+		case lastSeen.IsZero():
+			s.Never++
+		case now.Sub(lastSeen) < 24*time.Hour:
+			s.Last24h++
+		case now.Sub(lastSeen) < 7*24*time.Hour:
+			s.Last7d++
+		default:
+			s.Older++
+		}
+	}
+
+	subnets := []lastSeenSubnet{}
+	for _, s := range bySubnet {
+		subnets = append(subnets, *s)
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		if subnets[i].Devices != subnets[j].Devices {
+			return subnets[i].Devices > subnets[j].Devices
+		}
+		return subnets[i].Subnet < subnets[j].Subnet
+	})
+	return subnets
+}
+
+func lastSeenSubnetOf(ip net.IP, ipv4Prefix, ipv6Prefix int) string {
+	if ip == nil || ip.IsUnspecified() {
+		return unknownSubnet
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		network := net.IPNet{IP: ipv4.Mask(net.CIDRMask(ipv4Prefix, 32)), Mask: net.CIDRMask(ipv4Prefix, 32)}
+		return network.String()
+	}
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(ipv6Prefix, 128)), Mask: net.CIDRMask(ipv6Prefix, 128)}
+	return network.String()
+}
@@ -0,0 +1,240 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+)
+
+// samplesOutput receives the samples fetched by get-samples, as they are fetched
+type samplesOutput interface {
+	// header sets the columns of the following rows
+	header(columns table.Row) error
+	// sample outputs the rows of a sample for table outputs, and element as an item of a JSON array
+	sample(element interface{}, rows ...table.Row) error
+	// keyedSample outputs the rows of a sample for table outputs, and element as the key field of a JSON object
+	keyedSample(key string, element interface{}, rows ...table.Row) error
+	// close renders or flushes the samples received so far
+	close() error
+}
+
+// tableSamplesOutput collects samples in a table, and renders it when closed
+type tableSamplesOutput struct {
+	t             table.Writer
+	outputType    string
+	headerWritten bool
+}
+
+func newTableSamplesOutput(outputType string) *tableSamplesOutput {
+	return &tableSamplesOutput{t: tableWriterForOutputType(outputType), outputType: outputType}
+}
+
+func (o *tableSamplesOutput) header(columns table.Row) error {
+	if !o.headerWritten {
+		o.t.AppendHeader(columns)
+		o.headerWritten = true
+	}
+	return nil
+}
+
+func (o *tableSamplesOutput) sample(element interface{}, rows ...table.Row) error {
+	o.t.AppendRows(rows)
+	return nil
+}
+
+func (o *tableSamplesOutput) keyedSample(key string, element interface{}, rows ...table.Row) error {
+	o.t.AppendRows(rows)
+	return nil
+}
+
+func (o *tableSamplesOutput) close() error {
+	renderOutput(o.t, nil, o.outputType)
+	return nil
+}
+
+// streamSamplesOutput writes samples to w as soon as they are received, as CSV or as JSON. Nothing
+// is kept in memory, which makes it suitable for exports of any size, except for keyed JSON samples:
+// the same key comes in several pages, and they are merged into a single field when closing.
+type streamSamplesOutput struct {
+	outputType    string
+	csv           *csv.Writer
+	json          *jsonStreamWriter
+	headerWritten bool
+	keys          []string
+	keyed         map[string]interface{}
+}
+
+func newStreamSamplesOutput(w io.Writer, outputType string) (*streamSamplesOutput, error) {
+	if outputType != "csv" && outputType != "json" {
+		return nil, fmt.Errorf("only csv and json outputs can be streamed, %s is not supported", outputType)
+	}
+	return &streamSamplesOutput{outputType: outputType, csv: csv.NewWriter(w), json: newJSONStreamWriter(w),
+		keyed: map[string]interface{}{}}, nil
+}
+
+func (o *streamSamplesOutput) header(columns table.Row) error {
+	if o.outputType != "csv" || o.headerWritten {
+		return nil
+	}
+	o.headerWritten = true
+	return o.writeCSVRows(columns)
+}
+
+func (o *streamSamplesOutput) sample(element interface{}, rows ...table.Row) error {
+	if o.outputType == "csv" {
+		return o.writeCSVRows(rows...)
+	}
+	return o.json.writeElement(element)
+}
+
+func (o *streamSamplesOutput) keyedSample(key string, element interface{}, rows ...table.Row) error {
+	if o.outputType == "csv" {
+		return o.writeCSVRows(rows...)
+	}
+	previous, ok := o.keyed[key]
+	if !ok {
+		o.keys = append(o.keys, key)
+		o.keyed[key] = element
+		return nil
+	}
+	// Samples of objects come as slices, which are appended to the ones of the previous pages, while
+	// individual values replace the previous ones
+	if p, e := reflect.ValueOf(previous), reflect.ValueOf(element); p.Kind() == reflect.Slice && p.Type() == e.Type() {
+		o.keyed[key] = reflect.AppendSlice(p, e).Interface()
+		return nil
+	}
+	o.keyed[key] = element
+	return nil
+}
+
+func (o *streamSamplesOutput) writeCSVRows(rows ...table.Row) error {
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = fmt.Sprint(v)
+		}
+		if err := o.csv.Write(record); err != nil {
+			return err
+		}
+	}
+	// Flush at each sample, so that exports can be followed as they are written
+	o.csv.Flush()
+	return o.csv.Error()
+}
+
+func (o *streamSamplesOutput) close() error {
+	if o.outputType == "csv" {
+		o.csv.Flush()
+		return o.csv.Error()
+	}
+	for _, key := range o.keys {
+		if err := o.json.writeField(key, o.keyed[key]); err != nil {
+			return err
+		}
+	}
+	return o.json.close()
+}
+
+// templateSamplesOutput renders samples with a go-template or jsonpath as soon as they are received
+type templateSamplesOutput struct {
+	w   io.Writer
+	out *utils.TemplateOutput
+}
+
+// keyedTemplateSample is what templates are applied to for samples keyed by path, e.g. {{.Path}} {{.Sample.Value}}
+type keyedTemplateSample struct {
+	Path   string      `json:"path"`
+	Sample interface{} `json:"sample"`
+}
+
+func newTemplateSamplesOutput(w io.Writer, outputType string) (*templateSamplesOutput, error) {
+	out, err := utils.NewTemplateOutput(outputType)
+	if err != nil {
+		return nil, err
+	}
+	return &templateSamplesOutput{w: w, out: out}, nil
+}
+
+func (o *templateSamplesOutput) header(columns table.Row) error {
+	return nil
+}
+
+func (o *templateSamplesOutput) sample(element interface{}, rows ...table.Row) error {
+	return o.out.Write(o.w, element)
+}
+
+func (o *templateSamplesOutput) keyedSample(key string, element interface{}, rows ...table.Row) error {
+	// Objects are keyed by their base path as a slice, the template is applied to each of them
+	if v := reflect.ValueOf(element); v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			if err := o.out.Write(o.w, keyedTemplateSample{Path: key, Sample: v.Index(i).Interface()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return o.out.Write(o.w, keyedTemplateSample{Path: key, Sample: element})
+}
+
+func (o *templateSamplesOutput) close() error {
+	return nil
+}
+
+// openExport opens the destination of an export, which is outputFile, or stdout when outputFile
+// is empty or "-". With compress set to gzip, the export is compressed, otherwise compress must be empty.
+// The returned function flushes and closes the destination. It is called by utils.Exit too, so that
+// exports interrupted by an error are left well formed, if incomplete.
+func openExport(outputFile, compress string) (io.Writer, func() error, error) {
+	var w io.Writer = os.Stdout
+	closers := []io.Closer{}
+	if outputFile != "" && outputFile != "-" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = f
+		closers = append(closers, f)
+	}
+	if compress == "gzip" {
+		gz := gzip.NewWriter(w)
+		w = gz
+		// The gzip stream has to be closed before the file it writes to
+		closers = append([]io.Closer{gz}, closers...)
+	}
+
+	closed := false
+	closeExport := func() error {
+		if closed {
+			return nil
+		}
+		closed = true
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	utils.OnExit(func() { _ = closeExport() })
+	return w, closeExport, nil
+}
@@ -0,0 +1,198 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+// advancedSendMinimumVersion is the first Astarte version accepting reception timestamps and metadata
+// when publishing datastreams
+var advancedSendMinimumVersion = semver.MustParse("1.2.0")
+
+// advancedSendOptions are the options of publish-datastream going beyond the payload: the explicit
+// timestamp of the data, and the options meant for test environments
+type advancedSendOptions struct {
+	timestamp          time.Time
+	receptionTimestamp time.Time
+	metadata           map[string]string
+}
+
+func addAdvancedSendFlags(command *cobra.Command) {
+	command.Flags().String("timestamp", "", "The timestamp of the data, for mappings with explicit_timestamp. Either an absolute date or a time relative to now, such as -2h. Defaults to now.")
+	command.Flags().Bool("advanced", false, "When set, enables advanced send options, meant for test environments: --reception-timestamp and --metadata. Requires Astarte 1.2 or newer.")
+	command.Flags().String("reception-timestamp", "", "With --advanced, the reception timestamp of the data, in RFC3339 format.")
+	command.Flags().StringSlice("metadata", nil, "With --advanced, a metadata field of the data in the form key=value. Can be specified multiple times.")
+	_ = command.Flags().MarkHidden("reception-timestamp")
+	_ = command.Flags().MarkHidden("metadata")
+}
+
+// advancedSendOptionsFromFlags returns the advanced send options, or nil when neither --advanced
+// nor --timestamp are set
+func advancedSendOptionsFromFlags(command *cobra.Command) (*advancedSendOptions, error) {
+	advanced, err := command.Flags().GetBool("advanced")
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := command.Flags().GetString("timestamp")
+	if err != nil {
+		return nil, err
+	}
+	if !advanced {
+		for _, f := range []string{"reception-timestamp", "metadata"} {
+			if command.Flags().Changed(f) {
+				return nil, fmt.Errorf("--%s requires --advanced", f)
+			}
+		}
+		if timestamp == "" {
+			return nil, nil
+		}
+	}
+
+	options := &advancedSendOptions{metadata: map[string]string{}}
+	if timestamp != "" {
+		if options.timestamp, err = parseTimeExpression(timestamp, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if !advanced {
+		return options, nil
+	}
+	receptionTimestamp, err := command.Flags().GetString("reception-timestamp")
+	if err != nil {
+		return nil, err
+	}
+	if receptionTimestamp != "" {
+		if options.receptionTimestamp, err = time.Parse(time.RFC3339Nano, receptionTimestamp); err != nil {
+			return nil, fmt.Errorf("Invalid reception timestamp %s, it must be in RFC3339 format", receptionTimestamp)
+		}
+	}
+	metadata, err := command.Flags().GetStringSlice("metadata")
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range metadata {
+		s := strings.SplitN(m, "=", 2)
+		if len(s) != 2 || s[0] == "" {
+			return nil, fmt.Errorf("Invalid metadata %s, it must be in the form key=value", m)
+		}
+		options.metadata[s[0]] = s[1]
+	}
+
+	return options, nil
+}
+
+// needsAdvancedSendSupport returns whether options include any of the options meant for test
+// environments, which are not supported by all Astarte versions
+func (options *advancedSendOptions) needsAdvancedSendSupport() bool {
+	return !options.receptionTimestamp.IsZero() || len(options.metadata) > 0
+}
+
+// checkExplicitTimestamp fails when an explicit timestamp is given for data published on a path
+// of iface whose mapping has no explicit_timestamp, as Astarte would discard it
+func checkExplicitTimestamp(iface interfaces.AstarteInterface, interfacePath string, options *advancedSendOptions) error {
+	if options == nil || options.timestamp.IsZero() {
+		return nil
+	}
+	explicitTimestamp := iface.ExplicitTimestamp
+	if iface.Aggregation != interfaces.ObjectAggregation {
+		mapping, err := interfaces.InterfaceMappingFromPath(iface, interfacePath)
+		if err != nil {
+			return err
+		}
+		explicitTimestamp = explicitTimestamp || mapping.ExplicitTimestamp
+	} else if len(iface.Mappings) > 0 {
+		explicitTimestamp = explicitTimestamp || iface.Mappings[0].ExplicitTimestamp
+	}
+	if !explicitTimestamp {
+		return fmt.Errorf("--timestamp requires a mapping with explicit_timestamp, %s%s has none", iface.Name, interfacePath)
+	}
+	return nil
+}
+
+// publishDatastreamAdvanced publishes payload along with the advanced send options, after checking
+// that the Astarte cluster supports them
+func publishDatastreamAdvanced(deviceIdentifier string, deviceIdentifierType client.DeviceIdentifierType,
+	interfaceName, interfacePath string, payload interface{}, options *advancedSendOptions) error {
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	appEngineURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return err
+	}
+
+	if options.needsAdvancedSendSupport() {
+		versionURL := *appEngineURL
+		versionURL.Path = path.Join(versionURL.Path, "v1", realm, "version")
+		version, err := rawClient.ServiceVersion(&versionURL)
+		if err != nil {
+			return fmt.Errorf("Could not determine the Astarte version, advanced send options require Astarte %s or newer: %w",
+				advancedSendMinimumVersion, err)
+		}
+		if version.LessThan(advancedSendMinimumVersion) {
+			return fmt.Errorf("Astarte %s does not support advanced send options, they require Astarte %s or newer",
+				version, advancedSendMinimumVersion)
+		}
+	}
+
+	callURL := interfacePathURL(appEngineURL, deviceIdentifier, deviceIdentifierType, interfaceName, interfacePath)
+	_, err = rawClient.DoWithEnvelope(http.MethodPost, callURL, sendEnvelope(payload, options), http.StatusOK)
+	return err
+}
+
+// interfacePathURL returns the AppEngine URL of interfacePath of a device interface
+func interfacePathURL(appEngineURL *url.URL, deviceIdentifier string, deviceIdentifierType client.DeviceIdentifierType,
+	interfaceName, interfacePath string) *url.URL {
+	devicePath := "devices-by-alias"
+	if deviceIdentifierType == client.AstarteDeviceID ||
+		(deviceIdentifierType == client.AutodiscoverDeviceIdentifier && deviceid.IsValid(deviceIdentifier)) {
+		devicePath = "devices"
+	}
+	callURL := *appEngineURL
+	callURL.Path = path.Join(callURL.Path, "v1", realm, devicePath, deviceIdentifier, "interfaces", interfaceName) + interfacePath
+	return &callURL
+}
+
+// sendEnvelope returns the body of the request sending payload along with options, which may be nil
+func sendEnvelope(payload interface{}, options *advancedSendOptions) map[string]interface{} {
+	envelope := map[string]interface{}{"data": interfaces.NormalizePayload(payload, true)}
+	if options == nil {
+		return envelope
+	}
+	if !options.timestamp.IsZero() {
+		envelope["timestamp"] = options.timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	if !options.receptionTimestamp.IsZero() {
+		envelope["reception_timestamp"] = options.receptionTimestamp.UTC().Format(time.RFC3339Nano)
+	}
+	if len(options.metadata) > 0 {
+		envelope["metadata"] = options.metadata
+	}
+	return envelope
+}
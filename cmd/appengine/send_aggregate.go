@@ -0,0 +1,102 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/astarte-platform/astarte-go/interfaces"
+)
+
+// aggregateMessage is an object published on a path of an object aggregated interface
+type aggregateMessage struct {
+	path    string
+	payload map[string]interface{}
+}
+
+// splitAggregatePayload splits payload into the objects to be published on interfacePath and below.
+// As values of Astarte mappings are never JSON objects, a nested object stands for a further level of
+// a parametric path: {"kitchen": {"temperature": 21.5}} on /home is {"temperature": 21.5} on /home/kitchen.
+// Messages are sorted by path.
+func splitAggregatePayload(interfacePath string, payload map[string]interface{}) []aggregateMessage {
+	messages := map[string]map[string]interface{}{}
+	var walk func(p string, object map[string]interface{})
+	walk = func(p string, object map[string]interface{}) {
+		for k, v := range object {
+			if nested, ok := v.(map[string]interface{}); ok {
+				walk(path.Join(p, k), nested)
+				continue
+			}
+			if messages[p] == nil {
+				messages[p] = map[string]interface{}{}
+			}
+			messages[p][k] = v
+		}
+	}
+	walk(interfacePath, payload)
+
+	ret := []aggregateMessage{}
+	for p, object := range messages {
+		ret = append(ret, aggregateMessage{path: p, payload: object})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].path < ret[j].path })
+	return ret
+}
+
+// convertAggregatePayload converts the values of payload, as decoded from JSON with numbers as json.Number,
+// to the types of the mappings of iface at interfacePath, as jsonValueForMapping does. When checkMappings is
+// false, the interface mappings are not known, and numbers are just converted to integers or doubles.
+func convertAggregatePayload(iface interfaces.AstarteInterface, interfacePath string, payload map[string]interface{},
+	checkMappings, strict bool) error {
+	for k, v := range payload {
+		if !checkMappings {
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					payload[k] = i
+				} else if f, err := n.Float64(); err == nil {
+					payload[k] = f
+				}
+			}
+			continue
+		}
+
+		// since we're dealing with object aggregation, we need to reconstruct
+		// the full path to get the mapping and its type
+		fullPath := path.Join(interfacePath, k)
+		mapping, err := interfaces.InterfaceMappingFromPath(iface, fullPath)
+		if err != nil {
+			return err
+		}
+		converted, err := jsonValueForMapping(v, mapping.Type, strict)
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s: %w", fullPath, err)
+		}
+		payload[k] = converted
+	}
+	return nil
+}
+
+// encodeAggregatePayload prepares the values of payload, already validated, to be encoded as JSON with
+// encodeTypedValue
+func encodeAggregatePayload(iface interfaces.AstarteInterface, interfacePath string, payload map[string]interface{}) {
+	for k, v := range payload {
+		if mapping, err := interfaces.InterfaceMappingFromPath(iface, path.Join(interfacePath, k)); err == nil {
+			payload[k] = encodeTypedValue(v, mapping.Type)
+		}
+	}
+}
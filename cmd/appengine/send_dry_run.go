@@ -0,0 +1,45 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+func addDryRunFlag(command *cobra.Command) {
+	command.Flags().Bool("dry-run", false, "When set, validate the data and print the request which would send it, without sending it.")
+}
+
+// printSendDryRun prints the method, URL and body of the request sending payload to interfacePath,
+// the way it would be sent
+func printSendDryRun(method, deviceIdentifier string, deviceIdentifierType client.DeviceIdentifierType,
+	interfaceName, interfacePath string, payload interface{}, options *advancedSendOptions) error {
+	appEngineURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return err
+	}
+	callURL := interfacePathURL(appEngineURL, deviceIdentifier, deviceIdentifierType, interfaceName, interfacePath)
+	body, err := json.MarshalIndent(sendEnvelope(payload, options), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n%s\n", method, callURL, body)
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/spf13/cobra"
+)
+
+// maxStreamRecordSize is the maximum length of a line read by send-data --stream
+const maxStreamRecordSize = 1024 * 1024
+
+// sendDataArgs requires <path> and <data>, unless send-data is run with --stream
+func sendDataArgs(command *cobra.Command, args []string) error {
+	stream, err := command.Flags().GetBool("stream")
+	if err != nil {
+		return err
+	}
+	if stream {
+		if len(args) != 2 {
+			return fmt.Errorf("With --stream, only <device_id_or_alias> and <interface_name> must be given, records are read from stdin")
+		}
+		return nil
+	}
+	return cobra.ExactArgs(4)(command, args)
+}
+
+// readDataArgument returns data, unless it is "-": in that case, the data is read from stdin
+func readDataArgument(data string) (string, error) {
+	if data != "-" {
+		return data, nil
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("Could not read data from stdin: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// devicesSendDataStreamF sends each record read from stdin to the interface, in order. As the interface
+// has already been resolved, each record goes through the same path as a single send-data.
+func devicesSendDataStreamF(command *cobra.Command, args []string, iface interfaces.AstarteInterface) error {
+	// The timestamp given on the command line is used for records without their own
+	defaultTimestamp, err := command.Flags().GetString("timestamp")
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamRecordSize)
+	lineNumber := 0
+	sent := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		interfacePath, value, timestamp, err := parseStreamRecord(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Line %d: %v\n", lineNumber, err)
+			os.Exit(1)
+		}
+		if timestamp == "" {
+			timestamp = defaultTimestamp
+		} else if iface.Type == interfaces.PropertiesType {
+			fmt.Fprintf(os.Stderr, "Line %d: timestamps are supported only by datastreams\n", lineNumber)
+			os.Exit(1)
+		}
+		if err := command.Flags().Set("timestamp", timestamp); err != nil {
+			return err
+		}
+
+		recordArgs := []string{args[0], args[1], interfacePath, value}
+		if iface.Type == interfaces.PropertiesType {
+			err = devicesSetPropertyF(command, recordArgs)
+		} else {
+			err = devicesPublishDataStreamF(command, recordArgs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Line %d: %v\n", lineNumber, err)
+			os.Exit(1)
+		}
+		sent++
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read records from stdin after line %d: %v\n", lineNumber, err)
+		os.Exit(1)
+	}
+
+	if dryRun, _ := command.Flags().GetBool("dry-run"); dryRun {
+		fmt.Fprintf(os.Stderr, "Validated %d records, none was sent\n", sent)
+	} else {
+		fmt.Fprintf(os.Stderr, "Sent %d records\n", sent)
+	}
+	return nil
+}
+
+// parseStreamRecord splits a "path value [timestamp]" record. value is either a single word, or a JSON
+// document (an object, an array or a quoted string), which may hold spaces.
+func parseStreamRecord(line string) (interfacePath, value, timestamp string, err error) {
+	interfacePath, rest := splitFirstWord(line)
+	if rest == "" {
+		return "", "", "", fmt.Errorf("Invalid record %q, expected <path> <value> [timestamp]", line)
+	}
+
+	switch rest[0] {
+	case '{', '[', '"':
+		decoder := json.NewDecoder(strings.NewReader(rest))
+		var document json.RawMessage
+		if err := decoder.Decode(&document); err != nil {
+			return "", "", "", fmt.Errorf("Invalid JSON value: %w", err)
+		}
+		value = rest[:decoder.InputOffset()]
+		timestamp = strings.TrimSpace(rest[decoder.InputOffset():])
+		if rest[0] == '"' {
+			// Quotes just delimit the string, they are not part of it
+			if err := json.Unmarshal(document, &value); err != nil {
+				return "", "", "", err
+			}
+		}
+	default:
+		value, timestamp = splitFirstWord(rest)
+	}
+	return interfacePath, value, timestamp, nil
+}
+
+// splitFirstWord returns the first word of s and the rest of it, trimmed
+func splitFirstWord(s string) (string, string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
@@ -15,9 +15,17 @@
 package appengine
 
 import (
+	"context"
+	"encoding/csv"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
 
+	"github.com/astarte-platform/astarte-go/client"
 	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
 	"github.com/spf13/cobra"
 )
 
@@ -32,20 +40,61 @@ var statsDevicesCmd = &cobra.Command{
 	Use:   "devices",
 	Short: "Show devices stats",
 	Long: `Show various devices stats, such as the total number of devices and the number of
-connected devices`,
-	Example: `  astartectl appengine stats devices`,
+connected devices, together with the share of connected devices.
+
+With --watch <interval>, stats are fetched again at each interval, until interrupted or until --count
+samples were shown: failed fetches are reported, and don't count toward --count. Each sample shows the rates at which devices were registered and connected since the
+previous one, per minute: negative rates mean devices were deleted or disconnected.`,
+	Example: `  astartectl appengine stats devices
+  astartectl appengine stats devices --watch 30s`,
 	Args:    cobra.NoArgs,
 	Aliases: []string{"device"},
 	RunE:    statsDevicesF,
 }
 
+// devicesStatsSample is a sample of the devices stats of a realm. Rates are computed against the
+// previous sample, and are missing in the first one.
+type devicesStatsSample struct {
+	Timestamp              time.Time `json:"timestamp"`
+	TotalDevices           int64     `json:"total_devices"`
+	ConnectedDevices       int64     `json:"connected_devices"`
+	ConnectedPercentage    float64   `json:"connected_percentage"`
+	RegistrationsPerMinute *float64  `json:"registrations_per_minute,omitempty"`
+	ConnectionsPerMinute   *float64  `json:"connections_per_minute,omitempty"`
+}
+
 func init() {
+	statsDevicesCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv,json,go-template=<template>,jsonpath=<expression>)")
+	statsDevicesCmd.Flags().Duration("watch", 0, "When set, fetches stats again at the given interval, e.g. 30s, showing registration and connection rates.")
+	statsDevicesCmd.Flags().Int("count", 0, "With --watch, the number of samples to show. 0 means until interrupted.")
 	statsCmd.AddCommand(statsDevicesCmd)
 
 	AppEngineCmd.AddCommand(statsCmd)
 }
 
 func statsDevicesF(command *cobra.Command, args []string) error {
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if !isASupportedOutputType(outputType) {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are %v", outputType, supportedOutputTypes)
+	}
+	watch, err := command.Flags().GetDuration("watch")
+	if err != nil {
+		return err
+	}
+	count, err := command.Flags().GetInt("count")
+	if err != nil {
+		return err
+	}
+	if watch < 0 {
+		return fmt.Errorf("--watch must be a positive interval")
+	}
+	if count != 0 && watch == 0 {
+		return fmt.Errorf("--count requires --watch")
+	}
+
 	devicesStatsReq, err := astarteAPIClient.GetDevicesStats(realm)
 	if err != nil {
 		return err
@@ -53,12 +102,142 @@ func statsDevicesF(command *cobra.Command, args []string) error {
 
 	utils.MaybeCurlAndExit(devicesStatsReq, astarteAPIClient)
 
-	devicesStatsRes, err := devicesStatsReq.Run(astarteAPIClient)
+	if watch == 0 {
+		sample, err := fetchDevicesStats(devicesStatsReq, nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		t := tableWriterForOutputType(outputType)
+		t.AppendHeader(table.Row{"Total Devices", "Connected Devices", "Connected %"})
+		t.AppendRow(table.Row{sample.TotalDevices, sample.ConnectedDevices, fmt.Sprintf("%.1f", sample.ConnectedPercentage)})
+		renderOutput(t, sample, outputType)
+		return nil
+	}
+
+	// Stop watching gracefully on Ctrl-C, so that the output is well formed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := newDevicesStatsWatchOutput(outputType)
+	defer out.close()
+	var previous *devicesStatsSample
+	// Only the samples which were fetched successfully count toward --count
+	for attempt, shown := 0, 0; count == 0 || shown < count; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watch):
+			}
+		}
+		sample, err := fetchDevicesStats(devicesStatsReq, previous)
+		if err != nil {
+			// A failed sample doesn't stop watching, rates will be computed over a longer interval
+			fmt.Fprintf(os.Stderr, "warn: %s\n", err)
+			continue
+		}
+		if err := out.write(sample); err != nil {
+			out.close()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		previous = &sample
+		shown++
+	}
+	return nil
+}
+
+// fetchDevicesStats runs req and returns its result as a sample, computing rates against previous, if any
+func fetchDevicesStats(req client.AstarteRequest, previous *devicesStatsSample) (devicesStatsSample, error) {
+	devicesStatsRes, err := req.Run(astarteAPIClient)
 	if err != nil {
+		return devicesStatsSample{}, err
+	}
+	rawDevicesStats, err := devicesStatsRes.Parse()
+	if err != nil {
+		return devicesStatsSample{}, err
+	}
+	devicesStats, _ := rawDevicesStats.(client.DevicesStats)
+
+	sample := devicesStatsSample{
+		Timestamp:        time.Now(),
+		TotalDevices:     devicesStats.TotalDevices,
+		ConnectedDevices: devicesStats.ConnectedDevices,
+	}
+	if sample.TotalDevices > 0 {
+		sample.ConnectedPercentage = float64(sample.ConnectedDevices) * 100 / float64(sample.TotalDevices)
+	}
+	if previous != nil {
+		minutes := sample.Timestamp.Sub(previous.Timestamp).Minutes()
+		registrations := float64(sample.TotalDevices-previous.TotalDevices) / minutes
+		connections := float64(sample.ConnectedDevices-previous.ConnectedDevices) / minutes
+		sample.RegistrationsPerMinute = &registrations
+		sample.ConnectionsPerMinute = &connections
+	}
+	return sample, nil
+}
+
+// devicesStatsWatchOutput writes devices stats samples as they are fetched, as a table can't be
+// rendered before all of its rows are known
+type devicesStatsWatchOutput struct {
+	outputType string
+	csvWriter  *csv.Writer
+	jsonWriter *jsonStreamWriter
+	template   *utils.TemplateOutput
+}
+
+func newDevicesStatsWatchOutput(outputType string) *devicesStatsWatchOutput {
+	out := &devicesStatsWatchOutput{outputType: outputType}
+	header := []string{"Timestamp", "Total Devices", "Connected Devices", "Connected %", "Registrations/min", "Connections/min"}
+	switch outputType {
+	case "csv":
+		out.csvWriter = csv.NewWriter(os.Stdout)
+		_ = out.csvWriter.Write(header)
+	case "json":
+		out.jsonWriter = newJSONStreamWriter(os.Stdout)
+	default:
+		if utils.IsTemplateOutput(outputType) {
+			out.template = templateOutputForType(outputType)
+			break
+		}
+		fmt.Printf("%-25s %14s %18s %12s %18s %16s\n", header[0], header[1], header[2], header[3], header[4], header[5])
+	}
+	return out
+}
+
+func (o *devicesStatsWatchOutput) write(sample devicesStatsSample) error {
+	registrations, connections := "-", "-"
+	if sample.RegistrationsPerMinute != nil {
+		registrations = strconv.FormatFloat(*sample.RegistrationsPerMinute, 'f', 2, 64)
+		connections = strconv.FormatFloat(*sample.ConnectionsPerMinute, 'f', 2, 64)
+	}
+	timestamp := timestampForOutput(sample.Timestamp, o.outputType)
+	if o.outputType == "default" {
+		// Samples are seconds apart at best, keep the column short
+		timestamp = utils.FormatTimestamp(sample.Timestamp, time.RFC3339)
+	}
+	percentage := strconv.FormatFloat(sample.ConnectedPercentage, 'f', 1, 64)
+
+	if o.template != nil {
+		return o.template.Write(os.Stdout, sample)
+	}
+	switch o.outputType {
+	case "csv":
+		_ = o.csvWriter.Write([]string{timestamp, strconv.FormatInt(sample.TotalDevices, 10),
+			strconv.FormatInt(sample.ConnectedDevices, 10), percentage, registrations, connections})
+		o.csvWriter.Flush()
+		return o.csvWriter.Error()
+	case "json":
+		return o.jsonWriter.writeElement(sample)
+	default:
+		_, err := fmt.Printf("%-25s %14d %18d %12s %18s %16s\n", timestamp, sample.TotalDevices, sample.ConnectedDevices,
+			percentage, registrations, connections)
 		return err
 	}
-	devicesStats, _ := devicesStatsRes.Parse()
+}
 
-	fmt.Printf("%+v\n", devicesStats)
-	return nil
+func (o *devicesStatsWatchOutput) close() {
+	if o.jsonWriter != nil {
+		_ = o.jsonWriter.close()
+	}
 }
@@ -0,0 +1,76 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
+)
+
+var durationExpressionRegexp = regexp.MustCompile(`^(\d+)(ms|s|m|h|d|w)`)
+
+var durationExpressionUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// parseDurationExpression parses a duration such as 15m, 7d or 1d12h. On top of the units supported
+// by time.ParseDuration, d (days) and w (weeks) are supported.
+func parseDurationExpression(expression string) (time.Duration, error) {
+	rest := strings.TrimSpace(expression)
+	if rest == "" {
+		return 0, fmt.Errorf("Invalid duration %q", expression)
+	}
+
+	var ret time.Duration
+	for rest != "" {
+		match := durationExpressionRegexp.FindStringSubmatch(rest)
+		if match == nil {
+			return 0, fmt.Errorf("Invalid duration %q, it must be in the form e.g. 30s, 15m, 2h, 7d or 1w", expression)
+		}
+		value, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration %q: %w", expression, err)
+		}
+		ret += time.Duration(value) * durationExpressionUnits[match[2]]
+		rest = rest[len(match[0]):]
+	}
+	return ret, nil
+}
+
+// parseTimeExpression parses either an absolute date, in any format supported by dateparse, or a time
+// relative to now, such as -2h or -7d. "now" is accepted too.
+func parseTimeExpression(expression string, now time.Time) (time.Time, error) {
+	switch {
+	case expression == "now":
+		return now, nil
+	case strings.HasPrefix(expression, "-"):
+		duration, err := parseDurationExpression(expression[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-duration), nil
+	}
+	return dateparse.ParseLocal(expression)
+}
@@ -0,0 +1,239 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/interfaces"
+)
+
+// maxSafeJSONInteger is the largest integer which can be represented exactly by JSON parsers using
+// doubles for all numbers
+const maxSafeJSONInteger = 1<<53 - 1
+
+// astarteDouble is a double encoded in JSON always with a decimal point, so that it is never mistaken
+// for an integer
+type astarteDouble float64
+
+func (d astarteDouble) MarshalJSON() ([]byte, error) {
+	f := float64(d)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%v is not a valid double", f)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	} else if !strings.Contains(s, ".") {
+		s = strings.Replace(s, "e", ".0e", 1)
+	}
+	return []byte(s), nil
+}
+
+// astarteLongInteger is a longinteger encoded in JSON as a string when it could lose precision as a number
+type astarteLongInteger int64
+
+func (l astarteLongInteger) MarshalJSON() ([]byte, error) {
+	if l > maxSafeJSONInteger || l < -maxSafeJSONInteger {
+		return json.Marshal(strconv.FormatInt(int64(l), 10))
+	}
+	return []byte(strconv.FormatInt(int64(l), 10)), nil
+}
+
+// encodeTypedValue prepares a value of mappingType, already validated, to be encoded as JSON the way Astarte
+// expects it: doubles always have a decimal point, and longintegers are strings when they are too large to
+// be numbers. Other values are returned as they are.
+func encodeTypedValue(value interface{}, mappingType interfaces.AstarteMappingType) interface{} {
+	switch mappingType {
+	case interfaces.Double:
+		if f, ok := numberAsFloat(value); ok {
+			return astarteDouble(f)
+		}
+	case interfaces.LongInteger:
+		if i, ok := numberAsInt(value); ok {
+			return astarteLongInteger(i)
+		}
+	case interfaces.DoubleArray, interfaces.LongIntegerArray:
+		elementType := interfaces.AstarteMappingType(strings.TrimSuffix(string(mappingType), "array"))
+		var values []interface{}
+		switch v := value.(type) {
+		case []interface{}:
+			values = v
+		case []float64:
+			for _, f := range v {
+				values = append(values, f)
+			}
+		case []int64:
+			for _, i := range v {
+				values = append(values, i)
+			}
+		default:
+			return value
+		}
+		ret := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			ret = append(ret, encodeTypedValue(v, elementType))
+		}
+		return ret
+	}
+	return value
+}
+
+func numberAsFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func numberAsInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// jsonValueForMapping converts a value decoded from JSON (with numbers as json.Number) to the type of mappingType.
+// Unless strict is set, strings are parsed as the type of mappingType, and numbers without a decimal point are
+// accepted as doubles. Longintegers are accepted as strings anyway, as it is how Astarte encodes large ones.
+func jsonValueForMapping(value interface{}, mappingType interfaces.AstarteMappingType, strict bool) (interface{}, error) {
+	if elementType := strings.TrimSuffix(string(mappingType), "array"); elementType != string(mappingType) {
+		if s, ok := value.(string); ok && !strict {
+			return parseSendDataPayload(s, mappingType, false)
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not a valid %s", value, mappingType)
+		}
+		ret := []interface{}{}
+		for _, v := range values {
+			converted, err := jsonValueForMapping(v, interfaces.AstarteMappingType(elementType), strict)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, converted)
+		}
+		return ret, nil
+	}
+
+	var ret interface{}
+	var err error
+	switch v := value.(type) {
+	case string:
+		switch mappingType {
+		case interfaces.String, interfaces.BinaryBlob, interfaces.DateTime, interfaces.LongInteger:
+			ret, err = parseSendDataPayload(v, mappingType, strict)
+		default:
+			if strict {
+				return nil, fmt.Errorf("%q is a string while the mapping is %s, %w", v, mappingType, errImplicitConversion)
+			}
+			ret, err = parseSendDataPayload(v, mappingType, false)
+		}
+	case json.Number:
+		switch mappingType {
+		case interfaces.Double, interfaces.Integer, interfaces.LongInteger:
+			ret, err = parseSendDataPayload(v.String(), mappingType, strict)
+		default:
+			return nil, fmt.Errorf("%v is not a valid %s", value, mappingType)
+		}
+	case bool:
+		if mappingType != interfaces.Boolean {
+			return nil, fmt.Errorf("%v is not a valid %s", value, mappingType)
+		}
+		ret = v
+	default:
+		return nil, fmt.Errorf("%v is not a valid %s", value, mappingType)
+	}
+	if errors.Is(err, errImplicitConversion) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("%v is not a valid %s", value, mappingType)
+	}
+	return ret, nil
+}
+
+// errImplicitConversion is returned when --strict-types refuses a value which is not in the canonical
+// representation of its type
+var errImplicitConversion = errors.New("implicit conversions are refused with --strict-types")
+
+// checkStrictPayload checks that payload is in the canonical representation of mappingType. Arrays are
+// checked element by element while they are parsed.
+func checkStrictPayload(payload string, mappingType interfaces.AstarteMappingType) error {
+	switch mappingType {
+	case interfaces.Double:
+		if !strings.ContainsAny(payload, ".eE") {
+			return fmt.Errorf("%s has no decimal point, %w", payload, errImplicitConversion)
+		}
+	case interfaces.Boolean:
+		if payload != "true" && payload != "false" {
+			return fmt.Errorf("%s is neither true nor false, %w", payload, errImplicitConversion)
+		}
+	case interfaces.DateTime:
+		if _, err := time.Parse(time.RFC3339Nano, payload); err != nil {
+			return fmt.Errorf("%s is not in RFC3339 format, %w", payload, errImplicitConversion)
+		}
+	}
+	return nil
+}
+
+// checkStrictPayloadType fails when payloadType, given with --payload-type, is not the type of the mapping
+// of iface at interfacePath
+func checkStrictPayloadType(iface interfaces.AstarteInterface, interfacePath string, payloadType interfaces.AstarteMappingType) error {
+	mapping, err := interfaces.InterfaceMappingFromPath(iface, interfacePath)
+	if err != nil {
+		return err
+	}
+	if mapping.Type != payloadType {
+		return fmt.Errorf("--payload-type %s is not the type of %s, which is %s, %w", payloadType, interfacePath, mapping.Type, errImplicitConversion)
+	}
+	return nil
+}
+
+// parseInteger parses payload as an integer of bitSize bits. Unless strict is set, numbers with a decimal
+// point or an exponent are accepted too, as long as they are whole: they are never truncated.
+func parseInteger(payload string, bitSize int, strict bool) (int64, error) {
+	val, err := strconv.ParseInt(payload, 10, bitSize)
+	if err == nil {
+		return val, nil
+	}
+	f, floatErr := strconv.ParseFloat(payload, 64)
+	if floatErr != nil || f != math.Trunc(f) || f < -math.Pow(2, float64(bitSize-1)) || f >= math.Pow(2, float64(bitSize-1)) {
+		return 0, err
+	}
+	if strict {
+		return 0, fmt.Errorf("%s is not an integer literal, %w", payload, errImplicitConversion)
+	}
+	return int64(f), nil
+}
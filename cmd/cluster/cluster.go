@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/spf13/cobra"
@@ -58,6 +59,7 @@ var (
 	kubernetesClient              *kubernetes.Clientset
 	kubernetesAPIExtensionsClient *apiextensions.Clientset
 	kubernetesDynamicClient       dynamic.Interface
+	kubernetesRestConfig          *rest.Config
 
 	astarteV1Alpha1 = schema.GroupVersionResource{
 		Group:    "api.astarte-platform.org",
@@ -120,6 +122,8 @@ func clusterPersistentPreRunE(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	kubernetesRestConfig = config
+
 	// create the clientsets
 	kubernetesClient, err = kubernetes.NewForConfig(config)
 	if err != nil {
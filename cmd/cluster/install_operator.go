@@ -28,7 +28,9 @@ Since Astarte 1.0, operator installation through astartectl has been removed. Yo
 
 $ helm repo add astarte https://helm.astarte-platform.org
 $ helm repo update
-$ helm install astarte-operator astarte/astarte-operator --version 1.0.0-alpha.1`
+$ helm install astarte-operator astarte/astarte-operator --version 1.0.0-alpha.1
+
+Alternatively, you can use astartectl cluster instances install-operator, which does not require Helm to be configured.`
 
 var installCmd = &cobra.Command{
 	Use:   "install-operator",
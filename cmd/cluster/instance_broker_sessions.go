@@ -0,0 +1,264 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var instanceBrokerSessionsCmd = &cobra.Command{
+	Use:   "broker-sessions <name>",
+	Short: "Shows MQTT sessions on each broker node of an Astarte Instance",
+	Long: `Shows the number of MQTT sessions on each VerneMQ node of an Astarte Instance, which is handy
+when debugging uneven broker load. Sessions are read from the VerneMQ status API, through the Kubernetes API server.
+
+With --device-id and --realm, the node the device is connected to is shown too. This requires permissions
+to exec into VerneMQ pods.`,
+	Example: `  astartectl cluster instances broker-sessions astarte --realm test --device-id 2TBn-jNESuuHamE2Zo1anA`,
+	RunE:    instanceBrokerSessionsF,
+	Args:    cobra.ExactArgs(1),
+}
+
+// vernemqStatusPort is the VerneMQ HTTP port serving status.json
+const vernemqStatusPort = "8888"
+
+// brokerNodeStatus is the status of a VerneMQ node, as reported by status.json
+type brokerNodeStatus struct {
+	NumOnline  int `json:"num_online"`
+	NumOffline int `json:"num_offline"`
+}
+
+func init() {
+	instanceBrokerSessionsCmd.Flags().String("device-id", "", "When set, shows the broker node the device is connected to. Requires --realm.")
+	instanceBrokerSessionsCmd.Flags().String("realm", "", "The realm of the device specified with --device-id.")
+
+	InstancesCmd.AddCommand(instanceBrokerSessionsCmd)
+}
+
+func instanceBrokerSessionsF(command *cobra.Command, args []string) error {
+	resourceName := args[0]
+	resourceNamespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if resourceNamespace == "" {
+		resourceNamespace = "astarte"
+	}
+	deviceID, err := command.Flags().GetString("device-id")
+	if err != nil {
+		return err
+	}
+	realm, err := command.Flags().GetString("realm")
+	if err != nil {
+		return err
+	}
+	if deviceID != "" && realm == "" {
+		return errors.New("--realm is required when --device-id is specified")
+	}
+
+	if _, err := getAstarteInstance(resourceName, resourceNamespace); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
+		os.Exit(1)
+	}
+
+	pods, err := vernemqPods(resourceName, resourceNamespace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(pods) == 0 {
+		fmt.Fprintf(os.Stderr, "No running VerneMQ pods found for instance %s.\n", resourceName)
+		os.Exit(1)
+	}
+
+	// Each node reports the status of the whole cluster, so the first one answering is enough
+	var nodes map[string]brokerNodeStatus
+	for _, pod := range pods {
+		nodes, err = brokerNodesStatus(pod, resourceNamespace)
+		if err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "warn: Could not get broker status from pod %s: %s\n", pod.Name, err)
+	}
+	if nodes == nil {
+		fmt.Fprintln(os.Stderr, "Could not get broker status from any VerneMQ pod.")
+		os.Exit(1)
+	}
+
+	nodeNames := []string{}
+	totalOnline := 0
+	for name, status := range nodes {
+		nodeNames = append(nodeNames, name)
+		totalOnline += status.NumOnline
+	}
+	sort.Strings(nodeNames)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "NODE\tPOD\tONLINE SESSIONS\tOFFLINE SESSIONS\tSHARE OF ONLINE")
+	for _, name := range nodeNames {
+		status := nodes[name]
+		share := 0.0
+		if totalOnline > 0 {
+			share = 100 * float64(status.NumOnline) / float64(totalOnline)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\n", name, podForBrokerNode(name, pods), status.NumOnline, status.NumOffline, share)
+	}
+	w.Flush()
+
+	if deviceID == "" {
+		return nil
+	}
+
+	fmt.Println()
+	clientID := realm + "/" + deviceID
+	node, online, err := brokerNodeForClient(pods[0], resourceNamespace, clientID)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Could not look up the session of %s: %s\n", clientID, err)
+		os.Exit(1)
+	case node == "":
+		fmt.Printf("Device %s has no session on the broker.\n", deviceID)
+	case online:
+		fmt.Printf("Device %s is connected to node %s (pod %s).\n", deviceID, node, podForBrokerNode(node, pods))
+	default:
+		fmt.Printf("Device %s is not connected, its offline session is on node %s (pod %s).\n", deviceID, node, podForBrokerNode(node, pods))
+	}
+
+	return nil
+}
+
+// vernemqPods returns the running VerneMQ pods of an Astarte instance
+func vernemqPods(name, namespace string) ([]corev1.Pod, error) {
+	list, err := kubernetesClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "app=" + name + "-vernemq",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []corev1.Pod{}
+	for _, pod := range list.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			ret = append(ret, pod)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret, nil
+}
+
+// brokerNodesStatus queries the VerneMQ status API of pod through the Kubernetes API server proxy
+func brokerNodesStatus(pod corev1.Pod, namespace string) (map[string]brokerNodeStatus, error) {
+	body, err := kubernetesClient.CoreV1().Pods(namespace).ProxyGet("http", pod.Name, vernemqStatusPort, "status.json", nil).
+		DoRaw(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	// status.json is a list of objects, each mapping node names to their status
+	status := []map[string]brokerNodeStatus{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	ret := map[string]brokerNodeStatus{}
+	for _, s := range status {
+		for node, nodeStatus := range s {
+			ret[node] = nodeStatus
+		}
+	}
+	return ret, nil
+}
+
+// podForBrokerNode returns the name of the pod running a VerneMQ node (e.g. VerneMQ@astarte-vernemq-0.astarte-vernemq.astarte.svc.cluster.local)
+func podForBrokerNode(node string, pods []corev1.Pod) string {
+	host := node
+	if i := strings.Index(node, "@"); i >= 0 {
+		host = node[i+1:]
+	}
+	for _, pod := range pods {
+		if host == pod.Name || strings.HasPrefix(host, pod.Name+".") || host == pod.Status.PodIP {
+			return pod.Name
+		}
+	}
+	return "-"
+}
+
+// brokerNodeForClient looks up the session of clientID with vmq-admin, returning the node holding it
+// (empty if there is none) and whether the client is online.
+func brokerNodeForClient(pod corev1.Pod, namespace, clientID string) (string, bool, error) {
+	req := kubernetesClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: []string{"vmq-admin", "session", "show", "--client_id=" + clientID, "--node", "--is_online"},
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(kubernetesRestConfig, "POST", req.URL())
+	if err != nil {
+		return "", false, err
+	}
+	var stdout, stderr bytes.Buffer
+	if err := executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		if stderr.Len() > 0 {
+			return "", false, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", false, err
+	}
+
+	// vmq-admin prints a table with a header row naming the columns
+	nodeColumn, onlineColumn := -1, -1
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		fields := strings.Split(strings.Trim(line, "|"), "|")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if nodeColumn < 0 {
+			for i, f := range fields {
+				switch f {
+				case "node":
+					nodeColumn = i
+				case "is_online":
+					onlineColumn = i
+				}
+			}
+			continue
+		}
+		if nodeColumn >= len(fields) || onlineColumn < 0 || onlineColumn >= len(fields) {
+			return "", false, fmt.Errorf("unexpected vmq-admin output: %s", line)
+		}
+		return fields[nodeColumn], fields[onlineColumn] == "true", nil
+	}
+	return "", false, nil
+}
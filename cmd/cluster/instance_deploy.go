@@ -58,17 +58,14 @@ func init() {
 	deployCmd.PersistentFlags().String("vernemq-volume-size", "", "The VerneMQ PVC size for this Astarte deployment. If not specified, it will be prompted when deploying.")
 	deployCmd.PersistentFlags().String("storage-class-name", "", "The Kubernetes Storage Class name for this Astarte deployment. If not specified, it will be left empty and the default Storage Class for your Cloud Provider will be used. Keep in mind that with some Cloud Providers, you always need to specify this.")
 	deployCmd.PersistentFlags().Bool("no-ssl", false, "Don't use SSL for the API and Broker endpoints. Strongly not recommended.")
-	deployCmd.PersistentFlags().BoolP("non-interactive", "y", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	utils.AddNonInteractiveFlag(deployCmd.PersistentFlags())
 	deployCmd.PersistentFlags().Bool("burst", false, "Deploy a burst Astarte instance. Only useful in resource-constrained environments, such as CI runners.")
 
 	InstancesCmd.AddCommand(deployCmd)
 }
 
 func clusterDeployF(command *cobra.Command, args []string) error {
-	y, err := command.Flags().GetBool("non-interactive")
-	if err != nil {
-		return err
-	}
+	y := utils.NonInteractive(command)
 	version, err := command.Flags().GetString("version")
 	if err != nil {
 		return err
@@ -120,8 +117,8 @@ func clusterDeployF(command *cobra.Command, args []string) error {
 		}
 		goAhead, _ := utils.AskForConfirmation(fmt.Sprintf("Your Astarte instance \"%s\" will be deployed in namespace \"%s\". Do you want to continue?", resourceName, resourceNamespace))
 		if !goAhead {
-			fmt.Println("Aborting.")
-			os.Exit(0)
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
 		}
 	} else {
 		fmt.Println(string(marshaledResource))
@@ -171,7 +168,7 @@ func clusterDeployF(command *cobra.Command, args []string) error {
 		time.Sleep(5 * time.Second)
 		if _, err = getHousekeepingKey(resourceName, resourceNamespace, false); err == nil {
 			// Delegate this to the get-cluster-config implementation
-			return doGetClusterConfig(resourceName, resourceNamespace)
+			return doGetClusterConfig(resourceName, resourceNamespace, clusterConfigOptions{})
 		}
 	}
 
@@ -0,0 +1,259 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var deployIngressCmd = &cobra.Command{
+	Use:   "deploy-ingress <astarte-name>",
+	Short: "Deploy an AstarteDefaultIngress for an Astarte instance",
+	Long: `Deploy an AstarteDefaultIngress for an Astarte instance, exposing its APIs, Dashboard and Broker.
+
+Settings which are not given as flags are prompted interactively: the TLS secrets of the API and Dashboard
+hosts, whether the Dashboard is served on a dedicated host, whether Housekeeping API and metrics are
+exposed, and the type of the Broker service. The API host is the one in the spec of the Astarte instance.
+As TLS for the Broker is terminated by VerneMQ, a warning is shown when the VerneMQ SSL listener of the
+instance is not enabled.
+
+The resulting resource is validated against the AstarteDefaultIngress CustomResourceDefinition installed by
+the Astarte Operator in the cluster, and shown for review before being created. When --output is given,
+the resource is written to a file rather than created.`,
+	Example: `  astartectl cluster instances deploy-ingress astarte
+  astartectl cluster instances deploy-ingress astarte --api-tls-secret astarte-tls -y -o adi.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: deployIngressF,
+}
+
+func init() {
+	deployIngressCmd.Flags().String("name", "", "The name of the AstarteDefaultIngress. Defaults to <astarte-name>-adi.")
+	deployIngressCmd.Flags().String("ingress-class", "", "The ingress class employed by the AstarteDefaultIngress. Defaults to nginx.")
+	deployIngressCmd.Flags().String("api-tls-secret", "", "The secret holding the TLS certificate and key of the API host.")
+	deployIngressCmd.Flags().String("dashboard-host", "", "When set, the Dashboard is served on this host, rather than on the API host.")
+	deployIngressCmd.Flags().String("dashboard-tls-secret", "", "The secret holding the TLS certificate and key of the Dashboard host. Defaults to the API one.")
+	deployIngressCmd.Flags().Bool("no-dashboard", false, "When set, the Dashboard is not deployed.")
+	deployIngressCmd.Flags().Bool("expose-housekeeping", true, "Whether Housekeeping API is exposed.")
+	deployIngressCmd.Flags().Bool("serve-metrics", false, "Whether the metrics of Astarte services are exposed.")
+	deployIngressCmd.Flags().String("metrics-subnet", "", "When set together with --serve-metrics, metrics are served only to this subnet (e.g. 10.0.0.0/8).")
+	deployIngressCmd.Flags().String("broker-service-type", "", "The type of the Broker service: LoadBalancer or NodePort. Defaults to LoadBalancer.")
+	deployIngressCmd.Flags().StringP("output", "o", "", "When set, the AstarteDefaultIngress is written to this file rather than created.")
+	utils.AddNonInteractiveFlag(deployIngressCmd.Flags())
+
+	InstancesCmd.AddCommand(deployIngressCmd)
+}
+
+func deployIngressF(command *cobra.Command, args []string) error {
+	astarteName := args[0]
+	namespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+	output, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	astarteObj, err := getAstarteInstance(astarteName, namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", astarteName, err.Error())
+		os.Exit(1)
+	}
+	if existing := existingADIsFor(astarteName, namespace); len(existing) > 0 && output == "" {
+		fmt.Fprintf(os.Stderr, "Instance %s already has an AstarteDefaultIngress: %v.\n", astarteName, existing)
+		os.Exit(1)
+	}
+
+	// Check early whether the operator supports AstarteDefaultIngress, before prompting anything
+	crd, err := getCRDForKind(adiV1Alpha1.Group, "AstarteDefaultIngress")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v. AstarteDefaultIngress requires Astarte Operator 1.0 or newer.\n", err)
+		os.Exit(1)
+	}
+	adiSchema, err := crdVersionSchema(crd, adiV1Alpha1.Version)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if apiHost, _, _ := unstructured.NestedString(astarteObj.Object, "spec", "api", "host"); apiHost != "" {
+		fmt.Printf("APIs of %s will be served on %s.\n", astarteName, apiHost)
+	}
+	if sslListener, _, _ := unstructured.NestedBool(astarteObj.Object, "spec", "vernemq", "sslListener"); !sslListener {
+		fmt.Fprintf(os.Stderr, "warn: The VerneMQ SSL listener of %s is not enabled. TLS for the Broker is terminated by VerneMQ: "+
+			"set spec.vernemq.sslListener and spec.vernemq.sslListenerCertSecretName in the Astarte resource.\n", astarteName)
+	}
+
+	adiName := getStringFlagFromPromptOrDie(command, "name", "Choose the AstarteDefaultIngress name:", astarteName+"-adi", false)
+	ingressClass := getStringFlagFromPromptOrDie(command, "ingress-class", "Which ingress class should the AstarteDefaultIngress employ?", "nginx", false)
+
+	apiSpec := map[string]interface{}{"deploy": true}
+	apiTLSSecret := getStringFlagFromPromptOrDie(command, "api-tls-secret",
+		"Insert the name of the secret containing the TLS certificates and keys of the API host (empty for none):", "", true)
+	if apiTLSSecret != "" {
+		apiSpec["tlsSecret"] = apiTLSSecret
+	}
+	apiSpec["exposeHousekeeping"] = getBoolFlagOrConfirmOrDie(command, "expose-housekeeping", "Do you want to expose Housekeeping API?")
+	serveMetrics := getBoolFlagOrConfirmOrDie(command, "serve-metrics", "Do you want to expose the metrics of Astarte services?")
+	apiSpec["serveMetrics"] = serveMetrics
+	if serveMetrics {
+		subnet := getStringFlagFromPromptOrDie(command, "metrics-subnet",
+			"Which subnet should metrics be served to (e.g. 10.0.0.0/8, empty for any)?", "", true)
+		if subnet != "" {
+			apiSpec["serveMetricsToSubnet"] = subnet
+		}
+	}
+
+	dashboardSpec := map[string]interface{}{"deploy": false}
+	noDashboard, err := command.Flags().GetBool("no-dashboard")
+	if err != nil {
+		return err
+	}
+	if !noDashboard {
+		dashboardSpec["deploy"] = true
+		dashboardHost := getStringFlagFromPromptOrDie(command, "dashboard-host",
+			"Insert the Dashboard host (empty to serve it on the API host):", "", true)
+		if dashboardHost != "" {
+			dashboardSpec["host"] = dashboardHost
+			dashboardTLSSecret := getStringFlagFromPromptOrDie(command, "dashboard-tls-secret",
+				"Insert the name of the secret containing the TLS certificates and keys of the Dashboard host (empty for none):", apiTLSSecret, true)
+			dashboardSpec["ssl"] = dashboardTLSSecret != ""
+			if dashboardTLSSecret != "" {
+				dashboardSpec["tlsSecret"] = dashboardTLSSecret
+			}
+		}
+	}
+
+	brokerServiceType := getStringFlagFromPromptOrDie(command, "broker-service-type",
+		"Which type should the Broker service be (LoadBalancer or NodePort)?", "LoadBalancer", false)
+	brokerSpec := map[string]interface{}{"deploy": true, "serviceType": brokerServiceType}
+
+	adiObj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": adiV1Alpha1.GroupVersion().String(),
+		"kind":       "AstarteDefaultIngress",
+		"spec": map[string]interface{}{
+			"astarte":      astarteName,
+			"ingressClass": ingressClass,
+			"api":          apiSpec,
+			"dashboard":    dashboardSpec,
+			"broker":       brokerSpec,
+		},
+	}}
+	adiObj.SetName(adiName)
+	adiObj.SetNamespace(namespace)
+
+	if issues := validateADI(adiObj, adiSchema); len(issues) > 0 {
+		fmt.Fprintln(os.Stderr, "The AstarteDefaultIngress is not valid for the Astarte Operator installed in the cluster:")
+		for _, issue := range issues {
+			fmt.Fprintf(os.Stderr, "  - %s\n", issue)
+		}
+		os.Exit(1)
+	}
+
+	if output != "" {
+		if err := dumpResourceToYAMLFile(adiObj, output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("AstarteDefaultIngress %s written to %s\n", adiName, output)
+		return nil
+	}
+
+	y, _ := unstructuredToYAML(adiObj)
+	fmt.Println("")
+	fmt.Println("The following custom resource will be installed. Review it before proceeding.")
+	fmt.Println(string(y))
+	if !nonInteractive {
+		proceed, err := utils.AskForConfirmation("Do you want to proceed?")
+		if err != nil {
+			return err
+		}
+		if !proceed {
+			fmt.Fprintln(os.Stderr, "Aborting. Nothing has been created.")
+			os.Exit(1)
+		}
+	}
+
+	if err := createADI(adiObj); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("AstarteDefaultIngress %s created successfully\n", adiName)
+	return nil
+}
+
+// existingADIsFor returns the names of the AstarteDefaultIngresses of astarteName, if any
+func existingADIsFor(astarteName, namespace string) []string {
+	ret := []string{}
+	adis, err := kubernetesDynamicClient.Resource(adiV1Alpha1).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return ret
+	}
+	for _, adi := range adis.Items {
+		if astarte, _, _ := unstructured.NestedString(adi.Object, "spec", "astarte"); astarte == astarteName {
+			ret = append(ret, adi.GetName())
+		}
+	}
+	return ret
+}
+
+// validateADI validates the spec of adiObj against the schema of the AstarteDefaultIngress CRD
+func validateADI(adiObj *unstructured.Unstructured, adiSchema *apiextensionsv1.JSONSchemaProps) []string {
+	// Go through JSON, as validation expects the types of decoded JSON
+	j, err := unstructuredToJSON(adiObj)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	resource := map[string]interface{}{}
+	if err := json.Unmarshal(j, &resource); err != nil {
+		return []string{err.Error()}
+	}
+	// metadata is validated by the API server itself
+	delete(resource, "metadata")
+	issues := validateAgainstSchema(resource, adiSchema, "")
+	sort.Strings(issues)
+	return issues
+}
+
+// getBoolFlagOrConfirmOrDie returns the value of a boolean flag, asking for it when it is not given
+// and the command is interactive
+func getBoolFlagOrConfirmOrDie(command *cobra.Command, flagName, question string) bool {
+	ret, err := command.Flags().GetBool(flagName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	nonInteractive := utils.NonInteractive(command)
+	if command.Flags().Changed(flagName) || nonInteractive {
+		return ret
+	}
+
+	if ret, err = utils.AskForConfirmation(question); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return ret
+}
@@ -30,9 +30,10 @@ var destroyCmd = &cobra.Command{
 	Short: "Destroy an Astarte Instance in the current Kubernetes Cluster",
 	Long: `Destroy an Astarte Instance in the current Kubernetes Cluster. This will adhere to the same current-context
 kubectl mentions. Please be aware of the fact that when an Astarte instance is destroyed, there is no way to recover it.`,
-	Example: `  astartectl cluster instances destroy astarte`,
-	RunE:    clusterDestroyF,
-	Args:    cobra.ExactArgs(1),
+	Example: `  astartectl cluster instances destroy astarte
+  astartectl cluster instances destroy astarte --yes --confirm-name astarte`,
+	RunE: clusterDestroyF,
+	Args: cobra.ExactArgs(1),
 	Deprecated: `This command is deprecated and will be removed in future releases.
 Refer to the Astarte documentation on how to remove Astarte from your cluster:
 https://docs.astarte-platform.org/astarte-kubernetes-operator/latest`,
@@ -40,7 +41,8 @@ https://docs.astarte-platform.org/astarte-kubernetes-operator/latest`,
 
 func init() {
 	destroyCmd.PersistentFlags().Bool("delete-volumes", false, "When set, all the Persistent Volume Claims will be destroyed. All data will be lost with no means of recovery.")
-	destroyCmd.PersistentFlags().BoolP("non-interactive", "y", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	destroyCmd.PersistentFlags().String("confirm-name", "", "The name of the Astarte instance being destroyed, to confirm it without being prompted. Required with --yes.")
+	utils.AddNonInteractiveFlag(destroyCmd.PersistentFlags())
 
 	InstancesCmd.AddCommand(destroyCmd)
 }
@@ -65,14 +67,21 @@ func clusterDestroyF(command *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Could not find resource %s in namespace %s.\n", resourceName, resourceNamespace)
 		os.Exit(1)
 	}
-	y, err := command.Flags().GetBool("non-interactive")
+	confirmation, err := command.Flags().GetString("confirm-name")
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if confirmation == "" && utils.NonInteractive(command) {
+		fmt.Fprintln(os.Stderr, "--confirm-name <name> is required to destroy an Astarte instance without being prompted.")
+		os.Exit(1)
 	}
 
 	fmt.Printf("Will destroy Astarte instance %s in namespace %s.\n", resourceName, resourceNamespace)
 	fmt.Println("WARNING: This operation is NOT REVERSIBLE and ALL DATA WILL BE LOST!!!")
-	confirmation, _ := utils.PromptChoice("To continue, please enter the exact name of the Astarte instance you are deleting:", "", true, y)
+	if confirmation == "" {
+		confirmation, _ = utils.PromptChoice("To continue, please enter the exact name of the Astarte instance you are deleting:", "", true, false)
+	}
 	if confirmation != resourceName {
 		fmt.Fprintln(os.Stderr, "Aborting.")
 		os.Exit(1)
@@ -15,6 +15,7 @@
 package cluster
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/url"
@@ -22,6 +23,9 @@ import (
 
 	"github.com/astarte-platform/astartectl/config"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 var getClusterConfigCmd = &cobra.Command{
@@ -29,13 +33,34 @@ var getClusterConfigCmd = &cobra.Command{
 	Short: "Gets the current cluster config for instance <name> and updates your local Astarte configuration",
 	Long: `Fetches the current cluster config for instance <name>, including the Cluster URL and its
 housekeeping key, and adds it to your cluster and context configuration. A new cluster entry
-will be created, together with a new context matching the cluster, without an associated realm.`,
-	Example: `  astartectl cluster instances get-cluster-config`,
-	RunE:    instancesGetClusterConfigF,
-	Args:    cobra.ExactArgs(1),
+will be created, together with a new context matching the cluster, without an associated realm.
+
+The Cluster URL is taken from the Ingress serving the API host of the instance: it is an https URL
+if the Ingress has TLS configured for the host, an http one otherwise. When no such Ingress is
+found, https is assumed. The housekeeping key is read from the instance's generated secret.
+
+Cluster and context are named <name>-<api host>-cluster and <name>-<api host>-global, unless
+--cluster-name and --context-name are specified. When --output is specified, the local configuration
+is left untouched and the cluster and context are written to a bundle instead, which can be
+imported with 'astartectl config import-bundle'.`,
+	Example: `  astartectl cluster instances get-cluster-config astarte
+  astartectl cluster instances get-cluster-config astarte --context-name production -o production.yaml`,
+	RunE: instancesGetClusterConfigF,
+	Args: cobra.ExactArgs(1),
+}
+
+// clusterConfigOptions tweaks how the cluster config of an instance is named and where it is saved
+type clusterConfigOptions struct {
+	clusterName string
+	contextName string
+	output      string
 }
 
 func init() {
+	getClusterConfigCmd.Flags().String("cluster-name", "", "The name of the cluster configuration. Defaults to <name>-<api host>-cluster")
+	getClusterConfigCmd.Flags().String("context-name", "", "The name of the context configuration. Defaults to <name>-<api host>-global")
+	getClusterConfigCmd.Flags().StringP("output", "o", "", "When specified, writes cluster and context to a bundle in the specified file (- for stdout) rather than to the local configuration")
+
 	InstancesCmd.AddCommand(getClusterConfigCmd)
 }
 
@@ -49,25 +74,46 @@ func instancesGetClusterConfigF(command *cobra.Command, args []string) error {
 	if resourceNamespace == "" {
 		resourceNamespace = "astarte"
 	}
+	options := clusterConfigOptions{}
+	if options.clusterName, err = command.Flags().GetString("cluster-name"); err != nil {
+		return err
+	}
+	if options.contextName, err = command.Flags().GetString("context-name"); err != nil {
+		return err
+	}
+	if options.output, err = command.Flags().GetString("output"); err != nil {
+		return err
+	}
 
-	return doGetClusterConfig(resourceName, resourceNamespace)
+	return doGetClusterConfig(resourceName, resourceNamespace, options)
 }
 
-func doGetClusterConfig(resourceName, resourceNamespace string) error {
+func doGetClusterConfig(resourceName, resourceNamespace string, options clusterConfigOptions) error {
 	astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
 		os.Exit(1)
 	}
-	astarteSpec := astarteObject.Object["spec"].(map[string]interface{})
 
-	astarteHost := astarteSpec["api"].(map[string]interface{})["host"].(string)
+	astarteHost, found, err := unstructured.NestedString(astarteObject.Object, "spec", "api", "host")
+	if err != nil || !found || astarteHost == "" {
+		fmt.Fprintf(os.Stderr, "Instance %s has no API host set in its spec.\n", resourceName)
+		os.Exit(1)
+	}
 	astarteURL := url.URL{
-		Host:   astarteSpec["api"].(map[string]interface{})["host"].(string),
-		Scheme: "https",
+		Host:   astarteHost,
+		Scheme: apiSchemeFromIngress(astarteHost, resourceNamespace),
 	}
+	warnIfHousekeepingNotExposed(resourceName, resourceNamespace)
 
-	clusterName := fmt.Sprintf("%s-%s-cluster", resourceName, astarteHost)
+	clusterName := options.clusterName
+	if clusterName == "" {
+		clusterName = fmt.Sprintf("%s-%s-cluster", resourceName, astarteHost)
+	}
+	contextName := options.contextName
+	if contextName == "" {
+		contextName = fmt.Sprintf("%s-%s-global", resourceName, astarteHost)
+	}
 
 	// Fetch key
 	keyData, err := getHousekeepingKey(resourceName, resourceNamespace, false)
@@ -82,6 +128,13 @@ func doGetClusterConfig(resourceName, resourceNamespace string) error {
 			Key: base64.StdEncoding.EncodeToString(keyData),
 		},
 	}
+	contextConfig := config.ContextFile{
+		Cluster: clusterName,
+	}
+
+	if options.output != "" {
+		return writeClusterConfigBundle(options.output, clusterName, clusterConfig, contextName, contextConfig)
+	}
 
 	configDir := config.GetConfigDir()
 
@@ -92,10 +145,6 @@ func doGetClusterConfig(resourceName, resourceNamespace string) error {
 	fmt.Printf("Created new Cluster configuration %s\n", clusterName)
 
 	// Add a Context now
-	contextName := fmt.Sprintf("%s-%s-global", resourceName, astarteHost)
-	contextConfig := config.ContextFile{
-		Cluster: clusterName,
-	}
 	if err := config.SaveContextConfiguration(configDir, contextName, contextConfig, true); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -108,3 +157,78 @@ func doGetClusterConfig(resourceName, resourceNamespace string) error {
 
 	return nil
 }
+
+// apiSchemeFromIngress returns the scheme Astarte APIs are served with on host, according to the
+// Ingress in namespace serving it. https is returned when no such Ingress can be found.
+func apiSchemeFromIngress(host, namespace string) string {
+	ingresses, err := kubernetesClient.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: Could not list Ingresses in namespace %s, assuming https: %s\n", namespace, err)
+		return "https"
+	}
+	for _, ingress := range ingresses.Items {
+		servesHost := false
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host == host {
+				servesHost = true
+				break
+			}
+		}
+		if !servesHost {
+			continue
+		}
+		for _, tls := range ingress.Spec.TLS {
+			for _, tlsHost := range tls.Hosts {
+				if tlsHost == host {
+					return "https"
+				}
+			}
+		}
+		fmt.Fprintf(os.Stderr, "warn: Ingress %s serves %s without TLS, using http\n", ingress.Name, host)
+		return "http"
+	}
+	fmt.Fprintf(os.Stderr, "warn: No Ingress serving %s found in namespace %s, assuming https\n", host, namespace)
+	return "https"
+}
+
+// warnIfHousekeepingNotExposed warns when the AstarteDefaultIngress of the instance, if any, does not
+// expose Housekeeping API, as the cluster configuration would be of little use
+func warnIfHousekeepingNotExposed(name, namespace string) {
+	adis, err := kubernetesDynamicClient.Resource(adiV1Alpha1).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for _, adi := range adis.Items {
+		if astarte, _, _ := unstructured.NestedString(adi.Object, "spec", "astarte"); astarte != name {
+			continue
+		}
+		if expose, found, _ := unstructured.NestedBool(adi.Object, "spec", "api", "exposeHousekeeping"); found && !expose {
+			fmt.Fprintf(os.Stderr, "warn: AstarteDefaultIngress %s does not expose Housekeeping API, the cluster won't be usable for housekeeping commands\n", adi.GetName())
+		}
+		return
+	}
+}
+
+func writeClusterConfigBundle(output, clusterName string, clusterConfig config.ClusterFile, contextName string, contextConfig config.ContextFile) error {
+	bundle := config.Bundle{
+		Clusters: map[string]config.ClusterFile{clusterName: clusterConfig},
+		Contexts: map[string]config.ContextFile{contextName: contextConfig},
+	}
+	yamlBytes, err := yaml.Marshal(bundle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if output == "-" {
+		fmt.Print(string(yamlBytes))
+		return nil
+	}
+	// The bundle contains the housekeeping key
+	if err := os.WriteFile(output, yamlBytes, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Cluster %s and context %s written to %s\n", clusterName, contextName, output)
+	return nil
+}
@@ -0,0 +1,373 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var instanceHealthCmd = &cobra.Command{
+	Use:   "health <name>",
+	Short: "Diagnoses the health of an Astarte Instance",
+	Long: `Diagnoses the health of an Astarte Instance, inspecting the status conditions of its resource, the
+readiness of its Deployments and StatefulSets, pending or crashing pods, recent warning events, the expiry of
+its certificates (including the CFSSL CA) and its RabbitMQ and Cassandra connection secrets.
+
+Each check is either green, yellow or red, and the overall health is the worst of them. The command exits with
+status 1 when the overall health is red. Use --output json for monitoring integrations.`,
+	Example: `  astartectl cluster instances health astarte`,
+	RunE:    instanceHealthF,
+	Args:    cobra.ExactArgs(1),
+}
+
+const (
+	healthGreen  = "green"
+	healthYellow = "yellow"
+	healthRed    = "red"
+
+	// certificateExpiryWarning is how long before expiry certificates are reported as yellow
+	certificateExpiryWarning = 30 * 24 * time.Hour
+	// recentEventsWindow is how far back warning events are looked for
+	recentEventsWindow = time.Hour
+)
+
+// healthCheck is the result of a single check of instances health
+type healthCheck struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+// instanceHealth is the result of instances health
+type instanceHealth struct {
+	Instance string        `json:"instance"`
+	Status   string        `json:"status"`
+	Checks   []healthCheck `json:"checks"`
+}
+
+func init() {
+	instanceHealthCmd.Flags().StringP("output", "o", "default", "The type of output (default,json)")
+
+	InstancesCmd.AddCommand(instanceHealthCmd)
+}
+
+func instanceHealthF(command *cobra.Command, args []string) error {
+	resourceName := args[0]
+	resourceNamespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if resourceNamespace == "" {
+		resourceNamespace = "astarte"
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if outputType != "default" && outputType != "json" {
+		return fmt.Errorf("%s is not a supported output type. Supported output types are default and json", outputType)
+	}
+
+	astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
+		os.Exit(1)
+	}
+
+	health := instanceHealth{Instance: resourceName, Status: healthGreen}
+	health.Checks = append(health.Checks, checkResourceConditions(astarteObject)...)
+	health.Checks = append(health.Checks, checkWorkloadsReadiness(resourceName, resourceNamespace)...)
+	health.Checks = append(health.Checks, checkPods(resourceName, resourceNamespace)...)
+	health.Checks = append(health.Checks, checkRecentEvents(resourceName, resourceNamespace)...)
+	health.Checks = append(health.Checks, checkCertificates(resourceName, resourceNamespace)...)
+	health.Checks = append(health.Checks, checkConnectionSecrets(astarteObject, resourceNamespace)...)
+	for _, c := range health.Checks {
+		health.Status = worstHealth(health.Status, c.Status)
+	}
+
+	if outputType == "json" {
+		out, err := json.MarshalIndent(health, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	} else {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.SetStyle(table.StyleLight)
+		t.AppendHeader(table.Row{"Check", "Status", "Details"})
+		for _, c := range health.Checks {
+			t.AppendRow(table.Row{c.Check, c.Status, c.Details})
+		}
+		t.Render()
+		fmt.Printf("\nOverall health of %s: %s\n", resourceName, health.Status)
+	}
+
+	if health.Status == healthRed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func worstHealth(a, b string) string {
+	rank := map[string]int{healthGreen: 0, healthYellow: 1, healthRed: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+func checkResourceConditions(astarteObject *unstructured.Unstructured) []healthCheck {
+	ret := []healthCheck{}
+	if health, found, _ := unstructured.NestedString(astarteObject.Object, "status", "health"); found {
+		ret = append(ret, healthCheck{"Resource health", health, "As reported by Astarte Operator"})
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(astarteObject.Object, "status", "conditions")
+	for _, rawCondition := range conditions {
+		condition, ok := rawCondition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		status := healthYellow
+		switch condition["status"] {
+		case "True":
+			status = healthGreen
+		case "False":
+			status = healthRed
+		}
+		details := fmt.Sprintf("%v", condition["status"])
+		if reason, ok := condition["reason"].(string); ok && reason != "" {
+			details += ": " + reason
+		}
+		if message, ok := condition["message"].(string); ok && message != "" {
+			details += " - " + message
+		}
+		ret = append(ret, healthCheck{fmt.Sprintf("Condition %v", condition["type"]), status, details})
+	}
+
+	if len(ret) == 0 {
+		ret = append(ret, healthCheck{"Resource conditions", healthYellow, "The resource reports no status conditions"})
+	}
+	return ret
+}
+
+func replicasHealth(kind, name string, desired, ready int32) healthCheck {
+	status := healthGreen
+	switch {
+	case desired > 0 && ready == 0:
+		status = healthRed
+	case ready < desired:
+		status = healthYellow
+	}
+	return healthCheck{fmt.Sprintf("%s %s", kind, name), status, fmt.Sprintf("%d/%d replicas ready", ready, desired)}
+}
+
+func checkWorkloadsReadiness(name, namespace string) []healthCheck {
+	ret := []healthCheck{}
+	deployments, err := kubernetesClient.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return []healthCheck{{"Deployments", healthRed, fmt.Sprintf("Could not list Deployments: %s", err)}}
+	}
+	for _, d := range deployments.Items {
+		if !strings.HasPrefix(d.Name, name+"-") {
+			continue
+		}
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		ret = append(ret, replicasHealth("Deployment", d.Name, desired, d.Status.ReadyReplicas))
+	}
+
+	statefulSets, err := kubernetesClient.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return append(ret, healthCheck{"StatefulSets", healthRed, fmt.Sprintf("Could not list StatefulSets: %s", err)})
+	}
+	for _, s := range statefulSets.Items {
+		if !strings.HasPrefix(s.Name, name+"-") {
+			continue
+		}
+		desired := int32(1)
+		if s.Spec.Replicas != nil {
+			desired = *s.Spec.Replicas
+		}
+		ret = append(ret, replicasHealth("StatefulSet", s.Name, desired, s.Status.ReadyReplicas))
+	}
+	return ret
+}
+
+func checkPods(name, namespace string) []healthCheck {
+	pods, err := kubernetesClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return []healthCheck{{"Pods", healthRed, fmt.Sprintf("Could not list Pods: %s", err)}}
+	}
+
+	pending, crashing := []string{}, []string{}
+	for _, pod := range pods.Items {
+		if !strings.HasPrefix(pod.Name, name+"-") {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodPending {
+			pending = append(pending, pod.Name)
+		}
+		for _, c := range pod.Status.ContainerStatuses {
+			if c.State.Waiting != nil && c.State.Waiting.Reason == "CrashLoopBackOff" {
+				crashing = append(crashing, pod.Name)
+				break
+			}
+		}
+	}
+
+	ret := []healthCheck{}
+	if len(pending) > 0 {
+		ret = append(ret, healthCheck{"Pending pods", healthYellow, strings.Join(pending, ", ")})
+	} else {
+		ret = append(ret, healthCheck{"Pending pods", healthGreen, "None"})
+	}
+	if len(crashing) > 0 {
+		ret = append(ret, healthCheck{"Crashing pods", healthRed, strings.Join(crashing, ", ")})
+	} else {
+		ret = append(ret, healthCheck{"Crashing pods", healthGreen, "None"})
+	}
+	return ret
+}
+
+func checkRecentEvents(name, namespace string) []healthCheck {
+	events, err := kubernetesClient.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: "type=Warning"})
+	if err != nil {
+		return []healthCheck{{"Warning events", healthYellow, fmt.Sprintf("Could not list Events: %s", err)}}
+	}
+
+	reasons := map[string]int{}
+	since := time.Now().Add(-recentEventsWindow)
+	for _, e := range events.Items {
+		if !strings.HasPrefix(e.InvolvedObject.Name, name) {
+			continue
+		}
+		lastSeen := e.LastTimestamp.Time
+		if lastSeen.IsZero() {
+			lastSeen = e.EventTime.Time
+		}
+		if lastSeen.Before(since) {
+			continue
+		}
+		reasons[e.Reason] += int(e.Count)
+		if e.Count == 0 {
+			reasons[e.Reason]++
+		}
+	}
+
+	if len(reasons) == 0 {
+		return []healthCheck{{"Warning events", healthGreen, fmt.Sprintf("None in the last %s", recentEventsWindow)}}
+	}
+	details := []string{}
+	for reason, count := range reasons {
+		details = append(details, fmt.Sprintf("%s (%d)", reason, count))
+	}
+	sort.Strings(details)
+	return []healthCheck{{"Warning events", healthYellow, fmt.Sprintf("In the last %s: %s", recentEventsWindow, strings.Join(details, ", "))}}
+}
+
+func checkCertificates(name, namespace string) []healthCheck {
+	secrets, err := kubernetesClient.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return []healthCheck{{"Certificates", healthYellow, fmt.Sprintf("Could not list Secrets: %s", err)}}
+	}
+
+	ret := []healthCheck{}
+	for _, secret := range secrets.Items {
+		if !strings.HasPrefix(secret.Name, name+"-") {
+			continue
+		}
+		keys := []string{}
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			block, _ := pem.Decode(secret.Data[k])
+			if block == nil || block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			remaining := time.Until(cert.NotAfter)
+			status := healthGreen
+			switch {
+			case remaining <= 0:
+				status = healthRed
+			case remaining < certificateExpiryWarning:
+				status = healthYellow
+			}
+			ret = append(ret, healthCheck{fmt.Sprintf("Certificate %s/%s", secret.Name, k), status,
+				fmt.Sprintf("%s, expires on %s", cert.Subject.CommonName, utils.FormatTimestamp(cert.NotAfter, time.RFC3339))})
+		}
+	}
+	return ret
+}
+
+func checkConnectionSecrets(astarteObject *unstructured.Unstructured, namespace string) []healthCheck {
+	ret := []healthCheck{}
+	for _, component := range []string{"rabbitmq", "cassandra"} {
+		checkName := map[string]string{"rabbitmq": "RabbitMQ", "cassandra": "Cassandra"}[component] + " connection secret"
+		secretName, found, _ := unstructured.NestedString(astarteObject.Object, "spec", component, "connection", "secret", "name")
+		if !found || secretName == "" {
+			ret = append(ret, healthCheck{checkName, healthGreen, "No secret configured"})
+			continue
+		}
+
+		secret, err := kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+		if err != nil {
+			ret = append(ret, healthCheck{checkName, healthRed, fmt.Sprintf("Secret %s: %s", secretName, err)})
+			continue
+		}
+		missing := []string{}
+		for _, field := range []string{"usernameKey", "passwordKey"} {
+			key, _, _ := unstructured.NestedString(astarteObject.Object, "spec", component, "connection", "secret", field)
+			if key == "" {
+				key = strings.TrimSuffix(field, "Key")
+			}
+			if len(secret.Data[key]) == 0 {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			ret = append(ret, healthCheck{checkName, healthRed, fmt.Sprintf("Secret %s lacks %s", secretName, strings.Join(missing, ", "))})
+		} else {
+			ret = append(ret, healthCheck{checkName, healthGreen, fmt.Sprintf("Secret %s holds credentials", secretName)})
+		}
+	}
+	return ret
+}
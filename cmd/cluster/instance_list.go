@@ -0,0 +1,191 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+var instanceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the Astarte Instances in the current Kubernetes Cluster",
+	Long: `Lists the Astarte Instances in the current Kubernetes Cluster. Instances in all namespaces are listed,
+unless --namespace is specified.
+
+With --output json or yaml, the operator status, version, deployment profile, health and resource
+allocations of each instance are printed, for dashboards polling the state of the cluster.`,
+	Example: `  astartectl cluster instances list -o json`,
+	RunE:    instanceListF,
+	Args:    cobra.NoArgs,
+	Aliases: []string{"ls"},
+}
+
+// instanceSummary describes an Astarte Instance, as printed by instances list and show
+type instanceSummary struct {
+	Name                string `json:"name"`
+	Namespace           string `json:"namespace"`
+	Version             string `json:"version"`
+	OperatorStatus      string `json:"operatorStatus"`
+	OperatorVersion     string `json:"operatorVersion,omitempty"`
+	Health              string `json:"health,omitempty"`
+	ManagedByAstartectl bool   `json:"managedByAstartectl"`
+	DeploymentProfile   string `json:"deploymentProfile,omitempty"`
+	// Resources holds the resource requests and limits set in the spec, by component (e.g. components.dataUpdaterPlant)
+	Resources map[string]interface{} `json:"resources,omitempty"`
+}
+
+func init() {
+	instanceListCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default", "json", "yaml"))
+
+	InstancesCmd.AddCommand(instanceListCmd)
+}
+
+func instanceListF(command *cobra.Command, args []string) error {
+	outputType, err := instanceOutputTypeFromFlags(command)
+	if err != nil {
+		return err
+	}
+	namespace := ""
+	if command.Flags().Changed("namespace") {
+		if namespace, err = command.Flags().GetString("namespace"); err != nil {
+			return err
+		}
+	}
+
+	astartes, err := listAstartes(namespace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// The same instance may be served by several versions of the CRD
+	summaries := []instanceSummary{}
+	seen := map[string]bool{}
+	for _, v := range astartes {
+		for _, res := range v.Items {
+			key := res.GetNamespace() + "/" + res.GetName()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			summaries = append(summaries, summarizeInstance(res))
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Namespace != summaries[j].Namespace {
+			return summaries[i].Namespace < summaries[j].Namespace
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	if outputType != "default" {
+		return printInstanceOutput(summaries, outputType)
+	}
+	if len(summaries) == 0 {
+		fmt.Println("No Astarte Instances found.")
+		return nil
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Name", "Namespace", "Version", "Operator Status", "Health", "Deployment Profile"})
+	for _, s := range summaries {
+		t.AppendRow(table.Row{s.Name, s.Namespace, s.Version, s.OperatorStatus, s.Health, s.DeploymentProfile})
+	}
+	t.Render()
+	return nil
+}
+
+func instanceOutputTypeFromFlags(command *cobra.Command) (string, error) {
+	outputType, _, err := utils.OutputFromFlags(command, "default", "json", "yaml")
+	return outputType, err
+}
+
+// summarizeInstance returns the summary of an Astarte resource
+func summarizeInstance(res unstructured.Unstructured) instanceSummary {
+	operatorStatus, deploymentManager, deploymentProfile := getManagedAstarteResourceStatus(res)
+	summary := instanceSummary{
+		Name:                res.GetName(),
+		Namespace:           res.GetNamespace(),
+		OperatorStatus:      operatorStatus,
+		ManagedByAstartectl: deploymentManager == "astartectl",
+		DeploymentProfile:   deploymentProfile,
+		Resources:           map[string]interface{}{},
+	}
+	summary.Version, _, _ = unstructured.NestedString(res.Object, "spec", "version")
+	summary.OperatorVersion, _, _ = unstructured.NestedString(res.Object, "status", "operatorVersion")
+	summary.Health, _, _ = unstructured.NestedString(res.Object, "status", "health")
+	if spec, ok := res.Object["spec"].(map[string]interface{}); ok {
+		collectResources(spec, nil, summary.Resources)
+	}
+	return summary
+}
+
+// collectResources looks for resources (i.e. requests and limits) in spec, storing them in ret by their path
+func collectResources(spec map[string]interface{}, specPath []string, ret map[string]interface{}) {
+	for k, v := range spec {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if k == "resources" {
+			_, hasRequests := child["requests"]
+			_, hasLimits := child["limits"]
+			if hasRequests || hasLimits {
+				component := strings.Join(specPath, ".")
+				if component == "" {
+					component = "."
+				}
+				ret[component] = child
+				continue
+			}
+		}
+		collectResources(child, append(append([]string{}, specPath...), k), ret)
+	}
+}
+
+func printInstanceOutput(v interface{}, outputType string) error {
+	if utils.IsTemplateOutput(outputType) {
+		templateOutput, err := utils.NewTemplateOutput(outputType)
+		if err != nil {
+			return err
+		}
+		utils.PrintTemplateOutput(templateOutput, v)
+		return nil
+	}
+	var out []byte
+	var err error
+	if outputType == "yaml" {
+		out, err = yaml.Marshal(v)
+	} else {
+		out, err = json.MarshalIndent(v, "", "  ")
+		out = append(out, '\n')
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(string(out))
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var instanceLogsCmd = &cobra.Command{
+	Use:   "logs <name> [component]",
+	Short: "Shows logs of the components of an Astarte Instance",
+	Long: `Shows logs of the pods of an Astarte Instance, or only of one of its components. Logs of multiple
+pods are multiplexed, and each line is prefixed with the name of its pod.
+
+Components can be specified either by their full name (e.g. appengine-api) or by their short name: appengine,
+dup, housekeeping, pairing, realm-management, trigger-engine, vernemq, cfssl, rabbitmq, cassandra, flow and dashboard.`,
+	Example: `  astartectl cluster instances logs astarte dup --since 10m --follow`,
+	RunE:    instanceLogsF,
+	Args:    cobra.RangeArgs(1, 2),
+}
+
+// astarteComponentNames maps short component names to the ones used in pod names
+var astarteComponentNames = map[string]string{
+	"appengine":        "appengine-api",
+	"dup":              "data-updater-plant",
+	"housekeeping":     "housekeeping-api",
+	"pairing":          "pairing-api",
+	"realm-management": "realm-management-api",
+}
+
+func init() {
+	instanceLogsCmd.Flags().BoolP("follow", "f", false, "When set, keeps streaming logs.")
+	instanceLogsCmd.Flags().Duration("since", 0, "When set, shows only logs newer than the given duration, e.g. 10m.")
+	instanceLogsCmd.Flags().Int64("tail", -1, "When set, shows only the given number of most recent lines of each pod.")
+	instanceLogsCmd.Flags().StringP("container", "c", "", "When set, shows logs of the given container rather than the first one of each pod.")
+
+	InstancesCmd.AddCommand(instanceLogsCmd)
+}
+
+func instanceLogsF(command *cobra.Command, args []string) error {
+	resourceName := args[0]
+	resourceNamespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if resourceNamespace == "" {
+		resourceNamespace = "astarte"
+	}
+	follow, err := command.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	since, err := command.Flags().GetDuration("since")
+	if err != nil {
+		return err
+	}
+	tail, err := command.Flags().GetInt64("tail")
+	if err != nil {
+		return err
+	}
+	container, err := command.Flags().GetString("container")
+	if err != nil {
+		return err
+	}
+
+	podPrefix := resourceName + "-"
+	if len(args) > 1 {
+		component := args[1]
+		if fullName, ok := astarteComponentNames[component]; ok {
+			component = fullName
+		}
+		podPrefix += component + "-"
+	}
+
+	if _, err := getAstarteInstance(resourceName, resourceNamespace); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
+		os.Exit(1)
+	}
+	podList, err := kubernetesClient.CoreV1().Pods(resourceNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	pods := []corev1.Pod{}
+	for _, pod := range podList.Items {
+		if strings.HasPrefix(pod.Name, podPrefix) && pod.Status.Phase != corev1.PodPending {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		fmt.Fprintf(os.Stderr, "No pods found matching %s*.\n", podPrefix)
+		os.Exit(1)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	logOptions := corev1.PodLogOptions{Follow: follow, Container: container}
+	if since > 0 {
+		sinceSeconds := int64(since / time.Second)
+		logOptions.SinceSeconds = &sinceSeconds
+	}
+	if tail >= 0 {
+		logOptions.TailLines = &tail
+	}
+
+	// Pad prefixes, so that lines of different pods are aligned
+	prefixWidth := 0
+	for _, pod := range pods {
+		if len(pod.Name) > prefixWidth {
+			prefixWidth = len(pod.Name)
+		}
+	}
+
+	var outputMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod corev1.Pod) {
+			defer wg.Done()
+			if err := streamPodLogs(pod, resourceNamespace, logOptions, fmt.Sprintf("[%-*s] ", prefixWidth, pod.Name), &outputMutex); err != nil {
+				fmt.Fprintf(os.Stderr, "warn: Could not get logs of pod %s: %s\n", pod.Name, err)
+			}
+		}(pod)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// streamPodLogs prints the logs of pod, prefixing each line with prefix
+func streamPodLogs(pod corev1.Pod, namespace string, logOptions corev1.PodLogOptions, prefix string, outputMutex *sync.Mutex) error {
+	stream, err := kubernetesClient.CoreV1().Pods(namespace).GetLogs(pod.Name, &logOptions).Stream(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	// Log lines can be long, e.g. with stacktraces
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		outputMutex.Lock()
+		fmt.Println(prefix + scanner.Text())
+		outputMutex.Unlock()
+	}
+	return scanner.Err()
+}
@@ -163,13 +163,14 @@ func replaceVoyagerF(command *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("You are about to migrate the AstarteVoyagerIngress named: %s. ", aviObject.GetName())
-	shouldMigrate, err := utils.AskForConfirmation("Are you sure?")
+	nonInteractive := utils.NonInteractive(command)
+	shouldMigrate, err := utils.Confirm(command, "Are you sure?")
 	if err != nil {
 		return err
 	}
 	if !shouldMigrate {
-		fmt.Println("Ok, nothing left to do here.")
-		os.Exit(0)
+		fmt.Fprintln(os.Stderr, "Aborting. Nothing has been migrated.")
+		os.Exit(1)
 	}
 
 	// if required, dump the avi custom resource
@@ -181,27 +182,27 @@ func replaceVoyagerF(command *cobra.Command, args []string) error {
 		}
 	}
 
-	adiName, err := utils.PromptChoice("Choose the new AstarteDefaultIngress name:", "adi", false, false)
+	adiName, err := utils.PromptChoice("Choose the new AstarteDefaultIngress name:", "adi", false, nonInteractive)
 	if err != nil {
 		return err
 	}
 
 	// We are not checking if the secrets are present in the cluster: if they are not, the validation webhook will return an error
-	apiSecretName, err := utils.PromptChoice("Insert the name of the secret containing the TLS certificates and keys to connect to the Astarte API and Dashboard:", "", false, false)
+	apiSecretName, err := utils.PromptChoice("Insert the name of the secret containing the TLS certificates and keys to connect to the Astarte API and Dashboard:", "", false, nonInteractive)
 	if err != nil {
-		return nil
+		return err
 	}
-	brokerSecretName, err := utils.PromptChoice("Insert the name of the secret containing the TLS certificates and keys to connect to the Astarte Broker:", "", false, false)
+	brokerSecretName, err := utils.PromptChoice("Insert the name of the secret containing the TLS certificates and keys to connect to the Astarte Broker:", "", false, nonInteractive)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	ingressClass, err := utils.PromptChoice("Which ingress class should the AstarteDefaultIngress employ?", "nginx", false, false)
+	ingressClass, err := utils.PromptChoice("Which ingress class should the AstarteDefaultIngress employ?", "nginx", false, nonInteractive)
 	if err != nil {
 		return err
 	}
 
-	if err := migrateAVIToADI(aviObject, adiName, ingressClass, apiSecretName, brokerSecretName); err != nil {
+	if err := migrateAVIToADI(aviObject, adiName, ingressClass, apiSecretName, brokerSecretName, nonInteractive); err != nil {
 		return err
 	}
 
@@ -273,7 +274,7 @@ func updateAstarteVernemqTLSConfig(astarteObj *unstructured.Unstructured, secret
 	return nil
 }
 
-func migrateAVIToADI(aviObj *unstructured.Unstructured, adiName, ingressClass, apiSecretName, brokerSecretName string) error {
+func migrateAVIToADI(aviObj *unstructured.Unstructured, adiName, ingressClass, apiSecretName, brokerSecretName string, nonInteractive bool) error {
 	adiObj := &unstructured.Unstructured{}
 
 	adiObj.SetName(adiName)
@@ -327,7 +328,7 @@ func migrateAVIToADI(aviObj *unstructured.Unstructured, adiName, ingressClass, a
 	}
 
 	// check settings before proceeding
-	if err := reviewADIAndConfirmMigration(adiObj); err != nil {
+	if err := reviewADIAndConfirmMigration(adiObj, nonInteractive); err != nil {
 		return err
 	}
 
@@ -368,20 +369,23 @@ func migrateAVIToADI(aviObj *unstructured.Unstructured, adiName, ingressClass, a
 	return nil
 }
 
-func reviewADIAndConfirmMigration(adiObj *unstructured.Unstructured) error {
+func reviewADIAndConfirmMigration(adiObj *unstructured.Unstructured, nonInteractive bool) error {
 	y, _ := unstructuredToYAML(adiObj)
 
 	fmt.Println("")
 	fmt.Println("The following custom resource will be installed. Review it before proceeding.")
 	fmt.Println(string(y))
 
+	if nonInteractive {
+		return nil
+	}
 	proceed, err := utils.AskForConfirmation("Do you want to proceed with the migration?")
 	if err != nil {
 		return err
 	}
 	if !proceed {
-		fmt.Println("Aborting the migration procedure. Your Astarte instance has NOT been modified.")
-		os.Exit(0)
+		fmt.Fprintln(os.Stderr, "Aborting the migration procedure. Your Astarte instance has NOT been modified.")
+		os.Exit(1)
 	}
 	return nil
 }
@@ -0,0 +1,540 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	operatorRepo = "astarte-kubernetes-operator"
+	// operatorReleaseManifestsURL is the URL of the manifests attached to Astarte Operator releases,
+	// given the version and the name of the asset
+	operatorReleaseManifestsURL = "https://github.com/astarte-platform/" + operatorRepo + "/releases/download/v%s/%s"
+	operatorFieldManager        = "astartectl"
+	// operatorManifestsDownloadTimeout is the maximum time to download manifests from a URL
+	operatorManifestsDownloadTimeout = 2 * time.Minute
+)
+
+var installOperatorCmd = &cobra.Command{
+	Use:   "install-operator",
+	Short: "Install Astarte Operator in the current Kubernetes Cluster",
+	Long: `Install Astarte Operator in the current Kubernetes Cluster, without the need of configuring Helm.
+
+By default, the manifests attached to the Astarte Operator release on GitHub are used (the latest release, unless
+--version is specified). Alternatively, manifests can be read from a file or a URL with --manifests, or rendered
+from an OCI Helm chart with --chart: in the latter case, the helm binary is used to render the chart, but no Helm
+repository has to be configured.
+
+Manifests are rendered for the namespace given by --operator-namespace and applied with server-side apply.
+Use --dry-run to print the rendered manifests rather than applying them.`,
+	Example: `  astartectl cluster instances install-operator --version 24.5.0
+  astartectl cluster instances install-operator --chart oci://ghcr.io/astarte-platform/charts/astarte-operator --version 24.5.0`,
+	RunE: installOperatorF,
+	Args: cobra.NoArgs,
+}
+
+var upgradeOperatorInstancesCmd = &cobra.Command{
+	Use:   "upgrade-operator",
+	Short: "Upgrade Astarte Operator in the current Kubernetes Cluster",
+	Long: `Upgrade Astarte Operator in the current Kubernetes Cluster, without the need of configuring Helm.
+
+Manifests are fetched and rendered as in install-operator, and applied over the running Astarte Operator, which
+must already be installed. Downgrades are not allowed.`,
+	Example: `  astartectl cluster instances upgrade-operator --version 24.5.1 --wait`,
+	RunE:    upgradeOperatorInstancesF,
+	Args:    cobra.NoArgs,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{installOperatorCmd, upgradeOperatorInstancesCmd} {
+		c.Flags().String("version", "", "The Astarte Operator version. Defaults to the latest release.")
+		c.Flags().String("operator-name", "astarte-operator-controller-manager", "The name of the Astarte Operator instance.")
+		c.Flags().String("operator-namespace", "kube-system", "The namespace in which the Astarte Operator resides.")
+		c.Flags().String("manifests", "", "A file or a URL with the manifests to apply, rather than the ones attached to the release.")
+		c.Flags().String("manifests-asset", "astarte-operator.yaml", "The name of the manifests asset attached to Astarte Operator releases on GitHub.")
+		c.Flags().String("manifests-sha256", "", "The SHA-256 checksum the manifests must have, in hex. When not set, the checksum of downloaded manifests is printed, to be pinned.")
+		c.Flags().String("chart", "", "An OCI Helm chart to render the manifests from (e.g. oci://ghcr.io/astarte-platform/charts/astarte-operator). Requires the helm binary.")
+		c.Flags().Bool("dry-run", false, "When set, print the rendered manifests rather than applying them.")
+		c.Flags().Bool("wait", false, "When set, wait for Astarte Operator to be rolled out.")
+		c.Flags().Duration("wait-timeout", 5*time.Minute, "The maximum time to wait for Astarte Operator to be rolled out, when --wait is set.")
+		utils.AddNonInteractiveFlag(c.Flags())
+
+		InstancesCmd.AddCommand(c)
+	}
+}
+
+// operatorManifestsOptions are the options shared by install-operator and upgrade-operator
+type operatorManifestsOptions struct {
+	version           string
+	operatorName      string
+	operatorNamespace string
+	manifests         string
+	manifestsAsset    string
+	manifestsSHA256   string
+	chart             string
+	dryRun            bool
+	wait              bool
+	waitTimeout       time.Duration
+	nonInteractive    bool
+}
+
+func operatorManifestsOptionsFromFlags(command *cobra.Command) (operatorManifestsOptions, error) {
+	var err error
+	o := operatorManifestsOptions{}
+	if o.version, err = command.Flags().GetString("version"); err != nil {
+		return o, err
+	}
+	if o.operatorName, err = command.Flags().GetString("operator-name"); err != nil {
+		return o, err
+	}
+	if o.operatorNamespace, err = command.Flags().GetString("operator-namespace"); err != nil {
+		return o, err
+	}
+	if o.manifests, err = command.Flags().GetString("manifests"); err != nil {
+		return o, err
+	}
+	if o.manifestsAsset, err = command.Flags().GetString("manifests-asset"); err != nil {
+		return o, err
+	}
+	if o.manifestsSHA256, err = command.Flags().GetString("manifests-sha256"); err != nil {
+		return o, err
+	}
+	if o.chart, err = command.Flags().GetString("chart"); err != nil {
+		return o, err
+	}
+	if o.dryRun, err = command.Flags().GetBool("dry-run"); err != nil {
+		return o, err
+	}
+	if o.wait, err = command.Flags().GetBool("wait"); err != nil {
+		return o, err
+	}
+	if o.waitTimeout, err = command.Flags().GetDuration("wait-timeout"); err != nil {
+		return o, err
+	}
+	o.nonInteractive = utils.NonInteractive(command)
+	if o.manifests != "" && o.chart != "" {
+		return o, errors.New("--manifests and --chart are mutually exclusive")
+	}
+	if o.manifestsSHA256 != "" && o.chart != "" {
+		return o, errors.New("--manifests-sha256 cannot be used together with --chart")
+	}
+
+	o.version = strings.TrimPrefix(o.version, "v")
+	if o.version == "" && o.manifests == "" {
+		latest, err := getLastReleaseForAstarteRepo(operatorRepo)
+		if err != nil {
+			return o, fmt.Errorf("Could not find the latest Astarte Operator release: %w", err)
+		}
+		o.version = strings.TrimPrefix(latest, "v")
+	}
+	return o, nil
+}
+
+func installOperatorF(command *cobra.Command, args []string) error {
+	o, err := operatorManifestsOptionsFromFlags(command)
+	if err != nil {
+		return err
+	}
+
+	if !o.dryRun {
+		if operator, err := getAstarteOperator(o.operatorName, o.operatorNamespace); err == nil {
+			return fmt.Errorf("Astarte Operator %s is already installed in namespace %s. Use upgrade-operator to upgrade it",
+				deploymentOperatorVersion(operator), o.operatorNamespace)
+		}
+	}
+
+	return applyOperatorManifests(o, "install")
+}
+
+func upgradeOperatorInstancesF(command *cobra.Command, args []string) error {
+	o, err := operatorManifestsOptionsFromFlags(command)
+	if err != nil {
+		return err
+	}
+
+	operator, err := getAstarteOperator(o.operatorName, o.operatorNamespace)
+	if err != nil {
+		return fmt.Errorf("Could not find Astarte Operator %s in namespace %s. Use install-operator to install it", o.operatorName, o.operatorNamespace)
+	}
+	currentVersionString := deploymentOperatorVersion(operator)
+	if o.version != "" && !isUnstableVersion(currentVersionString) {
+		currentVersion, errCurrent := semver.NewVersion(currentVersionString)
+		toVersion, errTo := semver.NewVersion(o.version)
+		if errCurrent == nil && errTo == nil {
+			if toVersion.LessThan(currentVersion) {
+				return fmt.Errorf("Cannot upgrade Astarte Operator from %s to %s: downgrades are not supported", currentVersion, toVersion)
+			}
+			if toVersion.Equal(currentVersion) {
+				fmt.Fprintf(os.Stderr, "warn: Astarte Operator is already at version %s, its manifests will be applied again\n", currentVersion)
+			}
+		}
+	}
+	fmt.Printf("Astarte Operator is currently at version %s.\n", currentVersionString)
+
+	return applyOperatorManifests(o, "upgrade")
+}
+
+// operatorVersion returns the version of Astarte Operator from its image
+// deploymentOperatorVersion returns the version of the Astarte Operator run by its Deployment
+func deploymentOperatorVersion(operator *appsv1.Deployment) string {
+	containers := operator.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return "unknown"
+	}
+	return operatorVersion(containers[0].Image)
+}
+
+func operatorVersion(image string) string {
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		return image[i+1:]
+	}
+	return "unknown"
+}
+
+func applyOperatorManifests(o operatorManifestsOptions, action string) error {
+	manifests, err := fetchOperatorManifests(o)
+	if err != nil {
+		return err
+	}
+	objects, err := parseManifests(manifests)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return errors.New("No resources found in the Astarte Operator manifests")
+	}
+	objects = renderManifestsForNamespace(objects, o.operatorNamespace)
+
+	if o.dryRun {
+		for _, obj := range objects {
+			y, err := unstructuredToYAML(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("---\n%s", y)
+		}
+		return nil
+	}
+
+	fmt.Println("The following resources will be applied:")
+	for _, obj := range objects {
+		fmt.Printf("  %s %s\n", obj.GetKind(), qualifiedName(obj))
+	}
+	if !o.nonInteractive {
+		proceed, err := utils.AskForConfirmation(fmt.Sprintf("Do you want to %s Astarte Operator %s in namespace %s?",
+			action, valueOrUnknown(o.version), o.operatorNamespace))
+		if err != nil {
+			return err
+		}
+		if !proceed {
+			fmt.Fprintln(os.Stderr, "Aborting. Your cluster has NOT been modified.")
+			os.Exit(1)
+		}
+	}
+
+	if err := ensureNamespace(o.operatorNamespace); err != nil {
+		return err
+	}
+	if err := applyObjects(objects, o.operatorNamespace); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Astarte Operator manifests successfully applied in namespace %s.\n", o.operatorNamespace)
+
+	if o.wait {
+		if err := waitForOperatorRollout(o.operatorName, o.operatorNamespace, o.waitTimeout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Astarte Operator is up and running.")
+	}
+	return nil
+}
+
+// fetchOperatorManifests returns the manifests to apply, either from a Helm chart, from the manifests
+// given by the user or from the Astarte Operator release
+func fetchOperatorManifests(o operatorManifestsOptions) ([]byte, error) {
+	if o.chart != "" {
+		return renderOperatorChart(o)
+	}
+
+	source := o.manifests
+	if source == "" {
+		source = fmt.Sprintf(operatorReleaseManifestsURL, o.version, o.manifestsAsset)
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		manifests, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		if o.manifestsSHA256 != "" {
+			return manifests, verifyManifestsChecksum(manifests, source, o.manifestsSHA256)
+		}
+		return manifests, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Fetching Astarte Operator manifests from %s\n", source)
+	httpClient := &http.Client{Timeout: operatorManifestsDownloadTimeout}
+	res, err := httpClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch Astarte Operator manifests from %s: %s", source, res.Status)
+	}
+	manifests, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if o.manifestsSHA256 == "" {
+		sum := sha256.Sum256(manifests)
+		fmt.Fprintf(os.Stderr, "warn: The manifests were not verified. Their SHA-256 is %s, use --manifests-sha256 to verify them\n",
+			hex.EncodeToString(sum[:]))
+		return manifests, nil
+	}
+	return manifests, verifyManifestsChecksum(manifests, source, o.manifestsSHA256)
+}
+
+// verifyManifestsChecksum checks that the SHA-256 of manifests, read from source, is expected
+func verifyManifestsChecksum(manifests []byte, source, expected string) error {
+	sum := sha256.Sum256(manifests)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("The SHA-256 of the manifests from %s is %s, rather than %s", source, actual, expected)
+	}
+	return nil
+}
+
+// renderOperatorChart renders an OCI Helm chart with helm template. No Helm repository needs to be configured,
+// as OCI charts are pulled directly from their registry.
+func renderOperatorChart(o operatorManifestsOptions) ([]byte, error) {
+	helm, err := exec.LookPath("helm")
+	if err != nil {
+		return nil, errors.New("Rendering a Helm chart requires the helm binary in PATH. Use the release manifests or --manifests otherwise")
+	}
+	args := []string{"template", "astarte-operator", o.chart, "--namespace", o.operatorNamespace, "--include-crds"}
+	if o.version != "" {
+		args = append(args, "--version", o.version)
+	}
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(helm, args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Could not render %s: %w\n%s", o.chart, err, stderr.String())
+	}
+	return out, nil
+}
+
+// parseManifests parses a multi-document YAML (or JSON) stream into its objects, expanding Lists
+func parseManifests(manifests []byte) ([]*unstructured.Unstructured, error) {
+	ret := []*unstructured.Unstructured{}
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifests), 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		if u.IsList() {
+			list, err := u.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				ret = append(ret, &list.Items[i])
+			}
+			continue
+		}
+		ret = append(ret, u)
+	}
+	return ret, nil
+}
+
+// renderManifestsForNamespace moves the namespaced objects of the manifests to namespace. References to the
+// original namespace (e.g. RoleBinding subjects, webhook services, certificate DNS names and CA injection
+// annotations) are updated as well. Namespace objects are dropped, as the target namespace is created when needed.
+func renderManifestsForNamespace(objects []*unstructured.Unstructured, namespace string) []*unstructured.Unstructured {
+	originalNamespace := ""
+	for _, obj := range objects {
+		if obj.GetKind() == "Namespace" {
+			originalNamespace = obj.GetName()
+			break
+		}
+		if originalNamespace == "" && obj.GetNamespace() != "" {
+			originalNamespace = obj.GetNamespace()
+		}
+	}
+
+	ret := []*unstructured.Unstructured{}
+	for _, obj := range objects {
+		if obj.GetKind() == "Namespace" {
+			continue
+		}
+		if originalNamespace != "" && originalNamespace != namespace {
+			obj.Object = replaceNamespaceReferences(obj.Object, "", originalNamespace, namespace).(map[string]interface{})
+		}
+		ret = append(ret, obj)
+	}
+	return ret
+}
+
+func replaceNamespaceReferences(value interface{}, key, from, to string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = replaceNamespaceReferences(item, k, from, to)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = replaceNamespaceReferences(item, key, from, to)
+		}
+		return v
+	case string:
+		switch {
+		case key == "namespace" && v == from:
+			return to
+		case strings.HasPrefix(v, from+"/"):
+			// e.g. cert-manager.io/inject-ca-from: <namespace>/<certificate>
+			return to + strings.TrimPrefix(v, from)
+		case strings.Contains(v, "."+from+".svc"):
+			return strings.ReplaceAll(v, "."+from+".svc", "."+to+".svc")
+		}
+	}
+	return value
+}
+
+func qualifiedName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func ensureNamespace(namespace string) error {
+	_, err := kubernetesClient.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Namespace %s does not exist, creating it...\n", namespace)
+	nsSpec := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	_, err = kubernetesClient.CoreV1().Namespaces().Create(context.Background(), nsSpec, metav1.CreateOptions{})
+	return err
+}
+
+// applyObjects applies objects with server-side apply. CustomResourceDefinitions are applied first, so that
+// resources of the kinds they define can be applied afterwards. Namespaced objects with no namespace are applied
+// in namespace.
+func applyObjects(objects []*unstructured.Unstructured, namespace string) error {
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubernetesClient.Discovery()))
+
+	ordered := []*unstructured.Unstructured{}
+	others := []*unstructured.Unstructured{}
+	for _, obj := range objects {
+		if obj.GetKind() == "CustomResourceDefinition" {
+			ordered = append(ordered, obj)
+		} else {
+			others = append(others, obj)
+		}
+	}
+	crdsCount := len(ordered)
+	ordered = append(ordered, others...)
+
+	force := true
+	for i, obj := range ordered {
+		if i == crdsCount && crdsCount > 0 {
+			// Discover the kinds defined by the CRDs which were just applied
+			mapper.Reset()
+		}
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("Could not apply %s %s: %w", obj.GetKind(), qualifiedName(obj), err)
+		}
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		if namespaced && obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+
+		resourceClient := kubernetesDynamicClient.Resource(mapping.Resource)
+		patchOptions := metav1.PatchOptions{FieldManager: operatorFieldManager, Force: &force}
+		if namespaced {
+			_, err = resourceClient.Namespace(obj.GetNamespace()).Patch(context.Background(), obj.GetName(), types.ApplyPatchType, data, patchOptions)
+		} else {
+			_, err = resourceClient.Patch(context.Background(), obj.GetName(), types.ApplyPatchType, data, patchOptions)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not apply %s %s: %w", obj.GetKind(), qualifiedName(obj), err)
+		}
+		fmt.Printf("%s %s applied\n", obj.GetKind(), qualifiedName(obj))
+	}
+	return nil
+}
+
+func waitForOperatorRollout(operatorName, operatorNamespace string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		operator, err := getAstarteOperator(operatorName, operatorNamespace)
+		if err == nil && operator.Spec.Replicas != nil {
+			status := operator.Status
+			if status.ObservedGeneration >= operator.Generation && status.UpdatedReplicas == *operator.Spec.Replicas &&
+				status.AvailableReplicas == *operator.Spec.Replicas && status.Replicas == *operator.Spec.Replicas {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for Astarte Operator %s to be rolled out in namespace %s", operatorName, operatorNamespace)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
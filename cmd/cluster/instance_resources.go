@@ -0,0 +1,329 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/bytefmt"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var instanceResourcesCmd = &cobra.Command{
+	Use:   "resources <name>",
+	Short: "Reports the resource usage of the components of an Astarte Instance",
+	Long: `Reports the actual CPU and memory usage of each component of an Astarte Instance against the resources
+it requests, flagging under-provisioned and over-provisioned components.
+
+The usage is read from the pod metrics exposed by metrics-server, which must be installed in the cluster, and is
+averaged over the pods of each component. Requested resources are the ones in the spec of the Astarte resource
+or, when a component has none, the ones set by Astarte Operator on its pods.
+
+A component is under-provisioned when its usage exceeds --high-usage-threshold percent of its requests, and
+over-provisioned when its usage is below --low-usage-threshold percent of them.`,
+	Example: `  astartectl cluster instances resources astarte`,
+	RunE:    instanceResourcesF,
+	Args:    cobra.ExactArgs(1),
+}
+
+var podMetricsV1Beta1 = schema.GroupVersionResource{
+	Group:    "metrics.k8s.io",
+	Version:  "v1beta1",
+	Resource: "pods",
+}
+
+// astarteResourcesComponent is a component of an Astarte Instance, as named in its pods, along with
+// the path of its spec in the Astarte resource
+type astarteResourcesComponent struct {
+	name     string
+	specPath []string
+}
+
+var astarteResourcesComponents = []astarteResourcesComponent{
+	{"housekeeping-api", []string{"components", "housekeeping", "api"}},
+	{"housekeeping", []string{"components", "housekeeping", "backend"}},
+	{"realm-management-api", []string{"components", "realmManagement", "api"}},
+	{"realm-management", []string{"components", "realmManagement", "backend"}},
+	{"pairing-api", []string{"components", "pairing", "api"}},
+	{"pairing", []string{"components", "pairing", "backend"}},
+	{"appengine-api", []string{"components", "appengineApi"}},
+	{"data-updater-plant", []string{"components", "dataUpdaterPlant"}},
+	{"trigger-engine", []string{"components", "triggerEngine"}},
+	{"dashboard", []string{"components", "dashboard"}},
+	{"flow", []string{"components", "flow"}},
+	{"vernemq", []string{"vernemq"}},
+	{"rabbitmq", []string{"rabbitmq"}},
+	{"cassandra", []string{"cassandra"}},
+	{"cfssl", []string{"cfssl"}},
+}
+
+// componentResources is the resource usage of a component of an Astarte Instance. CPU is in
+// millicores, memory in bytes, and usage is averaged over the pods of the component.
+type componentResources struct {
+	Component        string   `json:"component"`
+	Pods             int      `json:"pods"`
+	CPUUsage         int64    `json:"cpu_usage_millicores"`
+	CPURequest       int64    `json:"cpu_request_millicores,omitempty"`
+	MemoryUsage      int64    `json:"memory_usage_bytes"`
+	MemoryRequest    int64    `json:"memory_request_bytes,omitempty"`
+	RequestsFromPods bool     `json:"requests_from_pods,omitempty"`
+	Flags            []string `json:"flags"`
+}
+
+func init() {
+	instanceResourcesCmd.Flags().StringP("output", "o", "default", "The type of output (default,json)")
+	instanceResourcesCmd.Flags().Int("high-usage-threshold", 100, "Usage, in percent of the requests, above which a component is reported as under-provisioned.")
+	instanceResourcesCmd.Flags().Int("low-usage-threshold", 20, "Usage, in percent of the requests, below which a component is reported as over-provisioned.")
+
+	InstancesCmd.AddCommand(instanceResourcesCmd)
+}
+
+func instanceResourcesF(command *cobra.Command, args []string) error {
+	resourceName := args[0]
+	resourceNamespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if resourceNamespace == "" {
+		resourceNamespace = "astarte"
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if outputType != "default" && outputType != "json" {
+		return fmt.Errorf("%s is not a supported output type. Supported output types are default and json", outputType)
+	}
+	highThreshold, err := command.Flags().GetInt("high-usage-threshold")
+	if err != nil {
+		return err
+	}
+	lowThreshold, err := command.Flags().GetInt("low-usage-threshold")
+	if err != nil {
+		return err
+	}
+	if lowThreshold < 0 || highThreshold <= lowThreshold {
+		return fmt.Errorf("--low-usage-threshold must be positive and lower than --high-usage-threshold")
+	}
+
+	astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
+		os.Exit(1)
+	}
+
+	podList, err := kubernetesClient.CoreV1().Pods(resourceNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	podMetrics, err := kubernetesDynamicClient.Resource(podMetricsV1Beta1).Namespace(resourceNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read pod metrics, ensure metrics-server is installed in the cluster: %s.\n", err)
+		os.Exit(1)
+	}
+	usageByPod := map[string][2]int64{}
+	for _, m := range podMetrics.Items {
+		usageByPod[m.GetName()] = podMetricsUsage(m)
+	}
+
+	resources := []componentResources{}
+	for _, component := range astarteResourcesComponents {
+		pods := componentPods(resourceName, component.name, podList.Items)
+		if len(pods) == 0 {
+			continue
+		}
+		r := componentResources{Component: component.name, Flags: []string{}}
+		for _, pod := range pods {
+			usage, ok := usageByPod[pod.Name]
+			if !ok {
+				// No metrics yet, e.g. the pod just started
+				continue
+			}
+			r.Pods++
+			r.CPUUsage += usage[0]
+			r.MemoryUsage += usage[1]
+		}
+		if r.Pods == 0 {
+			continue
+		}
+		r.CPUUsage /= int64(r.Pods)
+		r.MemoryUsage /= int64(r.Pods)
+
+		r.CPURequest, r.MemoryRequest = specRequests(astarteObject, component.specPath)
+		if r.CPURequest == 0 && r.MemoryRequest == 0 {
+			r.CPURequest, r.MemoryRequest = podRequests(pods[0])
+			r.RequestsFromPods = true
+		}
+		r.Flags = append(r.Flags, provisioningFlags("cpu", r.CPUUsage, r.CPURequest, lowThreshold, highThreshold)...)
+		r.Flags = append(r.Flags, provisioningFlags("memory", r.MemoryUsage, r.MemoryRequest, lowThreshold, highThreshold)...)
+		resources = append(resources, r)
+	}
+	if len(resources) == 0 {
+		fmt.Fprintf(os.Stderr, "No metrics found for the pods of %s.\n", resourceName)
+		os.Exit(1)
+	}
+
+	if outputType == "json" {
+		out, err := json.MarshalIndent(resources, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Component", "Pods", "CPU Used", "CPU Requested", "Memory Used", "Memory Requested", "Status"})
+	var totalCPU, totalMemory int64
+	for _, r := range resources {
+		cpuRequest, memoryRequest := "-", "-"
+		if r.CPURequest > 0 {
+			cpuRequest = fmt.Sprintf("%dm (%d%%)", r.CPURequest, r.CPUUsage*100/r.CPURequest)
+		}
+		if r.MemoryRequest > 0 {
+			memoryRequest = fmt.Sprintf("%s (%d%%)", bytefmt.ByteSize(uint64(r.MemoryRequest)), r.MemoryUsage*100/r.MemoryRequest)
+		}
+		if r.RequestsFromPods {
+			if r.CPURequest > 0 {
+				cpuRequest += "*"
+			}
+			if r.MemoryRequest > 0 {
+				memoryRequest += "*"
+			}
+		}
+		status := "ok"
+		if len(r.Flags) > 0 {
+			status = strings.Join(r.Flags, ", ")
+		}
+		t.AppendRow(table.Row{r.Component, r.Pods, fmt.Sprintf("%dm", r.CPUUsage), cpuRequest,
+			bytefmt.ByteSize(uint64(r.MemoryUsage)), memoryRequest, status})
+		totalCPU += r.CPUUsage * int64(r.Pods)
+		totalMemory += r.MemoryUsage * int64(r.Pods)
+	}
+	t.Render()
+	fmt.Println("\nUsage is per pod. Requests marked with * are not in the Astarte resource, and were read from the pods.")
+
+	nodes, allocatableCPU, allocatableMemory, err := getClusterAllocatableResources()
+	if err == nil && nodes > 0 {
+		fmt.Printf("%s uses %dm CPU and %s memory, out of %dm CPU and %s memory allocatable on %d nodes.\n",
+			resourceName, totalCPU, bytefmt.ByteSize(uint64(totalMemory)),
+			allocatableCPU, bytefmt.ByteSize(uint64(allocatableMemory)), nodes)
+	}
+	return nil
+}
+
+// componentPods returns the pods of component, excluding the ones of components whose name has
+// component as a prefix (e.g. housekeeping-api pods are not housekeeping pods)
+func componentPods(instanceName, component string, pods []corev1.Pod) []corev1.Pod {
+	ret := []corev1.Pod{}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || !strings.HasPrefix(pod.Name, instanceName+"-"+component+"-") {
+			continue
+		}
+		longerMatch := false
+		for _, other := range astarteResourcesComponents {
+			if len(other.name) > len(component) && strings.HasPrefix(pod.Name, instanceName+"-"+other.name+"-") {
+				longerMatch = true
+				break
+			}
+		}
+		if !longerMatch {
+			ret = append(ret, pod)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// podMetricsUsage returns the CPU (in millicores) and memory (in bytes) used by all containers
+// of a pod, as reported by metrics-server
+func podMetricsUsage(podMetrics unstructured.Unstructured) [2]int64 {
+	var ret [2]int64
+	containers, _, _ := unstructured.NestedSlice(podMetrics.Object, "containers")
+	for _, rawContainer := range containers {
+		container, ok := rawContainer.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cpu, _, _ := unstructured.NestedString(container, "usage", "cpu")
+		memory, _, _ := unstructured.NestedString(container, "usage", "memory")
+		if q, err := resource.ParseQuantity(cpu); err == nil {
+			ret[0] += q.ScaledValue(resource.Milli)
+		}
+		if q, err := resource.ParseQuantity(memory); err == nil {
+			ret[1] += q.Value()
+		}
+	}
+	return ret
+}
+
+// specRequests returns the CPU (in millicores) and memory (in bytes) requested for a component in
+// the spec of the Astarte resource, or zero when not set
+func specRequests(astarteObject *unstructured.Unstructured, specPath []string) (int64, int64) {
+	var cpu, memory int64
+	fields := append(append([]string{"spec"}, specPath...), "resources", "requests")
+	if value, found, _ := unstructured.NestedFieldNoCopy(astarteObject.Object, append(fields, "cpu")...); found {
+		if q, err := resource.ParseQuantity(fmt.Sprintf("%v", value)); err == nil {
+			cpu = q.ScaledValue(resource.Milli)
+		}
+	}
+	if value, found, _ := unstructured.NestedFieldNoCopy(astarteObject.Object, append(fields, "memory")...); found {
+		if q, err := resource.ParseQuantity(fmt.Sprintf("%v", value)); err == nil {
+			memory = q.Value()
+		}
+	}
+	return cpu, memory
+}
+
+// podRequests returns the CPU (in millicores) and memory (in bytes) requested by all containers of a pod
+func podRequests(pod corev1.Pod) (int64, int64) {
+	var cpu, memory int64
+	for _, c := range pod.Spec.Containers {
+		cpu += c.Resources.Requests.Cpu().ScaledValue(resource.Milli)
+		memory += c.Resources.Requests.Memory().Value()
+	}
+	return cpu, memory
+}
+
+// provisioningFlags flags usage as under-provisioned or over-provisioned, compared to request
+func provisioningFlags(resourceName string, usage, request int64, lowThreshold, highThreshold int) []string {
+	if request <= 0 {
+		return nil
+	}
+	percentage := usage * 100 / request
+	switch {
+	case percentage > int64(highThreshold):
+		return []string{resourceName + " under-provisioned"}
+	case percentage < int64(lowThreshold):
+		return []string{resourceName + " over-provisioned"}
+	}
+	return nil
+}
@@ -19,22 +19,28 @@ import (
 	"os"
 	"text/tabwriter"
 
+	"github.com/astarte-platform/astartectl/utils"
 	"github.com/spf13/cobra"
 )
 
 var instanceShowCmd = &cobra.Command{
-	Use:     "show <name>",
-	Short:   "Shows details about an Astarte Instance in the current Kubernetes Cluster",
-	Long:    `Shows details about an Astarte Instance in the current Kubernetes Cluster.`,
-	Example: `  astartectl cluster instances show astarte`,
-	RunE:    instanceShowF,
-	Args:    cobra.ExactArgs(1),
+	Use:   "show <name>",
+	Short: "Shows details about an Astarte Instance in the current Kubernetes Cluster",
+	Long: `Shows details about an Astarte Instance in the current Kubernetes Cluster.
+
+With --output json or yaml, the health and resource allocations of the instance are printed too.`,
+	Example: `  astartectl cluster instances show astarte
+  astartectl cluster instances show astarte -o yaml`,
+	RunE: instanceShowF,
+	Args: cobra.ExactArgs(1),
 	Deprecated: `This command is deprecated and will be removed in future releases.
 Refer to the Astarte documentation on how to interact with Astarte:
 https://docs.astarte-platform.org/astarte-kubernetes-operator/latest`,
 }
 
 func init() {
+	instanceShowCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default", "json", "yaml"))
+
 	InstancesCmd.AddCommand(instanceShowCmd)
 }
 
@@ -48,6 +54,10 @@ func instanceShowF(command *cobra.Command, args []string) error {
 	if resourceNamespace == "" {
 		resourceNamespace = "astarte"
 	}
+	outputType, err := instanceOutputTypeFromFlags(command)
+	if err != nil {
+		return err
+	}
 
 	astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
 	if err != nil {
@@ -55,6 +65,10 @@ func instanceShowF(command *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
+	if outputType != "default" {
+		return printInstanceOutput(summarizeInstance(*astarteObject), outputType)
+	}
+
 	astarteSpec := astarteObject.Object["spec"].(map[string]interface{})
 	operatorStatus, deploymentManager, deploymentProfile := getManagedAstarteResourceStatus(*astarteObject)
 
@@ -0,0 +1,289 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+var instanceUpgradeCmd = &cobra.Command{
+	Use:   "upgrade <name>",
+	Short: "Upgrade an Astarte Instance in the current Kubernetes Cluster to a new version",
+	Long: `Upgrade an Astarte Instance in the current Kubernetes Cluster to a new version, by updating the version
+in its resource and letting Astarte Operator roll out the upgrade.
+
+Before touching the resource, the upgrade path is validated: downgrades are not allowed, and release lines cannot
+be skipped (e.g. 1.0.x can be upgraded to 1.1.x, but not to 1.2.x, which requires upgrading to 1.1.x first).
+Upgrading to Astarte 1.1 or later also requires the Astarte CRD to store v1alpha2 resources only, see
+astartectl cluster instances migrate storage-version.
+
+The changes to the resource are shown and have to be confirmed. With --wait, the command waits for Astarte Operator
+to report the new version and a green health, printing its progress.`,
+	Example: `  astartectl cluster instances upgrade astarte --to-version 1.1.1 --wait`,
+	RunE:    instanceUpgradeF,
+	Args:    cobra.ExactArgs(1),
+}
+
+// storageVersionRequirementConstraint is the range of Astarte versions requiring astartesCRDName to
+// store v1alpha2 resources only
+const storageVersionRequirementConstraint = ">= 1.1.0"
+
+const astartesCRDName = "astartes.api.astarte-platform.org"
+
+func init() {
+	instanceUpgradeCmd.Flags().String("to-version", "", "The Astarte version to upgrade to, e.g. 1.1.1")
+	instanceUpgradeCmd.Flags().Bool("wait", false, "When set, wait for Astarte Operator to complete the upgrade.")
+	instanceUpgradeCmd.Flags().Duration("wait-timeout", 30*time.Minute, "The maximum time to wait for the upgrade to complete, when --wait is set.")
+	utils.AddNonInteractiveFlag(instanceUpgradeCmd.Flags())
+	_ = instanceUpgradeCmd.MarkFlagRequired("to-version")
+
+	InstancesCmd.AddCommand(instanceUpgradeCmd)
+}
+
+func instanceUpgradeF(command *cobra.Command, args []string) error {
+	resourceName := args[0]
+	resourceNamespace, err := command.Flags().GetString("namespace")
+	if err != nil {
+		return err
+	}
+	if resourceNamespace == "" {
+		resourceNamespace = "astarte"
+	}
+	toVersionString, err := command.Flags().GetString("to-version")
+	if err != nil {
+		return err
+	}
+	wait, err := command.Flags().GetBool("wait")
+	if err != nil {
+		return err
+	}
+	waitTimeout, err := command.Flags().GetDuration("wait-timeout")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+
+	if isUnstableVersion(toVersionString) {
+		return errors.New("Upgrading to snapshot versions is not supported")
+	}
+	toVersion, err := semver.StrictNewVersion(strings.TrimPrefix(toVersionString, "v"))
+	if err != nil {
+		return fmt.Errorf("%s is not a valid Astarte version: %w", toVersionString, err)
+	}
+
+	astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while looking for instance %s: %s.\n", resourceName, err.Error())
+		os.Exit(1)
+	}
+	currentVersionString, _, _ := unstructured.NestedString(astarteObject.Object, "spec", "version")
+	if isUnstableVersion(currentVersionString) {
+		return fmt.Errorf("%s is running the snapshot version %s, which cannot be upgraded in a managed way", resourceName, currentVersionString)
+	}
+	currentVersion, err := semver.NewVersion(currentVersionString)
+	if err != nil {
+		return fmt.Errorf("Could not parse the current version of %s: %w", resourceName, err)
+	}
+
+	if err := validateUpgradePath(currentVersion, toVersion); err != nil {
+		return err
+	}
+	if err := ensureStorageVersionRequirement(toVersion); err != nil {
+		return err
+	}
+
+	upgradedObject := astarteObject.DeepCopy()
+	if err := unstructured.SetNestedField(upgradedObject.Object, toVersion.String(), "spec", "version"); err != nil {
+		return err
+	}
+	if err := printResourceDiff(astarteObject, upgradedObject); err != nil {
+		return err
+	}
+
+	fmt.Printf("Will upgrade Astarte instance %s in namespace %s from %s to %s.\n", resourceName, resourceNamespace, currentVersion, toVersion)
+	if !nonInteractive {
+		proceed, err := utils.AskForConfirmation("Do you want to proceed with the upgrade?")
+		if err != nil {
+			return err
+		}
+		if !proceed {
+			fmt.Fprintln(os.Stderr, "Aborting the upgrade. Your Astarte instance has NOT been modified.")
+			os.Exit(1)
+		}
+	}
+
+	// The resource might have been updated by the Operator in the meanwhile, hence retry on conflicts
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := getAstarteInstance(resourceName, resourceNamespace)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, toVersion.String(), "spec", "version"); err != nil {
+			return err
+		}
+		resourceClient, ok := astarteResourceClients[obj.GroupVersionKind().Version]
+		if !ok {
+			return fmt.Errorf("Unsupported Astarte resource version %s", obj.GroupVersionKind().Version)
+		}
+		_, err = resourceClient.Namespace(resourceNamespace).Update(context.Background(), obj, metav1.UpdateOptions{})
+		return err
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error while upgrading Astarte Resource.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Astarte instance %s is being upgraded to %s.\n", resourceName, toVersion)
+	if !wait {
+		fmt.Println("You can monitor the progress with astartectl cluster instances health.")
+		return nil
+	}
+
+	if err := waitForUpgrade(resourceName, resourceNamespace, toVersion, waitTimeout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Astarte instance %s was successfully upgraded to %s.\n", resourceName, toVersion)
+	return nil
+}
+
+// validateUpgradePath ensures that from can be upgraded to to. Astarte releases can be upgraded within
+// the same release line (major.minor), to the next minor release line, or to the first release line of the
+// next major (e.g. 0.11.x to 1.0.x). Skipping release lines and downgrading are not allowed.
+func validateUpgradePath(from, to *semver.Version) error {
+	if !to.GreaterThan(from) {
+		return fmt.Errorf("Cannot upgrade from %s to %s: downgrades are not supported", from, to)
+	}
+
+	switch {
+	case to.Major() == from.Major() && to.Minor() <= from.Minor()+1:
+		return nil
+	case to.Major() == from.Major()+1 && to.Minor() == 0:
+		return nil
+	case to.Major() == from.Major():
+		return fmt.Errorf("Cannot upgrade from %s to %s: upgrade to %d.%d first", from, to, from.Major(), from.Minor()+1)
+	default:
+		return fmt.Errorf("Cannot upgrade from %s to %s: upgrade to the latest %d.x release and then to %d.0 first",
+			from, to, from.Major(), from.Major()+1)
+	}
+}
+
+// ensureStorageVersionRequirement ensures the Astarte CRD satisfies the storage version prerequisites of version
+func ensureStorageVersionRequirement(version *semver.Version) error {
+	constraint, err := semver.NewConstraint(storageVersionRequirementConstraint)
+	if err != nil {
+		return err
+	}
+	if !constraint.Check(version) {
+		return nil
+	}
+
+	crd, err := kubernetesAPIExtensionsClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(),
+		astartesCRDName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !checkStoredVersionsMatch(crd.Status.StoredVersions, crdsStoredVersionsAfterUpgrade) {
+		return fmt.Errorf("Astarte %s requires CRD %s to store %v resources only, while it stores %v. Run astartectl cluster instances migrate storage-version first",
+			version, astartesCRDName, crdsStoredVersionsAfterUpgrade, crd.Status.StoredVersions)
+	}
+	return nil
+}
+
+func printResourceDiff(from, to *unstructured.Unstructured) error {
+	fromYAML, err := unstructuredToYAML(from)
+	if err != nil {
+		return err
+	}
+	toYAML, err := unstructuredToYAML(to)
+	if err != nil {
+		return err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromYAML)),
+		B:        difflib.SplitLines(string(toYAML)),
+		FromFile: "current",
+		ToFile:   "upgraded",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("The following changes will be applied to the Astarte resource:")
+	fmt.Print(diff)
+	return nil
+}
+
+// waitForUpgrade waits until Astarte Operator reports version as the version of the instance, with a green health
+func waitForUpgrade(resourceName, resourceNamespace string, version *semver.Version, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	lastProgress := ""
+	for {
+		astarteObject, err := getAstarteInstance(resourceName, resourceNamespace)
+		if err != nil {
+			return err
+		}
+		reportedVersion, _, _ := unstructured.NestedString(astarteObject.Object, "status", "astarteVersion")
+		health, _, _ := unstructured.NestedString(astarteObject.Object, "status", "health")
+		phase := reconciliationPhase(astarteObject)
+
+		progress := fmt.Sprintf("version %s, phase %s, health %s", valueOrUnknown(reportedVersion), valueOrUnknown(phase), valueOrUnknown(health))
+		if progress != lastProgress {
+			fmt.Printf("%s Astarte Operator reports %s\n", time.Now().Format(time.RFC3339), progress)
+			lastProgress = progress
+		}
+
+		if reportedVersion != "" {
+			if v, err := semver.NewVersion(reportedVersion); err == nil && v.Equal(version) && (health == "" || health == healthGreen) {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s to be upgraded to %s. The upgrade might still be in progress, check astartectl cluster instances health", resourceName, version)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// reconciliationPhase returns the reconciliation phase of an Astarte resource, as reported by Astarte Operator
+func reconciliationPhase(astarteObject *unstructured.Unstructured) string {
+	if phase, found, _ := unstructured.NestedString(astarteObject.Object, "status", "reconciliationPhase"); found {
+		return phase
+	}
+	phase, _, _ := unstructured.NestedString(astarteObject.Object, "status", "phase")
+	return phase
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
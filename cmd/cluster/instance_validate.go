@@ -0,0 +1,288 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate an Astarte custom resource",
+	Long: `Validate an Astarte custom resource (e.g. an Astarte, an AstarteDefaultIngress or a Flow) against
+the schema of its CustomResourceDefinition, reporting unknown fields, type mismatches and missing required
+fields before the resource is applied to the cluster.
+
+By default, the CustomResourceDefinition is fetched from the cluster. For offline use, a local
+CustomResourceDefinition file can be provided with --crd: in that case, no access to the cluster is required.`,
+	Example: `  astartectl cluster instances validate -f astarte.yaml
+  astartectl cluster instances validate -f astarte.yaml --crd api.astarte-platform.org_astartes.yaml`,
+	PersistentPreRunE: validatePersistentPreRunE,
+	RunE:              validateF,
+}
+
+func init() {
+	validateCmd.Flags().StringP("filename", "f", "", "The file containing the custom resource to be validated.")
+	validateCmd.Flags().String("crd", "", "When set, validate against the CustomResourceDefinition in this file rather than the one installed in the cluster.")
+	_ = validateCmd.MarkFlagRequired("filename")
+
+	InstancesCmd.AddCommand(validateCmd)
+}
+
+func validatePersistentPreRunE(cmd *cobra.Command, args []string) error {
+	crdFile, err := cmd.Flags().GetString("crd")
+	if err != nil {
+		return err
+	}
+	// No need to talk to the cluster when validating offline
+	if crdFile != "" {
+		return nil
+	}
+	return clusterPersistentPreRunE(cmd, args)
+}
+
+func validateF(command *cobra.Command, args []string) error {
+	filename, err := command.Flags().GetString("filename")
+	if err != nil {
+		return err
+	}
+	crdFile, err := command.Flags().GetString("crd")
+	if err != nil {
+		return err
+	}
+
+	resource, err := loadYAMLObject(filename)
+	if err != nil {
+		return err
+	}
+	apiVersion, _ := resource["apiVersion"].(string)
+	kind, _ := resource["kind"].(string)
+	if apiVersion == "" || kind == "" {
+		return errors.New("The resource must have both apiVersion and kind set")
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return err
+	}
+
+	var crd *apiextensionsv1.CustomResourceDefinition
+	if crdFile != "" {
+		crd, err = loadCRDFromFile(crdFile)
+	} else {
+		crd, err = getCRDForKind(gv.Group, kind)
+	}
+	if err != nil {
+		return err
+	}
+	if crd.Spec.Group != gv.Group || crd.Spec.Names.Kind != kind {
+		return fmt.Errorf("CustomResourceDefinition %s does not define %s, %s", crd.Name, apiVersion, kind)
+	}
+
+	openAPISchema, err := crdVersionSchema(crd, gv.Version)
+	if err != nil {
+		return err
+	}
+
+	// metadata is validated by the API server itself
+	delete(resource, "metadata")
+	issues := validateAgainstSchema(resource, openAPISchema, "")
+	if len(issues) == 0 {
+		fmt.Printf("%s is a valid %s %s\n", filename, apiVersion, kind)
+		return nil
+	}
+
+	sort.Strings(issues)
+	fmt.Printf("%s is not a valid %s %s:\n", filename, apiVersion, kind)
+	for _, issue := range issues {
+		fmt.Printf("  - %s\n", issue)
+	}
+	os.Exit(1)
+	return nil
+}
+
+func loadYAMLObject(filename string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	j, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]interface{}{}
+	if err := json.Unmarshal(j, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func loadCRDFromFile(filename string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(content, crd); err != nil {
+		return nil, err
+	}
+	return crd, nil
+}
+
+func getCRDForKind(group, kind string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	crds, err := kubernetesAPIExtensionsClient.ApiextensionsV1().CustomResourceDefinitions().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range crds.Items {
+		if crds.Items[i].Spec.Group == group && crds.Items[i].Spec.Names.Kind == kind {
+			return &crds.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No CustomResourceDefinition for %s in group %s is installed in the cluster", kind, group)
+}
+
+// crdVersionSchema returns the OpenAPI schema of version in crd
+func crdVersionSchema(crd *apiextensionsv1.CustomResourceDefinition, version string) (*apiextensionsv1.JSONSchemaProps, error) {
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && v.Schema != nil {
+			return v.Schema.OpenAPIV3Schema, nil
+		}
+	}
+	return nil, fmt.Errorf("CustomResourceDefinition %s has no schema for version %s", crd.Name, version)
+}
+
+// validateAgainstSchema returns all the issues found when validating value against s. path is the
+// path of value within the resource, and it's used for reporting.
+func validateAgainstSchema(value interface{}, s *apiextensionsv1.JSONSchemaProps, path string) []string {
+	issues := []string{}
+	displayPath := path
+	if displayPath == "" {
+		displayPath = "."
+	}
+
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			issues = append(issues, fmt.Sprintf("%s: null is not allowed, expected %s", displayPath, s.Type))
+		}
+		return issues
+	}
+
+	if s.XIntOrString {
+		if _, ok := value.(string); !ok && !isInteger(value) {
+			issues = append(issues, fmt.Sprintf("%s: type mismatch, expected integer or string, got %s", displayPath, jsonTypeOf(value)))
+		}
+		return issues
+	}
+
+	if s.Type != "" && !matchesType(value, s.Type) {
+		return append(issues, fmt.Sprintf("%s: type mismatch, expected %s, got %s", displayPath, s.Type, jsonTypeOf(value)))
+	}
+
+	if len(s.Enum) > 0 {
+		marshaledValue, _ := json.Marshal(value)
+		allowed := []string{}
+		found := false
+		for _, e := range s.Enum {
+			if string(e.Raw) == string(marshaledValue) {
+				found = true
+			}
+			allowed = append(allowed, string(e.Raw))
+		}
+		if !found {
+			issues = append(issues, fmt.Sprintf("%s: %s is not one of the allowed values %s", displayPath, marshaledValue, strings.Join(allowed, ", ")))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, required := range s.Required {
+			if _, ok := v[required]; !ok {
+				issues = append(issues, fmt.Sprintf("%s: missing required field", path+"."+required))
+			}
+		}
+		preserveUnknownFields := s.XPreserveUnknownFields != nil && *s.XPreserveUnknownFields
+		for k, fieldValue := range v {
+			fieldPath := path + "." + k
+			if fieldSchema, ok := s.Properties[k]; ok {
+				issues = append(issues, validateAgainstSchema(fieldValue, &fieldSchema, fieldPath)...)
+				continue
+			}
+			switch {
+			case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+				issues = append(issues, validateAgainstSchema(fieldValue, s.AdditionalProperties.Schema, fieldPath)...)
+			case s.AdditionalProperties != nil && s.AdditionalProperties.Allows, preserveUnknownFields, s.XEmbeddedResource:
+				// anything goes
+			default:
+				issues = append(issues, fmt.Sprintf("%s: unknown field", fieldPath))
+			}
+		}
+	case []interface{}:
+		if s.Items != nil && s.Items.Schema != nil {
+			for i, item := range v {
+				issues = append(issues, validateAgainstSchema(item, s.Items.Schema, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return issues
+}
+
+func matchesType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "integer":
+		return isInteger(value)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeOf(value) == schemaType
+	}
+}
+
+func isInteger(value interface{}) bool {
+	f, ok := value.(float64)
+	return ok && f == math.Trunc(f)
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -26,7 +26,9 @@ var upgradeDeprecationMessage = `Error: removed command
 
 Since Astarte 1.0, operator upgrade through astartectl has been removed. You can upgrade astarte-operator using Helm (https://helm.sh/) with this command:
 
-$ helm upgrade astarte-operator`
+$ helm upgrade astarte-operator
+
+Alternatively, you can use astartectl cluster instances upgrade-operator, which does not require Helm to be configured.`
 
 var upgradeOperatorCmd = &cobra.Command{
 	Use:   "upgrade-operator",
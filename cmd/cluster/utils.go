@@ -332,11 +332,7 @@ func getStringFlagFromPromptOrDie(command *cobra.Command, flagName string, quest
 }
 
 func getFromPromptOrDie(command *cobra.Command, question string, defaultValue string, allowEmpty bool) string {
-	y, err := command.Flags().GetBool("non-interactive")
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
+	y := utils.NonInteractive(command)
 
 	ret, err := utils.PromptChoice(question, defaultValue, allowEmpty, y)
 	if err != nil {
@@ -0,0 +1,204 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var configExportBundleCmd = &cobra.Command{
+	Use:   "export-bundle --contexts <context_name>,... [-o <output_file>]",
+	Short: "Export contexts and their clusters to a portable bundle",
+	Long: `Export a set of contexts, together with the clusters they refer to, to a single YAML bundle which can
+be shared with teammates and imported with 'astartectl config import-bundle'.
+
+The bundle includes the Realm and Housekeeping keys of the exported contexts and clusters, if any.
+Use --strip-secrets to leave them out: whoever imports the bundle will then have to provide their
+own credentials, e.g. with 'astartectl config contexts update'.`,
+	Example: `  astartectl config export-bundle --contexts staging,production --strip-secrets -o bundle.yaml`,
+	Args:    cobra.NoArgs,
+	RunE:    configExportBundleF,
+}
+
+var configImportBundleCmd = &cobra.Command{
+	Use:   "import-bundle <bundle_file>",
+	Short: "Import contexts and clusters from a bundle",
+	Long: `Import the contexts and clusters in a YAML bundle created with 'astartectl config export-bundle'.
+By default, existing clusters and contexts won't be overwritten - you can force this behavior with --overwrite.
+The current context is left untouched, unless --set-current-context is specified.`,
+	Example: `  astartectl config import-bundle bundle.yaml`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    configImportBundleF,
+}
+
+func init() {
+	configExportBundleCmd.Flags().StringSlice("contexts", []string{}, "A list of contexts to be exported, comma separated. Defaults to the current context")
+	configExportBundleCmd.Flags().Bool("strip-secrets", false, "When specified, private keys and tokens are not included in the bundle")
+	configExportBundleCmd.Flags().StringP("output", "o", "", "If specified, the bundle will be saved to specified file")
+	_ = configExportBundleCmd.RegisterFlagCompletionFunc("contexts", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return utils.ContextNamesCompletion(cmd, nil, toComplete)
+	})
+
+	configImportBundleCmd.Flags().Bool("overwrite", false, "When specified, overwrites existing clusters or contexts with matching names")
+	configImportBundleCmd.Flags().String("set-current-context", "", "When specified, sets the given context of the bundle as the current context")
+
+	ConfigCmd.AddCommand(configExportBundleCmd)
+	ConfigCmd.AddCommand(configImportBundleCmd)
+}
+
+func configExportBundleF(command *cobra.Command, args []string) error {
+	contexts, err := command.Flags().GetStringSlice("contexts")
+	if err != nil {
+		return err
+	}
+	stripSecrets, err := command.Flags().GetBool("strip-secrets")
+	if err != nil {
+		return err
+	}
+	output, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	configDir := config.GetConfigDir()
+	if len(contexts) == 0 {
+		baseConfig, err := config.LoadBaseConfiguration(configDir)
+		if err != nil || baseConfig.CurrentContext == "" {
+			fmt.Fprintln(os.Stderr, "No current context set, specify the contexts to export with --contexts")
+			os.Exit(1)
+		}
+		contexts = []string{baseConfig.CurrentContext}
+	}
+
+	bundle, err := config.CreateContextsBundle(configDir, contexts, stripSecrets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	yamlBytes, err := yaml.Marshal(bundle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		fmt.Print(string(yamlBytes))
+	} else {
+		fileMode := os.FileMode(0600)
+		if stripSecrets {
+			fileMode = 0644
+		}
+		if err := os.WriteFile(output, yamlBytes, fileMode); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d contexts and %d clusters\n", len(bundle.Contexts), len(bundle.Clusters))
+	return nil
+}
+
+func configImportBundleF(command *cobra.Command, args []string) error {
+	overwrite, err := command.Flags().GetBool("overwrite")
+	if err != nil {
+		return err
+	}
+	currentContext, err := command.Flags().GetString("set-current-context")
+	if err != nil {
+		return err
+	}
+
+	contents, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var bundle config.Bundle
+	if err := yaml.UnmarshalStrict(contents, &bundle); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not a valid bundle: %s\n", args[0], err)
+		os.Exit(1)
+	}
+	if currentContext != "" {
+		if _, ok := bundle.Contexts[currentContext]; !ok {
+			fmt.Fprintf(os.Stderr, "Context %s is not in the bundle\n", currentContext)
+			os.Exit(1)
+		}
+	}
+
+	configDir := config.GetConfigDir()
+	existingClusters, err := config.ListClusterConfigurations(configDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	existingContexts, err := config.ListContextConfigurations(configDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for name, cluster := range bundle.Clusters {
+		if !overwrite && contains(existingClusters, name) {
+			fmt.Fprintf(os.Stderr, "warn: Cluster %s already exists, skipping it\n", name)
+			continue
+		}
+		if err := config.SaveClusterConfiguration(configDir, name, cluster, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported cluster %s\n", name)
+	}
+
+	for name, context := range bundle.Contexts {
+		if _, ok := bundle.Clusters[context.Cluster]; !ok && !contains(existingClusters, context.Cluster) {
+			fmt.Fprintf(os.Stderr, "warn: Context %s refers to cluster %s, which is neither in the bundle nor configured\n", name, context.Cluster)
+		}
+		if !overwrite && contains(existingContexts, name) {
+			fmt.Fprintf(os.Stderr, "warn: Context %s already exists, skipping it\n", name)
+			continue
+		}
+		if err := config.SaveContextConfiguration(configDir, name, context, true); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported context %s\n", name)
+		if context.Realm.Key == "" && context.Realm.Token == "" && context.Realm.Name != "" {
+			fmt.Fprintf(os.Stderr, "warn: Context %s has no credentials, set them with 'astartectl config contexts update %s --realm-private-key <key>'\n", name, name)
+		}
+	}
+
+	if currentContext != "" {
+		config.UpdateBaseConfigWithContext(configDir, currentContext)
+		fmt.Printf("Current context set to %s\n", currentContext)
+	}
+
+	return nil
+}
+
+func contains(list []string, match string) bool {
+	for _, v := range list {
+		if v == match {
+			return true
+		}
+	}
+	return false
+}
@@ -42,21 +42,23 @@ var clustersListCmd = &cobra.Command{
 }
 
 var clustersShowCmd = &cobra.Command{
-	Use:     "show <cluster_name>",
-	Short:   "Show cluster",
-	Long:    "Show a cluster in your astartectl configuration.",
-	Example: `  astartectl config clusters show mycluster`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    clustersShowF,
+	Use:               "show <cluster_name>",
+	Short:             "Show cluster",
+	Long:              "Show a cluster in your astartectl configuration.",
+	Example:           `  astartectl config clusters show mycluster`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ClusterNamesCompletion,
+	RunE:              clustersShowF,
 }
 
 var clustersGetHousekeepingKeyCmd = &cobra.Command{
-	Use:     "get-housekeeping-key <cluster_name>",
-	Short:   "Get the Housekeeping key from a cluster",
-	Long:    "Get the Housekeeping key from a cluster in your astartectl configuration. This will work only if a housekeeping key is set",
-	Example: `  astartectl config clusters get-housekeeping-key mycluster`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    clustersGetHousekeepingKeyF,
+	Use:               "get-housekeeping-key <cluster_name>",
+	Short:             "Get the Housekeeping key from a cluster",
+	Long:              "Get the Housekeeping key from a cluster in your astartectl configuration. This will work only if a housekeeping key is set",
+	Example:           `  astartectl config clusters get-housekeeping-key mycluster`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ClusterNamesCompletion,
+	RunE:              clustersGetHousekeepingKeyF,
 }
 
 var clustersCreateCmd = &cobra.Command{
@@ -69,22 +71,36 @@ var clustersCreateCmd = &cobra.Command{
 }
 
 var clustersUpdateCmd = &cobra.Command{
-	Use:     "update <cluster_name>",
-	Short:   "Update cluster",
-	Long:    "Update a cluster in your astartectl configuration.",
-	Example: `  astartectl config clusters update mycluster --api-url https://my.astarte.apis.example.com`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    clustersUpdateF,
+	Use:               "update <cluster_name>",
+	Short:             "Update cluster",
+	Long:              "Update a cluster in your astartectl configuration.",
+	Example:           `  astartectl config clusters update mycluster --api-url https://my.astarte.apis.example.com`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ClusterNamesCompletion,
+	RunE:              clustersUpdateF,
 }
 
 var clustersDeleteCmd = &cobra.Command{
-	Use:     "delete <cluster_name>",
-	Short:   "Delete cluster",
-	Long:    "Delete a cluster in your Astarte instance.",
-	Example: `  astartectl config clusters delete mycluster`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    clustersDeleteF,
-	Aliases: []string{"del"},
+	Use:               "delete <cluster_name>",
+	Short:             "Delete cluster",
+	Long:              "Delete a cluster in your Astarte instance.",
+	Example:           `  astartectl config clusters delete mycluster`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ClusterNamesCompletion,
+	RunE:              clustersDeleteF,
+	Aliases:           []string{"del"},
+}
+
+var clustersRenameCmd = &cobra.Command{
+	Use:   "rename <old_cluster_name> <new_cluster_name>",
+	Short: "Rename cluster",
+	Long: `Rename a cluster, updating all the contexts referring to it.
+Should any step fail, the changes made so far are reverted.`,
+	Example:           `  astartectl config clusters rename mycluster production`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: utils.ClusterNamesCompletion,
+	RunE:              clustersRenameF,
+	Aliases:           []string{"mv"},
 }
 
 func init() {
@@ -129,6 +145,7 @@ func init() {
 		clustersCreateCmd,
 		clustersUpdateCmd,
 		clustersDeleteCmd,
+		clustersRenameCmd,
 	)
 }
 
@@ -251,8 +268,9 @@ func clustersDeleteF(command *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
-	if ok, err := utils.AskForConfirmation(fmt.Sprintf("Will delete cluster %s. Are you sure you want to continue?", clusterName)); !ok || err != nil {
-		return nil
+	if ok, err := utils.Confirm(command, fmt.Sprintf("Will delete cluster %s. Are you sure you want to continue?", clusterName)); !ok || err != nil {
+		fmt.Fprintln(os.Stderr, "Aborting.")
+		os.Exit(1)
 	}
 
 	if err := config.DeleteClusterConfiguration(config.GetConfigDir(), clusterName); err != nil {
@@ -264,6 +282,22 @@ func clustersDeleteF(command *cobra.Command, args []string) error {
 	return nil
 }
 
+func clustersRenameF(command *cobra.Command, args []string) error {
+	oldName, newName := args[0], args[1]
+
+	updatedContexts, err := config.RenameClusterConfiguration(config.GetConfigDir(), oldName, newName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Cluster %s renamed to %s successfully\n", oldName, newName)
+	for _, c := range updatedContexts {
+		fmt.Printf("Context %s updated\n", c)
+	}
+	return nil
+}
+
 func performClusterCreation(clusterName string, isUpdate bool, command *cobra.Command, args []string) error {
 	configDir := config.GetConfigDir()
 	housekeepingKey, err := command.Flags().GetString("housekeeping-key")
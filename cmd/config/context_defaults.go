@@ -0,0 +1,250 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Global flags which select the configuration itself. They apply to set-default, rather than being stored
+var configSelectionFlags = []string{"config-dir", "config-profile", "config-storage", "config-secret-namespace", "config-secret-name"}
+
+// Flags which cannot have a default, as they select the context itself or they must be given explicitly
+var nonDefaultableFlags = []string{"context", "use-cluster", "yes", "help"}
+
+var contextsSetDefaultCmd = &cobra.Command{
+	Use:   "set-default <context_name> --<flag> <value> [...]",
+	Short: "Set default flags for a context",
+	Long: `Set the default value of command line flags for a context. Whenever the context is in use, flags
+which are not given on the command line take their value from the context defaults, rather than
+from their built-in default. Defaults are applied only to commands having the flag, hence they
+can be shared by all commands using it (e.g. --output). Defaults are not applied to config and
+cluster commands.
+
+Any flag of any astartectl command can be given, by its long name. Boolean flags can be given
+without a value. Existing defaults for other flags are kept: use unset-default to remove them.`,
+	Example: `  astartectl config contexts set-default mycontext --output json --force-id-type device-id`,
+	// Flags are the defaults to be stored, they are parsed by the command itself
+	DisableFlagParsing: true,
+	ValidArgsFunction:  utils.ContextNamesCompletion,
+	RunE:               contextsSetDefaultF,
+}
+
+var contextsUnsetDefaultCmd = &cobra.Command{
+	Use:   "unset-default <context_name> <flag> [...]",
+	Short: "Remove default flags from a context",
+	Long:  `Remove default flags, given by their long name, from a context. With --all, all defaults are removed.`,
+	Example: `  astartectl config contexts unset-default mycontext output
+  astartectl config contexts unset-default mycontext --all`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: contextDefaultsCompletion,
+	RunE:              contextsUnsetDefaultF,
+}
+
+func init() {
+	contextsUnsetDefaultCmd.Flags().Bool("all", false, "Remove all defaults of the context.")
+
+	contextsCmd.AddCommand(
+		contextsSetDefaultCmd,
+		contextsUnsetDefaultCmd,
+	)
+}
+
+func contextsSetDefaultF(command *cobra.Command, args []string) error {
+	contextName := ""
+	defaults := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-h" || arg == "--help":
+			return command.Help()
+		case !strings.HasPrefix(arg, "-"):
+			if contextName != "" {
+				return fmt.Errorf("Unexpected argument %s", arg)
+			}
+			contextName = arg
+			continue
+		case !strings.HasPrefix(arg, "--"):
+			return fmt.Errorf("%s: flags have to be given by their long name", arg)
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		flags := flagsNamed(command.Root(), name)
+		if len(flags) == 0 {
+			return fmt.Errorf("No astartectl command has a --%s flag", name)
+		}
+		if !hasValue {
+			// Boolean flags can be given without a value
+			if flags[0].NoOptDefVal != "" && (i+1 == len(args) || strings.HasPrefix(args[i+1], "-")) {
+				value = flags[0].NoOptDefVal
+			} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				i++
+				value = args[i]
+			} else {
+				return fmt.Errorf("Flag --%s needs a value", name)
+			}
+		}
+
+		if isConfigSelectionFlag(name) {
+			if err := command.Flags().Set(name, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if !CanHaveDefault(name) {
+			return fmt.Errorf("--%s cannot have a default", name)
+		}
+		if !isValidFlagValue(flags, value) {
+			return fmt.Errorf("%s is not a valid value for --%s", value, name)
+		}
+		defaults[name] = value
+	}
+
+	if contextName == "" {
+		return errors.New("A context name has to be given")
+	}
+	if len(defaults) == 0 {
+		return errors.New("At least a flag has to be given")
+	}
+
+	configDir := config.GetConfigDir()
+	context, err := config.LoadContextConfiguration(configDir, contextName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if context.Defaults == nil {
+		context.Defaults = map[string]string{}
+	}
+	for name, value := range defaults {
+		context.Defaults[name] = value
+	}
+	if err := config.SaveContextConfiguration(configDir, contextName, context, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Defaults of context %s saved successfully\n", contextName)
+	return nil
+}
+
+func contextsUnsetDefaultF(command *cobra.Command, args []string) error {
+	contextName := args[0]
+	all, err := command.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	if !all && len(args) == 1 {
+		return errors.New("Either some flags or --all have to be given")
+	}
+
+	configDir := config.GetConfigDir()
+	context, err := config.LoadContextConfiguration(configDir, contextName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if all {
+		context.Defaults = nil
+	}
+	for _, name := range args[1:] {
+		name = strings.TrimPrefix(name, "--")
+		if _, ok := context.Defaults[name]; !ok {
+			fmt.Fprintf(os.Stderr, "warn: Context %s has no default for --%s\n", contextName, name)
+		}
+		delete(context.Defaults, name)
+	}
+	if len(context.Defaults) == 0 {
+		context.Defaults = nil
+	}
+	if err := config.SaveContextConfiguration(configDir, contextName, context, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Defaults of context %s saved successfully\n", contextName)
+	return nil
+}
+
+// flagsNamed returns the flags with the given name defined by command or by any of its subcommands
+func flagsNamed(command *cobra.Command, name string) []*pflag.Flag {
+	ret := []*pflag.Flag{}
+	if f := command.Flags().Lookup(name); f != nil {
+		ret = append(ret, f)
+	}
+	for _, c := range command.Commands() {
+		ret = append(ret, flagsNamed(c, name)...)
+	}
+	return ret
+}
+
+// isValidFlagValue returns whether value is accepted by at least one of flags. The flags are actually
+// set, which is harmless, as set-default does not run any of the commands defining them.
+func isValidFlagValue(flags []*pflag.Flag, value string) bool {
+	for _, f := range flags {
+		if f.Value.Set(value) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CanHaveDefault returns whether the flag with the given long name can be set through context defaults
+func CanHaveDefault(name string) bool {
+	if isConfigSelectionFlag(name) {
+		return false
+	}
+	for _, f := range nonDefaultableFlags {
+		if f == name {
+			return false
+		}
+	}
+	return true
+}
+
+func isConfigSelectionFlag(name string) bool {
+	for _, f := range configSelectionFlags {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// contextDefaultsCompletion completes the context name, and then the names of its defaults
+func contextDefaultsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return utils.ContextNamesCompletion(cmd, args, toComplete)
+	}
+	context, err := config.LoadContextConfiguration(config.GetConfigDir(), args[0])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	ret := []string{}
+	for name := range context.Defaults {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, cobra.ShellCompDirectiveNoFileComp
+}
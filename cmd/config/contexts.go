@@ -18,6 +18,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/astarte-platform/astartectl/config"
@@ -42,21 +44,23 @@ var contextsListCmd = &cobra.Command{
 }
 
 var contextsShowCmd = &cobra.Command{
-	Use:     "show <context_name>",
-	Short:   "Show context",
-	Long:    "Show a context in your astartectl configuration.",
-	Example: `  astartectl config contexts show mycontext`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    contextsShowF,
+	Use:               "show <context_name>",
+	Short:             "Show context",
+	Long:              "Show a context in your astartectl configuration.",
+	Example:           `  astartectl config contexts show mycontext`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsShowF,
 }
 
 var contextsGetRealmKeyCmd = &cobra.Command{
-	Use:     "get-realm-key <context_name>",
-	Short:   "Get the Realm key from a context",
-	Long:    "Get the Realm key from a context in your astartectl configuration. This will work only if a realm key is set",
-	Example: `  astartectl config contexts get-realm-key mycontext`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    contextsGetRealmKeyF,
+	Use:               "get-realm-key <context_name>",
+	Short:             "Get the Realm key from a context",
+	Long:              "Get the Realm key from a context in your astartectl configuration. This will work only if a realm key is set",
+	Example:           `  astartectl config contexts get-realm-key mycontext`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsGetRealmKeyF,
 }
 
 var contextsCreateCmd = &cobra.Command{
@@ -69,22 +73,36 @@ var contextsCreateCmd = &cobra.Command{
 }
 
 var contextsUpdateCmd = &cobra.Command{
-	Use:     "update <context_name>",
-	Short:   "Update context",
-	Long:    "Update a context in your astartectl configuration.",
-	Example: `  astartectl config contexts update mycontext --realm-key /path/to/private_key`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    contextsUpdateF,
+	Use:               "update <context_name>",
+	Short:             "Update context",
+	Long:              "Update a context in your astartectl configuration.",
+	Example:           `  astartectl config contexts update mycontext --realm-key /path/to/private_key`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsUpdateF,
 }
 
 var contextsDeleteCmd = &cobra.Command{
-	Use:     "delete <context_name>",
-	Short:   "Delete context",
-	Long:    "Delete a context in your Astarte instance.",
-	Example: `  astartectl config contexts delete mycontext`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    contextsDeleteF,
-	Aliases: []string{"del"},
+	Use:               "delete <context_name>",
+	Short:             "Delete context",
+	Long:              "Delete a context in your Astarte instance.",
+	Example:           `  astartectl config contexts delete mycontext`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsDeleteF,
+	Aliases:           []string{"del"},
+}
+
+var contextsRenameCmd = &cobra.Command{
+	Use:   "rename <old_context_name> <new_context_name>",
+	Short: "Rename context",
+	Long: `Rename a context, updating the current context when it is the renamed one.
+Should any step fail, the changes made so far are reverted.`,
+	Example:           `  astartectl config contexts rename mycontext production`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsRenameF,
+	Aliases:           []string{"mv"},
 }
 
 func init() {
@@ -125,6 +143,7 @@ func init() {
 		contextsCreateCmd,
 		contextsUpdateCmd,
 		contextsDeleteCmd,
+		contextsRenameCmd,
 	)
 }
 
@@ -189,6 +208,18 @@ func contextsShowF(command *cobra.Command, args []string) error {
 	} else {
 		fmt.Fprintln(w, "Cluster API URL Type:\tindividual")
 	}
+	if len(context.Defaults) > 0 {
+		names := []string{}
+		for name := range context.Defaults {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		defaults := []string{}
+		for _, name := range names {
+			defaults = append(defaults, fmt.Sprintf("--%s=%s", name, context.Defaults[name]))
+		}
+		fmt.Fprintf(w, "Defaults:\t%s\n", strings.Join(defaults, " "))
+	}
 	w.Flush()
 
 	return nil
@@ -247,8 +278,9 @@ func contextsDeleteF(command *cobra.Command, args []string) error {
 		os.Exit(1)
 	}
 
-	if ok, err := utils.AskForConfirmation(fmt.Sprintf("Will delete context %s. Are you sure you want to continue?", contextName)); !ok || err != nil {
-		return nil
+	if ok, err := utils.Confirm(command, fmt.Sprintf("Will delete context %s. Are you sure you want to continue?", contextName)); !ok || err != nil {
+		fmt.Fprintln(os.Stderr, "Aborting.")
+		os.Exit(1)
 	}
 
 	if err := config.DeleteContextConfiguration(config.GetConfigDir(), contextName); err != nil {
@@ -260,6 +292,18 @@ func contextsDeleteF(command *cobra.Command, args []string) error {
 	return nil
 }
 
+func contextsRenameF(command *cobra.Command, args []string) error {
+	oldName, newName := args[0], args[1]
+
+	if err := config.RenameContextConfiguration(config.GetConfigDir(), oldName, newName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Context %s renamed to %s successfully\n", oldName, newName)
+	return nil
+}
+
 func performContextCreation(contextName string, isUpdate bool, command *cobra.Command, args []string) error {
 	configDir := config.GetConfigDir()
 	realmName, err := command.Flags().GetString("realm-name")
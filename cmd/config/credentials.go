@@ -0,0 +1,60 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/spf13/cobra"
+)
+
+var setCredentialStoreCmd = &cobra.Command{
+	Use:   "set-credential-store <plaintext|keyring>",
+	Short: "Sets where private keys and tokens are stored",
+	Long: `Sets where Realm and Housekeeping private keys and tokens are stored.
+
+plaintext - Keys and tokens are stored in the configuration files. This is the default.
+keyring - Keys and tokens are stored in the OS keychain, and the configuration files only refer to them.
+When no keychain is available (e.g. on headless Linux systems), they are stored in a file encrypted with
+a passphrase, which is read from the ASTARTECTL_CREDENTIALS_PASSPHRASE environment variable or asked for.
+
+Keys and tokens of all existing contexts and clusters are migrated to the new store.`,
+	Example:   `  astartectl config set-credential-store keyring`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{config.PlaintextCredentialStore, config.KeyringCredentialStore},
+	RunE:      setCredentialStoreF,
+}
+
+func init() {
+	ConfigCmd.AddCommand(setCredentialStoreCmd)
+}
+
+func setCredentialStoreF(command *cobra.Command, args []string) error {
+	store := args[0]
+	if !config.IsValidCredentialStore(store) {
+		return fmt.Errorf("%s is not a valid credential store. Valid credential stores are %s and %s", store,
+			config.PlaintextCredentialStore, config.KeyringCredentialStore)
+	}
+
+	if err := config.MigrateCredentials(config.GetConfigDir(), store); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Credentials are now stored in %s\n", store)
+	return nil
+}
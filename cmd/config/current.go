@@ -15,17 +15,23 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var currentContextCmd = &cobra.Command{
 	Use:     "current-context",
 	Short:   "Shows the current astartectl configuration context",
-	Long:    `Shows the current astartectl configuration context.`,
+	Long:    `Shows the current astartectl configuration context, or the one given with --context or ASTARTE_CONTEXT.`,
 	Args:    cobra.ExactArgs(0),
 	RunE:    currentContextF,
 	Aliases: []string{"get-current-context"},
@@ -34,36 +40,84 @@ var currentContextCmd = &cobra.Command{
 var currentClusterCmd = &cobra.Command{
 	Use:     "current-cluster",
 	Short:   "Shows the cluster being used by the current astartectl configuration context",
-	Long:    `Shows the cluster being used by the current astartectl configuration context.`,
+	Long:    `Shows the cluster being used by the current astartectl configuration context, or the one given with --use-cluster or ASTARTE_CLUSTER.`,
 	Args:    cobra.ExactArgs(0),
 	RunE:    currentClusterF,
 	Aliases: []string{"get-current-cluster"},
 }
 
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Shows the effective astartectl configuration",
+	Long: `Shows the effective configuration used by astartectl commands, and where each value comes from.
+
+Values are resolved in this order of precedence: flags, environment variables, the current context
+and its cluster. These environment variables are supported, besides ASTARTECTL_<SETTING> ones:
+
+ASTARTE_CONTEXT - The context to use
+ASTARTE_CLUSTER - The cluster to use, rather than the one of the context
+ASTARTE_URL - Base url for your Astarte deployment
+ASTARTE_REALM - The name of the realm
+ASTARTE_TOKEN - Token for authenticating against Astarte APIs
+ASTARTE_REALM_KEY - Path to the PEM encoded realm private key
+ASTARTE_HOUSEKEEPING_KEY - Path to the PEM encoded housekeeping private key
+
+Secrets such as keys and tokens are never shown. Flags specific to a command (e.g. --realm-name)
+are not taken into account.`,
+	Example: `  astartectl config current`,
+	Args:    cobra.ExactArgs(0),
+	RunE:    currentF,
+}
+
 var setCurrentContextCmd = &cobra.Command{
-	Use:     "set-current-context <context>",
-	Short:   "Sets the current astartectl configuration context",
-	Long:    `Sets the current astartectl configuration context`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    setCurrentContextF,
-	Aliases: []string{"use-context"},
+	Use:   "set-current-context <context>",
+	Short: "Sets the current astartectl configuration context",
+	Long: `Sets the current astartectl configuration context.
+
+<context> does not need to be the full name of the context: a prefix, or some of its characters in
+order (e.g. "prdeu" for "production-eu"), is enough as long as it matches a single context.
+Use - as <context> to switch back to the previous context.`,
+	Example: `  astartectl config use-context production-eu
+  astartectl config use-context prod
+  astartectl config use-context -`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              setCurrentContextF,
+	Aliases:           []string{"use-context"},
 }
 
 func init() {
 	ConfigCmd.AddCommand(currentContextCmd)
 	ConfigCmd.AddCommand(currentClusterCmd)
+	ConfigCmd.AddCommand(currentCmd)
 	ConfigCmd.AddCommand(setCurrentContextCmd)
 }
 
 func currentContextF(command *cobra.Command, args []string) error {
-	baseConfig := config.GetBaseConfig(config.GetConfigDir())
-	fmt.Println(baseConfig.CurrentContext)
+	contextOverride, err := command.Flags().GetString("context")
+	if err != nil {
+		return err
+	}
+	contextName, _ := config.CurrentContextName(config.GetConfigDir(), contextOverride)
+	fmt.Println(contextName)
 	return nil
 }
 
 func currentClusterF(command *cobra.Command, args []string) error {
-	baseConfig := config.GetBaseConfig(config.GetConfigDir())
-	currentContext, err := config.LoadContextConfiguration(config.GetConfigDir(), baseConfig.CurrentContext)
+	contextOverride, err := command.Flags().GetString("context")
+	if err != nil {
+		return err
+	}
+	clusterOverride, err := command.Flags().GetString("use-cluster")
+	if err != nil {
+		return err
+	}
+	if clusterName, _ := config.ClusterOverrideName(clusterOverride); clusterName != "" {
+		fmt.Println(clusterName)
+		return nil
+	}
+	contextName, _ := config.CurrentContextName(config.GetConfigDir(), contextOverride)
+	currentContext, err := config.LoadContextConfiguration(config.GetConfigDir(), contextName)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -73,13 +127,66 @@ func currentClusterF(command *cobra.Command, args []string) error {
 	return nil
 }
 
+func currentF(command *cobra.Command, args []string) error {
+	contextOverride, err := command.Flags().GetString("context")
+	if err != nil {
+		return err
+	}
+	clusterOverride, err := command.Flags().GetString("use-cluster")
+	if err != nil {
+		return err
+	}
+
+	configDir := config.GetConfigDir()
+	contextName, contextSource := config.CurrentContextName(configDir, contextOverride)
+	clusterName, clusterSource := config.ClusterOverrideName(clusterOverride)
+	var contextSettings, clusterSettings map[string]interface{}
+	if contextName != "" || clusterName != "" {
+		if contextSettings, clusterName, clusterSettings, err = config.LoadContextSettings(configDir, contextName, clusterName); err != nil {
+			fmt.Fprintf(os.Stderr, "warn: %s\n", err)
+		}
+	}
+	if clusterSource == "" {
+		clusterSource = "context " + contextName
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Setting", "Value", "Source"})
+	t.AppendRow(table.Row{"config-dir", strings.Join(config.GetConfigDirStack(), string(os.PathListSeparator)), config.GetConfigDirSource()})
+	t.AppendRow(table.Row{"context", contextName, contextSource})
+	if clusterName != "" {
+		t.AppendRow(table.Row{"cluster", clusterName, clusterSource})
+	}
+	for _, s := range config.Settings {
+		source := config.SettingSource(s, command.Flags(), contextName, contextSettings, clusterName, clusterSettings)
+		if source == "" {
+			continue
+		}
+		value := viper.GetString(s.Key)
+		if s.Secret {
+			value = "(hidden)"
+		}
+		t.AppendRow(table.Row{s.Key, value, source})
+	}
+	t.Render()
+
+	return nil
+}
+
 func setCurrentContextF(command *cobra.Command, args []string) error {
-	if err := updateCurrentContext(args[0]); err != nil {
+	contextName, err := resolveContextName(config.GetConfigDir(), args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := updateCurrentContext(contextName); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Context switched to %s\n", args[0])
+	fmt.Printf("Context switched to %s\n", contextName)
 	return nil
 }
 
@@ -87,3 +194,61 @@ func updateCurrentContext(newCurrentContext string) error {
 	config.UpdateBaseConfigWithContext(config.GetConfigDir(), newCurrentContext)
 	return nil
 }
+
+// resolveContextName returns the name of the context matched by name, which is either the name of a
+// context, a prefix or a fuzzy match of a single context, or - for the previous context
+func resolveContextName(configDir, name string) (string, error) {
+	contexts, err := config.ListContextConfigurations(configDir)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "-" {
+		previous := config.GetBaseConfig(configDir).PreviousContext
+		if previous == "" {
+			return "", errors.New("There is no previous context to switch back to")
+		}
+		for _, c := range contexts {
+			if c == previous {
+				return c, nil
+			}
+		}
+		return "", fmt.Errorf("The previous context %s does not exist anymore", previous)
+	}
+
+	prefixMatches, fuzzyMatches := []string{}, []string{}
+	for _, c := range contexts {
+		switch {
+		case c == name:
+			return c, nil
+		case strings.HasPrefix(c, name):
+			prefixMatches = append(prefixMatches, c)
+		case isSubsequence(name, c):
+			fuzzyMatches = append(fuzzyMatches, c)
+		}
+	}
+	// Prefixes are more specific than fuzzy matches
+	matches := prefixMatches
+	if len(matches) == 0 {
+		matches = fuzzyMatches
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("No context matches %s", name)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("%s is ambiguous, it matches these contexts: %s", name, strings.Join(matches, ", "))
+}
+
+// isSubsequence returns whether all the characters of s appear in target in the same order
+func isSubsequence(s, target string) bool {
+	remaining := []rune(strings.ToLower(s))
+	for _, c := range strings.ToLower(target) {
+		if len(remaining) > 0 && remaining[0] == c {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
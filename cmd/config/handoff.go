@@ -0,0 +1,176 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/auth"
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var contextsIssueHandoffCmd = &cobra.Command{
+	Use:   "issue-handoff <context_name>",
+	Short: "Issue a time-limited context bundle",
+	Long: `Issue a self-contained, time-limited configuration bundle out of a context, which can be shared
+for temporary access to the context's realm and imported with 'astartectl config import'.
+
+The bundle contains the cluster API URLs and a short-lived token signed with the context's Realm key.
+No private keys (neither the Realm nor the Housekeeping one) are ever included in the bundle.
+The context must hold a Realm key.
+
+--claims controls which claims are granted to the token. It can be one of these presets:
+
+read-only - Allows only GET requests on all Realm APIs, and joining and watching Astarte Channels.
+full - Allows any request on all Realm APIs.
+
+Otherwise, it is a list of claims applied to all Realm APIs, with the same syntax of 'astartectl utils gen-jwt'.`,
+	Example:           `  astartectl config contexts issue-handoff mycontext --ttl 2h --claims read-only -o handoff.json`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: utils.ContextNamesCompletion,
+	RunE:              contextsIssueHandoffF,
+}
+
+var handoffServices = []astarteservices.AstarteService{
+	astarteservices.AppEngine,
+	astarteservices.Channels,
+	astarteservices.Flow,
+	astarteservices.Pairing,
+	astarteservices.RealmManagement,
+}
+
+func init() {
+	contextsIssueHandoffCmd.Flags().Duration("ttl", time.Hour, "How long the handoff token will be valid for.")
+	contextsIssueHandoffCmd.Flags().StringSlice("claims", []string{"read-only"}, "The claims granted to the handoff token. Either read-only, full, or a list of claims.")
+	contextsIssueHandoffCmd.Flags().String("name", "", "The name of the context in the bundle. Defaults to <context_name>-handoff.")
+	contextsIssueHandoffCmd.Flags().StringP("output", "o", "", "If specified, the bundle will be saved to specified file")
+
+	contextsCmd.AddCommand(contextsIssueHandoffCmd)
+}
+
+func contextsIssueHandoffF(command *cobra.Command, args []string) error {
+	contextName := args[0]
+	ttl, err := command.Flags().GetDuration("ttl")
+	if err != nil {
+		return err
+	}
+	claims, err := command.Flags().GetStringSlice("claims")
+	if err != nil {
+		return err
+	}
+	handoffContextName, err := command.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	output, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	if ttl < time.Second {
+		return errors.New("--ttl must be at least 1s")
+	}
+	if handoffContextName == "" {
+		handoffContextName = contextName + "-handoff"
+	}
+
+	configDir := config.GetConfigDir()
+	context, err := config.LoadContextConfiguration(configDir, contextName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if context.Realm.Name == "" || context.Realm.Key == "" {
+		fmt.Fprintf(os.Stderr, "Context %s has no Realm Key associated, cannot issue a handoff token\n", contextName)
+		os.Exit(1)
+	}
+	cluster, err := config.LoadClusterConfiguration(configDir, context.Cluster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(context.Realm.Key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	token, err := auth.GenerateAstarteJWTFromPEMKey(decoded, handoffServicesAndClaims(claims), int64(ttl.Seconds()))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Strip away any credential from the cluster
+	cluster.Housekeeping = config.HousekeepingConfiguration{}
+	bundle := config.Bundle{
+		BaseConfig: config.BaseConfigFile{CurrentContext: handoffContextName},
+		Clusters:   map[string]config.ClusterFile{context.Cluster: cluster},
+		Contexts: map[string]config.ContextFile{
+			handoffContextName: {
+				Cluster: context.Cluster,
+				Realm:   config.RealmConfiguration{Name: context.Realm.Name, Token: token},
+			},
+		},
+	}
+
+	jsonBytes, err := json.Marshal(bundle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		fmt.Println(string(jsonBytes))
+	} else {
+		// The bundle holds a valid token, don't let anybody else read it
+		if err := os.WriteFile(output, jsonBytes, 0600); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Handoff bundle for context %s issued, valid until %s\n", handoffContextName,
+		time.Now().Add(ttl).Format(time.RFC3339))
+	return nil
+}
+
+func handoffServicesAndClaims(claims []string) map[astarteservices.AstarteService][]string {
+	ret := map[astarteservices.AstarteService][]string{}
+	for _, svc := range handoffServices {
+		switch {
+		case len(claims) == 1 && claims[0] == "read-only":
+			if svc == astarteservices.Channels {
+				ret[svc] = []string{"JOIN::.*", "WATCH::.*"}
+			} else {
+				ret[svc] = []string{"GET::.*"}
+			}
+		case len(claims) == 1 && claims[0] == "full":
+			// An empty list means all claims
+			ret[svc] = []string{}
+		default:
+			ret[svc] = claims
+		}
+	}
+	return ret
+}
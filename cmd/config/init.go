@@ -0,0 +1,478 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/auth"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively configure astartectl for an Astarte cluster",
+	Long: `Interactively configure astartectl for an Astarte cluster, creating a cluster and a context and
+making the latter the current one.
+
+The wizard probes the health endpoint of every Astarte API under the given base URL, and asks for
+the URL of the APIs which cannot be found there. When a Housekeeping key is supplied, the realms of the
+cluster are listed, and the realm is created if it does not exist yet. A new realm key is generated
+unless one is supplied.
+
+Values given through flags are used as defaults for the questions. With --yes, no question
+is asked, the realm is created only when --create-realm is set, and an existing cluster or
+context is overwritten only when --overwrite is set.`,
+	Example: `  astartectl config init
+  astartectl config init --api-url https://api.astarte.example.com --realm-name myrealm --realm-private-key myrealm_private.pem -y`,
+	Args: cobra.NoArgs,
+	RunE: configInitF,
+}
+
+// initProbedServices maps Astarte services to their path under the Astarte base URL
+var initProbedServices = []struct {
+	Name          string
+	DefaultPrefix string
+}{
+	{"appengine", "appengine"},
+	{"realm-management", "realmmanagement"},
+	{"pairing", "pairing"},
+	{"housekeeping", "housekeeping"},
+	{"flow", "flow"},
+}
+
+func init() {
+	configInitCmd.Flags().String("api-url", "", "The base URL of the Astarte APIs")
+	configInitCmd.Flags().String("housekeeping-key", "", "Path to the PEM encoded Housekeeping private key")
+	if err := configInitCmd.MarkFlagFilename("housekeeping-key"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	configInitCmd.Flags().StringP("realm-name", "r", "", "The name of the realm")
+	configInitCmd.Flags().StringP("realm-private-key", "k", "", "Path to the PEM encoded realm private key. When not given, a new key is generated for new realms")
+	if err := configInitCmd.MarkFlagFilename("realm-private-key"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	configInitCmd.Flags().Bool("create-realm", false, "In non-interactive mode, create the realm when it does not exist")
+	configInitCmd.Flags().String("cluster-name", "", "The name of the cluster to save. Defaults to the API host name")
+	configInitCmd.Flags().String("context-name", "", "The name of the context to save. Defaults to <host>-realm-<realm_name>")
+	configInitCmd.Flags().Bool("overwrite", false, "In non-interactive mode, overwrite an existing cluster or context with the same name")
+	configInitCmd.Flags().Duration("probe-timeout", 5*time.Second, "The maximum time to wait for each API health endpoint")
+	utils.AddNonInteractiveFlag(configInitCmd.Flags())
+
+	ConfigCmd.AddCommand(configInitCmd)
+}
+
+func configInitF(command *cobra.Command, args []string) error {
+	apiURL, err := command.Flags().GetString("api-url")
+	if err != nil {
+		return err
+	}
+	housekeepingKey, err := command.Flags().GetString("housekeeping-key")
+	if err != nil {
+		return err
+	}
+	realmName, err := command.Flags().GetString("realm-name")
+	if err != nil {
+		return err
+	}
+	realmPrivateKey, err := command.Flags().GetString("realm-private-key")
+	if err != nil {
+		return err
+	}
+	createRealm, err := command.Flags().GetBool("create-realm")
+	if err != nil {
+		return err
+	}
+	clusterName, err := command.Flags().GetString("cluster-name")
+	if err != nil {
+		return err
+	}
+	contextName, err := command.Flags().GetString("context-name")
+	if err != nil {
+		return err
+	}
+	overwrite, err := command.Flags().GetBool("overwrite")
+	if err != nil {
+		return err
+	}
+	probeTimeout, err := command.Flags().GetDuration("probe-timeout")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+	configDir := config.GetConfigDir()
+
+	// Cluster
+	apiURL, err = utils.PromptChoice("Astarte API base URL (e.g. https://api.astarte.example.com):", apiURL, false, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	baseURL, err := url.Parse(apiURL)
+	if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+		fmt.Fprintf(os.Stderr, "%s is not a valid URL\n", apiURL)
+		os.Exit(1)
+	}
+	cluster := config.ClusterFile{URL: apiURL}
+
+	fmt.Println("Probing Astarte APIs...")
+	httpClient := utils.NewHTTPClient()
+	httpClient.Timeout = probeTimeout
+	for _, service := range initProbedServices {
+		serviceURL := *baseURL
+		serviceURL.Path = path.Join(serviceURL.Path, service.DefaultPrefix)
+		if isServiceHealthy(httpClient, serviceURL) {
+			fmt.Printf("  %s: found at %s\n", service.Name, serviceURL.String())
+			continue
+		}
+		fmt.Printf("  %s: not found at %s\n", service.Name, serviceURL.String())
+
+		individualURL, err := utils.PromptChoice(fmt.Sprintf("URL of the %s API (leave empty to skip):", service.Name), "", true, nonInteractive)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if individualURL == "" {
+			continue
+		}
+		parsedURL, err := url.Parse(individualURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !isServiceHealthy(httpClient, *parsedURL) {
+			fmt.Fprintf(os.Stderr, "warn: %s is not reachable, saving it anyway\n", individualURL)
+		}
+		setIndividualURL(&cluster.IndividualURLs, service.Name, individualURL)
+	}
+	fmt.Println()
+
+	housekeepingKey, err = utils.PromptChoice("Path to the Housekeeping private key (leave empty if you don't have it):", housekeepingKey, true, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var housekeepingClient *client.Client
+	if housekeepingKey != "" {
+		contents, err := os.ReadFile(housekeepingKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cluster.Housekeeping.Key = base64.StdEncoding.EncodeToString(contents)
+
+		housekeepingURL := cluster.IndividualURLs.Housekeeping
+		if housekeepingURL == "" {
+			u := *baseURL
+			u.Path = path.Join(u.Path, "housekeeping")
+			housekeepingURL = u.String()
+		}
+		housekeepingClient, err = client.New(
+			client.WithHousekeepingURL(housekeepingURL),
+			client.WithPrivateKey(contents),
+			client.WithHTTPClient(utils.NewHTTPClient()),
+		)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// Realm
+	var existingRealms []string
+	if housekeepingClient != nil {
+		existingRealms, err = listRealms(housekeepingClient)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: could not list realms: %s\n", err)
+		} else if len(existingRealms) > 0 {
+			fmt.Println("Realms in the cluster:")
+			utils.PrintList(existingRealms)
+			fmt.Println()
+		}
+	}
+	realmName, err = utils.PromptChoice("Realm name:", realmName, false, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	willCreateRealm := false
+	if housekeepingClient != nil && existingRealms != nil && !slices.Contains(existingRealms, realmName) {
+		if nonInteractive {
+			willCreateRealm = createRealm
+		} else {
+			willCreateRealm, err = utils.AskForConfirmation(fmt.Sprintf("Realm %s does not exist. Do you want to create it?", realmName))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if !willCreateRealm {
+			fmt.Fprintf(os.Stderr, "warn: realm %s does not exist in the cluster\n", realmName)
+		}
+	}
+
+	keyQuestion := "Path to the realm private key (leave empty if you don't have it):"
+	if willCreateRealm {
+		keyQuestion = "Path to the realm private key (leave empty to generate a new one):"
+	}
+	realmPrivateKey, err = utils.PromptChoice(keyQuestion, realmPrivateKey, true, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var realmKeyContent []byte
+	switch {
+	case realmPrivateKey != "":
+		realmKeyContent, err = os.ReadFile(realmPrivateKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case willCreateRealm:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		marshaled, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		realmKeyContent = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: marshaled})
+	}
+
+	// Names
+	if clusterName == "" {
+		clusterName = baseURL.Hostname()
+	}
+	clusterName, err = utils.PromptChoice("Cluster name:", clusterName, false, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if contextName == "" {
+		contextName = fmt.Sprintf("%s-realm-%s", baseURL.Hostname(), realmName)
+	}
+	contextName, err = utils.PromptChoice("Context name:", contextName, false, nonInteractive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_, clusterErr := config.LoadClusterConfiguration(configDir, clusterName)
+	_, contextErr := config.LoadContextConfiguration(configDir, contextName)
+	if nonInteractive && !overwrite {
+		if clusterErr == nil {
+			fmt.Fprintf(os.Stderr, "Cluster %s already exists. Use --overwrite to replace it, or --cluster-name to choose another name\n", clusterName)
+			os.Exit(1)
+		}
+		if contextErr == nil {
+			fmt.Fprintf(os.Stderr, "Context %s already exists. Use --overwrite to replace it, or --context-name to choose another name\n", contextName)
+			os.Exit(1)
+		}
+	}
+	fmt.Println()
+
+	fmt.Println("Will save the following configuration:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "Cluster:\t%s%s\n", clusterName, existingSuffix(clusterErr == nil))
+	fmt.Fprintf(w, "Astarte API URL:\t%s\n", cluster.URL)
+	for _, service := range initProbedServices {
+		if u := getIndividualURL(cluster.IndividualURLs, service.Name); u != "" {
+			fmt.Fprintf(w, "%s API URL:\t%s\n", service.Name, u)
+		}
+	}
+	fmt.Fprintf(w, "Context:\t%s%s\n", contextName, existingSuffix(contextErr == nil))
+	if willCreateRealm {
+		fmt.Fprintf(w, "Realm:\t%s (will be created)\n", realmName)
+	} else {
+		fmt.Fprintf(w, "Realm:\t%s\n", realmName)
+	}
+	switch {
+	case realmPrivateKey != "":
+		fmt.Fprintf(w, "Realm key:\t%s\n", realmPrivateKey)
+	case realmKeyContent != nil:
+		fmt.Fprint(w, "Realm key:\tnewly generated\n")
+	default:
+		fmt.Fprint(w, "Realm key:\tnone\n")
+	}
+	w.Flush()
+	fmt.Println()
+
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	if willCreateRealm {
+		if err := createInitRealm(housekeepingClient, realmName, realmKeyContent); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Realm %s created successfully\n", realmName)
+	}
+
+	if err := config.SaveClusterConfiguration(configDir, clusterName, cluster, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Cluster %s saved successfully\n", clusterName)
+
+	context := config.ContextFile{Cluster: clusterName, Realm: config.RealmConfiguration{Name: realmName}}
+	if realmKeyContent != nil {
+		context.Realm.Key = base64.StdEncoding.EncodeToString(realmKeyContent)
+	}
+	if err := config.SaveContextConfiguration(configDir, contextName, context, true); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Context %s saved successfully\n", contextName)
+
+	if err := updateCurrentContext(contextName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Context switched to %s\n", contextName)
+
+	if realmPrivateKey == "" && realmKeyContent != nil {
+		fmt.Println()
+		fmt.Println("A new private key was generated for the realm and saved in your configuration.")
+		fmt.Printf("You can access it with \"astartectl config contexts get-realm-key %s\".\n", contextName)
+	}
+	return nil
+}
+
+func isServiceHealthy(httpClient *http.Client, serviceURL url.URL) bool {
+	serviceURL.Path = path.Join(serviceURL.Path, "health")
+	res, err := httpClient.Get(serviceURL.String())
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
+
+func setIndividualURL(urls *config.IndividualURLsConfiguration, service, serviceURL string) {
+	switch service {
+	case "appengine":
+		urls.AppEngine = serviceURL
+	case "realm-management":
+		urls.RealmManagement = serviceURL
+	case "pairing":
+		urls.Pairing = serviceURL
+	case "housekeeping":
+		urls.Housekeeping = serviceURL
+	case "flow":
+		urls.Flow = serviceURL
+	}
+}
+
+func getIndividualURL(urls config.IndividualURLsConfiguration, service string) string {
+	switch service {
+	case "appengine":
+		return urls.AppEngine
+	case "realm-management":
+		return urls.RealmManagement
+	case "pairing":
+		return urls.Pairing
+	case "housekeeping":
+		return urls.Housekeeping
+	case "flow":
+		return urls.Flow
+	}
+	return ""
+}
+
+func existingSuffix(exists bool) string {
+	if exists {
+		return " (existing, will be overwritten)"
+	}
+	return ""
+}
+
+func listRealms(housekeepingClient *client.Client) ([]string, error) {
+	listRealmsReq, err := housekeepingClient.ListRealms()
+	if err != nil {
+		return nil, err
+	}
+	listRealmsRes, err := listRealmsReq.Run(housekeepingClient)
+	if err != nil {
+		return nil, err
+	}
+	rawRealms, err := listRealmsRes.Parse()
+	if err != nil {
+		return nil, err
+	}
+	realms, ok := rawRealms.([]string)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected realms listing from Housekeeping: %v", rawRealms)
+	}
+	return realms, nil
+}
+
+func createInitRealm(housekeepingClient *client.Client, realmName string, privateKey []byte) error {
+	key, err := auth.ParsePrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.New("Unsupported private key type")
+	}
+	pkixBytes, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	var publicKey bytes.Buffer
+	if err := pem.Encode(&publicKey, &pem.Block{Type: "PUBLIC KEY", Bytes: pkixBytes}); err != nil {
+		return err
+	}
+
+	createRealmReq, err := housekeepingClient.CreateRealm(
+		client.WithRealmName(realmName),
+		client.WithRealmPublicKey(publicKey.String()),
+	)
+	if err != nil {
+		return err
+	}
+	createRealmRes, err := createRealmReq.Run(housekeepingClient)
+	if err != nil {
+		return err
+	}
+	_, _ = createRealmRes.Parse()
+	return nil
+}
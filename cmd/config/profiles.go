@@ -0,0 +1,86 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/spf13/cobra"
+)
+
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "Manage configuration profiles",
+	Long: `Manage configuration profiles. A profile is a configuration directory of its own, with its own clusters,
+contexts and current context, e.g. to keep work and personal, or production and staging, configurations apart.
+
+A profile is used with --config-profile <profile> or the ASTARTECTL_CONFIG_PROFILE environment variable, and it is
+created as soon as anything is saved to it, e.g. with 'astartectl --config-profile <profile> config init'.
+--config-dir and ASTARTECTL_CONFIG_DIR take precedence over profiles.`,
+	Aliases: []string{"profile"},
+}
+
+var profilesListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List configuration profiles",
+	Long:    "List configuration profiles, along with the default configuration directory. The one in use is marked with *.",
+	Example: `  astartectl config profiles list`,
+	Args:    cobra.NoArgs,
+	RunE:    profilesListF,
+	Aliases: []string{"ls"},
+}
+
+func init() {
+	profilesCmd.AddCommand(profilesListCmd)
+
+	ConfigCmd.AddCommand(profilesCmd)
+}
+
+func profilesListF(command *cobra.Command, args []string) error {
+	profiles, err := config.ListConfigProfiles()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	inUse := config.GetConfigDir()
+	inUseListed := false
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tCONFIG DIR\tCLUSTERS\tCONTEXTS\tCURRENT CONTEXT")
+	printProfile := func(name, dir string) {
+		clusters, contexts, currentContext, err := config.ConfigDirSummary(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Could not read profile %s: %s\n", name, err)
+		}
+		if dir == inUse {
+			fmt.Fprint(w, "* ")
+			inUseListed = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", name, dir, clusters, contexts, currentContext)
+	}
+	printProfile("(default)", config.GetDefaultConfigDir())
+	for _, p := range profiles {
+		printProfile(p, config.GetConfigProfileDir(p))
+	}
+	w.Flush()
+
+	if !inUseListed {
+		fmt.Printf("\nNo profile is in use, as the config directory is %s (from %s).\n", inUse, config.GetConfigDirSource())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/spf13/cobra"
+)
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manage cached tokens",
+	Long: `Manage the tokens astartectl mints from Realm and Housekeeping private keys.
+
+Minted tokens are cached in the configuration directory and reused by subsequent invocations until they
+are about to expire, when they are renewed automatically.`,
+}
+
+var tokensPurgeCmd = &cobra.Command{
+	Use:     "purge",
+	Short:   "Remove all cached tokens",
+	Long:    `Remove all cached tokens. New tokens will be minted from private keys when needed.`,
+	Example: `  astartectl config tokens purge`,
+	Args:    cobra.NoArgs,
+	RunE:    tokensPurgeF,
+}
+
+func init() {
+	ConfigCmd.AddCommand(tokensCmd)
+
+	tokensCmd.AddCommand(tokensPurgeCmd)
+}
+
+func tokensPurgeF(command *cobra.Command, args []string) error {
+	purged, err := config.PurgeTokenCache(config.GetConfigDir())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Purged %d cached tokens\n", purged)
+	return nil
+}
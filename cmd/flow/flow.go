@@ -0,0 +1,76 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"errors"
+	"net/url"
+	"path"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// FlowCmd represents the flow command
+var FlowCmd = &cobra.Command{
+	Use:               "flow",
+	Short:             "Interact with Astarte Flow API",
+	Long:              `Interact with Astarte Flow API to manage pipelines and flows.`,
+	PersistentPreRunE: flowPersistentPreRunE,
+}
+
+var realm string
+var flowAPIClient *utils.RawAPIClient
+var flowURL *url.URL
+
+func init() {
+	FlowCmd.PersistentFlags().StringP("realm-key", "k", "",
+		"Path to realm private key used to generate JWT for authentication")
+	_ = FlowCmd.MarkPersistentFlagFilename("realm-key")
+	FlowCmd.PersistentFlags().String("flow-url", "",
+		"Flow API base URL. Defaults to <astarte-url>/flow.")
+	FlowCmd.PersistentFlags().StringP("realm-name", "r", "",
+		"The name of the realm that will be queried")
+	_ = FlowCmd.RegisterFlagCompletionFunc("realm-name", utils.RealmNamesCompletion)
+}
+
+func flowPersistentPreRunE(cmd *cobra.Command, args []string) error {
+	_ = viper.BindPFlag("individual-urls.flow", cmd.Flags().Lookup("flow-url"))
+	_ = viper.BindPFlag("realm.key-file", cmd.Flags().Lookup("realm-key"))
+	var err error
+	flowAPIClient, err = utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	flowURL, err = utils.ServiceURL("individual-urls.flow", "flow")
+	if err != nil {
+		return err
+	}
+
+	_ = viper.BindPFlag("realm.name", cmd.Flags().Lookup("realm-name"))
+	realm = viper.GetString("realm.name")
+	if realm == "" {
+		return errors.New("realm is required")
+	}
+
+	return nil
+}
+
+func flowAPIURL(elems ...string) *url.URL {
+	ret := *flowURL
+	ret.Path = path.Join(append([]string{ret.Path, "v1", realm}, elems...)...)
+	return &ret
+}
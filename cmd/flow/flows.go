@@ -0,0 +1,180 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var flowsCmd = &cobra.Command{
+	Use:     "flows",
+	Short:   "Manage flows",
+	Long:    `List, show, start or stop flows in your realm. A flow is a running instance of a pipeline.`,
+	Aliases: []string{"instances"},
+}
+
+var flowsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List flows",
+	Long:    `List the names of the flows running in the realm.`,
+	Example: `  astartectl flow flows list`,
+	RunE:    flowsListF,
+	Aliases: []string{"ls"},
+}
+
+var flowsShowCmd = &cobra.Command{
+	Use:     "show <flow_name>",
+	Short:   "Show flow",
+	Long:    `Show the pipeline and the configuration of a flow running in the realm.`,
+	Example: `  astartectl flow flows show my-flow`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    flowsShowF,
+}
+
+var flowsStartCmd = &cobra.Command{
+	Use:   "start <flow_name> <pipeline_name>",
+	Short: "Start a flow",
+	Long: `Start a new flow named <flow_name>, running the pipeline <pipeline_name>.
+The configuration of the flow can be provided as a JSON file with --config, and it must match the
+schema of the pipeline.`,
+	Example: `  astartectl flow flows start my-flow my-pipeline --config my-flow-config.json`,
+	Args:    cobra.ExactArgs(2),
+	RunE:    flowsStartF,
+}
+
+var flowsStopCmd = &cobra.Command{
+	Use:     "stop <flow_name>",
+	Short:   "Stop a flow",
+	Long:    `Stops and deletes the specified flow from the realm.`,
+	Example: `  astartectl flow flows stop my-flow`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    flowsStopF,
+}
+
+// flowDefinition is a flow, as represented by Flow API
+type flowDefinition struct {
+	Name     string                 `json:"name"`
+	Pipeline string                 `json:"pipeline"`
+	Config   map[string]interface{} `json:"config"`
+}
+
+func init() {
+	flowsStartCmd.Flags().String("config", "", "Path to a JSON file containing the configuration of the flow.")
+	_ = flowsStartCmd.MarkFlagFilename("config")
+	utils.AddNonInteractiveFlag(flowsStopCmd.Flags())
+
+	FlowCmd.AddCommand(flowsCmd)
+
+	flowsCmd.AddCommand(
+		flowsListCmd,
+		flowsShowCmd,
+		flowsStartCmd,
+		flowsStopCmd,
+	)
+}
+
+func flowsListF(command *cobra.Command, args []string) error {
+	data, err := flowAPIClient.Do(http.MethodGet, flowAPIURL("flows"), nil, http.StatusOK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	flows := []string{}
+	if err := json.Unmarshal(data, &flows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	utils.PrintList(flows)
+	return nil
+}
+
+func flowsShowF(command *cobra.Command, args []string) error {
+	data, err := flowAPIClient.Do(http.MethodGet, flowAPIURL("flows", args[0]), nil, http.StatusOK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	flow := flowDefinition{}
+	if err := json.Unmarshal(data, &flow); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	respJSON, err := json.MarshalIndent(flow, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(respJSON))
+	return nil
+}
+
+func flowsStartF(command *cobra.Command, args []string) error {
+	configFile, err := command.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+
+	flow := flowDefinition{Name: args[0], Pipeline: args[1], Config: map[string]interface{}{}}
+	if configFile != "" {
+		configContent, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(configContent, &flow.Config); err != nil {
+			return fmt.Errorf("Invalid flow configuration: %w", err)
+		}
+	}
+
+	if _, err := flowAPIClient.Do(http.MethodPost, flowAPIURL("flows"), flow, http.StatusCreated); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func flowsStopF(command *cobra.Command, args []string) error {
+	flowName := args[0]
+	nonInteractive := utils.NonInteractive(command)
+
+	if !nonInteractive {
+		confirmation, err := utils.AskForConfirmation(fmt.Sprintf("Will stop flow %s in realm %s. Do you want to continue?", flowName, realm))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !confirmation {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	if _, err := flowAPIClient.Do(http.MethodDelete, flowAPIURL("flows", flowName), nil, http.StatusNoContent); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
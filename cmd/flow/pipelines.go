@@ -0,0 +1,178 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var pipelinesCmd = &cobra.Command{
+	Use:     "pipelines",
+	Short:   "Manage pipelines",
+	Long:    `List, show, install or delete pipelines in your realm.`,
+	Aliases: []string{"pipeline"},
+}
+
+var pipelinesListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List pipelines",
+	Long:    `List the names of the pipelines installed in the realm.`,
+	Example: `  astartectl flow pipelines list`,
+	RunE:    pipelinesListF,
+	Aliases: []string{"ls"},
+}
+
+var pipelinesShowCmd = &cobra.Command{
+	Use:     "show <pipeline_name>",
+	Short:   "Show pipeline",
+	Long:    `Show the definition of a pipeline installed in the realm.`,
+	Example: `  astartectl flow pipelines show my-pipeline`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    pipelinesShowF,
+}
+
+var pipelinesInstallCmd = &cobra.Command{
+	Use:   "install <pipeline_file>",
+	Short: "Install pipeline",
+	Long: `Install the given pipeline in the realm.
+<pipeline_file> must be a path to a JSON file containing the pipeline definition, with its name, source,
+and optionally its description and the JSON schema of its configuration.`,
+	Example: `  astartectl flow pipelines install my-pipeline.json`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    pipelinesInstallF,
+}
+
+var pipelinesDeleteCmd = &cobra.Command{
+	Use:     "delete <pipeline_name>",
+	Short:   "Delete pipeline",
+	Long:    `Deletes the specified pipeline from the realm.`,
+	Example: `  astartectl flow pipelines delete my-pipeline`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    pipelinesDeleteF,
+	Aliases: []string{"del"},
+}
+
+// pipelineDefinition is a pipeline, as represented by Flow API
+type pipelineDefinition struct {
+	Name        string          `json:"name"`
+	Source      string          `json:"source"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+func init() {
+	utils.AddNonInteractiveFlag(pipelinesDeleteCmd.Flags())
+
+	FlowCmd.AddCommand(pipelinesCmd)
+
+	pipelinesCmd.AddCommand(
+		pipelinesListCmd,
+		pipelinesShowCmd,
+		pipelinesInstallCmd,
+		pipelinesDeleteCmd,
+	)
+}
+
+func pipelinesListF(command *cobra.Command, args []string) error {
+	data, err := flowAPIClient.Do(http.MethodGet, flowAPIURL("pipelines"), nil, http.StatusOK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	pipelines := []string{}
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	utils.PrintList(pipelines)
+	return nil
+}
+
+func pipelinesShowF(command *cobra.Command, args []string) error {
+	data, err := flowAPIClient.Do(http.MethodGet, flowAPIURL("pipelines", args[0]), nil, http.StatusOK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	pipeline := pipelineDefinition{}
+	if err := json.Unmarshal(data, &pipeline); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	respJSON, err := json.MarshalIndent(pipeline, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(respJSON))
+	return nil
+}
+
+func pipelinesInstallF(command *cobra.Command, args []string) error {
+	pipelineFile, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	pipeline := pipelineDefinition{}
+	if err := json.Unmarshal(pipelineFile, &pipeline); err != nil {
+		return err
+	}
+	if pipeline.Name == "" || pipeline.Source == "" {
+		return errors.New("The pipeline definition must contain both name and source")
+	}
+
+	if _, err := flowAPIClient.Do(http.MethodPost, flowAPIURL("pipelines"), pipeline, http.StatusCreated); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func pipelinesDeleteF(command *cobra.Command, args []string) error {
+	pipelineName := args[0]
+	nonInteractive := utils.NonInteractive(command)
+
+	if !nonInteractive {
+		confirmation, err := utils.AskForConfirmation(fmt.Sprintf("Will delete pipeline %s from realm %s. Do you want to continue?", pipelineName, realm))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !confirmation {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	if _, err := flowAPIClient.Do(http.MethodDelete, flowAPIURL("pipelines", pipelineName), nil, http.StatusNoContent); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
@@ -0,0 +1,309 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package housekeeping
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the configuration of all realms",
+	Long: `Back up the public configuration of all realms in your Astarte instance: their settings, public key,
+interfaces and triggers. Each realm is saved in its own directory:
+
+  <output-dir>/<realm>/realm.json               settings, as returned by Housekeeping
+  <output-dir>/<realm>/public_key.pem
+  <output-dir>/<realm>/interfaces/<name>_v<major>.json
+  <output-dir>/<realm>/triggers/<name>.json
+
+Housekeeping credentials do not grant access to Realm Management, hence interfaces and triggers are saved
+only for realms having an astartectl context on the same cluster. Other realms are backed up without them,
+and are reported at the end. Device data and private keys are not part of the backup.`,
+	Example: `  astartectl housekeeping backup -o backup-dir/
+  astartectl housekeeping backup -o backup-dir/ --realms myrealm,otherrealm`,
+	Args: cobra.NoArgs,
+	RunE: backupF,
+}
+
+// realmBackup is the outcome of the backup of a realm
+type realmBackup struct {
+	realm      string
+	interfaces int
+	triggers   int
+	note       string
+	failed     bool
+}
+
+func init() {
+	backupCmd.Flags().StringP("output-dir", "o", "", "The directory the backup is written to. It is created if it does not exist.")
+	_ = backupCmd.MarkFlagRequired("output-dir")
+	_ = backupCmd.MarkFlagDirname("output-dir")
+	backupCmd.Flags().StringSlice("realms", nil, "When set, only the given realms are backed up.")
+
+	HousekeepingCmd.AddCommand(backupCmd)
+}
+
+func backupF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println("backup does not support --to-curl")
+		os.Exit(1)
+	}
+	outputDir, err := command.Flags().GetString("output-dir")
+	if err != nil {
+		return err
+	}
+	onlyRealms, err := command.Flags().GetStringSlice("realms")
+	if err != nil {
+		return err
+	}
+
+	realmsCall, err := astarteAPIClient.ListRealms()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	realmsRes, err := realmsCall.Run(astarteAPIClient)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rawRealms, _ := realmsRes.Parse()
+	realms, _ := rawRealms.([]string)
+	for _, r := range onlyRealms {
+		if !slices.Contains(realms, r) {
+			return fmt.Errorf("Realm %s does not exist", r)
+		}
+	}
+	if len(onlyRealms) > 0 {
+		realms = onlyRealms
+	}
+	slices.Sort(realms)
+
+	// Realm Management is reached through the contexts of the realms on the current cluster
+	configDir := config.GetConfigDir()
+	clusterName, err := getClusterNameFromURLs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warn: No astartectl cluster matches the current Astarte URL, interfaces and triggers will not be saved")
+	}
+
+	backups := []realmBackup{}
+	for _, realm := range realms {
+		fmt.Fprintf(os.Stderr, "Backing up realm %s\n", realm)
+		backup := realmBackup{realm: realm}
+		if err := backupRealm(filepath.Join(outputDir, realm), configDir, clusterName, &backup); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not back up realm %s: %s\n", realm, err)
+			backup.note = "backup failed"
+			backup.failed = true
+		}
+		backups = append(backups, backup)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "Realm\tInterfaces\tTriggers\tNotes")
+	failed := false
+	for _, b := range backups {
+		interfacesCount, triggersCount := fmt.Sprint(b.interfaces), fmt.Sprint(b.triggers)
+		if b.note != "" {
+			interfacesCount, triggersCount = "-", "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.realm, interfacesCount, triggersCount, b.note)
+		failed = failed || b.failed
+	}
+	w.Flush()
+	fmt.Printf("\nBackup written to %s\n", outputDir)
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// backupRealm saves realm settings and public key to dir and, when realm has a context on clusterName,
+// its interfaces and triggers. An error is returned only when the backup of realm failed, while
+// skipping interfaces and triggers is recorded as a note in backup.
+func backupRealm(dir, configDir, clusterName string, backup *realmBackup) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	housekeepingClient, realmURL, err := housekeepingRealmURL(backup.realm)
+	if err != nil {
+		return err
+	}
+	// Raw settings are saved as is, so that fields unknown to astartectl (e.g. limits) are preserved
+	rawSettings, err := housekeepingClient.Do(http.MethodGet, realmURL, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if err := writeBackupJSON(filepath.Join(dir, "realm.json"), rawSettings); err != nil {
+		return err
+	}
+	settings := client.RealmDetails{}
+	if err := json.Unmarshal(rawSettings, &settings); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "public_key.pem"), []byte(settings.JwtPublicKeyPEM), 0644); err != nil {
+		return err
+	}
+
+	contextName := ""
+	if clusterName != "" {
+		contextName = findRealmContext(configDir, clusterName, backup.realm)
+	}
+	if contextName == "" {
+		backup.note = "no context for the realm, interfaces and triggers were not saved"
+		return nil
+	}
+	realmClient, _, err := utils.ContextAPIClient(contextName,
+		map[astarteservices.AstarteService]string{astarteservices.RealmManagement: "individual-urls.realm-management"})
+	if err != nil {
+		return err
+	}
+	if backup.interfaces, err = backupInterfaces(realmClient, backup.realm, filepath.Join(dir, "interfaces")); err != nil {
+		return err
+	}
+	if backup.triggers, err = backupTriggers(realmClient, backup.realm, filepath.Join(dir, "triggers")); err != nil {
+		return err
+	}
+	return nil
+}
+
+// backupInterfaces saves each major version of each interface of realm to dir, returning how many were saved
+func backupInterfaces(realmClient *client.Client, realm, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	listCall, err := realmClient.ListInterfaces(realm)
+	if err != nil {
+		return 0, err
+	}
+	names, err := runBackupRequest(realmClient, listCall)
+	if err != nil {
+		return 0, err
+	}
+	interfaceNames, ok := names.([]string)
+	if !ok {
+		return 0, fmt.Errorf("Unexpected interfaces listing from Realm Management: %v", names)
+	}
+	count := 0
+	for _, name := range interfaceNames {
+		majorsCall, err := realmClient.ListInterfaceMajorVersions(realm, name)
+		if err != nil {
+			return count, err
+		}
+		majors, err := runBackupRequest(realmClient, majorsCall)
+		if err != nil {
+			return count, err
+		}
+		interfaceMajors, ok := majors.([]int)
+		if !ok {
+			return count, fmt.Errorf("Unexpected major versions listing of %s from Realm Management: %v", name, majors)
+		}
+		for _, major := range interfaceMajors {
+			getCall, err := realmClient.GetInterface(realm, name, major)
+			if err != nil {
+				return count, err
+			}
+			rawInterface, err := runBackupRequest(realmClient, getCall)
+			if err != nil {
+				return count, err
+			}
+			iface, ok := rawInterface.(interfaces.AstarteInterface)
+			if !ok {
+				return count, fmt.Errorf("Unexpected definition of %s v%d from Realm Management: %v", name, major, rawInterface)
+			}
+			ifaceJSON, err := json.Marshal(iface)
+			if err != nil {
+				return count, err
+			}
+			if err := writeBackupJSON(filepath.Join(dir, fmt.Sprintf("%s_v%d.json", name, major)), ifaceJSON); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// backupTriggers saves each trigger of realm to dir, returning how many were saved
+func backupTriggers(realmClient *client.Client, realm, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	listCall, err := realmClient.ListTriggers(realm)
+	if err != nil {
+		return 0, err
+	}
+	names, err := runBackupRequest(realmClient, listCall)
+	if err != nil {
+		return 0, err
+	}
+	triggerNames, ok := names.([]string)
+	if !ok {
+		return 0, fmt.Errorf("Unexpected triggers listing from Realm Management: %v", names)
+	}
+	count := 0
+	for _, name := range triggerNames {
+		// Triggers are saved as returned by Astarte, as astarte-go triggers do not carry AMQP actions
+		getCall, err := realmClient.GetTrigger(realm, name)
+		if err != nil {
+			return count, err
+		}
+		rawTrigger, err := runBackupRequest(realmClient, getCall)
+		if err != nil {
+			return count, err
+		}
+		triggerJSON, err := json.Marshal(rawTrigger)
+		if err != nil {
+			return count, err
+		}
+		if err := writeBackupJSON(filepath.Join(dir, name+".json"), triggerJSON); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func runBackupRequest(realmClient *client.Client, req client.AstarteRequest) (interface{}, error) {
+	res, err := req.Run(realmClient)
+	if err != nil {
+		return nil, err
+	}
+	return res.Parse()
+}
+
+// writeBackupJSON writes content to fileName, indented to ease diffing backups
+func writeBackupJSON(fileName string, content json.RawMessage) error {
+	indented, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(indented, '\n'), 0644)
+}
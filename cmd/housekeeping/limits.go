@@ -0,0 +1,199 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package housekeeping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var realmsSetLimitCmd = &cobra.Command{
+	Use:   "set-limit <realm_name>",
+	Short: "Set the device registration limit of a realm",
+	Long: `Set the maximum number of devices which can be registered in a realm, or remove the limit with --unlimited.
+
+When the realm is the one of the current context, its credentials are used to count the registered devices,
+and a confirmation is asked before lowering the limit below that count. Devices which are already registered
+are not affected by the limit.`,
+	Example:           `  astartectl housekeeping realms set-limit myrealm --max-registered-devices 1000`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: realmNamesCompletion,
+	RunE:              realmsSetLimitF,
+}
+
+var realmsGetLimitsCmd = &cobra.Command{
+	Use:               "get-limits <realm_name>",
+	Short:             "Show the limits of a realm",
+	Long:              `Show the limits of a realm, such as its device registration limit.`,
+	Example:           `  astartectl housekeeping realms get-limits myrealm`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: realmNamesCompletion,
+	RunE:              realmsGetLimitsF,
+}
+
+// realmLimits are the limits of a realm, as reported by Housekeeping
+type realmLimits struct {
+	DeviceRegistrationLimit *int64 `json:"device_registration_limit"`
+}
+
+func init() {
+	realmsSetLimitCmd.Flags().Int64("max-registered-devices", 0, "The maximum number of devices which can be registered in the realm.")
+	realmsSetLimitCmd.Flags().Bool("unlimited", false, "When set, removes the device registration limit.")
+	utils.AddNonInteractiveFlag(realmsSetLimitCmd.Flags())
+
+	realmsCmd.AddCommand(
+		realmsSetLimitCmd,
+		realmsGetLimitsCmd,
+	)
+}
+
+func realmsSetLimitF(command *cobra.Command, args []string) error {
+	realm := args[0]
+	if utils.ShouldCurl() {
+		fmt.Println("set-limit does not support --to-curl")
+		os.Exit(1)
+	}
+	unlimited, err := command.Flags().GetBool("unlimited")
+	if err != nil {
+		return err
+	}
+	maxDevices, err := command.Flags().GetInt64("max-registered-devices")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+	switch {
+	case unlimited && command.Flags().Changed("max-registered-devices"):
+		return errors.New("--max-registered-devices and --unlimited are mutually exclusive")
+	case !unlimited && !command.Flags().Changed("max-registered-devices"):
+		return errors.New("Either --max-registered-devices or --unlimited is required")
+	case !unlimited && maxDevices < 0:
+		return errors.New("--max-registered-devices must be a non-negative number")
+	}
+
+	limits := realmLimits{}
+	if !unlimited {
+		limits.DeviceRegistrationLimit = &maxDevices
+
+		if registeredDevices, err := registeredDevicesCount(realm); err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Could not count the devices registered in realm %s: %s\n", realm, err)
+		} else if registeredDevices > maxDevices && !nonInteractive {
+			confirmation, err := utils.AskForConfirmation(fmt.Sprintf("Realm %s already has %d registered devices, more than the new limit of %d. Do you want to continue?",
+				realm, registeredDevices, maxDevices))
+			if err != nil || !confirmation {
+				fmt.Fprintln(os.Stderr, "Aborting.")
+				os.Exit(1)
+			}
+		}
+	}
+
+	housekeepingClient, realmURL, err := housekeepingRealmURL(realm)
+	if err != nil {
+		return err
+	}
+	if _, err := housekeepingClient.Do(http.MethodPatch, realmURL, limits, http.StatusOK); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+func realmsGetLimitsF(command *cobra.Command, args []string) error {
+	realm := args[0]
+	if utils.ShouldCurl() {
+		fmt.Println("get-limits does not support --to-curl")
+		os.Exit(1)
+	}
+
+	housekeepingClient, realmURL, err := housekeepingRealmURL(realm)
+	if err != nil {
+		return err
+	}
+	data, err := housekeepingClient.Do(http.MethodGet, realmURL, nil, http.StatusOK)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	limits := realmLimits{}
+	if err := json.Unmarshal(data, &limits); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	if limits.DeviceRegistrationLimit != nil {
+		fmt.Fprintf(w, "Device registration limit:\t%d\n", *limits.DeviceRegistrationLimit)
+	} else {
+		fmt.Fprintf(w, "Device registration limit:\tunlimited\n")
+	}
+	if registeredDevices, err := registeredDevicesCount(realm); err == nil {
+		fmt.Fprintf(w, "Registered devices:\t%d\n", registeredDevices)
+	}
+	w.Flush()
+	return nil
+}
+
+func housekeepingRealmURL(realm string) (*utils.RawAPIClient, *url.URL, error) {
+	housekeepingClient, err := utils.RawAPICommandSetup("housekeeping.key", "housekeeping.key-file")
+	if err != nil {
+		return nil, nil, err
+	}
+	realmURL, err := utils.ServiceURL("individual-urls.housekeeping", "housekeeping")
+	if err != nil {
+		return nil, nil, err
+	}
+	realmURL.Path = path.Join(realmURL.Path, "v1", "realms", realm)
+	return housekeepingClient, realmURL, nil
+}
+
+// registeredDevicesCount counts the devices registered in realm through AppEngine. This is possible only
+// when realm is the one of the current context, as Housekeeping credentials do not grant access to AppEngine.
+func registeredDevicesCount(realm string) (int64, error) {
+	if viper.GetString("realm.name") != realm {
+		return 0, fmt.Errorf("realm %s is not the one of the current context", realm)
+	}
+	appEngineClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return 0, err
+	}
+	statsURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return 0, err
+	}
+	statsURL.Path = path.Join(statsURL.Path, "v1", realm, "stats", "devices")
+	data, err := appEngineClient.Do(http.MethodGet, statsURL, nil, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	stats := struct {
+		TotalDevices int64 `json:"total_devices"`
+	}{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return 0, err
+	}
+	return stats.TotalDevices, nil
+}
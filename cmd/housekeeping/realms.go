@@ -43,7 +43,7 @@ import (
 var realmsCmd = &cobra.Command{
 	Use:     "realms",
 	Short:   "Manage realms",
-	Long:    `List, show or create realms in your Astarte instance.`,
+	Long:    `List, show or create realms in your Astarte instance, and manage their limits.`,
 	Aliases: []string{"realm"},
 }
 
@@ -57,21 +57,28 @@ var realmsListCmd = &cobra.Command{
 }
 
 var realmsShowCmd = &cobra.Command{
-	Use:     "show <realm_name>",
-	Short:   "Show realm",
-	Long:    "Show a realm in your Astarte instance.",
-	Example: `  astartectl housekeeping realms show myrealm`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    realmsShowF,
+	Use:               "show <realm_name>",
+	Short:             "Show realm",
+	Long:              "Show a realm in your Astarte instance.",
+	Example:           `  astartectl housekeeping realms show myrealm`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: realmNamesCompletion,
+	RunE:              realmsShowF,
 }
 
 var realmsCreateCmd = &cobra.Command{
-	Use:     "create <realm_name>",
-	Short:   "Create realm",
-	Long:    "Create a realm in your Astarte instance. If a private key is provided, an astartectl context with full access is created.",
-	Example: `  astartectl housekeeping realms create myrealm --realm-public-key /path/to/public_key`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    realmsCreateF,
+	Use:   "create <realm_name>",
+	Short: "Create realm",
+	Long: `Create a realm in your Astarte instance. If a private key is provided (or generated), an astartectl context
+with full access is created and activated.
+
+When a context for the same cluster and realm already exists, or a context named as --context-name exists, it is
+updated rather than created. Use --no-context to skip contexts altogether, and --activate=false to keep the current
+context active.`,
+	Example: `  astartectl housekeeping realms create myrealm --realm-public-key /path/to/public_key
+  astartectl housekeeping realms create myrealm --context-name prod-myrealm --activate=false -y`,
+	Args: cobra.ExactArgs(1),
+	RunE: realmsCreateF,
 }
 
 func init() {
@@ -87,6 +94,8 @@ func init() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	realmsListCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to each realm name.")
+	realmsShowCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to the details of the realm.")
 	realmsCreateCmd.Flags().IntP("replication-factor", "r", 0, `Replication factor for the realm, used with SimpleStrategy replication.`)
 	realmsCreateCmd.Flags().StringSliceP("datacenter-replication", "d", nil,
 		`Replication factor for a datacenter, used with NetworkTopologyStrategy replication.
@@ -94,7 +103,10 @@ func init() {
 The format is <datacenter-name>:<replication-factor>,<other-datacenter-name>:<other-replication-factor>.
 You can also specify the flag multiple times instead of separating it with a comma.`)
 
-	realmsCreateCmd.PersistentFlags().BoolP("non-interactive", "y", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	realmsCreateCmd.Flags().Bool("no-context", false, "When set, no astartectl context is created or updated for the realm.")
+	realmsCreateCmd.Flags().String("context-name", "", "The name of the astartectl context of the realm. Defaults to an existing context for the same cluster and realm, or to <astarte-host>-realm-<realm_name>. An existing context is updated only if it is for the same cluster and realm.")
+	realmsCreateCmd.Flags().Bool("activate", true, "When set, the context of the realm becomes the current context.")
+	utils.AddNonInteractiveFlag(realmsCreateCmd.PersistentFlags())
 
 	realmsCmd.AddCommand(
 		realmsListCmd,
@@ -104,6 +116,10 @@ You can also specify the flag multiple times instead of separating it with a com
 }
 
 func realmsListF(command *cobra.Command, args []string) error {
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
 	realmsCall, err := astarteAPIClient.ListRealms()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -119,12 +135,40 @@ func realmsListF(command *cobra.Command, args []string) error {
 	}
 	rawRealms, _ := realmsRes.Parse()
 	realms, _ := rawRealms.([]string)
-	fmt.Println(realms)
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, realms)
+		return nil
+	}
+	utils.PrintList(realms)
 	return nil
 }
 
+func realmNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// PersistentPreRunE is not run when completing, hence the client has to be set up explicitly
+	if len(args) > 0 || housekeepingPersistentPreRunE(cmd, nil) != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return utils.CachedCompletions("realms", func() ([]string, error) {
+		realmsCall, err := astarteAPIClient.ListRealms()
+		if err != nil {
+			return nil, err
+		}
+		realmsRes, err := realmsCall.Run(astarteAPIClient)
+		if err != nil {
+			return nil, err
+		}
+		rawRealms, _ := realmsRes.Parse()
+		realms, _ := rawRealms.([]string)
+		return realms, nil
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
 func realmsShowF(command *cobra.Command, args []string) error {
 	realm := args[0]
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
 
 	getRealmDetailsCall, err := astarteAPIClient.GetRealm(realm)
 	if err != nil {
@@ -141,6 +185,10 @@ func realmsShowF(command *cobra.Command, args []string) error {
 	}
 	realmDetails, _ := getRealmDetailsRes.Parse()
 
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, realmDetails)
+		return nil
+	}
 	fmt.Printf("%+v\n", realmDetails)
 	return nil
 }
@@ -173,7 +221,23 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 		return errors.New("replication-factor and datacenter-replication are mutually exclusive, you only have to specify one")
 	}
 
-	createContext := true
+	noContext, err := command.Flags().GetBool("no-context")
+	if err != nil {
+		return err
+	}
+	contextName, err := command.Flags().GetString("context-name")
+	if err != nil {
+		return err
+	}
+	activate, err := command.Flags().GetBool("activate")
+	if err != nil {
+		return err
+	}
+	if noContext && contextName != "" {
+		return errors.New("--no-context and --context-name are mutually exclusive")
+	}
+
+	createContext := !noContext
 	clusterConfigurationName, err := getClusterNameFromURLs()
 	if err != nil {
 		createContext = false
@@ -209,9 +273,22 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	contextName := ""
+	configDir := config.GetConfigDir()
+	var existingContext *config.ContextFile
 	if createContext {
-		contextName = fmt.Sprintf("%s-realm-%s", astarteURL.Hostname(), realm)
+		if contextName == "" {
+			contextName = findRealmContext(configDir, clusterConfigurationName, realm)
+		}
+		if contextName == "" {
+			contextName = fmt.Sprintf("%s-realm-%s", astarteURL.Hostname(), realm)
+		}
+		if c, err := config.LoadContextConfiguration(configDir, contextName); err == nil {
+			if c.Cluster != clusterConfigurationName || c.Realm.Name != realm {
+				return fmt.Errorf("context %s already exists for realm %s of cluster %s. Use --context-name to choose another name, or --no-context",
+					contextName, c.Realm.Name, c.Cluster)
+			}
+			existingContext = &c
+		}
 	}
 
 	fmt.Println("Will create Astarte Realm with following parameters:")
@@ -231,12 +308,16 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 		fmt.Fprintf(w, "Replication factor:\t%d\n", printedReplicationFactor)
 	}
 	if createContext {
-		fmt.Fprintf(w, "Astarte Context:\t%s\n", contextName)
+		if existingContext != nil {
+			fmt.Fprintf(w, "Astarte Context:\t%s (existing, will be updated)\n", contextName)
+		} else {
+			fmt.Fprintf(w, "Astarte Context:\t%s\n", contextName)
+		}
 	}
 	w.Flush()
 	fmt.Println()
 
-	if !createContext {
+	if !createContext && !noContext {
 		fmt.Println("Will not create an Astarte context - to do so, you need to have a matching Astarte Cluster configuration and supply a private key for the Realm.")
 		fmt.Println()
 	}
@@ -251,13 +332,11 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 		fmt.Println()
 	}
 
-	y, err := command.Flags().GetBool("non-interactive")
-	if err != nil {
-		return err
-	}
+	y := utils.NonInteractive(command)
 	if !y {
 		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
-			os.Exit(0)
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
 		}
 	}
 
@@ -369,12 +448,14 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 		realmContext.Key = base64.StdEncoding.EncodeToString(privateKeyContent)
 	}
 
-	configContext := config.ContextFile{
-		Cluster: clusterConfigurationName,
-		Realm:   realmContext,
+	configContext := config.ContextFile{}
+	if existingContext != nil {
+		// Keep everything else, such as flag defaults
+		configContext = *existingContext
 	}
+	configContext.Cluster = clusterConfigurationName
+	configContext.Realm = realmContext
 
-	configDir := config.GetConfigDir()
 	if err := config.SaveContextConfiguration(configDir, contextName, configContext, true); err != nil {
 		fmt.Fprintf(os.Stderr, "Could not save cluster configuration: %s\n", err)
 		if privateKey == "" {
@@ -383,15 +464,36 @@ func realmsCreateF(command *cobra.Command, args []string) error {
 			fmt.Println(string(privateKeyContent))
 		}
 	} else {
-		fmt.Printf("Context %s created successfully\n", contextName)
+		if existingContext != nil {
+			fmt.Printf("Context %s updated successfully\n", contextName)
+		} else {
+			fmt.Printf("Context %s created successfully\n", contextName)
+		}
 
 		// Now set the current context to the new one
-		config.UpdateBaseConfigWithContext(configDir, contextName)
+		if activate {
+			config.UpdateBaseConfigWithContext(configDir, contextName)
+		}
 	}
 
 	return nil
 }
 
+// findRealmContext returns the name of the first context for realm on clusterName, or an empty string if there is none
+func findRealmContext(configDir, clusterName, realm string) string {
+	contexts, err := config.ListContextConfigurations(configDir)
+	if err != nil {
+		return ""
+	}
+	for _, c := range contexts {
+		if context, err := config.LoadContextConfiguration(configDir, c); err == nil &&
+			context.Cluster == clusterName && context.Realm.Name == realm {
+			return c
+		}
+	}
+	return ""
+}
+
 func getPrivateKeyPEMBytes(key *ecdsa.PrivateKey) ([]byte, error) {
 	marshaled, err := x509.MarshalECPrivateKey(key)
 	if err != nil {
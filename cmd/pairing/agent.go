@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/astarte-platform/astarte-go/client"
 	"github.com/astarte-platform/astarte-go/deviceid"
 	"github.com/astarte-platform/astartectl/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var agentCmd = &cobra.Command{
@@ -35,10 +37,16 @@ var agentRegisterCmd = &cobra.Command{
 	Long: `Register a new device to your realm.
 
 This returns the credentials_secret that can be use to obtain device credentials.
-<device_id> must be a 128 bit base64 url-encoded UUID`,
-	Example: `  astartectl pairing agent register 2TBn-jNESuuHamE2Zo1anA`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    agentRegisterF,
+<device_id> must be a 128 bit base64 url-encoded UUID
+
+--introspection declares the interfaces the device is expected to have, as its initial introspection,
+so that e.g. server owned properties can be set before the device connects for the first time.
+--aliases sets the aliases of the device right after its registration, in a single AppEngine API call.
+Both are handy for factory provisioning. --to-curl is not supported when either of them is given.`,
+	Example: `  astartectl pairing agent register 2TBn-jNESuuHamE2Zo1anA
+  astartectl pairing agent register 2TBn-jNESuuHamE2Zo1anA --introspection com.my.Sensor:1:0,com.my.Config:0:2 --aliases serial=SN0042`,
+	Args: cobra.ExactArgs(1),
+	RunE: agentRegisterF,
 }
 
 var agentUnregisterCmd = &cobra.Command{
@@ -52,43 +60,107 @@ All data belonging to the device will be kept as is in Astarte.`,
 	RunE:    agentUnregisterF,
 }
 
+var agentRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret <device_id>",
+	Short: "Issue a new Credentials Secret for a device",
+	Long: `Issue a new Credentials Secret for a registered device, by unregistering and registering it again.
+The previous Credentials Secret stops being valid immediately. All data belonging to the device will
+be kept as is in Astarte.
+
+WARNING: the device must be reconfigured with the new Credentials Secret. Until then, it won't be able to
+obtain new credentials from Pairing API, and it will stop connecting once its current certificate expires.
+
+When --inhibit-credentials is set, the device is also inhibited from requesting credentials at all, so that
+it can't pair again until you lift the inhibition once it has been reconfigured, with
+'astartectl appengine devices credentials inhibit <device_id> false'. Note that its current certificate
+stays valid until its expiration.`,
+	Example: `  astartectl pairing agent rotate-secret 2TBn-jNESuuHamE2Zo1anA`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    agentRotateSecretF,
+}
+
 func init() {
 	agentRegisterCmd.PersistentFlags().Bool("compact-output", false, "When true, only the Credentials Secret will be printed to stdout upon success.")
+	agentRegisterCmd.PersistentFlags().StringSlice("introspection", []string{}, "The initial introspection of the device, as a comma separated list of <interface_name>:<major>:<minor>")
+	agentRegisterCmd.PersistentFlags().StringSlice("aliases", []string{}, "The aliases of the device, as a comma separated list of <tag>=<alias>")
 
-	agentUnregisterCmd.PersistentFlags().BoolP("non-interactive", "y", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	utils.AddNonInteractiveFlag(agentUnregisterCmd.PersistentFlags())
+
+	agentRotateSecretCmd.PersistentFlags().Bool("compact-output", false, "When true, only the new Credentials Secret will be printed to stdout upon success.")
+	agentRotateSecretCmd.PersistentFlags().Bool("inhibit-credentials", false, "When set, inhibit the device from requesting credentials after the rotation, until the inhibition is lifted.")
+	utils.AddNonInteractiveFlag(agentRotateSecretCmd.PersistentFlags())
 
 	PairingCmd.AddCommand(agentCmd)
 
 	agentCmd.AddCommand(
 		agentRegisterCmd,
 		agentUnregisterCmd,
+		agentRotateSecretCmd,
 	)
 }
 
 func agentRegisterF(command *cobra.Command, args []string) error {
-	// TODO: add support for initial_introspection
 	deviceID := args[0]
 	if !deviceid.IsValid(deviceID) {
 		return errors.New("Invalid device id")
 	}
-
-	registerDeviceCall, err := astarteAPIClient.RegisterDevice(realm, deviceID)
+	introspectionEntries, err := command.Flags().GetStringSlice("introspection")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
-
-	utils.MaybeCurlAndExit(registerDeviceCall, astarteAPIClient)
-
-	registerDeviceRes, err := registerDeviceCall.Run(astarteAPIClient)
+	introspection, err := parseInitialIntrospection(introspectionEntries)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
 	}
-	credentialsSecret, err := registerDeviceRes.Parse()
+	aliasEntries, err := command.Flags().GetStringSlice("aliases")
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return err
+	}
+	aliases, err := parseDeviceAliases(aliasEntries)
+	if err != nil {
+		return err
+	}
+
+	var credentialsSecret interface{}
+	if len(introspection) == 0 && len(aliases) == 0 {
+		registerDeviceCall, err := astarteAPIClient.RegisterDevice(realm, deviceID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		utils.MaybeCurlAndExit(registerDeviceCall, astarteAPIClient)
+
+		registerDeviceRes, err := registerDeviceCall.Run(astarteAPIClient)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		credentialsSecret, err = registerDeviceRes.Parse()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else {
+		if utils.ShouldCurl() {
+			fmt.Println(`'agent register' does not support the --to-curl option together with --introspection or --aliases.`)
+			os.Exit(1)
+		}
+		if len(introspection) > 0 {
+			credentialsSecret, err = registerDeviceWithIntrospection(deviceID, introspection)
+		} else {
+			credentialsSecret, err = registerDevice(deviceID)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// The Credentials Secret is printed anyway, as it can't be retrieved again
+	var aliasesErr error
+	if len(aliases) > 0 {
+		aliasesErr = setDeviceAliases(deviceID, aliases)
 	}
 
 	if compact, err := command.Flags().GetBool("compact-output"); err != nil {
@@ -106,6 +178,11 @@ func agentRegisterF(command *cobra.Command, args []string) error {
 		fmt.Println(credentialsSecret)
 	}
 
+	if aliasesErr != nil {
+		fmt.Fprintf(os.Stderr, "Device %s was registered, but setting its aliases failed: %s\n", deviceID, aliasesErr)
+		os.Exit(1)
+	}
+
 	return nil
 }
 
@@ -115,10 +192,7 @@ func agentUnregisterF(command *cobra.Command, args []string) error {
 		return errors.New("Invalid device id")
 	}
 
-	nonInteractive, err := command.Flags().GetBool("non-interactive")
-	if err != nil {
-		return err
-	}
+	nonInteractive := utils.NonInteractive(command)
 
 	fmt.Printf("Will unregister device %s from realm %s.\n", deviceID, realm)
 	if !nonInteractive {
@@ -128,7 +202,8 @@ func agentUnregisterF(command *cobra.Command, args []string) error {
 			os.Exit(1)
 		}
 		if !confirmation {
-			return nil
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
 		}
 	}
 
@@ -150,3 +225,116 @@ func agentUnregisterF(command *cobra.Command, args []string) error {
 	fmt.Println("ok")
 	return nil
 }
+
+func agentRotateSecretF(command *cobra.Command, args []string) error {
+	if viper.GetBool("pairing-to-curl") {
+		fmt.Println(`'agent rotate-secret' does not support the --to-curl option.
+Use 'agent unregister' and 'agent register' to rotate the Credentials Secret step by step.`)
+		os.Exit(1)
+	}
+
+	deviceID := args[0]
+	if !deviceid.IsValid(deviceID) {
+		return errors.New("Invalid device id")
+	}
+	compact, err := command.Flags().GetBool("compact-output")
+	if err != nil {
+		return err
+	}
+	inhibitCredentials, err := command.Flags().GetBool("inhibit-credentials")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+	// Credentials inhibition goes through AppEngine API, whose URL is known only when using the base URL
+	if inhibitCredentials && (viper.GetString("url") == "" || viper.GetString("individual-urls.pairing") != "") {
+		return errors.New("--inhibit-credentials requires the Astarte base URL to be set with --astarte-url, rather than --pairing-url")
+	}
+
+	fmt.Fprintf(os.Stderr, "Will rotate the Credentials Secret of device %s in realm %s.\n", deviceID, realm)
+	fmt.Fprintln(os.Stderr, "The current Credentials Secret will stop working immediately, and the device will have to be reconfigured with the new one.")
+	if inhibitCredentials {
+		fmt.Fprintln(os.Stderr, "The device will also be inhibited from requesting credentials until the inhibition is lifted.")
+	}
+	if !nonInteractive {
+		confirmation, err := utils.AskForConfirmation("Do you want to continue?")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !confirmation {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	unregisterDeviceCall, err := astarteAPIClient.UnregisterDevice(realm, deviceID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	unregisterDeviceRes, err := unregisterDeviceCall.Run(astarteAPIClient)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	_, _ = unregisterDeviceRes.Parse()
+
+	credentialsSecret, err := registerDevice(deviceID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Device %s was unregistered, but registering it again failed: %s\n", deviceID, err)
+		fmt.Fprintf(os.Stderr, "Run 'astartectl pairing agent register %s' to get a new Credentials Secret.\n", deviceID)
+		os.Exit(1)
+	}
+
+	if inhibitCredentials {
+		if err := setCredentialsInhibited(deviceID, true); err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Could not inhibit credentials for device %s: %s\n", deviceID, err)
+		}
+	}
+
+	if compact {
+		fmt.Println(credentialsSecret)
+		return nil
+	}
+
+	fmt.Printf("The Credentials Secret of device %s was successfully rotated.\n", deviceID)
+	fmt.Printf("The Device's new Credentials Secret is \"%s\".\n", credentialsSecret)
+	fmt.Println()
+	fmt.Println("Please don't share the Credentials Secret, and ensure it is transferred securely to your Device.")
+	fmt.Println("The Device must be reconfigured with the new Credentials Secret before it can request new credentials.")
+	if inhibitCredentials {
+		fmt.Printf("Once done, lift the credentials inhibition with 'astartectl appengine devices credentials inhibit %s false'.\n", deviceID)
+	}
+
+	return nil
+}
+
+func registerDevice(deviceID string) (string, error) {
+	registerDeviceCall, err := astarteAPIClient.RegisterDevice(realm, deviceID)
+	if err != nil {
+		return "", err
+	}
+	registerDeviceRes, err := registerDeviceCall.Run(astarteAPIClient)
+	if err != nil {
+		return "", err
+	}
+	credentialsSecret, err := registerDeviceRes.Parse()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", credentialsSecret), nil
+}
+
+func setCredentialsInhibited(deviceID string, inhibit bool) error {
+	inhibitDeviceCall, err := astarteAPIClient.SetDeviceInhibited(realm, deviceID, client.AstarteDeviceID, inhibit)
+	if err != nil {
+		return err
+	}
+	inhibitDeviceRes, err := inhibitDeviceCall.Run(astarteAPIClient)
+	if err != nil {
+		return err
+	}
+	_, _ = inhibitDeviceRes.Parse()
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pairing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/astarte-platform/astartectl/utils"
+)
+
+// introspectionVersion is the version of an interface in the initial introspection of a device
+type introspectionVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+}
+
+// parseInitialIntrospection parses the interfaces given as <interface_name>:<major>:<minor>
+func parseInitialIntrospection(entries []string) (map[string]introspectionVersion, error) {
+	introspection := map[string]introspectionVersion{}
+	for _, entry := range entries {
+		tokens := strings.Split(entry, ":")
+		if len(tokens) != 3 || tokens[0] == "" {
+			return nil, fmt.Errorf("%s is not a valid interface, expected <interface_name>:<major>:<minor>", entry)
+		}
+		major, err := strconv.Atoi(tokens[1])
+		if err != nil || major < 0 {
+			return nil, fmt.Errorf("%s is not a valid major version for interface %s", tokens[1], tokens[0])
+		}
+		minor, err := strconv.Atoi(tokens[2])
+		if err != nil || minor < 0 {
+			return nil, fmt.Errorf("%s is not a valid minor version for interface %s", tokens[2], tokens[0])
+		}
+		if major == 0 && minor == 0 {
+			return nil, fmt.Errorf("interface %s can't have version 0.0", tokens[0])
+		}
+		if _, ok := introspection[tokens[0]]; ok {
+			return nil, fmt.Errorf("interface %s is given more than once", tokens[0])
+		}
+		introspection[tokens[0]] = introspectionVersion{Major: major, Minor: minor}
+	}
+	return introspection, nil
+}
+
+// parseDeviceAliases parses the aliases given as <tag>=<alias>
+func parseDeviceAliases(entries []string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for _, entry := range entries {
+		tag, alias, ok := strings.Cut(entry, "=")
+		if !ok || tag == "" || alias == "" {
+			return nil, fmt.Errorf("%s is not a valid alias, expected <tag>=<alias>", entry)
+		}
+		if _, ok := aliases[tag]; ok {
+			return nil, fmt.Errorf("alias tag %s is given more than once", tag)
+		}
+		aliases[tag] = alias
+	}
+	return aliases, nil
+}
+
+// registerDeviceWithIntrospection registers deviceID declaring its initial introspection, which is not
+// supported by astarte-go, and returns its Credentials Secret
+func registerDeviceWithIntrospection(deviceID string, introspection map[string]introspectionVersion) (string, error) {
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return "", err
+	}
+	registerURL, err := utils.ServiceURL("individual-urls.pairing", "pairing")
+	if err != nil {
+		return "", err
+	}
+	registerURL.Path = path.Join(registerURL.Path, "v1", realm, "agent", "devices")
+
+	payload := map[string]interface{}{"hw_id": deviceID, "initial_introspection": introspection}
+	data, err := rawClient.Do(http.MethodPost, registerURL, payload, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	var registration struct {
+		CredentialsSecret string `json:"credentials_secret"`
+	}
+	if err := json.Unmarshal(data, &registration); err != nil {
+		return "", err
+	}
+	return registration.CredentialsSecret, nil
+}
+
+// setDeviceAliases sets all the aliases of deviceID at once, through AppEngine API
+func setDeviceAliases(deviceID string, aliases map[string]string) error {
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	deviceURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return err
+	}
+	deviceURL.Path = path.Join(deviceURL.Path, "v1", realm, "devices", deviceID)
+
+	_, err = rawClient.MergePatch(deviceURL, map[string]interface{}{"aliases": aliases}, http.StatusOK)
+	return err
+}
@@ -0,0 +1,241 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pairing
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var agentStatusCmd = &cobra.Command{
+	Use:   "status <device_id>",
+	Short: "Show the pairing status of a device",
+	Long: `Show the pairing status of a device, gathering what AppEngine and Pairing API know about it:
+whether it is registered, when it first requested its credentials and from which IP, and whether it is
+inhibited from requesting credentials.
+
+With --credentials-secret, the Credentials Secret is checked against Pairing API, as the device would do.
+Astarte does not keep the certificates it issues: with --certificate, a certificate of the device is inspected,
+showing its serial number and expiry, and it is verified by Pairing API when --credentials-secret is set too.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl pairing agent status 2TBn-jNESuuHamE2Zo1anA
+  astartectl pairing agent status 2TBn-jNESuuHamE2Zo1anA --credentials-secret <secret> --certificate device.crt`,
+	Args: cobra.ExactArgs(1),
+	RunE: agentStatusF,
+}
+
+// pairingDeviceInfo is the information returned by Pairing API to a device authenticated with its Credentials Secret
+type pairingDeviceInfo struct {
+	Status    string `json:"status"`
+	Version   string `json:"version"`
+	Protocols struct {
+		AstarteMQTTv1 struct {
+			BrokerURL string `json:"broker_url"`
+		} `json:"astarte_mqtt_v1"`
+	} `json:"protocols"`
+}
+
+// certificateVerification is the outcome of the verification of a device certificate by Pairing API
+type certificateVerification struct {
+	Valid   bool   `json:"valid"`
+	Cause   string `json:"cause"`
+	Details string `json:"details"`
+}
+
+func init() {
+	agentStatusCmd.Flags().String("credentials-secret", "", "When set, check the given Credentials Secret of the device.")
+	agentStatusCmd.Flags().String("certificate", "", "Path to a PEM encoded certificate of the device to inspect.")
+	_ = agentStatusCmd.MarkFlagFilename("certificate")
+
+	agentCmd.AddCommand(agentStatusCmd)
+}
+
+func agentStatusF(command *cobra.Command, args []string) error {
+	if viper.GetBool("pairing-to-curl") {
+		fmt.Println(`'agent status' does not support the --to-curl option.
+Use 'appengine devices show' to get the details of the device.`)
+		os.Exit(1)
+	}
+
+	deviceID := args[0]
+	if !deviceid.IsValid(deviceID) {
+		return errors.New("Invalid device id")
+	}
+	credentialsSecret, err := command.Flags().GetString("credentials-secret")
+	if err != nil {
+		return err
+	}
+	certFile, err := command.Flags().GetString("certificate")
+	if err != nil {
+		return err
+	}
+
+	deviceDetails, registered, err := pairingDeviceDetails(deviceID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "Device ID:\t%s\n", deviceID)
+	fmt.Fprintf(w, "Realm:\t%s\n", realm)
+	if !registered {
+		fmt.Fprintln(w, "Registered:\tno")
+		w.Flush()
+		return nil
+	}
+	fmt.Fprintf(w, "Registered:\tyes, since %s\n", utils.FormatTimestamp(deviceDetails.FirstRegistration, time.RFC3339))
+	if deviceDetails.FirstCredentialsRequest.IsZero() {
+		fmt.Fprintln(w, "First Credentials Request:\tnever, the device did not pair yet")
+	} else {
+		fmt.Fprintf(w, "First Credentials Request:\t%s\n", utils.FormatTimestamp(deviceDetails.FirstCredentialsRequest, time.RFC3339))
+	}
+	if deviceDetails.LastCredentialsRequestIP != nil {
+		fmt.Fprintf(w, "Last Credentials Request IP:\t%s\n", deviceDetails.LastCredentialsRequestIP)
+	}
+	fmt.Fprintf(w, "Credentials Inhibited:\t%t\n", deviceDetails.CredentialsInhibited)
+
+	if credentialsSecret == "" {
+		fmt.Fprintln(w, "Credentials Secret:\tnot checked, use --credentials-secret to check it")
+	} else if info, valid, err := pairingDeviceInfoWithSecret(deviceID, credentialsSecret); err != nil {
+		fmt.Fprintf(w, "Credentials Secret:\tunknown, %s\n", err)
+	} else if !valid {
+		fmt.Fprintln(w, "Credentials Secret:\tnot valid")
+	} else {
+		fmt.Fprintln(w, "Credentials Secret:\tvalid")
+		if info.Status != "" {
+			fmt.Fprintf(w, "Pairing Status:\t%s\n", info.Status)
+		}
+		if info.Protocols.AstarteMQTTv1.BrokerURL != "" {
+			fmt.Fprintf(w, "Broker URL:\t%s\n", info.Protocols.AstarteMQTTv1.BrokerURL)
+		}
+	}
+
+	if certFile == "" {
+		fmt.Fprintln(w, "Certificate:\tnot checked, use --certificate to inspect it")
+		w.Flush()
+		return nil
+	}
+	certificate, err := readCertificate(certFile)
+	if err != nil {
+		w.Flush()
+		return err
+	}
+	if certificate.Subject.CommonName != fmt.Sprintf("%s/%s", realm, deviceID) {
+		fmt.Fprintf(w, "Certificate:\tissued for %s, not for this device\n", certificate.Subject.CommonName)
+	}
+	fmt.Fprintf(w, "Certificate Serial Number:\t%s\n", certificate.SerialNumber.Text(16))
+	fmt.Fprintf(w, "Certificate Not After:\t%s\n", utils.FormatTimestamp(certificate.NotAfter, time.RFC3339))
+	fmt.Fprintf(w, "Certificate Status:\t%s\n", certificateStatus(certificate, time.Now()))
+	if credentialsSecret != "" {
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+		if verification, err := verifyDeviceCertificate(deviceID, credentialsSecret, string(certPEM)); err != nil {
+			fmt.Fprintf(w, "Certificate Verification:\tunknown, %s\n", err)
+		} else if verification.Valid {
+			fmt.Fprintln(w, "Certificate Verification:\tvalid")
+		} else {
+			reason := verification.Cause
+			if verification.Details != "" {
+				reason = fmt.Sprintf("%s: %s", reason, verification.Details)
+			}
+			fmt.Fprintf(w, "Certificate Verification:\tnot valid, %s\n", reason)
+		}
+	}
+	w.Flush()
+
+	return nil
+}
+
+// pairingDeviceDetails returns the details of deviceID from AppEngine API, and whether it is registered at all
+func pairingDeviceDetails(deviceID string) (client.DeviceDetails, bool, error) {
+	rawClient, err := utils.RawAPICommandSetup("realm.key", "realm.key-file")
+	if err != nil {
+		return client.DeviceDetails{}, false, err
+	}
+	deviceURL, err := utils.ServiceURL("individual-urls.appengine", "appengine")
+	if err != nil {
+		return client.DeviceDetails{}, false, err
+	}
+	deviceURL.Path = path.Join(deviceURL.Path, "v1", realm, "devices", deviceID)
+
+	data, err := rawClient.Do(http.MethodGet, deviceURL, nil, http.StatusOK)
+	var apiErr *utils.RawAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return client.DeviceDetails{}, false, nil
+	} else if err != nil {
+		return client.DeviceDetails{}, false, err
+	}
+	deviceDetails := client.DeviceDetails{}
+	if err := json.Unmarshal(data, &deviceDetails); err != nil {
+		return client.DeviceDetails{}, false, err
+	}
+	return deviceDetails, true, nil
+}
+
+// pairingDeviceInfoWithSecret requests the information of deviceID to Pairing API with credentialsSecret, as the
+// device would do. When Pairing API rejects credentialsSecret, it is reported as not valid.
+func pairingDeviceInfoWithSecret(deviceID, credentialsSecret string) (pairingDeviceInfo, bool, error) {
+	infoURL, err := utils.ServiceURL("individual-urls.pairing", "pairing")
+	if err != nil {
+		return pairingDeviceInfo{}, false, err
+	}
+	infoURL.Path = path.Join(infoURL.Path, "v1", realm, "devices", deviceID)
+
+	data, err := utils.NewDeviceRawAPIClient(credentialsSecret).Do(http.MethodGet, infoURL, nil, http.StatusOK)
+	var apiErr *utils.RawAPIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return pairingDeviceInfo{}, false, nil
+	} else if err != nil {
+		return pairingDeviceInfo{}, false, err
+	}
+	info := pairingDeviceInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return pairingDeviceInfo{}, false, err
+	}
+	return info, true, nil
+}
+
+// verifyDeviceCertificate asks Pairing API whether certPEM is a valid astarte_mqtt_v1 certificate for deviceID
+func verifyDeviceCertificate(deviceID, credentialsSecret, certPEM string) (certificateVerification, error) {
+	verifyURL, err := utils.ServiceURL("individual-urls.pairing", "pairing")
+	if err != nil {
+		return certificateVerification{}, err
+	}
+	verifyURL.Path = path.Join(verifyURL.Path, "v1", realm, "devices", deviceID, "protocols", "astarte_mqtt_v1", "credentials", "verify")
+
+	data, err := utils.NewDeviceRawAPIClient(credentialsSecret).Do(http.MethodPost, verifyURL,
+		map[string]interface{}{"client_crt": certPEM}, http.StatusOK)
+	if err != nil {
+		return certificateVerification{}, err
+	}
+	verification := certificateVerification{}
+	if err := json.Unmarshal(data, &verification); err != nil {
+		return certificateVerification{}, err
+	}
+	return verification, nil
+}
@@ -0,0 +1,208 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pairing
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var certificatesCmd = &cobra.Command{
+	Use:   "certificates",
+	Short: "Inspect and renew device certificates",
+	Long: `Inspect and renew the astarte_mqtt_v1 certificates of devices. These commands act on behalf of
+a device, with its Credentials Secret, and they do not need the realm key.`,
+	Aliases:           []string{"certificate", "cert"},
+	PersistentPreRunE: devicePersistentPreRunE,
+}
+
+var certificatesInfoCmd = &cobra.Command{
+	Use:   "info <cert.pem>",
+	Short: "Show the details of a device certificate",
+	Long: `Show the details of a device certificate: the realm and the Device ID it was issued for, its issuing CA
+and its validity. This is handy to diagnose devices which can't connect, e.g. as their certificate expired
+while they were offline. No request is made to Astarte.`,
+	Example: `  astartectl pairing certificates info device.crt`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    certificatesInfoF,
+}
+
+var certificatesRenewCmd = &cobra.Command{
+	Use:   "renew <device_id>",
+	Short: "Request a new certificate for a device",
+	Long: `Request a new astarte_mqtt_v1 certificate for a device to Pairing API, given its Credentials Secret
+and a Certificate Signing Request for its private key. The certificate is printed, or written to --output.`,
+	Example: `  astartectl pairing certificates renew 2TBn-jNESuuHamE2Zo1anA --credentials-secret <secret> --csr device.csr -o device.crt`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    certificatesRenewF,
+}
+
+func init() {
+	certificatesRenewCmd.Flags().String("credentials-secret", "", "The Credentials Secret of the device.")
+	_ = certificatesRenewCmd.MarkFlagRequired("credentials-secret")
+	certificatesRenewCmd.Flags().String("csr", "", "Path to the PEM encoded Certificate Signing Request.")
+	_ = certificatesRenewCmd.MarkFlagRequired("csr")
+	_ = certificatesRenewCmd.MarkFlagFilename("csr")
+	certificatesRenewCmd.Flags().StringP("output", "o", "", "If specified, the certificate will be saved to specified file")
+
+	certificatesCmd.AddCommand(
+		certificatesInfoCmd,
+		certificatesRenewCmd,
+	)
+	PairingCmd.AddCommand(certificatesCmd)
+}
+
+// devicePersistentPreRunE sets up commands acting on behalf of a device, which do not need the realm key
+func devicePersistentPreRunE(cmd *cobra.Command, args []string) error {
+	_ = viper.BindPFlag("realm.name", cmd.Flags().Lookup("realm-name"))
+	realm = viper.GetString("realm.name")
+
+	// if just --to-curl is given, default to true
+	cmd.Flags().Lookup("to-curl").NoOptDefVal = "true"
+
+	return nil
+}
+
+func certificatesInfoF(command *cobra.Command, args []string) error {
+	certificate, err := readCertificate(args[0])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "Common Name:\t%s\n", certificate.Subject.CommonName)
+	// Astarte issues certificates with <realm>/<device_id> as Common Name
+	if certRealm, certDeviceID, ok := strings.Cut(certificate.Subject.CommonName, "/"); ok && deviceid.IsValid(certDeviceID) {
+		fmt.Fprintf(w, "Realm:\t%s\n", certRealm)
+		fmt.Fprintf(w, "Device ID:\t%s\n", certDeviceID)
+	} else {
+		fmt.Fprintln(w, "Device ID:\tunknown, this is not an Astarte device certificate")
+	}
+	fmt.Fprintf(w, "Issuer:\t%s\n", certificate.Issuer)
+	fmt.Fprintf(w, "Serial Number:\t%s\n", certificate.SerialNumber.Text(16))
+	fmt.Fprintf(w, "Not Before:\t%s\n", utils.FormatTimestamp(certificate.NotBefore, time.RFC3339))
+	fmt.Fprintf(w, "Not After:\t%s\n", utils.FormatTimestamp(certificate.NotAfter, time.RFC3339))
+	fmt.Fprintf(w, "Status:\t%s\n", certificateStatus(certificate, time.Now()))
+	fingerprint := sha256.Sum256(certificate.Raw)
+	fmt.Fprintf(w, "SHA-256 Fingerprint:\t%s\n", hex.EncodeToString(fingerprint[:]))
+	w.Flush()
+
+	return nil
+}
+
+// readCertificate reads the first PEM encoded certificate in certFile
+func readCertificate(certFile string) (*x509.Certificate, error) {
+	contents, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	block, rest := pem.Decode(contents)
+	for block != nil && block.Type != "CERTIFICATE" {
+		block, rest = pem.Decode(rest)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded certificate", certFile)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certificateStatus describes the validity of certificate at now
+func certificateStatus(certificate *x509.Certificate, now time.Time) string {
+	switch {
+	case now.Before(certificate.NotBefore):
+		return fmt.Sprintf("not valid yet, valid in %s", certificate.NotBefore.Sub(now).Round(time.Second))
+	case now.After(certificate.NotAfter):
+		return fmt.Sprintf("expired %s ago", now.Sub(certificate.NotAfter).Round(time.Second))
+	default:
+		return fmt.Sprintf("valid, expires in %s", certificate.NotAfter.Sub(now).Round(time.Second))
+	}
+}
+
+func certificatesRenewF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	if !deviceid.IsValid(deviceID) {
+		return errors.New("Invalid device id")
+	}
+	if realm == "" {
+		return errors.New("realm is required")
+	}
+	credentialsSecret, err := command.Flags().GetString("credentials-secret")
+	if err != nil {
+		return err
+	}
+	csrFile, err := command.Flags().GetString("csr")
+	if err != nil {
+		return err
+	}
+	output, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	csr, err := os.ReadFile(csrFile)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(csr); block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return fmt.Errorf("%s does not contain a PEM encoded Certificate Signing Request", csrFile)
+	}
+
+	deviceClient, err := utils.NewDevicePairingClient(credentialsSecret)
+	if err != nil {
+		return err
+	}
+	certificateCall, err := deviceClient.ObtainNewMQTTv1CertificateForDevice(realm, deviceID, string(csr))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	utils.MaybeCurlAndExit(certificateCall, deviceClient)
+
+	certificateRes, err := certificateCall.Run(deviceClient)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	certificate, err := certificateRes.Parse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%v", certificate)))
+		return nil
+	}
+	if err := os.WriteFile(output, []byte(fmt.Sprintf("%v", certificate)), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Certificate written to %s\n", output)
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pairing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info <device_id>",
+	Short: "Show the broker URL and protocol information of a device",
+	Long: `Show the information returned by Pairing API to a device authenticated with its Credentials Secret,
+as the device would request it: its status and, for each protocol, its parameters such as the broker URL.
+This is handy to verify the pairing configuration of a realm without embedding an SDK. The realm key is not needed.
+
+With --check-broker, the broker is connected to, checking that it is exposed and showing the certificate it
+presents. No client certificate is sent: use 'pairing onboard --verify' to check that a device can connect.`,
+	Example:           `  astartectl pairing info 2TBn-jNESuuHamE2Zo1anA --credentials-secret <secret> --check-broker`,
+	Args:              cobra.ExactArgs(1),
+	PersistentPreRunE: devicePersistentPreRunE,
+	RunE:              infoF,
+}
+
+// pairingProtocolsInfo is the information returned by Pairing API to a device, with the parameters of all its protocols
+type pairingProtocolsInfo struct {
+	DeviceID  string                            `json:"device_id"`
+	Realm     string                            `json:"realm"`
+	Status    string                            `json:"status,omitempty"`
+	Version   string                            `json:"version,omitempty"`
+	Protocols map[string]map[string]interface{} `json:"protocols"`
+	Broker    *brokerCheck                      `json:"broker_check,omitempty"`
+}
+
+// brokerCheck is the outcome of a connection to the broker of a device
+type brokerCheck struct {
+	Address            string     `json:"address"`
+	Reachable          bool       `json:"reachable"`
+	CertificateSubject string     `json:"certificate_subject,omitempty"`
+	CertificateIssuer  string     `json:"certificate_issuer,omitempty"`
+	CertificateExpiry  *time.Time `json:"certificate_expiry,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
+func init() {
+	infoCmd.Flags().String("credentials-secret", "", "The Credentials Secret of the device.")
+	_ = infoCmd.MarkFlagRequired("credentials-secret")
+	infoCmd.Flags().Bool("check-broker", false, "When set, check that the broker of the device is reachable.")
+	infoCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default", "json"))
+
+	PairingCmd.AddCommand(infoCmd)
+}
+
+func infoF(command *cobra.Command, args []string) error {
+	deviceID := args[0]
+	if !deviceid.IsValid(deviceID) {
+		return errors.New("Invalid device id")
+	}
+	if realm == "" {
+		return errors.New("realm is required")
+	}
+	credentialsSecret, err := command.Flags().GetString("credentials-secret")
+	if err != nil {
+		return err
+	}
+	checkBroker, err := command.Flags().GetBool("check-broker")
+	if err != nil {
+		return err
+	}
+	outputType, templateOutput, err := utils.OutputFromFlags(command, "default", "json")
+	if err != nil {
+		return err
+	}
+
+	deviceClient, err := utils.NewDevicePairingClient(credentialsSecret)
+	if err != nil {
+		return err
+	}
+	infoCall, err := deviceClient.GetMQTTv1ProtocolInformationForDevice(realm, deviceID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	utils.MaybeCurlAndExit(infoCall, deviceClient)
+
+	info, err := pairingProtocolsInfoWithSecret(deviceID, credentialsSecret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	info.DeviceID = deviceID
+	info.Realm = realm
+
+	if checkBroker {
+		brokerURL, _ := info.Protocols["astarte_mqtt_v1"]["broker_url"].(string)
+		if brokerURL == "" {
+			fmt.Fprintln(os.Stderr, "Pairing API returned no broker URL for the device.")
+			os.Exit(1)
+		}
+		check := checkBrokerExposure(brokerURL)
+		info.Broker = &check
+	}
+
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, info)
+	} else if outputType == "json" {
+		out, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	} else {
+		printProtocolsInfo(info)
+	}
+
+	if info.Broker != nil && info.Broker.Error != "" {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// pairingProtocolsInfoWithSecret asks Pairing API the information of a device, authenticated with its Credentials Secret.
+// astarte-go parses only the broker URL, hence the request is performed with a RawAPIClient.
+func pairingProtocolsInfoWithSecret(deviceID, credentialsSecret string) (pairingProtocolsInfo, error) {
+	infoURL, err := utils.ServiceURL("individual-urls.pairing", "pairing")
+	if err != nil {
+		return pairingProtocolsInfo{}, err
+	}
+	infoURL.Path = path.Join(infoURL.Path, "v1", realm, "devices", deviceID)
+
+	data, err := utils.NewDeviceRawAPIClient(credentialsSecret).Do(http.MethodGet, infoURL, nil, http.StatusOK)
+	var apiErr *utils.RawAPIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return pairingProtocolsInfo{}, fmt.Errorf("The Credentials Secret is not valid for device %s", deviceID)
+	} else if err != nil {
+		return pairingProtocolsInfo{}, err
+	}
+	info := pairingProtocolsInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return pairingProtocolsInfo{}, err
+	}
+	return info, nil
+}
+
+func printProtocolsInfo(info pairingProtocolsInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "Device ID:\t%s\n", info.DeviceID)
+	fmt.Fprintf(w, "Realm:\t%s\n", info.Realm)
+	if info.Status != "" {
+		fmt.Fprintf(w, "Pairing Status:\t%s\n", info.Status)
+	}
+	if info.Version != "" {
+		fmt.Fprintf(w, "Astarte Version:\t%s\n", info.Version)
+	}
+
+	protocols := []string{}
+	for p := range info.Protocols {
+		protocols = append(protocols, p)
+	}
+	sort.Strings(protocols)
+	for _, p := range protocols {
+		fmt.Fprintf(w, "Protocol:\t%s\n", p)
+		params := []string{}
+		for k := range info.Protocols[p] {
+			params = append(params, k)
+		}
+		sort.Strings(params)
+		for _, k := range params {
+			fmt.Fprintf(w, "  %s:\t%v\n", k, info.Protocols[p][k])
+		}
+	}
+
+	if info.Broker != nil {
+		switch {
+		case !info.Broker.Reachable:
+			fmt.Fprintf(w, "Broker:\tnot reachable at %s, %s\n", info.Broker.Address, info.Broker.Error)
+		case info.Broker.Error != "":
+			fmt.Fprintf(w, "Broker:\treachable at %s, but %s\n", info.Broker.Address, info.Broker.Error)
+		default:
+			fmt.Fprintf(w, "Broker:\treachable at %s\n", info.Broker.Address)
+			fmt.Fprintf(w, "Broker Certificate:\t%s, issued by %s\n", info.Broker.CertificateSubject, info.Broker.CertificateIssuer)
+			fmt.Fprintf(w, "Broker Certificate Expiry:\t%s\n", utils.FormatTimestamp(*info.Broker.CertificateExpiry, time.RFC3339))
+		}
+	}
+	w.Flush()
+}
+
+// checkBrokerExposure connects to the broker at brokerURL, checking that it is reachable and that it
+// presents a valid certificate. As no client certificate is sent, the broker may close the connection
+// after presenting its certificate, which is not reported as an error.
+func checkBrokerExposure(brokerURL string) brokerCheck {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return brokerCheck{Address: brokerURL, Error: err.Error()}
+	}
+	check := brokerCheck{Address: u.Host}
+	if u.Port() == "" {
+		check.Address = net.JoinHostPort(u.Hostname(), "8883")
+	}
+
+	conn, err := net.DialTimeout("tcp", check.Address, 10*time.Second)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer conn.Close()
+	check.Reachable = true
+	if u.Scheme != "mqtts" && u.Scheme != "ssl" {
+		return check
+	}
+
+	var serverCertificate *x509.Certificate
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: viper.GetBool("ignore-ssl-errors"),
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) > 0 {
+				serverCertificate = state.PeerCertificates[0]
+			}
+			return nil
+		},
+	})
+	if err := tlsConn.Handshake(); err != nil && serverCertificate == nil {
+		check.Error = fmt.Sprintf("the TLS handshake failed: %s", err)
+		return check
+	}
+	check.CertificateSubject = serverCertificate.Subject.CommonName
+	check.CertificateIssuer = serverCertificate.Issuer.CommonName
+	check.CertificateExpiry = &serverCertificate.NotAfter
+	return check
+}
@@ -0,0 +1,229 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pairing
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var onboardCmd = &cobra.Command{
+	Use:   "onboard [<device_id>]",
+	Short: "Bring up a device, from registration to its MQTT credentials",
+	Long: `Guide through all the steps needed to bring up a device, typically for testing:
+registering it (or using an existing device with --credentials-secret), requesting an
+astarte_mqtt_v1 certificate for it through Pairing API, writing its private key and certificate to
+disk and, with --verify, checking that the broker accepts them.
+
+When <device_id> is not given, you are asked for one, defaulting to a random Device ID.
+The private key and the certificate are written to --output-dir as <device_id>.key and <device_id>.crt.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl pairing onboard --verify
+  astartectl pairing onboard 2TBn-jNESuuHamE2Zo1anA --credentials-secret <secret> --output-dir ./device -y`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: onboardF,
+}
+
+func init() {
+	onboardCmd.Flags().String("credentials-secret", "", "The Credentials Secret of an already registered device. When set, the device is not registered.")
+	onboardCmd.Flags().String("output-dir", ".", "The directory where the private key and the certificate of the device are written.")
+	_ = onboardCmd.MarkFlagDirname("output-dir")
+	onboardCmd.Flags().Bool("verify", false, "When set, verify that the broker accepts the device certificate.")
+	utils.AddNonInteractiveFlag(onboardCmd.Flags())
+
+	PairingCmd.AddCommand(onboardCmd)
+}
+
+func onboardF(command *cobra.Command, args []string) error {
+	if viper.GetBool("pairing-to-curl") {
+		fmt.Println(`'onboard' does not support the --to-curl option.
+Use 'agent register' to register the device, then request its credentials to Pairing API step by step.`)
+		os.Exit(1)
+	}
+
+	credentialsSecret, err := command.Flags().GetString("credentials-secret")
+	if err != nil {
+		return err
+	}
+	outputDir, err := command.Flags().GetString("output-dir")
+	if err != nil {
+		return err
+	}
+	verify, err := command.Flags().GetBool("verify")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+
+	deviceID := ""
+	if len(args) == 1 {
+		deviceID = args[0]
+	} else {
+		if credentialsSecret != "" {
+			return errors.New("<device_id> is required when using --credentials-secret")
+		}
+		randomID, err := deviceid.GenerateRandom()
+		if err != nil {
+			return err
+		}
+		if deviceID, err = utils.PromptChoice("Device ID:", randomID, false, nonInteractive); err != nil {
+			return err
+		}
+	}
+	if !deviceid.IsValid(deviceID) {
+		return errors.New("Invalid device id")
+	}
+
+	keyFile := filepath.Join(outputDir, deviceID+".key")
+	certFile := filepath.Join(outputDir, deviceID+".crt")
+	for _, f := range []string{keyFile, certFile} {
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("%s already exists, refusing to overwrite it", f)
+		}
+	}
+
+	fmt.Printf("Will onboard device %s in realm %s, writing its credentials to %s.\n", deviceID, realm, outputDir)
+	if credentialsSecret == "" {
+		fmt.Println("The device will be registered: make sure it is not registered yet.")
+	}
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	// 1. Credentials secret
+	if credentialsSecret == "" {
+		fmt.Print("Registering device... ")
+		if credentialsSecret, err = registerDevice(deviceID); err != nil {
+			fmt.Println()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("ok")
+	}
+
+	// 2. Certificate, requested on behalf of the device
+	deviceClient, err := utils.NewDevicePairingClient(credentialsSecret)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print("Requesting device certificate... ")
+	privateKey, certificate, err := utils.ObtainDeviceCertificate(deviceClient, realm, deviceID)
+	if err != nil {
+		fmt.Println()
+		fmt.Fprintln(os.Stderr, err)
+		onboardFailed(deviceID, credentialsSecret)
+	}
+	fmt.Println("ok")
+
+	// 3. Files
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		onboardFailed(deviceID, credentialsSecret)
+	}
+	if err := os.WriteFile(keyFile, privateKey, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		onboardFailed(deviceID, credentialsSecret)
+	}
+	if err := os.WriteFile(certFile, certificate, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		onboardFailed(deviceID, credentialsSecret)
+	}
+	fmt.Printf("Private key written to %s, certificate written to %s\n", keyFile, certFile)
+
+	// 4. Broker
+	brokerURL, err := utils.DeviceBrokerURL(deviceClient, realm, deviceID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warn: Could not get the broker URL: %s\n", err)
+	}
+	if verify && brokerURL != "" {
+		fmt.Printf("Connecting to %s... ", brokerURL)
+		if err := verifyBrokerConnection(brokerURL, keyFile, certFile); err != nil {
+			fmt.Println()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("ok")
+	}
+
+	fmt.Println()
+	fmt.Printf("Device ID:          %s\n", deviceID)
+	fmt.Printf("Credentials Secret: %s\n", credentialsSecret)
+	if brokerURL != "" {
+		fmt.Printf("Broker URL:         %s\n", brokerURL)
+	}
+	fmt.Println()
+	fmt.Println("Please don't share the Credentials Secret, and ensure it is transferred securely to your Device.")
+	return nil
+}
+
+// onboardFailed reports the Credentials Secret of a device whose onboarding failed after its
+// registration, as it can't be obtained again, and exits.
+func onboardFailed(deviceID, credentialsSecret string) {
+	fmt.Fprintf(os.Stderr, "The Credentials Secret of device %s is \"%s\": use it with --credentials-secret to try again.\n", deviceID, credentialsSecret)
+	os.Exit(1)
+}
+
+// verifyBrokerConnection checks that the broker at brokerURL accepts a TLS connection authenticated
+// with the device certificate
+func verifyBrokerConnection(brokerURL, keyFile, certFile string) error {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "8883")
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: viper.GetBool("ignore-ssl-errors"),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not connect to the broker: %w", err)
+	}
+	defer conn.Close()
+
+	// With TLS 1.3, a rejected client certificate is reported only after the handshake
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return fmt.Errorf("The broker rejected the device certificate: %w", err)
+		}
+	}
+	return nil
+}
@@ -44,6 +44,7 @@ func init() {
 	_ = viper.BindPFlag("individual-urls.pairing", PairingCmd.PersistentFlags().Lookup("pairing-url"))
 	PairingCmd.PersistentFlags().StringP("realm-name", "r", "",
 		"The name of the realm that will be queried")
+	_ = PairingCmd.RegisterFlagCompletionFunc("realm-name", utils.RealmNamesCompletion)
 	PairingCmd.PersistentFlags().Bool("to-curl", false,
 		"When set, display a command-line equivalent instead of running the command.")
 	_ = viper.BindPFlag("pairing-to-curl", PairingCmd.PersistentFlags().Lookup("to-curl"))
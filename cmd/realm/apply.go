@@ -0,0 +1,458 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astarte-go/triggers"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply -f <directory>",
+	Short: "Apply a bundle of interfaces and triggers",
+	Long: `Apply all interfaces and triggers found in a directory to the realm, as a single
+entrypoint replacing separate 'interfaces sync' and 'triggers sync' invocations.
+
+The directory is scanned recursively for JSON files, which are recognized as interfaces or triggers
+by their content. Operations are ordered so that interfaces are installed or updated before the
+triggers referencing them, and a trigger is not installed if an interface it depends on could not be
+applied. Triggers referencing interfaces which are neither in the bundle nor in the realm are
+reported as errors before anything is applied.
+
+Interfaces are handled as in 'interfaces sync'. Triggers which are already installed are left
+untouched, unless --force is set: in that case, they are deleted and recreated.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl realm-management apply -f realm-bundle/
+  astartectl realm-management apply -f realm-bundle/ --force -y`,
+	Args: cobra.NoArgs,
+	RunE: applyF,
+}
+
+type applyAction string
+
+const (
+	applyInstall  applyAction = "install"
+	applyUpdate   applyAction = "update"
+	applyRecreate applyAction = "recreate"
+	applySkip     applyAction = "skip"
+)
+
+var applyActionDone = map[applyAction]string{
+	applyInstall:  "installed",
+	applyUpdate:   "updated",
+	applyRecreate: "recreated",
+}
+
+// applyOperation is a step of the plan built by apply
+type applyOperation struct {
+	Action    applyAction
+	File      string
+	Interface *interfaces.AstarteInterface
+	Trigger   *triggers.AstarteTrigger
+	// RawTrigger, when set, is installed in place of Trigger, as it may hold fields (e.g. AMQP actions)
+	// which triggers.AstarteTrigger does not support
+	RawTrigger map[string]interface{}
+	// DependsOn holds the interfaces of the bundle (in "name vMajor" form) a trigger references
+	DependsOn []string
+}
+
+func (o applyOperation) String() string {
+	if o.Interface != nil {
+		switch o.Action {
+		case applyInstall:
+			return fmt.Sprintf("Will install interface %s version %d.%d", o.Interface.Name, o.Interface.MajorVersion, o.Interface.MinorVersion)
+		case applyUpdate:
+			return fmt.Sprintf("Will update interface %s to version %d.%d", o.Interface.Name, o.Interface.MajorVersion, o.Interface.MinorVersion)
+		default:
+			return fmt.Sprintf("Will skip interface %s version %d.%d, as it is already installed", o.Interface.Name, o.Interface.MajorVersion, o.Interface.MinorVersion)
+		}
+	}
+	switch o.Action {
+	case applyInstall:
+		return fmt.Sprintf("Will install trigger %s", o.Trigger.Name)
+	case applyRecreate:
+		return fmt.Sprintf("Will DELETE and RECREATE trigger %s", o.Trigger.Name)
+	}
+	return fmt.Sprintf("Will skip trigger %s, as it is already installed (use --force to recreate it)", o.Trigger.Name)
+}
+
+func init() {
+	applyCmd.Flags().StringP("filename", "f", "", "The directory containing the interfaces and triggers to be applied.")
+	_ = applyCmd.MarkFlagRequired("filename")
+	_ = applyCmd.MarkFlagDirname("filename")
+	applyCmd.Flags().Bool("force", false, "When set, recreate triggers which are already installed")
+	utils.AddNonInteractiveFlag(applyCmd.Flags())
+
+	RealmManagementCmd.AddCommand(applyCmd)
+}
+
+func applyF(command *cobra.Command, args []string) error {
+	if viper.GetBool("realmmanagement-to-curl") {
+		fmt.Println(`'apply' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+
+	bundleDir, err := command.Flags().GetString("filename")
+	if err != nil {
+		return err
+	}
+	force, err := command.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+
+	files, err := jsonFilesIn(bundleDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No JSON files found in %s\n", bundleDir)
+		os.Exit(1)
+	}
+	interfaceOps, triggerOps, err := planApply(astarteAPIClient, realm, files, force)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	plan := append(append([]applyOperation{}, interfaceOps...), triggerOps...)
+	pending := 0
+	for _, op := range plan {
+		if op.Action != applySkip {
+			pending++
+		}
+	}
+	if pending == 0 {
+		for _, op := range plan {
+			fmt.Println(op)
+		}
+		// All good in the hood
+		fmt.Println("Your realm is in sync with the provided bundle")
+		return nil
+	}
+
+	// Notify the user about what we're about to do
+	fmt.Println("The following actions will be taken:")
+	fmt.Println()
+	for _, op := range plan {
+		fmt.Println(op)
+	}
+	fmt.Println()
+
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	if failures := executeApply(astarteAPIClient, realm, interfaceOps, triggerOps, map[applyAction]int{}); failures > 0 {
+		fmt.Fprintf(os.Stderr, "%d operations failed\n", failures)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// executeApply performs the operations planned by planApply, returning how many of them failed.
+// Operations which succeed are counted in done, by action.
+func executeApply(realmClient *client.Client, realm string, interfaceOps, triggerOps []applyOperation, done map[applyAction]int) int {
+	// Interfaces come first, so that triggers can reference them
+	failedInterfaces := map[string]bool{}
+	failures := 0
+	var err error
+	for _, op := range interfaceOps {
+		if op.Action == applySkip {
+			continue
+		}
+		key := interfaceKey(op.Interface.Name, op.Interface.MajorVersion)
+		switch op.Action {
+		case applyInstall:
+			err = installInterface(realmClient, realm, *op.Interface)
+		case applyUpdate:
+			err = updateInterface(realmClient, realm, op.Interface.Name, op.Interface.MajorVersion, *op.Interface)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not %s interface %s: %s\n", op.Action, key, err)
+			failedInterfaces[key] = true
+			failures++
+		} else {
+			fmt.Printf("Interface %s %s successfully\n", key, applyActionDone[op.Action])
+			done[op.Action]++
+		}
+	}
+
+	for _, op := range triggerOps {
+		if op.Action == applySkip {
+			continue
+		}
+		failedDependencies := []string{}
+		for _, d := range op.DependsOn {
+			if failedInterfaces[d] {
+				failedDependencies = append(failedDependencies, d)
+			}
+		}
+		if len(failedDependencies) > 0 {
+			fmt.Fprintf(os.Stderr, "Not applying trigger %s, as interfaces %s could not be applied\n", op.Trigger.Name,
+				strings.Join(failedDependencies, ", "))
+			failures++
+			continue
+		}
+
+		var triggerPayload interface{} = *op.Trigger
+		if op.RawTrigger != nil {
+			triggerPayload = op.RawTrigger
+		}
+		if op.Action == applyRecreate {
+			err = updateTrigger(realmClient, realm, op.Trigger.Name, triggerPayload)
+		} else {
+			err = installTrigger(realmClient, realm, triggerPayload)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not %s trigger %s: %s\n", op.Action, op.Trigger.Name, err)
+			failures++
+		} else {
+			fmt.Printf("Trigger %s %s successfully\n", op.Trigger.Name, applyActionDone[op.Action])
+			done[op.Action]++
+		}
+	}
+	return failures
+}
+
+// jsonFilesIn returns the JSON files found in dir and its subdirectories, sorted by path
+func jsonFilesIn(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".json") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// planApply returns the operations needed to bring realm in sync with the interfaces and triggers
+// in files, split between interfaces and triggers. Triggers are checked against the interfaces of the
+// bundle and of the realm, and an error is returned if any of them is invalid or has unmet dependencies.
+func planApply(realmClient *client.Client, realm string, files []string, force bool) ([]applyOperation, []applyOperation, error) {
+	inventory, err := newRealmInventory(realmClient, realm)
+	if err != nil {
+		return nil, nil, err
+	}
+	interfaceOps := []applyOperation{}
+	triggerOps := []applyOperation{}
+	bundleInterfaces := map[string]string{}
+	bundleTriggers := map[string]string{}
+	problems := []string{}
+
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(content, &fields); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: not a valid JSON object: %s", f, err))
+			continue
+		}
+
+		switch {
+		case fields["interface_name"] != nil:
+			var astarteInterface interfaces.AstarteInterface
+			if err := json.Unmarshal(content, &astarteInterface); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid interface: %s", f, err))
+				continue
+			}
+			key := interfaceKey(astarteInterface.Name, astarteInterface.MajorVersion)
+			if other, ok := bundleInterfaces[key]; ok {
+				problems = append(problems, fmt.Sprintf("%s: interface %s is also defined in %s", f, key, other))
+				continue
+			}
+			bundleInterfaces[key] = f
+
+			op := applyOperation{Action: applyInstall, File: f, Interface: &astarteInterface}
+			interfaceDefinition, err := inventory.interfaceDefinition(astarteInterface.Name, astarteInterface.MajorVersion)
+			if err != nil {
+				return nil, nil, err
+			}
+			if interfaceDefinition != nil {
+				switch {
+				case interfaceDefinition.MinorVersion < astarteInterface.MinorVersion:
+					op.Action = applyUpdate
+				case interfaceDefinition.MinorVersion > astarteInterface.MinorVersion:
+					// Notify that the realm has a more recent revision
+					fmt.Fprintf(os.Stderr, "warn: Interface %s has version %d.%d in the realm and %d.%d in the local file\n", interfaceDefinition.Name,
+						interfaceDefinition.MajorVersion, interfaceDefinition.MinorVersion, astarteInterface.MajorVersion, astarteInterface.MinorVersion)
+					continue
+				default:
+					op.Action = applySkip
+				}
+			}
+			interfaceOps = append(interfaceOps, op)
+
+		case fields["simple_triggers"] != nil:
+			if !validateTrigger(f) {
+				problems = append(problems, fmt.Sprintf("%s: invalid trigger", f))
+				continue
+			}
+			var astarteTrigger triggers.AstarteTrigger
+			if err := json.Unmarshal(content, &astarteTrigger); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid trigger: %s", f, err))
+				continue
+			}
+			if other, ok := bundleTriggers[astarteTrigger.Name]; ok {
+				problems = append(problems, fmt.Sprintf("%s: trigger %s is also defined in %s", f, astarteTrigger.Name, other))
+				continue
+			}
+			bundleTriggers[astarteTrigger.Name] = f
+
+			op := applyOperation{Action: applyInstall, File: f, Trigger: &astarteTrigger}
+			if inventory.triggers[astarteTrigger.Name] {
+				op.Action = applySkip
+				if force {
+					op.Action = applyRecreate
+				}
+			}
+			triggerOps = append(triggerOps, op)
+
+		default:
+			fmt.Fprintf(os.Stderr, "warn: %s is neither an interface nor a trigger, skipping it\n", f)
+		}
+	}
+
+	// Resolve the interfaces referenced by triggers, either in the bundle or in the realm
+	for i, op := range triggerOps {
+		if op.Action == applySkip {
+			continue
+		}
+		for _, s := range op.Trigger.SimpleTriggers {
+			if s.InterfaceName == "" || s.InterfaceName == "*" {
+				continue
+			}
+			major, err := strconv.Atoi(s.InterfaceMajor.String())
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid interface_major %q for interface %s", op.File, s.InterfaceMajor, s.InterfaceName))
+				continue
+			}
+			key := interfaceKey(s.InterfaceName, major)
+			if _, ok := bundleInterfaces[key]; ok {
+				triggerOps[i].DependsOn = append(triggerOps[i].DependsOn, key)
+				continue
+			}
+			found, err := inventory.hasInterface(s.InterfaceName, major)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("%s: trigger %s references interface %s, which is neither in the bundle nor in the realm",
+					op.File, op.Trigger.Name, key))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, errors.New("The bundle cannot be applied:\n  " + strings.Join(problems, "\n  "))
+	}
+	return interfaceOps, triggerOps, nil
+}
+
+// realmInventory tells which interfaces and triggers are installed in a realm. It relies on the realm
+// listings rather than on failed lookups, which might fail for other reasons than a missing entry.
+type realmInventory struct {
+	realmClient *client.Client
+	realm       string
+	// interfaceMajors are the major versions of each interface, listed when first needed
+	interfaceMajors map[string][]int
+	triggers        map[string]bool
+}
+
+func newRealmInventory(realmClient *client.Client, realm string) (*realmInventory, error) {
+	interfaceNames, err := listInterfaces(realmClient, realm)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the interfaces of realm %s: %w", realm, err)
+	}
+	triggerNames, err := listTriggers(realmClient, realm)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the triggers of realm %s: %w", realm, err)
+	}
+	inventory := &realmInventory{realmClient: realmClient, realm: realm, interfaceMajors: map[string][]int{}, triggers: map[string]bool{}}
+	for _, name := range interfaceNames {
+		inventory.interfaceMajors[name] = nil
+	}
+	for _, name := range triggerNames {
+		inventory.triggers[name] = true
+	}
+	return inventory, nil
+}
+
+// hasInterface returns whether the given major version of an interface is installed in the realm
+func (i *realmInventory) hasInterface(name string, major int) (bool, error) {
+	majors, ok := i.interfaceMajors[name]
+	if !ok {
+		return false, nil
+	}
+	if majors == nil {
+		var err error
+		if majors, err = interfaceVersions(i.realmClient, i.realm, name); err != nil {
+			return false, fmt.Errorf("Could not list the versions of interface %s: %w", name, err)
+		}
+		i.interfaceMajors[name] = majors
+	}
+	for _, m := range majors {
+		if m == major {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// interfaceDefinition returns the given major version of an interface, or nil if it is not installed in the realm
+func (i *realmInventory) interfaceDefinition(name string, major int) (*interfaces.AstarteInterface, error) {
+	found, err := i.hasInterface(name, major)
+	if err != nil || !found {
+		return nil, err
+	}
+	interfaceDefinition, err := getInterfaceDefinition(i.realmClient, i.realm, name, major)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get interface %s: %w", interfaceKey(name, major), err)
+	}
+	return &interfaceDefinition, nil
+}
+
+func interfaceKey(name string, major int) string {
+	return fmt.Sprintf("%s v%d", name, major)
+}
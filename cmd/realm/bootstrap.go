@@ -0,0 +1,475 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+var bootstrapCmd = &cobra.Command{
+	Use:   "bootstrap -f <manifest>",
+	Short: "Reconcile the realm with a declarative manifest",
+	Long: `Reconcile the realm with a YAML manifest declaring its interfaces, triggers, trigger delivery policies
+and groups, turning the setup of a new realm into a single idempotent command.
+
+Directories in the manifest are relative to the manifest itself, and they are scanned recursively for
+JSON files. Delivery policies are installed first, then interfaces and triggers are applied as in
+'apply', and finally groups are created, or the devices they lack are added to them. Devices in a group
+but not in the manifest are left untouched, as are delivery policies which are already installed.
+
+Before anything is changed, the planned actions are shown and confirmation is asked, unless
+--yes is set. With --dry-run, only the plan is shown. A report of the installed, updated
+and skipped resources is printed at the end. This command does not support the --to-curl flag.
+
+The manifest looks like this:
+
+  interfaces:
+    - interfaces/
+  triggers:
+    - triggers/
+  trigger-delivery-policies:
+    - policies/
+  groups:
+    - name: beta-testers
+      devices:
+        - 2TBn-jNESuuHamE2Zo1anA`,
+	Example: `  astartectl realm-management bootstrap -f realm.yaml
+  astartectl realm-management bootstrap -f realm.yaml --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: bootstrapF,
+}
+
+// bootstrapManifest is the declarative description of a realm read by bootstrap
+type bootstrapManifest struct {
+	Interfaces              []string                 `yaml:"interfaces"`
+	Triggers                []string                 `yaml:"triggers"`
+	TriggerDeliveryPolicies []string                 `yaml:"trigger-delivery-policies"`
+	Groups                  []bootstrapManifestGroup `yaml:"groups"`
+}
+
+type bootstrapManifestGroup struct {
+	Name    string   `yaml:"name"`
+	Devices []string `yaml:"devices"`
+}
+
+// bootstrapPolicyOperation is a step of the plan built by bootstrap for a trigger delivery policy
+type bootstrapPolicyOperation struct {
+	Action     applyAction
+	File       string
+	Name       string
+	Definition map[string]interface{}
+}
+
+func (o bootstrapPolicyOperation) String() string {
+	if o.Action == applySkip {
+		return fmt.Sprintf("Will skip trigger delivery policy %s, as it is already installed", o.Name)
+	}
+	return fmt.Sprintf("Will install trigger delivery policy %s", o.Name)
+}
+
+// bootstrapGroupOperation is a step of the plan built by bootstrap for a group. Devices are the ones
+// to be added to the group.
+type bootstrapGroupOperation struct {
+	Action  applyAction
+	Name    string
+	Devices []string
+}
+
+func (o bootstrapGroupOperation) String() string {
+	switch o.Action {
+	case applyInstall:
+		return fmt.Sprintf("Will create group %s with %d devices", o.Name, len(o.Devices))
+	case applyUpdate:
+		return fmt.Sprintf("Will add %d devices to group %s", len(o.Devices), o.Name)
+	}
+	return fmt.Sprintf("Will skip group %s, as it already holds all of its devices", o.Name)
+}
+
+func init() {
+	bootstrapCmd.Flags().StringP("filename", "f", "", "The manifest describing the realm.")
+	_ = bootstrapCmd.MarkFlagRequired("filename")
+	_ = bootstrapCmd.MarkFlagFilename("filename", "yaml", "yml")
+	bootstrapCmd.Flags().Bool("force", false, "When set, recreate triggers which are already installed")
+	bootstrapCmd.Flags().Bool("dry-run", false, "When set, show the planned actions without performing them")
+	utils.AddNonInteractiveFlag(bootstrapCmd.Flags())
+
+	RealmManagementCmd.AddCommand(bootstrapCmd)
+}
+
+func bootstrapF(command *cobra.Command, args []string) error {
+	if viper.GetBool("realmmanagement-to-curl") {
+		fmt.Println(`'bootstrap' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+
+	manifestFile, err := command.Flags().GetString("filename")
+	if err != nil {
+		return err
+	}
+	force, err := command.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+
+	manifest, err := loadBootstrapManifest(manifestFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	policyOps, err := planBootstrapPolicies(manifest.TriggerDeliveryPolicies)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	files := []string{}
+	for _, dir := range append(append([]string{}, manifest.Interfaces...), manifest.Triggers...) {
+		dirFiles, err := jsonFilesIn(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		files = append(files, dirFiles...)
+	}
+	interfaceOps, triggerOps := []applyOperation{}, []applyOperation{}
+	if len(files) > 0 {
+		if interfaceOps, triggerOps, err = planApply(astarteAPIClient, realm, files, force); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	var appEngineClient *client.Client
+	groupOps := []bootstrapGroupOperation{}
+	if len(manifest.Groups) > 0 {
+		if appEngineClient, err = utils.APICommandSetup(
+			map[astarteservices.AstarteService]string{astarteservices.AppEngine: "individual-urls.appengine"}, "realm.key", "realm.key-file"); err != nil {
+			return err
+		}
+		if groupOps, err = planBootstrapGroups(appEngineClient, manifest.Groups); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	plan := []fmt.Stringer{}
+	actions := []applyAction{}
+	for _, op := range policyOps {
+		plan, actions = append(plan, op), append(actions, op.Action)
+	}
+	for _, op := range append(append([]applyOperation{}, interfaceOps...), triggerOps...) {
+		plan, actions = append(plan, op), append(actions, op.Action)
+	}
+	for _, op := range groupOps {
+		plan, actions = append(plan, op), append(actions, op.Action)
+	}
+	pending := 0
+	for _, a := range actions {
+		if a != applySkip {
+			pending++
+		}
+	}
+
+	if pending == 0 {
+		for _, op := range plan {
+			fmt.Println(op)
+		}
+		fmt.Println("Your realm is in sync with the provided manifest")
+		printBootstrapReport(map[applyAction]int{applySkip: len(actions)}, 0)
+		return nil
+	}
+
+	fmt.Println("The following actions will be taken:")
+	fmt.Println()
+	for _, op := range plan {
+		fmt.Println(op)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Println("This was a dry run, nothing was changed")
+		return nil
+	}
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	// Policies come first, so that triggers can reference them
+	done := map[applyAction]int{applySkip: len(actions) - pending}
+	failures := 0
+	for _, op := range policyOps {
+		if op.Action == applySkip {
+			continue
+		}
+		if err := installTriggerPolicy(realm, op.Definition); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not install trigger delivery policy %s: %s\n", op.Name, err)
+			failures++
+			continue
+		}
+		fmt.Printf("Trigger delivery policy %s installed successfully\n", op.Name)
+		done[op.Action]++
+	}
+	failures += executeApply(astarteAPIClient, realm, interfaceOps, triggerOps, done)
+	for _, op := range groupOps {
+		if op.Action == applySkip {
+			continue
+		}
+		if groupFailures := executeBootstrapGroup(appEngineClient, op); groupFailures > 0 {
+			failures += groupFailures
+		} else {
+			done[op.Action]++
+		}
+	}
+
+	printBootstrapReport(done, failures)
+	if failures > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// loadBootstrapManifest reads a manifest, resolving its directories relative to the manifest itself
+func loadBootstrapManifest(manifestFile string) (bootstrapManifest, error) {
+	manifest := bootstrapManifest{}
+	content, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return manifest, err
+	}
+	if err := yaml.UnmarshalStrict(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("%s is not a valid manifest: %w", manifestFile, err)
+	}
+
+	baseDir := filepath.Dir(manifestFile)
+	for _, dirs := range []*[]string{&manifest.Interfaces, &manifest.Triggers, &manifest.TriggerDeliveryPolicies} {
+		for i, dir := range *dirs {
+			if !filepath.IsAbs(dir) {
+				(*dirs)[i] = filepath.Join(baseDir, dir)
+			}
+		}
+	}
+
+	problems := []string{}
+	groupNames := map[string]bool{}
+	for _, g := range manifest.Groups {
+		switch {
+		case g.Name == "":
+			problems = append(problems, "a group has no name")
+		case groupNames[g.Name]:
+			problems = append(problems, fmt.Sprintf("group %s is declared more than once", g.Name))
+		case len(g.Devices) == 0:
+			problems = append(problems, fmt.Sprintf("group %s has no devices, while Astarte groups need at least one", g.Name))
+		}
+		groupNames[g.Name] = true
+		for _, d := range g.Devices {
+			if !deviceid.IsValid(d) {
+				problems = append(problems, fmt.Sprintf("group %s: %s is not a valid Astarte Device ID", g.Name, d))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return manifest, errors.New("The manifest cannot be applied:\n  " + strings.Join(problems, "\n  "))
+	}
+	return manifest, nil
+}
+
+// planBootstrapPolicies returns the operations needed to install the trigger delivery policies in dirs
+// which are not installed yet
+func planBootstrapPolicies(dirs []string) ([]bootstrapPolicyOperation, error) {
+	ret := []bootstrapPolicyOperation{}
+	if len(dirs) == 0 {
+		return ret, nil
+	}
+	installed, err := listPolicies(realm)
+	if err != nil {
+		return nil, err
+	}
+	installedPolicies := map[string]bool{}
+	for _, p := range installed {
+		installedPolicies[p] = true
+	}
+
+	bundlePolicies := map[string]string{}
+	problems := []string{}
+	for _, dir := range dirs {
+		files, err := jsonFilesIn(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			content, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			definition := map[string]interface{}{}
+			if err := json.Unmarshal(content, &definition); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: not a valid JSON object: %s", f, err))
+				continue
+			}
+			name, _ := definition["name"].(string)
+			if name == "" {
+				problems = append(problems, fmt.Sprintf("%s: trigger delivery policy has no name", f))
+				continue
+			}
+			if other, ok := bundlePolicies[name]; ok {
+				problems = append(problems, fmt.Sprintf("%s: trigger delivery policy %s is also defined in %s", f, name, other))
+				continue
+			}
+			bundlePolicies[name] = f
+
+			op := bootstrapPolicyOperation{Action: applyInstall, File: f, Name: name, Definition: definition}
+			if installedPolicies[name] {
+				op.Action = applySkip
+			}
+			ret = append(ret, op)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New("The trigger delivery policies cannot be applied:\n  " + strings.Join(problems, "\n  "))
+	}
+	return ret, nil
+}
+
+// planBootstrapGroups returns the operations needed to create the groups in the manifest, or to add
+// the devices they lack
+func planBootstrapGroups(appEngineClient *client.Client, groups []bootstrapManifestGroup) ([]bootstrapGroupOperation, error) {
+	listGroupsCall, err := appEngineClient.ListGroups(realm)
+	if err != nil {
+		return nil, err
+	}
+	listGroupsRes, err := listGroupsCall.Run(appEngineClient)
+	if err != nil {
+		return nil, err
+	}
+	rawGroups, err := listGroupsRes.Parse()
+	if err != nil {
+		return nil, err
+	}
+	groupNames, ok := rawGroups.([]string)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected groups listing from AppEngine: %v", rawGroups)
+	}
+	existingGroups := map[string]bool{}
+	for _, g := range groupNames {
+		existingGroups[g] = true
+	}
+
+	ret := []bootstrapGroupOperation{}
+	for _, g := range groups {
+		if !existingGroups[g.Name] {
+			ret = append(ret, bootstrapGroupOperation{Action: applyInstall, Name: g.Name, Devices: g.Devices})
+			continue
+		}
+		groupDevices, err := listGroupDevices(appEngineClient, g.Name)
+		if err != nil {
+			return nil, err
+		}
+		op := bootstrapGroupOperation{Action: applySkip, Name: g.Name}
+		for _, d := range g.Devices {
+			if !groupDevices[d] {
+				op.Devices = append(op.Devices, d)
+			}
+		}
+		if len(op.Devices) > 0 {
+			op.Action = applyUpdate
+		}
+		ret = append(ret, op)
+	}
+	return ret, nil
+}
+
+func listGroupDevices(appEngineClient *client.Client, groupName string) (map[string]bool, error) {
+	ret := map[string]bool{}
+	paginator, err := appEngineClient.ListGroupDevices(realm, groupName, 100, client.DeviceIDFormat)
+	if err != nil {
+		return nil, err
+	}
+	for paginator.HasNextPage() {
+		call, err := paginator.GetNextPage()
+		if err != nil {
+			return nil, err
+		}
+		res, err := call.Run(appEngineClient)
+		if err != nil {
+			return nil, err
+		}
+		page, err := res.Parse()
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range page.([]string) {
+			ret[d] = true
+		}
+	}
+	return ret, nil
+}
+
+// executeBootstrapGroup performs a group operation planned by bootstrap, returning how many of its
+// steps failed
+func executeBootstrapGroup(appEngineClient *client.Client, op bootstrapGroupOperation) int {
+	if op.Action == applyInstall {
+		call, err := appEngineClient.CreateGroup(realm, op.Name, op.Devices)
+		if err == nil {
+			_, err = call.Run(appEngineClient)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not create group %s: %s\n", op.Name, err)
+			return 1
+		}
+		fmt.Printf("Group %s created successfully\n", op.Name)
+		return 0
+	}
+
+	failures := 0
+	for _, d := range op.Devices {
+		call, err := appEngineClient.AddDeviceToGroup(realm, op.Name, d)
+		if err == nil {
+			_, err = call.Run(appEngineClient)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not add device %s to group %s: %s\n", d, op.Name, err)
+			failures++
+		}
+	}
+	if failures == 0 {
+		fmt.Printf("Group %s updated successfully\n", op.Name)
+	}
+	return failures
+}
+
+// printBootstrapReport prints how many resources were handled by each action, and how many operations failed
+func printBootstrapReport(done map[applyAction]int, failures int) {
+	fmt.Printf("Report: %d installed, %d updated, %d recreated, %d skipped, %d failed\n", done[applyInstall],
+		done[applyUpdate], done[applyRecreate], done[applySkip], failures)
+}
@@ -0,0 +1,83 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"strconv"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+// PersistentPreRunE is not run when completing, hence the client has to be set up explicitly
+func completionSetup(cmd *cobra.Command) bool {
+	return realmManagementPersistentPreRunE(cmd, nil) == nil
+}
+
+func interfaceNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("interfaces", func() ([]string, error) {
+		return listInterfaces(astarteAPIClient, realm)
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
+func interfaceNameAndMajorCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 1 {
+		return interfaceNamesCompletion(cmd, args, toComplete)
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("interface-majors/"+args[0], func() ([]string, error) {
+		majors, err := interfaceVersions(astarteAPIClient, realm, args[0])
+		if err != nil {
+			return nil, err
+		}
+		ret := []string{}
+		for _, m := range majors {
+			ret = append(ret, strconv.Itoa(m))
+		}
+		return ret, nil
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
+func triggerNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("triggers", func() ([]string, error) {
+		return listTriggers(astarteAPIClient, realm)
+	}), cobra.ShellCompDirectiveNoFileComp
+}
+
+func triggerPolicyNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	if !completionSetup(cmd) {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return utils.CachedCompletions("trigger-policies", func() ([]string, error) {
+		return listPolicies(realm)
+	}), cobra.ShellCompDirectiveNoFileComp
+}
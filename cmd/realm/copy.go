@@ -0,0 +1,334 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astarte-go/triggers"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var copyCmd = &cobra.Command{
+	Use:   "copy --from-context <context> --to-context <context>",
+	Short: "Copy interfaces and triggers between realms",
+	Long: `Copy interfaces and triggers from the realm of a context to the realm of another one (e.g. from
+staging to production), without switching contexts. The realms may belong to different clusters.
+
+By default, both interfaces and triggers are copied: use --interfaces or --triggers to copy only one
+of them. Interfaces are handled as in 'interfaces sync': missing ones are installed, and the ones
+with an older minor version in the destination realm are updated. Triggers missing in the destination
+realm are installed, while the ones which differ are left untouched, unless --force is set: in that
+case, they are deleted and recreated.
+
+The planned actions are shown before asking for confirmation, use --dry-run to only show them.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl realm-management copy --from-context staging --to-context production --dry-run
+  astartectl realm-management copy --from-context staging --to-context production --triggers --force -y`,
+	Args:              cobra.NoArgs,
+	PersistentPreRunE: copyPersistentPreRunE,
+	RunE:              copyF,
+}
+
+func init() {
+	copyCmd.Flags().String("from-context", "", "The context of the realm to copy from")
+	_ = copyCmd.MarkFlagRequired("from-context")
+	_ = copyCmd.RegisterFlagCompletionFunc("from-context", utils.ContextNamesCompletion)
+	copyCmd.Flags().String("to-context", "", "The context of the realm to copy to")
+	_ = copyCmd.MarkFlagRequired("to-context")
+	_ = copyCmd.RegisterFlagCompletionFunc("to-context", utils.ContextNamesCompletion)
+	copyCmd.Flags().Bool("interfaces", false, "When set, copy interfaces. Defaults to true when --triggers is not set")
+	copyCmd.Flags().Bool("triggers", false, "When set, copy triggers. Defaults to true when --interfaces is not set")
+	copyCmd.Flags().Bool("force", false, "When set, recreate triggers which differ in the destination realm")
+	copyCmd.Flags().Bool("dry-run", false, "When set, show the planned actions without performing them")
+	utils.AddNonInteractiveFlag(copyCmd.Flags())
+
+	RealmManagementCmd.AddCommand(copyCmd)
+}
+
+func copyPersistentPreRunE(cmd *cobra.Command, args []string) error {
+	// Clients are set up from --from-context and --to-context, rather than from the current context
+	return nil
+}
+
+func copyF(command *cobra.Command, args []string) error {
+	if viper.GetBool("realmmanagement-to-curl") {
+		fmt.Println(`'copy' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+
+	fromContext, err := command.Flags().GetString("from-context")
+	if err != nil {
+		return err
+	}
+	toContext, err := command.Flags().GetString("to-context")
+	if err != nil {
+		return err
+	}
+	copyInterfaces, err := command.Flags().GetBool("interfaces")
+	if err != nil {
+		return err
+	}
+	copyTriggers, err := command.Flags().GetBool("triggers")
+	if err != nil {
+		return err
+	}
+	force, err := command.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+	if fromContext == toContext {
+		return errors.New("--from-context and --to-context must be different")
+	}
+	if !copyInterfaces && !copyTriggers {
+		copyInterfaces, copyTriggers = true, true
+	}
+
+	sourceClient, sourceRealm, err := utils.ContextAPIClient(fromContext, realmManagementURLVariables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	destinationClient, destinationRealm, err := utils.ContextAPIClient(toContext, realmManagementURLVariables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	sourceInterfaces := []interfaces.AstarteInterface{}
+	if copyInterfaces {
+		if sourceInterfaces, err = realmInterfaceDefinitions(sourceClient, sourceRealm); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read interfaces from context %s: %s\n", fromContext, err)
+			os.Exit(1)
+		}
+	}
+	sourceTriggers := []map[string]interface{}{}
+	if copyTriggers {
+		if sourceTriggers, err = realmRawTriggerDefinitions(sourceClient, sourceRealm); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read triggers from context %s: %s\n", fromContext, err)
+			os.Exit(1)
+		}
+	}
+
+	// AMQP exchanges are bound to a realm, hence they usually need to be changed across realms
+	for _, t := range sourceTriggers {
+		if action, ok := t["action"].(map[string]interface{}); ok {
+			if exchange, ok := action["amqp_exchange"].(string); ok && !strings.HasPrefix(exchange, fmt.Sprintf("astarte_events_%s_", destinationRealm)) {
+				fmt.Fprintf(os.Stderr, "warn: Trigger %v publishes to AMQP exchange %s, which is not valid in realm %s\n", t["name"], exchange, destinationRealm)
+			}
+		}
+	}
+
+	interfaceOps, triggerOps, err := planCopy(destinationClient, destinationRealm, sourceInterfaces, sourceTriggers, force)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	plan := append(append([]applyOperation{}, interfaceOps...), triggerOps...)
+	pending := 0
+	for _, op := range plan {
+		if op.Action != applySkip {
+			pending++
+		}
+	}
+	if pending == 0 {
+		for _, op := range plan {
+			fmt.Println(op)
+		}
+		fmt.Printf("Realm %s (context %s) is in sync with realm %s (context %s)\n", destinationRealm, toContext, sourceRealm, fromContext)
+		printBootstrapReport(map[applyAction]int{applySkip: len(plan)}, 0)
+		return nil
+	}
+
+	fmt.Printf("The following actions will be taken on realm %s (context %s):\n", destinationRealm, toContext)
+	fmt.Println()
+	for _, op := range plan {
+		fmt.Println(op)
+	}
+	fmt.Println()
+	if dryRun {
+		fmt.Println("This was a dry run, nothing was changed")
+		return nil
+	}
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			os.Exit(1)
+		}
+	}
+
+	done := map[applyAction]int{applySkip: len(plan) - pending}
+	failures := executeApply(destinationClient, destinationRealm, interfaceOps, triggerOps, done)
+	printBootstrapReport(done, failures)
+	if failures > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// realmInterfaceDefinitions returns all major versions of all interfaces in realm
+func realmInterfaceDefinitions(realmClient *client.Client, realm string) ([]interfaces.AstarteInterface, error) {
+	names, err := listInterfaces(realmClient, realm)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	definitions := []interfaces.AstarteInterface{}
+	for _, name := range names {
+		majors, err := interfaceVersions(realmClient, realm, name)
+		if err != nil {
+			return nil, err
+		}
+		sort.Ints(majors)
+		for _, major := range majors {
+			definition, err := getInterfaceDefinition(realmClient, realm, name, major)
+			if err != nil {
+				return nil, err
+			}
+			definitions = append(definitions, definition)
+		}
+	}
+	return definitions, nil
+}
+
+// realmRawTriggerDefinitions returns all triggers in realm, as returned by Astarte
+func realmRawTriggerDefinitions(realmClient *client.Client, realm string) ([]map[string]interface{}, error) {
+	names, err := listTriggers(realmClient, realm)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	definitions := []map[string]interface{}{}
+	for _, name := range names {
+		definition, err := getRawTriggerDefinition(realmClient, realm, name)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// planCopy returns the operations needed to copy the given interfaces and triggers into realm, split
+// between interfaces and triggers. An error is returned if any trigger references an interface which is
+// neither copied nor in realm.
+func planCopy(realmClient *client.Client, realm string, sourceInterfaces []interfaces.AstarteInterface, sourceTriggers []map[string]interface{}, force bool) ([]applyOperation, []applyOperation, error) {
+	inventory, err := newRealmInventory(realmClient, realm)
+	if err != nil {
+		return nil, nil, err
+	}
+	interfaceOps := []applyOperation{}
+	triggerOps := []applyOperation{}
+	copiedInterfaces := map[string]bool{}
+	problems := []string{}
+
+	for i := range sourceInterfaces {
+		astarteInterface := sourceInterfaces[i]
+		op := applyOperation{Action: applyInstall, Interface: &astarteInterface}
+		interfaceDefinition, err := inventory.interfaceDefinition(astarteInterface.Name, astarteInterface.MajorVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		if interfaceDefinition != nil {
+			switch {
+			case interfaceDefinition.MinorVersion < astarteInterface.MinorVersion:
+				op.Action = applyUpdate
+			case interfaceDefinition.MinorVersion > astarteInterface.MinorVersion:
+				// Notify that the destination realm has a more recent revision
+				fmt.Fprintf(os.Stderr, "warn: Interface %s has version %d.%d in the destination realm and %d.%d in the source realm\n", interfaceDefinition.Name,
+					interfaceDefinition.MajorVersion, interfaceDefinition.MinorVersion, astarteInterface.MajorVersion, astarteInterface.MinorVersion)
+				continue
+			default:
+				op.Action = applySkip
+			}
+		}
+		if op.Action != applySkip {
+			copiedInterfaces[interfaceKey(astarteInterface.Name, astarteInterface.MajorVersion)] = true
+		}
+		interfaceOps = append(interfaceOps, op)
+	}
+
+	for _, rawTrigger := range sourceTriggers {
+		content, err := json.Marshal(rawTrigger)
+		if err != nil {
+			return nil, nil, err
+		}
+		var astarteTrigger triggers.AstarteTrigger
+		if err := json.Unmarshal(content, &astarteTrigger); err != nil {
+			problems = append(problems, fmt.Sprintf("trigger %v: invalid trigger: %s", rawTrigger["name"], err))
+			continue
+		}
+
+		op := applyOperation{Action: applyInstall, Trigger: &astarteTrigger, RawTrigger: rawTrigger}
+		if inventory.triggers[astarteTrigger.Name] {
+			existing, err := getRawTriggerDefinition(realmClient, realm, astarteTrigger.Name)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Could not get trigger %s: %w", astarteTrigger.Name, err)
+			}
+			op.Action = applySkip
+			if force && !reflect.DeepEqual(existing, rawTrigger) {
+				op.Action = applyRecreate
+			}
+		}
+		if op.Action != applySkip {
+			for _, s := range astarteTrigger.SimpleTriggers {
+				if s.InterfaceName == "" || s.InterfaceName == "*" {
+					continue
+				}
+				major, err := strconv.Atoi(s.InterfaceMajor.String())
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("trigger %s: invalid interface_major %q for interface %s", astarteTrigger.Name, s.InterfaceMajor, s.InterfaceName))
+					continue
+				}
+				key := interfaceKey(s.InterfaceName, major)
+				if copiedInterfaces[key] {
+					op.DependsOn = append(op.DependsOn, key)
+					continue
+				}
+				found, err := inventory.hasInterface(s.InterfaceName, major)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !found {
+					problems = append(problems, fmt.Sprintf("trigger %s references interface %s, which is neither copied nor in the destination realm",
+						astarteTrigger.Name, key))
+				}
+			}
+		}
+		triggerOps = append(triggerOps, op)
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, errors.New("The realm cannot be copied:\n  " + strings.Join(problems, "\n  "))
+	}
+	return interfaceOps, triggerOps, nil
+}
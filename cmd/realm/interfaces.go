@@ -16,11 +16,14 @@ package realm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
+	"github.com/astarte-platform/astarte-go/client"
 	"github.com/astarte-platform/astarte-go/interfaces"
 	"github.com/astarte-platform/astartectl/utils"
 	"github.com/spf13/cobra"
@@ -45,21 +48,23 @@ var interfacesListCmd = &cobra.Command{
 }
 
 var interfacesVersionsCmd = &cobra.Command{
-	Use:     "versions <interface_name>",
-	Short:   "List major versions of an interface",
-	Long:    `List the major versions of an interface installed in the realm.`,
-	Example: `  astartectl realm-management interfaces versions com.my.Interface`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    interfacesVersionsF,
+	Use:               "versions <interface_name>",
+	Short:             "List major versions of an interface",
+	Long:              `List the major versions of an interface installed in the realm.`,
+	Example:           `  astartectl realm-management interfaces versions com.my.Interface`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: interfaceNamesCompletion,
+	RunE:              interfacesVersionsF,
 }
 
 var interfacesShowCmd = &cobra.Command{
-	Use:     "show <interface_name> <interface_major>",
-	Short:   "Show interface",
-	Long:    `Show the given major version of the interface installed in the realm.`,
-	Example: `  astartectl realm-management interfaces show com.my.Interface 0`,
-	Args:    cobra.ExactArgs(2),
-	RunE:    interfacesShowF,
+	Use:               "show <interface_name> <interface_major>",
+	Short:             "Show interface",
+	Long:              `Show the given major version of the interface installed in the realm.`,
+	Example:           `  astartectl realm-management interfaces show com.my.Interface 0`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: interfaceNameAndMajorCompletion,
+	RunE:              interfacesShowF,
 }
 
 var interfacesInstallCmd = &cobra.Command{
@@ -79,10 +84,11 @@ var interfacesDeleteCmd = &cobra.Command{
 Only draft interfaces for which no devices has sent data to can be removed - as such,
 only Major Version 0 of <interface_name> will be deleted, if existing.
 Non-draft interfaces should be removed manually or by your system administrator.`,
-	Example: `  astartectl realm-management interfaces delete com.my.Interface`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    interfacesDeleteF,
-	Aliases: []string{"del"},
+	Example:           `  astartectl realm-management interfaces delete com.my.Interface`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: interfaceNamesCompletion,
+	RunE:              interfacesDeleteF,
+	Aliases:           []string{"del"},
 }
 
 var interfacesUpdateCmd = &cobra.Command{
@@ -114,8 +120,16 @@ var interfacesSaveCmd = &cobra.Command{
 	Long: `Save each interface in a realm to a local folder. Each interface will
 be saved in a dedicated file whose name will be in the form '<interface_name>_v<version>.json'.
 When no destination path is set, interfaces will be saved in the current working directory.
-This command does not support the --to-curl flag.`,
-	Example: `  astartectl realm-management interfaces save`,
+
+Along with the interfaces, an 'interfaces.manifest' JSON file is written, recording the name, version and
+checksum of each saved interface. With --prune, files of interfaces which are no longer in the realm are
+removed, so that the folder is a faithful mirror of the realm, e.g. to be tracked in version control and
+used as the source of 'interfaces sync'. Only files recorded in the manifest of a previous save, and not
+changed since, are ever removed.
+
+Interfaces are fetched --concurrency at a time. With --to-curl, no file is saved, and the calls needed to fetch
+the interfaces are printed as a shell script.`,
+	Example: `  astartectl realm-management interfaces save interfaces/ --prune`,
 	Args:    cobra.MaximumNArgs(1),
 	RunE:    interfacesSaveF,
 }
@@ -123,7 +137,12 @@ This command does not support the --to-curl flag.`,
 func init() {
 	RealmManagementCmd.AddCommand(interfacesCmd)
 
-	interfacesSyncCmd.PersistentFlags().BoolP("non-interactive", "y", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	interfacesListCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to each interface name.")
+	interfacesVersionsCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to each major version.")
+	interfacesShowCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to the interface definition.")
+	utils.AddNonInteractiveFlag(interfacesSyncCmd.PersistentFlags())
+	interfacesSaveCmd.Flags().Bool("prune", false, "When set, remove saved files of interfaces which are no longer in the realm.")
+	interfacesSaveCmd.Flags().Int("concurrency", 8, "The maximum number of interfaces fetched at the same time.")
 
 	interfacesCmd.AddCommand(
 		interfacesListCmd,
@@ -138,26 +157,46 @@ func init() {
 }
 
 func interfacesListF(command *cobra.Command, args []string) error {
-	realmInterfaces, err := listInterfaces(realm)
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
+	realmInterfaces, err := listInterfaces(astarteAPIClient, realm)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
-	fmt.Println(realmInterfaces)
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, realmInterfaces)
+		return nil
+	}
+	utils.PrintList(realmInterfaces)
 	return nil
 }
 
 func interfacesVersionsF(command *cobra.Command, args []string) error {
 	interfaceName := args[0]
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
 
-	interfaceVersions, err := interfaceVersions(interfaceName)
+	interfaceVersions, err := interfaceVersions(astarteAPIClient, realm, interfaceName)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
+	}
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, interfaceVersions)
+		return nil
 	}
 
-	fmt.Println(interfaceVersions)
+	versions := []string{}
+	for _, v := range interfaceVersions {
+		versions = append(versions, strconv.Itoa(v))
+	}
+	utils.PrintList(versions)
 	return nil
 }
 
@@ -168,16 +207,24 @@ func interfacesShowF(command *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	interfaceDefinition, err := getInterfaceDefinition(realm, interfaceName, interfaceMajor)
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
+	interfaceDefinition, err := getInterfaceDefinition(astarteAPIClient, realm, interfaceName, interfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
+	}
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, interfaceDefinition)
+		return nil
 	}
 
 	respJSON, err := json.MarshalIndent(interfaceDefinition, "", "  ")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 	fmt.Println(string(respJSON))
 	return nil
@@ -194,9 +241,9 @@ func interfacesInstallF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	if err = installInterface(realm, interfaceBody); err != nil {
+	if err = installInterface(astarteAPIClient, realm, interfaceBody); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	fmt.Println("ok")
@@ -210,7 +257,7 @@ func interfacesDeleteF(command *cobra.Command, args []string) error {
 	deleteInterfaceCall, err := astarteAPIClient.DeleteInterface(realm, interfaceName, interfaceMajor)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(deleteInterfaceCall, astarteAPIClient)
@@ -218,7 +265,7 @@ func interfacesDeleteF(command *cobra.Command, args []string) error {
 	deleteInterfaceRes, err := deleteInterfaceCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	_, _ = deleteInterfaceRes.Parse()
@@ -238,9 +285,9 @@ func interfacesUpdateF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	if err := updateInterface(realm, astarteInterface.Name, astarteInterface.MajorVersion, astarteInterface); err != nil {
+	if err := updateInterface(astarteAPIClient, realm, astarteInterface.Name, astarteInterface.MajorVersion, astarteInterface); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	fmt.Println("ok")
@@ -252,7 +299,7 @@ func interfacesSyncF(command *cobra.Command, args []string) error {
 	if viper.GetBool("realmmanagement-to-curl") {
 		fmt.Println(`'interfaces sync' does not support the --to-curl option.
 Install or update your interfaces one by one with 'interfaces install' or 'interface update'.`)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	interfacesToInstall := []interfaces.AstarteInterface{}
@@ -269,7 +316,7 @@ Install or update your interfaces one by one with 'interfaces install' or 'inter
 			return err
 		}
 
-		if interfaceDefinition, err := getInterfaceDefinition(realm, astarteInterface.Name, astarteInterface.MajorVersion); err != nil {
+		if interfaceDefinition, err := getInterfaceDefinition(astarteAPIClient, realm, astarteInterface.Name, astarteInterface.MajorVersion); err != nil {
 			// The interface does not exist
 			interfacesToInstall = append(interfacesToInstall, astarteInterface)
 		} else {
@@ -300,26 +347,24 @@ Install or update your interfaces one by one with 'interfaces install' or 'inter
 	}
 	fmt.Println()
 
-	y, err := command.Flags().GetBool("non-interactive")
-	if err != nil {
-		return err
-	}
+	y := utils.NonInteractive(command)
 	if !y {
 		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
-			return nil
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			utils.Exit(1)
 		}
 	}
 
 	// Start syncing.
 	for _, v := range interfacesToInstall {
-		if err := installInterface(realm, v); err != nil {
+		if err := installInterface(astarteAPIClient, realm, v); err != nil {
 			fmt.Fprintf(os.Stderr, "Could not install interface %s: %s\n", v.Name, err)
 		} else {
 			fmt.Printf("Interface %s installed successfully\n", v.Name)
 		}
 	}
 	for _, v := range interfacesToUpdate {
-		if err := updateInterface(realm, v.Name, v.MajorVersion, v); err != nil {
+		if err := updateInterface(astarteAPIClient, realm, v.Name, v.MajorVersion, v); err != nil {
 			fmt.Fprintf(os.Stderr, "Could not update interface %s: %s\n", v.Name, err)
 		} else {
 			fmt.Printf("Interface %s updated successfully to version %d.%d\n", v.Name, v.MajorVersion, v.MinorVersion)
@@ -329,8 +374,8 @@ Install or update your interfaces one by one with 'interfaces install' or 'inter
 	return nil
 }
 
-func getInterfaceDefinition(realm, interfaceName string, interfaceMajor int) (interfaces.AstarteInterface, error) {
-	getInterfaceCall, err := astarteAPIClient.GetInterface(realm, interfaceName, interfaceMajor)
+func getInterfaceDefinition(realmClient *client.Client, realm, interfaceName string, interfaceMajor int) (interfaces.AstarteInterface, error) {
+	getInterfaceCall, err := realmClient.GetInterface(realm, interfaceName, interfaceMajor)
 	if err != nil {
 		return interfaces.AstarteInterface{}, err
 	}
@@ -338,9 +383,9 @@ func getInterfaceDefinition(realm, interfaceName string, interfaceMajor int) (in
 	// When we're here in the context of `interfaces sync`, the to-curl flag
 	// is always false (`interfaces sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(getInterfaceCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(getInterfaceCall, realmClient)
 
-	getInterfaceRes, err := getInterfaceCall.Run(astarteAPIClient)
+	getInterfaceRes, err := getInterfaceCall.Run(realmClient)
 	if err != nil {
 		return interfaces.AstarteInterface{}, err
 	}
@@ -352,8 +397,8 @@ func getInterfaceDefinition(realm, interfaceName string, interfaceMajor int) (in
 	return interfaceDefinition, nil
 }
 
-func installInterface(realm string, iface interfaces.AstarteInterface) error {
-	installInterfaceCall, err := astarteAPIClient.InstallInterface(realm, iface, false)
+func installInterface(realmClient *client.Client, realm string, iface interfaces.AstarteInterface) error {
+	installInterfaceCall, err := realmClient.InstallInterface(realm, iface, false)
 	if err != nil {
 		return err
 	}
@@ -361,9 +406,9 @@ func installInterface(realm string, iface interfaces.AstarteInterface) error {
 	// When we're here in the context of `interfaces sync`, the to-curl flag
 	// is always false (`interfaces sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(installInterfaceCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(installInterfaceCall, realmClient)
 
-	installInterfaceRes, err := installInterfaceCall.Run(astarteAPIClient)
+	installInterfaceRes, err := installInterfaceCall.Run(realmClient)
 	if err != nil {
 		return err
 	}
@@ -372,8 +417,8 @@ func installInterface(realm string, iface interfaces.AstarteInterface) error {
 	return nil
 }
 
-func updateInterface(realm string, interfaceName string, interfaceMajor int, newInterface interfaces.AstarteInterface) error {
-	updateInterfaceCall, err := astarteAPIClient.UpdateInterface(realm, interfaceName, interfaceMajor, newInterface, false)
+func updateInterface(realmClient *client.Client, realm string, interfaceName string, interfaceMajor int, newInterface interfaces.AstarteInterface) error {
+	updateInterfaceCall, err := realmClient.UpdateInterface(realm, interfaceName, interfaceMajor, newInterface, false)
 	if err != nil {
 		return err
 	}
@@ -381,9 +426,9 @@ func updateInterface(realm string, interfaceName string, interfaceMajor int, new
 	// When we're here in the context of `interfaces sync`, the to-curl flag
 	// is always false (`interfaces sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(updateInterfaceCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(updateInterfaceCall, realmClient)
 
-	updateInterfaceRes, err := updateInterfaceCall.Run(astarteAPIClient)
+	updateInterfaceRes, err := updateInterfaceCall.Run(realmClient)
 	if err != nil {
 		return err
 	}
@@ -393,82 +438,153 @@ func updateInterface(realm string, interfaceName string, interfaceMajor int, new
 }
 
 func interfacesSaveF(command *cobra.Command, args []string) error {
-	if viper.GetBool("realmmanagement-to-curl") {
-		fmt.Println(`'interfaces save' does not support the --to-curl option. Use 'interfaces list' to get the interfaces in your realm, 'interfaces versions' to get their versions, and 'interfaces show' to get the content of an interface.`)
-		os.Exit(1)
+	prune, err := command.Flags().GetBool("prune")
+	if err != nil {
+		return err
+	}
+	concurrency, err := command.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("--concurrency must be greater than 0")
+	}
+	if utils.ShouldCurl() {
+		// The script lists the calls in order
+		concurrency = 1
 	}
 
+	// Saving takes a call per interface version, after listing them
+	utils.StartCurlScript()
+
 	var targetPath string
-	var err error
 	if len(args) == 0 {
 		targetPath, _ = filepath.Abs(".")
 	} else {
 		targetPath, err = filepath.Abs(args[0])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 	}
 
-	// retrieve interfaces list
-	realmInterfaces, err := listInterfaces(realm)
+	// The previous manifest tells which files were written by earlier saves, and can be pruned
+	previous, err := readInterfacesManifest(targetPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
-	ifaceNameAndVersions := map[string][]int{}
+	// retrieve interfaces list
+	realmInterfaces, err := listInterfaces(astarteAPIClient, realm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
 
 	// and the versions for each interface
-	for _, ifaceName := range realmInterfaces {
-		interfaceVersions, err := interfaceVersions(ifaceName)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+	versions := make([][]int, len(realmInterfaces))
+	errs := make([]error, len(realmInterfaces))
+	progress := utils.NewProgress("Listing interface versions", len(realmInterfaces))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ifaceName := range realmInterfaces {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, ifaceName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			versions[i], errs[i] = interfaceVersions(astarteAPIClient, realm, ifaceName)
+			progress.Increment()
+		}(i, ifaceName)
+	}
+	wg.Wait()
+	progress.Done()
+	if err := errors.Join(errs...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+
+	type savedInterface struct {
+		name       string
+		major      int
+		definition interfaces.AstarteInterface
+		err        error
+	}
+	saved := []savedInterface{}
+	for i, ifaceName := range realmInterfaces {
+		for _, v := range versions[i] {
+			saved = append(saved, savedInterface{name: ifaceName, major: v})
 		}
-		ifaceNameAndVersions[ifaceName] = interfaceVersions
 	}
+	progress = utils.NewProgress("Downloading interfaces", len(saved))
+	for i := range saved {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(s *savedInterface) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			s.definition, s.err = getInterfaceDefinition(astarteAPIClient, realm, s.name, s.major)
+			progress.Increment()
+		}(&saved[i])
+	}
+	wg.Wait()
+	progress.Done()
+
+	manifest := interfacesManifest{Realm: realm, Interfaces: []interfacesManifestEntry{}}
+	for _, s := range saved {
+		if s.err != nil {
+			fmt.Fprintln(os.Stderr, s.err)
+			utils.Exit(1)
+		}
+		if utils.ShouldCurl() {
+			continue
+		}
 
-	for name, versions := range ifaceNameAndVersions {
-		for _, v := range versions {
-			interfaceDefinition, err := getInterfaceDefinition(realm, name, v)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
+		respJSON, err := json.MarshalIndent(s.definition, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		}
 
-			respJSON, err := json.MarshalIndent(interfaceDefinition, "", "  ")
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
+		filename := savedInterfaceFilename(s.name, s.major)
+		if err := os.WriteFile(filepath.Join(targetPath, filename), respJSON, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
+		}
+		manifest.Interfaces = append(manifest.Interfaces, newInterfacesManifestEntry(s.definition, filename, respJSON))
+	}
+	if utils.ShouldCurl() {
+		return nil
+	}
 
-			filename := fmt.Sprintf("/%s/%s_v%d.json", targetPath, name, v)
-			outFile, err := os.Create(filename)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-			defer outFile.Close()
+	if err := writeInterfacesManifest(targetPath, manifest); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
 
-			if _, err := outFile.Write(respJSON); err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
+	if prune {
+		removed, err := pruneSavedInterfaces(targetPath, previous, manifest)
+		for _, f := range removed {
+			fmt.Printf("Removed %s\n", f)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			utils.Exit(1)
 		}
 	}
 	return nil
 }
 
-func listInterfaces(realm string) ([]string, error) {
-	listInterfacesCall, err := astarteAPIClient.ListInterfaces(realm)
+func listInterfaces(realmClient *client.Client, realm string) ([]string, error) {
+	listInterfacesCall, err := realmClient.ListInterfaces(realm)
 	if err != nil {
 		return []string{}, err
 	}
 
-	utils.MaybeCurlAndExit(listInterfacesCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(listInterfacesCall, realmClient)
 
-	listInterfacesRes, err := listInterfacesCall.Run(astarteAPIClient)
+	listInterfacesRes, err := listInterfacesCall.Run(realmClient)
 	if err != nil {
 		return []string{}, err
 	}
@@ -479,15 +595,15 @@ func listInterfaces(realm string) ([]string, error) {
 	return rawListInterfaces.([]string), nil
 }
 
-func interfaceVersions(interfaceName string) ([]int, error) {
-	interfaceVersionsCall, err := astarteAPIClient.ListInterfaceMajorVersions(realm, interfaceName)
+func interfaceVersions(realmClient *client.Client, realm, interfaceName string) ([]int, error) {
+	interfaceVersionsCall, err := realmClient.ListInterfaceMajorVersions(realm, interfaceName)
 	if err != nil {
 		return []int{}, err
 	}
 
-	utils.MaybeCurlAndExit(interfaceVersionsCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(interfaceVersionsCall, realmClient)
 
-	interfaceVersionsRes, err := interfaceVersionsCall.Run(astarteAPIClient)
+	interfaceVersionsRes, err := interfaceVersionsCall.Run(realmClient)
 	if err != nil {
 		return []int{}, err
 	}
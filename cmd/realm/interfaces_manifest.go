@@ -0,0 +1,129 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/astarte-platform/astarte-go/interfaces"
+)
+
+// interfacesManifestFile is written by 'interfaces save' next to the saved interfaces. It is not
+// a .json file, so that it is not picked up by globs and bundles of interface files.
+const interfacesManifestFile = "interfaces.manifest"
+
+// interfacesManifest records the interfaces saved from a realm
+type interfacesManifest struct {
+	Realm      string                    `json:"realm"`
+	Interfaces []interfacesManifestEntry `json:"interfaces"`
+}
+
+type interfacesManifestEntry struct {
+	Name   string `json:"name"`
+	Major  int    `json:"major"`
+	Minor  int    `json:"minor"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+func savedInterfaceFilename(name string, major int) string {
+	return fmt.Sprintf("%s_v%d.json", name, major)
+}
+
+func newInterfacesManifestEntry(iface interfaces.AstarteInterface, filename string, content []byte) interfacesManifestEntry {
+	checksum := sha256.Sum256(content)
+	return interfacesManifestEntry{
+		Name:   iface.Name,
+		Major:  iface.MajorVersion,
+		Minor:  iface.MinorVersion,
+		File:   filename,
+		SHA256: hex.EncodeToString(checksum[:]),
+	}
+}
+
+// readInterfacesManifest reads the manifest in dir, returning nil if there is none
+func readInterfacesManifest(dir string) (*interfacesManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, interfacesManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	manifest := &interfacesManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("Invalid %s in %s: %w", interfacesManifestFile, dir, err)
+	}
+	return manifest, nil
+}
+
+// writeInterfacesManifest writes the manifest in dir, with a stable ordering to keep diffs minimal
+func writeInterfacesManifest(dir string, manifest interfacesManifest) error {
+	sort.Slice(manifest.Interfaces, func(i, j int) bool {
+		if manifest.Interfaces[i].Name != manifest.Interfaces[j].Name {
+			return manifest.Interfaces[i].Name < manifest.Interfaces[j].Name
+		}
+		return manifest.Interfaces[i].Major < manifest.Interfaces[j].Major
+	})
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, interfacesManifestFile), append(content, '\n'), 0644)
+}
+
+// pruneSavedInterfaces removes the files in dir which were recorded in the previous manifest, but are
+// not in manifest, so that only files written by 'interfaces save' are ever removed. Files which were
+// changed since they were saved are kept. It returns the names of the removed files.
+func pruneSavedInterfaces(dir string, previous *interfacesManifest, manifest interfacesManifest) ([]string, error) {
+	removed := []string{}
+	if previous == nil {
+		return removed, nil
+	}
+	saved := map[string]bool{}
+	for _, e := range manifest.Interfaces {
+		saved[e.File] = true
+	}
+
+	for _, e := range previous.Interfaces {
+		// Manifests are not trusted to point outside of dir
+		if saved[e.File] || e.File != filepath.Base(e.File) {
+			continue
+		}
+		fileName := filepath.Join(dir, e.File)
+		content, err := os.ReadFile(fileName)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return removed, err
+		}
+		if checksum := sha256.Sum256(content); hex.EncodeToString(checksum[:]) != e.SHA256 {
+			fmt.Fprintf(os.Stderr, "warn: Not removing %s, as it was changed since it was saved\n", e.File)
+			continue
+		}
+		if err := os.Remove(fileName); err != nil {
+			return removed, err
+		}
+		removed = append(removed, e.File)
+	}
+	return removed, nil
+}
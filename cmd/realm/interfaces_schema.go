@@ -0,0 +1,174 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/spf13/cobra"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var interfacesSchemaCmd = &cobra.Command{
+	Use:   "schema <interface_name> <interface_major>",
+	Short: "Export the JSON Schema of an interface",
+	Long: `Convert the given major version of an interface installed in the realm into a JSON Schema
+describing its valid payloads, e.g. to generate validation code or types for consumers of AppEngine API data.
+
+The schema describes an object whose keys are the paths of the interface: parametric endpoints are
+matched with patternProperties, each describing the payload of the path. For object aggregated
+interfaces, each path holds an object with a key for each mapping. longinteger values may be
+given either as JSON numbers or as strings, to preserve their precision.`,
+	Example:           `  astartectl realm-management interfaces schema com.my.Interface 1 > com.my.Interface.schema.json`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: interfaceNameAndMajorCompletion,
+	RunE:              interfacesSchemaF,
+}
+
+func init() {
+	interfacesCmd.AddCommand(interfacesSchemaCmd)
+}
+
+func interfacesSchemaF(command *cobra.Command, args []string) error {
+	interfaceName := args[0]
+	interfaceMajor, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	interfaceDefinition, err := getInterfaceDefinition(astarteAPIClient, realm, interfaceName, interfaceMajor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	schemaJSON, err := json.MarshalIndent(interfaceJSONSchema(interfaceDefinition), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(schemaJSON))
+	return nil
+}
+
+// interfaceJSONSchema returns a JSON Schema describing the payloads of iface, keyed by path
+func interfaceJSONSchema(iface interfaces.AstarteInterface) map[string]interface{} {
+	paths := map[string]interface{}{}
+	if iface.Aggregation == interfaces.ObjectAggregation {
+		// All mappings share the same parent endpoint, which is the path of the object
+		properties := map[string]interface{}{}
+		required := []string{}
+		basePath := ""
+		for _, m := range iface.Mappings {
+			lastSlash := strings.LastIndex(m.Endpoint, "/")
+			basePath = m.Endpoint[:lastSlash]
+			key := m.Endpoint[lastSlash+1:]
+			properties[key] = mappingJSONSchema(m, false)
+			required = append(required, key)
+		}
+		paths[endpointPattern(basePath)] = map[string]interface{}{
+			"title":                basePath,
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	} else {
+		for _, m := range iface.Mappings {
+			schema := mappingJSONSchema(m, iface.Type == interfaces.PropertiesType && m.AllowUnset)
+			schema["title"] = m.Endpoint
+			paths[endpointPattern(m.Endpoint)] = schema
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaDialect,
+		"title":                fmt.Sprintf("%s v%d.%d", iface.Name, iface.MajorVersion, iface.MinorVersion),
+		"type":                 "object",
+		"patternProperties":    paths,
+		"additionalProperties": false,
+	}
+	if iface.Description != "" {
+		schema["description"] = iface.Description
+	}
+	return schema
+}
+
+// mappingJSONSchema returns the JSON Schema of the values of m. When nullable is true, null is valid too,
+// as it is for properties which can be unset.
+func mappingJSONSchema(m interfaces.AstarteInterfaceMapping, nullable bool) map[string]interface{} {
+	mappingType := string(m.Type)
+	var schema map[string]interface{}
+	if strings.HasSuffix(mappingType, "array") {
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": scalarJSONSchema(interfaces.AstarteMappingType(strings.TrimSuffix(mappingType, "array"))),
+		}
+	} else {
+		schema = scalarJSONSchema(m.Type)
+	}
+
+	if nullable {
+		schema = map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	}
+	if m.Description != "" {
+		schema["description"] = m.Description
+	}
+	return schema
+}
+
+func scalarJSONSchema(t interfaces.AstarteMappingType) map[string]interface{} {
+	switch t {
+	case interfaces.Double:
+		return map[string]interface{}{"type": "number"}
+	case interfaces.Integer:
+		return map[string]interface{}{"type": "integer", "minimum": math.MinInt32, "maximum": math.MaxInt32}
+	case interfaces.LongInteger:
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "integer", "minimum": int64(math.MinInt64), "maximum": int64(math.MaxInt64)},
+			map[string]interface{}{"type": "string", "pattern": "^-?[0-9]+$"},
+		}}
+	case interfaces.Boolean:
+		return map[string]interface{}{"type": "boolean"}
+	case interfaces.String:
+		return map[string]interface{}{"type": "string"}
+	case interfaces.BinaryBlob:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case interfaces.DateTime:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	return map[string]interface{}{}
+}
+
+var endpointParameterRegexp = regexp.MustCompile(`%{[^}]+}`)
+
+// endpointPattern returns a regular expression matching the paths of endpoint, where each
+// parameter matches a single level
+func endpointPattern(endpoint string) string {
+	pattern := ""
+	last := 0
+	for _, loc := range endpointParameterRegexp.FindAllStringIndex(endpoint, -1) {
+		pattern += regexp.QuoteMeta(endpoint[last:loc[0]]) + "[^/]+"
+		last = loc[1]
+	}
+	return "^" + pattern + regexp.QuoteMeta(endpoint[last:]) + "$"
+}
@@ -0,0 +1,251 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var preflightUpgradeCmd = &cobra.Command{
+	Use:   "preflight-upgrade --target <astarte_version>",
+	Short: "Check a realm for compatibility with an Astarte version",
+	Long: `Scan the interfaces and triggers installed in the realm for constructs which are deprecated,
+ignored or not supported in the target Astarte version, and print a compatibility report to act on before
+upgrading the cluster.
+
+Findings are either errors, which are expected to break with the target version, or warnings, which
+should be reviewed. The command exits with a non-zero status if any error is found.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl realm-management preflight-upgrade --target 1.2`,
+	Args:    cobra.NoArgs,
+	RunE:    preflightUpgradeF,
+}
+
+const (
+	preflightError   = "error"
+	preflightWarning = "warning"
+)
+
+// triggerEventsSince maps trigger events which were not available since the first Astarte release
+// to the version introducing them
+var triggerEventsSince = map[string]string{
+	"incoming_introspection":  "1.1.0",
+	"interface_added":         "1.1.0",
+	"interface_removed":       "1.1.0",
+	"interface_minor_updated": "1.1.0",
+}
+
+// trigger delivery policies were introduced in Astarte 1.1
+const triggerPoliciesSince = "1.1.0"
+
+type preflightFinding struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Finding  string `json:"finding"`
+}
+
+func init() {
+	preflightUpgradeCmd.Flags().String("target", "", "The Astarte version the cluster will be upgraded to (e.g. 1.2)")
+	_ = preflightUpgradeCmd.MarkFlagRequired("target")
+	preflightUpgradeCmd.Flags().StringP("output", "o", "default", "The type of output (default,csv)")
+
+	RealmManagementCmd.AddCommand(preflightUpgradeCmd)
+}
+
+func preflightUpgradeF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'preflight-upgrade' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+
+	target, err := command.Flags().GetString("target")
+	if err != nil {
+		return err
+	}
+	targetVersion, err := semver.NewVersion(target)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid Astarte version: %w", target, err)
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if outputType != "default" && outputType != "csv" {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are default and csv", outputType)
+	}
+
+	findings := []preflightFinding{}
+
+	interfaceNames, err := listInterfaces(astarteAPIClient, realm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range interfaceNames {
+		majors, err := interfaceVersions(astarteAPIClient, realm, name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, major := range majors {
+			iface, err := getInterfaceDefinition(astarteAPIClient, realm, name, major)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			findings = append(findings, preflightInterface(iface)...)
+		}
+	}
+
+	triggerNames, err := listTriggers(astarteAPIClient, realm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range triggerNames {
+		trigger, err := getRawTriggerDefinition(astarteAPIClient, realm, name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		findings = append(findings, preflightTrigger(name, trigger, targetVersion)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity == preflightError
+		}
+		return false
+	})
+
+	errorsCount := 0
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.StyleLight)
+	t.AppendHeader(table.Row{"Kind", "Name", "Severity", "Finding"})
+	for _, f := range findings {
+		if f.Severity == preflightError {
+			errorsCount++
+		}
+		t.AppendRow(table.Row{f.Kind, f.Name, f.Severity, f.Finding})
+	}
+	if outputType == "csv" {
+		t.RenderCSV()
+	} else if len(findings) > 0 {
+		t.Render()
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d interfaces and %d triggers against Astarte %s: %d errors, %d warnings\n",
+		len(interfaceNames), len(triggerNames), targetVersion, errorsCount, len(findings)-errorsCount)
+	if errorsCount > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func preflightInterface(iface interfaces.AstarteInterface) []preflightFinding {
+	findings := []preflightFinding{}
+	name := fmt.Sprintf("%s v%d.%d", iface.Name, iface.MajorVersion, iface.MinorVersion)
+	add := func(severity, format string, a ...interface{}) {
+		findings = append(findings, preflightFinding{"interface", name, severity, fmt.Sprintf(format, a...)})
+	}
+
+	var first *interfaces.AstarteInterfaceMapping
+	for i, m := range iface.Mappings {
+		if m.DatabaseRetentionPolicy == interfaces.UseTTL && m.DatabaseRetentionTTL <= 0 {
+			add(preflightError, "%s uses database_retention_policy use_ttl without a valid database_retention_ttl", m.Endpoint)
+		}
+
+		if iface.Type == interfaces.PropertiesType {
+			if m.Reliability != "" && m.Reliability != interfaces.UnreliableReliability || m.Retention != "" && m.Retention != interfaces.DiscardRetention ||
+				m.Expiry != 0 || m.ExplicitTimestamp || m.DatabaseRetentionPolicy == interfaces.UseTTL {
+				add(preflightWarning, "%s sets datastream only attributes (reliability, retention, expiry, explicit_timestamp or database retention), which are ignored for properties", m.Endpoint)
+			}
+			continue
+		}
+
+		if m.AllowUnset {
+			add(preflightWarning, "%s sets allow_unset, which is ignored for datastreams", m.Endpoint)
+		}
+		if m.Retention != "" && m.Retention != interfaces.DiscardRetention && (m.Reliability == "" || m.Reliability == interfaces.UnreliableReliability) {
+			add(preflightWarning, "%s has %s retention but unreliable reliability, data is never retained when the device is offline", m.Endpoint, m.Retention)
+		}
+		if m.Expiry != 0 && (m.Retention == "" || m.Retention == interfaces.DiscardRetention) {
+			add(preflightWarning, "%s sets expiry with discard retention, expiry is ignored", m.Endpoint)
+		}
+
+		if iface.Aggregation != interfaces.ObjectAggregation {
+			continue
+		}
+		if first == nil {
+			first = &iface.Mappings[i]
+			continue
+		}
+		if m.Reliability != first.Reliability || m.Retention != first.Retention || m.Expiry != first.Expiry ||
+			m.ExplicitTimestamp != first.ExplicitTimestamp || m.DatabaseRetentionPolicy != first.DatabaseRetentionPolicy ||
+			m.DatabaseRetentionTTL != first.DatabaseRetentionTTL {
+			add(preflightWarning, "%s has reliability, retention, expiry, explicit_timestamp or database retention different from %s, while objects are handled as a whole",
+				m.Endpoint, first.Endpoint)
+		}
+	}
+
+	return findings
+}
+
+func preflightTrigger(name string, trigger map[string]interface{}, targetVersion *semver.Version) []preflightFinding {
+	findings := []preflightFinding{}
+	add := func(severity, format string, a ...interface{}) {
+		findings = append(findings, preflightFinding{"trigger", name, severity, fmt.Sprintf(format, a...)})
+	}
+
+	action, _ := trigger["action"].(map[string]interface{})
+	if _, ok := action["http_post_url"]; ok {
+		add(preflightWarning, "the action uses the deprecated http_post_url, use http_url with http_method post instead")
+	}
+	if exchange, ok := action["amqp_exchange"].(string); ok {
+		prefix := fmt.Sprintf("astarte_events_%s_", realm)
+		if !strings.HasPrefix(exchange, prefix) {
+			add(preflightError, "the AMQP exchange %s does not start with %s", exchange, prefix)
+		}
+	}
+
+	if policy, ok := trigger["policy"].(string); ok && policy != "" {
+		if targetVersion.LessThan(semver.MustParse(triggerPoliciesSince)) {
+			add(preflightError, "the trigger uses the delivery policy %s, while trigger delivery policies are supported since Astarte %s",
+				policy, triggerPoliciesSince)
+		}
+	}
+
+	simpleTriggers, _ := trigger["simple_triggers"].([]interface{})
+	for _, rawSimpleTrigger := range simpleTriggers {
+		simpleTrigger, _ := rawSimpleTrigger.(map[string]interface{})
+		on, _ := simpleTrigger["on"].(string)
+		if since, ok := triggerEventsSince[on]; ok && targetVersion.LessThan(semver.MustParse(since)) {
+			add(preflightError, "the trigger fires on %s, which is supported since Astarte %s", on, since)
+		}
+	}
+
+	return findings
+}
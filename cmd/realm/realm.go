@@ -36,6 +36,9 @@ var RealmManagementCmd = &cobra.Command{
 var realm string
 var astarteAPIClient *client.Client
 
+// realmManagementURLVariables maps Realm Management to the setting of its individual URL
+var realmManagementURLVariables = map[astarteservices.AstarteService]string{astarteservices.RealmManagement: "individual-urls.realm-management"}
+
 func init() {
 	RealmManagementCmd.PersistentFlags().StringP("realm-key", "k", "",
 		"Path to realm private key used to generate JWT for authentication")
@@ -44,6 +47,7 @@ func init() {
 		"Realm Management API base URL. Defaults to <astarte-url>/realmmanagement.")
 	RealmManagementCmd.PersistentFlags().StringP("realm-name", "r", "",
 		"The name of the realm that will be queried")
+	_ = RealmManagementCmd.RegisterFlagCompletionFunc("realm-name", utils.RealmNamesCompletion)
 	RealmManagementCmd.PersistentFlags().Bool("to-curl", false, "When set, display a command-line equivalent instead of running the command.")
 	_ = viper.BindPFlag("realmmanagement-to-curl", RealmManagementCmd.PersistentFlags().Lookup("to-curl"))
 }
@@ -52,8 +56,7 @@ func realmManagementPersistentPreRunE(cmd *cobra.Command, args []string) error {
 	_ = viper.BindPFlag("individual-urls.realm-management", cmd.Flags().Lookup("realm-management-url"))
 	_ = viper.BindPFlag("realm.key-file", cmd.Flags().Lookup("realm-key"))
 	var err error
-	astarteAPIClient, err = utils.APICommandSetup(
-		map[astarteservices.AstarteService]string{astarteservices.RealmManagement: "individual-urls.realm-management"}, "realm.key", "realm.key-file")
+	astarteAPIClient, err = utils.APICommandSetup(realmManagementURLVariables, "realm.key", "realm.key-file")
 	if err != nil {
 		return err
 	}
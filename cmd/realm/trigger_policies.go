@@ -40,12 +40,13 @@ var triggersPoliciesListCmd = &cobra.Command{
 }
 
 var triggersPoliciesShowCmd = &cobra.Command{
-	Use:     "show <trigger_policy_name>",
-	Short:   "Show trigger policy",
-	Long:    `Shows a trigger policy installed in the realm.`,
-	Example: `  astartectl realm-management trigger-policies show my_trigger_policiy`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    triggersPoliciesShowF,
+	Use:               "show <trigger_policy_name>",
+	Short:             "Show trigger policy",
+	Long:              `Shows a trigger policy installed in the realm.`,
+	Example:           `  astartectl realm-management trigger-policies show my_trigger_policiy`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: triggerPolicyNamesCompletion,
+	RunE:              triggersPoliciesShowF,
 }
 
 var triggersPoliciesInstallCmd = &cobra.Command{
@@ -59,13 +60,14 @@ var triggersPoliciesInstallCmd = &cobra.Command{
 }
 
 var triggersPoliciesDeleteCmd = &cobra.Command{
-	Use:     "delete <trigger_policy_name>",
-	Short:   "Delete a trigger policy",
-	Long:    `Deletes the specified trigger policy from the realm.`,
-	Example: `  astartectl realm-management trigger-policies delete my_trigger_policiy`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    triggersPoliciesDeleteF,
-	Aliases: []string{"del"},
+	Use:               "delete <trigger_policy_name>",
+	Short:             "Delete a trigger policy",
+	Long:              `Deletes the specified trigger policy from the realm.`,
+	Example:           `  astartectl realm-management trigger-policies delete my_trigger_policiy`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: triggerPolicyNamesCompletion,
+	RunE:              triggersPoliciesDeleteF,
+	Aliases:           []string{"del"},
 }
 
 func init() {
@@ -80,7 +82,7 @@ func init() {
 
 func triggersPoliciesListtF(command *cobra.Command, args []string) error {
 	realmPolicies, _ := listPolicies(realm)
-	fmt.Println(realmPolicies)
+	utils.PrintList(realmPolicies)
 	return nil
 }
 
@@ -16,39 +16,53 @@ package realm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/astarte-platform/astarte-go/client"
 	"github.com/astarte-platform/astarte-go/triggers"
 	"github.com/astarte-platform/astartectl/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 )
 
 // triggersCmd represents the triggers command
 var triggersCmd = &cobra.Command{
 	Use:     "triggers",
 	Short:   "Manage triggers",
-	Long:    `List, show, install or delete triggers in your realm.`,
+	Long:    `List, show, generate, install or delete triggers in your realm.`,
 	Aliases: []string{"trigger"},
 }
 
 var triggersListCmd = &cobra.Command{
-	Use:     "list",
-	Short:   "List triggers",
-	Long:    `List the name of triggers installed in the realm.`,
-	Example: `  astartectl realm-management triggers list`,
+	Use:   "list",
+	Short: "List triggers",
+	Long: `List the name of triggers installed in the realm.
+
+With --device, only the triggers which can fire for the given device are listed: those targeting the device,
+one of its groups, or all devices. Likewise, --group lists the triggers targeting the given group or all devices.
+They require querying AppEngine API, and they do not support the --to-curl flag.`,
+	Example: `  astartectl realm-management triggers list
+  astartectl realm-management triggers list --device 2TBn-jNESuuHamE2Zo1anA`,
 	RunE:    triggersListF,
 	Aliases: []string{"ls"},
 }
 
 var triggersShowCmd = &cobra.Command{
-	Use:     "show <trigger_name>",
-	Short:   "Show trigger",
-	Long:    `Shows a trigger installed in the realm.`,
-	Example: `  astartectl realm-management triggers show my_data_trigger`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    triggersShowF,
+	Use:   "show <trigger_name>",
+	Short: "Show trigger",
+	Long: `Shows a trigger installed in the realm.
+
+With --resolve-device, the devices each simple trigger applies to are shown after the trigger: the device,
+with its aliases, the group, with the number of its devices, or all devices. This requires querying AppEngine API.`,
+	Example: `  astartectl realm-management triggers show my_data_trigger
+  astartectl realm-management triggers show my_data_trigger --resolve-device`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: triggerNamesCompletion,
+	RunE:              triggersShowF,
 }
 
 var triggersInstallCmd = &cobra.Command{
@@ -62,13 +76,20 @@ var triggersInstallCmd = &cobra.Command{
 }
 
 var triggersDeleteCmd = &cobra.Command{
-	Use:     "delete <trigger_name>",
-	Short:   "Delete a trigger",
-	Long:    `Deletes the specified trigger from the realm.`,
-	Example: `  astartectl realm-management triggers delete my_data_trigger`,
-	Args:    cobra.ExactArgs(1),
-	RunE:    triggersDeleteF,
-	Aliases: []string{"del"},
+	Use:   "delete {<trigger_name> | --match <pattern>}",
+	Short: "Delete a trigger",
+	Long: `Deletes the specified trigger from the realm.
+When --match is used instead of <trigger_name>, all triggers whose name matches the given pattern
+are deleted. The pattern is a glob (e.g. 'staging_*'), unless --regex is set, and it has to match the
+whole name. The list of triggers to be deleted is shown before asking for confirmation, use --dry-run
+to only show it. The command fails if any of the triggers could not be deleted.
+--match does not support the --to-curl flag.`,
+	Example: `  astartectl realm-management triggers delete my_data_trigger
+  astartectl realm-management triggers delete --match 'staging_*' --dry-run`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: triggerNamesCompletion,
+	RunE:              triggersDeleteF,
+	Aliases:           []string{"del"},
 }
 
 var triggersSaveCmd = &cobra.Command{
@@ -77,10 +98,18 @@ var triggersSaveCmd = &cobra.Command{
 	Long: `Save each trigger in a realm to a local folder. Each trigger will
 be saved in a dedicated file whose name will be in the form '<trigger_name>.json'.
 When no destination path is set, triggers will be saved in the current working directory.
-This command does not support the --to-curl flag.`,
-	Example: `  astartectl realm-management triggers save`,
-	Args:    cobra.MaximumNArgs(1),
-	RunE:    triggersSaveF,
+With --to-curl, no file is saved, and the calls needed to fetch the triggers are printed as a shell script.
+
+With --redact, the credentials in trigger actions are replaced by placeholders such as
+${my_trigger.http_static_headers.Authorization}, so that trigger files can be safely committed to git.
+Credentials are the password and the sensitive query parameters in the http_url, and the values
+of http_static_headers and amqp_static_headers whose name suggests they hold a secret (e.g.
+Authorization, X-Api-Key, token). The redacted values are written to --values-file, if set,
+to be given back to 'triggers sync'.`,
+	Example: `  astartectl realm-management triggers save
+  astartectl realm-management triggers save triggers/ --redact --values-file triggers-secrets.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: triggersSaveF,
 }
 
 var triggersSyncCmd = &cobra.Command{
@@ -88,16 +117,34 @@ var triggersSyncCmd = &cobra.Command{
 	Short: "Synchronize triggers",
 	Long: `Synchronize triggers in the realm with the given files.
 All given files will be parsed, and only new triggers will be installed in the
-realm, depending on the realm's state. In order to force triggers update, use --force flag.`,
-	Example: `  astartectl realm-management triggers sync triggers/*.json`,
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    triggersSyncF,
+realm, depending on the realm's state. In order to force triggers update, use --force flag.
+
+Triggers saved with 'triggers save --redact' hold placeholders in place of their credentials:
+their values are read from --values-file, a YAML file mapping placeholder names to values, e.g.
+  my_trigger.http_static_headers.Authorization: Bearer 3xampl3
+Triggers with placeholders whose value is not found are not processed.`,
+	Example: `  astartectl realm-management triggers sync triggers/*.json
+  astartectl realm-management triggers sync triggers/*.json --values-file triggers-secrets.yaml`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: triggersSyncF,
 }
 
 func init() {
 
 	RealmManagementCmd.AddCommand(triggersCmd)
+	triggersListCmd.Flags().String("device", "", "When set, list only the triggers which can fire for this Device ID")
+	triggersListCmd.Flags().String("group", "", "When set, list only the triggers targeting this group or all devices")
+	triggersListCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to each trigger name.")
+	triggersShowCmd.Flags().Bool("resolve-device", false, "When set, show the devices each simple trigger applies to")
+	triggersShowCmd.Flags().StringP("output", "o", "default", utils.OutputFlagHelp("default")+". Templates are applied to the trigger definition.")
+	triggersSaveCmd.Flags().Bool("redact", false, "When set, credentials in trigger actions are replaced by placeholders")
+	triggersSaveCmd.Flags().String("values-file", "", "When set together with --redact, the redacted credentials are saved to this file")
 	triggersSyncCmd.Flags().Bool("force", false, "When set, force triggers update")
+	triggersSyncCmd.Flags().String("values-file", "", "A YAML file with the values of the credentials redacted by 'triggers save --redact'")
+	triggersDeleteCmd.Flags().String("match", "", "Delete all triggers whose name matches this glob pattern (or regular expression, if --regex is set)")
+	triggersDeleteCmd.Flags().Bool("regex", false, "When set, --match is evaluated as a regular expression rather than a glob")
+	triggersDeleteCmd.Flags().Bool("dry-run", false, "When set, only show the triggers matching --match, without deleting them")
+	utils.AddNonInteractiveFlag(triggersDeleteCmd.Flags())
 	triggersCmd.AddCommand(
 		triggersListCmd,
 		triggersShowCmd,
@@ -109,16 +156,111 @@ func init() {
 }
 
 func triggersListF(command *cobra.Command, args []string) error {
-	realmTriggers, _ := listTriggers(realm)
-	fmt.Println(realmTriggers)
+	deviceID, err := command.Flags().GetString("device")
+	if err != nil {
+		return err
+	}
+	groupName, err := command.Flags().GetString("group")
+	if err != nil {
+		return err
+	}
+	if deviceID != "" && groupName != "" {
+		return errors.New("Only one of --device and --group can be specified")
+	}
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
+	if deviceID == "" && groupName == "" {
+		realmTriggers, _ := listTriggers(astarteAPIClient, realm)
+		printTriggerNames(realmTriggers, templateOutput)
+		return nil
+	}
+	if utils.ShouldCurl() {
+		fmt.Println(`'triggers list' does not support the --to-curl option together with --device or --group.`)
+		utils.Exit(1)
+	}
+
+	match := func(s triggerScope) bool { return s.matchesGroup(groupName) }
+	if deviceID != "" {
+		appEngineClient, err := appEngineAPIClient()
+		if err != nil {
+			return err
+		}
+		groups, err := deviceGroups(appEngineClient, deviceID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not list the groups of %s: %v\n", deviceID, err)
+			utils.Exit(1)
+		}
+		match = func(s triggerScope) bool { return s.matchesDevice(deviceID, groups) }
+	}
+
+	realmTriggers, err := listTriggers(astarteAPIClient, realm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+	matching := []string{}
+	for _, name := range realmTriggers {
+		trigger, err := getTriggerDefinition(astarteAPIClient, realm, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not get trigger %s: %v\n", name, err)
+			utils.Exit(1)
+		}
+		if triggerMatches(trigger, match) {
+			matching = append(matching, name)
+		}
+	}
+	printTriggerNames(matching, templateOutput)
 	return nil
 }
 
+// printTriggerNames prints names as a list, or renders each of them with templateOutput when it is not nil
+func printTriggerNames(names []string, templateOutput *utils.TemplateOutput) {
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, names)
+		return
+	}
+	utils.PrintList(names)
+}
+
 func triggersShowF(command *cobra.Command, args []string) error {
 	triggerName := args[0]
-	triggerDefinition, _ := getTriggerDefinition(realm, triggerName)
+	resolveDevice, err := command.Flags().GetBool("resolve-device")
+	if err != nil {
+		return err
+	}
+	_, templateOutput, err := utils.OutputFromFlags(command, "default")
+	if err != nil {
+		return err
+	}
+	if resolveDevice && templateOutput != nil {
+		return errors.New("--resolve-device cannot be used together with go-template and jsonpath outputs")
+	}
+	triggerDefinition, err := getTriggerDefinition(astarteAPIClient, realm, triggerName)
+	if (resolveDevice || templateOutput != nil) && err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+	if templateOutput != nil {
+		utils.PrintTemplateOutput(templateOutput, triggerDefinition)
+		return nil
+	}
 	respJSON, _ := json.MarshalIndent(triggerDefinition, "", "  ")
 	fmt.Println(string(respJSON))
+	if !resolveDevice {
+		return nil
+	}
+
+	appEngineClient, err := appEngineAPIClient()
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println("Applies to:")
+	for i, t := range triggerDefinition.SimpleTriggers {
+		fmt.Printf("  %d. %s on %s: %s\n", i+1, t.Type, t.On, describeTriggerScope(appEngineClient, simpleTriggerScope(t)))
+	}
 	return nil
 }
 
@@ -134,18 +276,33 @@ func triggersInstallF(command *cobra.Command, args []string) error {
 		return err
 	}
 
-	_ = installTrigger(realm, triggerBody)
+	// triggers.AstarteTrigger is used just for validation: the file is sent as is, as
+	// AstarteTrigger does not support AMQP actions
+	_ = installTrigger(astarteAPIClient, realm, json.RawMessage(triggerFile))
 
 	fmt.Println("ok")
 	return nil
 }
 
 func triggersDeleteF(command *cobra.Command, args []string) error {
+	match, err := command.Flags().GetString("match")
+	if err != nil {
+		return err
+	}
+	switch {
+	case match != "" && len(args) > 0:
+		return errors.New("Either <trigger_name> or --match must be specified, not both")
+	case match != "":
+		return triggersDeleteMatchingF(command, match)
+	case len(args) == 0:
+		return errors.New("Either <trigger_name> or --match must be specified")
+	}
+
 	triggerName := args[0]
 	deleteTriggerCall, err := astarteAPIClient.DeleteTrigger(realm, triggerName)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	utils.MaybeCurlAndExit(deleteTriggerCall, astarteAPIClient)
@@ -153,7 +310,7 @@ func triggersDeleteF(command *cobra.Command, args []string) error {
 	deleteTriggerRes, err := deleteTriggerCall.Run(astarteAPIClient)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
 	_, _ = deleteTriggerRes.Parse()
@@ -162,89 +319,233 @@ func triggersDeleteF(command *cobra.Command, args []string) error {
 	return nil
 }
 
-func triggersSaveF(command *cobra.Command, args []string) error {
+func triggersDeleteMatchingF(command *cobra.Command, match string) error {
 	if viper.GetBool("realmmanagement-to-curl") {
-		fmt.Println(`'triggers save' does not support the --to-curl option. Use 'triggers list' to get the triggers in your realm, 'triggers versions' to get their versions, and 'triggers show' to get the content of a trigger.`)
-		os.Exit(1)
+		fmt.Println(`'triggers delete --match' does not support the --to-curl option. Delete your triggers one by one with 'triggers delete <trigger_name>'.`)
+		utils.Exit(1)
+	}
+
+	useRegex, err := command.Flags().GetBool("regex")
+	if err != nil {
+		return err
+	}
+	dryRun, err := command.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	nonInteractive := utils.NonInteractive(command)
+
+	matches, err := triggerNameMatcher(match, useRegex)
+	if err != nil {
+		return err
+	}
+
+	realmTriggers, err := listTriggers(astarteAPIClient, realm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		utils.Exit(1)
+	}
+
+	triggersToDelete := []string{}
+	for _, name := range realmTriggers {
+		if matches(name) {
+			triggersToDelete = append(triggersToDelete, name)
+		}
 	}
 
+	if len(triggersToDelete) == 0 {
+		fmt.Printf("No triggers in realm %s match %s\n", realm, match)
+		return nil
+	}
+
+	for _, name := range triggersToDelete {
+		fmt.Printf("Will delete trigger %s\n", name)
+	}
+	fmt.Println()
+
+	if dryRun {
+		return nil
+	}
+
+	if !nonInteractive {
+		if ok, err := utils.AskForConfirmation(fmt.Sprintf("Do you want to delete %d triggers?", len(triggersToDelete))); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			utils.Exit(1)
+		}
+	}
+
+	failed := 0
+	for _, name := range triggersToDelete {
+		if err := deleteTrigger(astarteAPIClient, realm, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not delete trigger %s: %s\n", name, err)
+			failed++
+		} else {
+			fmt.Printf("Trigger %s deleted successfully\n", name)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d triggers could not be deleted\n", failed, len(triggersToDelete))
+		utils.Exit(1)
+	}
+
+	return nil
+}
+
+// triggerNameMatcher returns a function which tells whether a trigger name matches pattern,
+// which is either a glob or a regular expression. Both have to match the whole name.
+func triggerNameMatcher(pattern string, useRegex bool) (func(string) bool, error) {
+	if useRegex {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression %s: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	// Check the glob is well formed upfront
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid glob pattern %s: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+func triggersSaveF(command *cobra.Command, args []string) error {
+	redact, err := command.Flags().GetBool("redact")
+	if err != nil {
+		return err
+	}
+	valuesFile, err := command.Flags().GetString("values-file")
+	if err != nil {
+		return err
+	}
+	if valuesFile != "" && !redact {
+		return errors.New("--values-file can be used only together with --redact")
+	}
+
+	// Saving takes a call per trigger, after listing them
+	utils.StartCurlScript()
+
 	var targetPath string
-	var err error
 	if len(args) == 0 {
 		targetPath, _ = filepath.Abs(".")
 	} else {
 		targetPath, err = filepath.Abs(args[0])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 	}
 
 	// retrieve triggers list
-	realmTriggers, err := listTriggers(realm)
+	realmTriggers, err := listTriggers(astarteAPIClient, realm)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utils.Exit(1)
 	}
 
+	secrets := map[string]string{}
 	for _, name := range realmTriggers {
 
-		triggerDefinition, err := getTriggerDefinition(realm, name)
+		// The trigger is saved as returned by Astarte, as triggers.AstarteTrigger does not support AMQP actions
+		triggerDefinition, err := getRawTriggerDefinition(astarteAPIClient, realm, name)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
+		}
+		if utils.ShouldCurl() {
+			continue
 		}
 
-		respJSON, err := json.MarshalIndent(*triggerDefinition, "", "  ")
+		if redact {
+			triggerSecrets, err := redactTriggerSecrets(triggerDefinition)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+			for k, v := range triggerSecrets {
+				secrets[k] = v
+			}
+		}
+
+		respJSON, err := json.MarshalIndent(triggerDefinition, "", "  ")
 
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 
 		filename := fmt.Sprintf("/%s/%s.json", targetPath, name)
 		outFile, err := os.Create(filename)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 		defer outFile.Close()
 
 		if _, err := outFile.Write(respJSON); err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+			utils.Exit(1)
 		}
 
 	}
+
+	if redact && !utils.ShouldCurl() {
+		fmt.Printf("%d secrets redacted\n", len(secrets))
+		if valuesFile != "" {
+			if err := saveTriggerSecretValues(valuesFile, secrets); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				utils.Exit(1)
+			}
+			fmt.Printf("Redacted values saved to %s: do not commit it together with your triggers\n", valuesFile)
+		}
+	}
 	return nil
 }
 
 func triggersSyncF(command *cobra.Command, args []string) error {
 	if viper.GetBool("realmmanagement-to-curl") {
 		fmt.Println(`'triggers sync' does not support the --to-curl option. Install your triggers one by one with 'triggers install'.`)
-		os.Exit(1)
+		utils.Exit(1)
+	}
+
+	valuesFile, err := command.Flags().GetString("values-file")
+	if err != nil {
+		return err
+	}
+	secretValues := map[string]string{}
+	if valuesFile != "" {
+		if secretValues, err = loadTriggerSecretValues(valuesFile); err != nil {
+			return err
+		}
 	}
 
-	triggersToInstall := []triggers.AstarteTrigger{}
-	triggersToUpdate := []triggers.AstarteTrigger{}
+	triggersToInstall := []syncedTrigger{}
+	triggersToUpdate := []syncedTrigger{}
 	invalidTriggers := []string{}
 
 	for _, f := range args {
-		triggerFile, err := os.ReadFile(f)
-		if err != nil {
-			return err
+		// Triggers are validated by lintTriggerFile, as triggers.AstarteTrigger does not support AMQP actions
+		result, trigger := lintTriggerFile(f)
+		if len(result.Errors) > 0 {
+			invalidTriggers = append(invalidTriggers, f)
+			continue
 		}
-		if !validateTrigger(f) {
+		if err := injectTriggerSecrets(trigger, secretValues); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", f, err)
 			invalidTriggers = append(invalidTriggers, f)
 			continue
 		}
 
-		var astarteTrigger triggers.AstarteTrigger
-		if err = json.Unmarshal(triggerFile, &astarteTrigger); err != nil {
+		body, err := json.Marshal(trigger)
+		if err != nil {
 			return err
 		}
+		astarteTrigger := syncedTrigger{Name: result.Trigger, Body: body}
 
-		if _, err := getTriggerDefinition(realm, astarteTrigger.Name); err != nil {
+		if _, err := getTriggerDefinition(astarteAPIClient, realm, astarteTrigger.Name); err != nil {
 			// The trigger does not exist
 			triggersToInstall = append(triggersToInstall, astarteTrigger)
 		} else {
@@ -278,13 +579,13 @@ func triggersSyncF(command *cobra.Command, args []string) error {
 
 		fmt.Printf("The following new triggers will be installed: %+q \n", list)
 
-		if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
-			fmt.Printf("aborting")
-			return nil
+		if ok, err := utils.Confirm(command, "Do you want to continue?"); !ok || err != nil {
+			fmt.Fprintln(os.Stderr, "Aborting.")
+			utils.Exit(1)
 		}
 
 		for _, trigger := range triggersToInstall {
-			if err := installTrigger(realm, trigger); err != nil {
+			if err := installTrigger(astarteAPIClient, realm, trigger.Body); err != nil {
 				fmt.Fprintf(os.Stderr, "Could not install trigger %s: %s\n", trigger.Name, err)
 			} else {
 				fmt.Printf("trigger %s installed successfully\n", trigger.Name)
@@ -299,12 +600,12 @@ func triggersSyncF(command *cobra.Command, args []string) error {
 		}
 		if y {
 			fmt.Printf("The following triggers already exists and WILL be DELETED and RECREATED: %+q \n", listExisting)
-			if ok, err := utils.AskForConfirmation("Do you want to continue?"); !ok || err != nil {
-				fmt.Printf("aborting")
-				return nil
+			if ok, err := utils.Confirm(command, "Do you want to continue?"); !ok || err != nil {
+				fmt.Fprintln(os.Stderr, "Aborting.")
+				utils.Exit(1)
 			}
 			for _, trigger := range triggersToUpdate {
-				if err := updateTrigger(realm, trigger.Name, trigger); err != nil {
+				if err := updateTrigger(astarteAPIClient, realm, trigger.Name, trigger.Body); err != nil {
 					fmt.Fprintf(os.Stderr, "Could not update trigger %s: %s\n", trigger.Name, err)
 				} else {
 					fmt.Printf("trigger %s updated successfully\n", trigger.Name)
@@ -317,8 +618,14 @@ func triggersSyncF(command *cobra.Command, args []string) error {
 	return nil
 }
 
-func installTrigger(realm string, trigger triggers.AstarteTrigger) error {
-	installTriggerCall, err := astarteAPIClient.InstallTrigger(realm, trigger)
+// syncedTrigger is a trigger read by 'triggers sync', sent to Astarte as is
+type syncedTrigger struct {
+	Name string
+	Body json.RawMessage
+}
+
+func installTrigger(realmClient *client.Client, realm string, trigger interface{}) error {
+	installTriggerCall, err := realmClient.InstallTrigger(realm, trigger)
 	if err != nil {
 		return err
 	}
@@ -326,9 +633,9 @@ func installTrigger(realm string, trigger triggers.AstarteTrigger) error {
 	// When we're here in the context of `triggers sync`, the to-curl flag
 	// is always false (`triggers sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(installTriggerCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(installTriggerCall, realmClient)
 
-	installTriggerRes, err := installTriggerCall.Run(astarteAPIClient)
+	installTriggerRes, err := installTriggerCall.Run(realmClient)
 	if err != nil {
 		return err
 	}
@@ -337,19 +644,34 @@ func installTrigger(realm string, trigger triggers.AstarteTrigger) error {
 	return nil
 }
 
-func updateTrigger(realm string, triggername string, newtrig triggers.AstarteTrigger) error {
-	deleteTriggercall, err := astarteAPIClient.DeleteTrigger(realm, triggername)
+func deleteTrigger(realmClient *client.Client, realm string, triggerName string) error {
+	deleteTriggerCall, err := realmClient.DeleteTrigger(realm, triggerName)
 	if err != nil {
 		return err
 	}
-	utils.MaybeCurlAndExit(deleteTriggercall, astarteAPIClient)
 
-	_, err = deleteTriggercall.Run(astarteAPIClient)
+	deleteTriggerRes, err := deleteTriggerCall.Run(realmClient)
 	if err != nil {
 		return err
 	}
 
-	updateTriggerCall, err := astarteAPIClient.InstallTrigger(realm, newtrig)
+	_, _ = deleteTriggerRes.Parse()
+	return nil
+}
+
+func updateTrigger(realmClient *client.Client, realm string, triggername string, newtrig interface{}) error {
+	deleteTriggercall, err := realmClient.DeleteTrigger(realm, triggername)
+	if err != nil {
+		return err
+	}
+	utils.MaybeCurlAndExit(deleteTriggercall, realmClient)
+
+	_, err = deleteTriggercall.Run(realmClient)
+	if err != nil {
+		return err
+	}
+
+	updateTriggerCall, err := realmClient.InstallTrigger(realm, newtrig)
 	if err != nil {
 		return err
 	}
@@ -357,9 +679,9 @@ func updateTrigger(realm string, triggername string, newtrig triggers.AstarteTri
 	// When we're here in the context of `triggers sync`, the to-curl flag
 	// is always false (`triggers sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(updateTriggerCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(updateTriggerCall, realmClient)
 
-	updateTriggerRes, err := updateTriggerCall.Run(astarteAPIClient)
+	updateTriggerRes, err := updateTriggerCall.Run(realmClient)
 	if err != nil {
 		return err
 	}
@@ -368,15 +690,15 @@ func updateTrigger(realm string, triggername string, newtrig triggers.AstarteTri
 	return nil
 }
 
-func listTriggers(realm string) ([]string, error) {
-	listTriggersCall, err := astarteAPIClient.ListTriggers(realm)
+func listTriggers(realmClient *client.Client, realm string) ([]string, error) {
+	listTriggersCall, err := realmClient.ListTriggers(realm)
 	if err != nil {
 		return []string{}, err
 	}
 
-	utils.MaybeCurlAndExit(listTriggersCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(listTriggersCall, realmClient)
 
-	listTriggersRes, err := listTriggersCall.Run(astarteAPIClient)
+	listTriggersRes, err := listTriggersCall.Run(realmClient)
 	if err != nil {
 		return []string{}, err
 	}
@@ -387,8 +709,27 @@ func listTriggers(realm string) ([]string, error) {
 	return rawlistTriggers.([]string), nil
 }
 
-func getTriggerDefinition(realm, triggerName string) (*triggers.AstarteTrigger, error) {
-	getTriggerCall, err := astarteAPIClient.GetTrigger(realm, triggerName)
+func getTriggerDefinition(realmClient *client.Client, realm, triggerName string) (*triggers.AstarteTrigger, error) {
+	rawTrigger, err := getRawTriggerDefinition(realmClient, realm, triggerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var triggerDefinition triggers.AstarteTrigger
+
+	UnmarshalledTrigger, _ := json.Marshal(rawTrigger)
+
+	if err := json.Unmarshal(UnmarshalledTrigger, &triggerDefinition); err != nil {
+		return nil, err
+	}
+
+	return &triggerDefinition, nil
+}
+
+// getRawTriggerDefinition returns a trigger as returned by Astarte, including the fields
+// which are not supported by triggers.AstarteTrigger, such as AMQP actions
+func getRawTriggerDefinition(realmClient *client.Client, realm, triggerName string) (map[string]interface{}, error) {
+	getTriggerCall, err := realmClient.GetTrigger(realm, triggerName)
 	if err != nil {
 		return nil, err
 	}
@@ -396,9 +737,9 @@ func getTriggerDefinition(realm, triggerName string) (*triggers.AstarteTrigger,
 	// When we're here in the context of `trigger sync`, the to-curl flag
 	// is always false (`trigger sync` has no `--to-curl` flag)
 	// and thus the call will never exit unexpectedly
-	utils.MaybeCurlAndExit(getTriggerCall, astarteAPIClient)
+	utils.MaybeCurlAndExit(getTriggerCall, realmClient)
 
-	getTriggerRes, err := getTriggerCall.Run(astarteAPIClient)
+	getTriggerRes, err := getTriggerCall.Run(realmClient)
 	if err != nil {
 		return nil, err
 	}
@@ -407,15 +748,8 @@ func getTriggerDefinition(realm, triggerName string) (*triggers.AstarteTrigger,
 		return nil, err
 	}
 
-	var triggerDefinition triggers.AstarteTrigger
-
-	UnmarshalledTrigger, _ := json.Marshal(rawTRigger.(map[string]interface{}))
-
-	if err := json.Unmarshal(UnmarshalledTrigger, &triggerDefinition); err != nil {
-		return nil, err
-	}
-
-	return &triggerDefinition, nil
+	trigger, _ := rawTRigger.(map[string]interface{})
+	return trigger, nil
 }
 
 func validateTrigger(path string) bool {
@@ -0,0 +1,418 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/triggers"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var triggersGenerateCmd = &cobra.Command{
+	Use:   "generate <trigger_name>",
+	Short: "Generate a trigger",
+	Long: `Generate the JSON definition of a trigger for common integrations, ready to be installed with
+'triggers install'.
+
+--type chooses the action of the trigger: http sends the event to a webhook, amqp publishes it to an
+AMQP exchange. The exchange must be named astarte_events_<realm_name>_<suffix>, and defaults to
+astarte_events_<realm_name>_default when the realm is known.
+
+--event chooses what fires the trigger. Device events (device-connected, device-disconnected,
+device-error) fire for all devices, unless --device-id or --group is given. Data events (incoming-data,
+value-change, value-change-applied, value-stored, path-created, path-removed) fire for all interfaces,
+unless --interface and --interface-major are given, optionally restricted to the paths matching --path.
+
+With --mustache, http triggers send a JSON body built from a mustache template with the most relevant
+fields of the event, rather than the default Astarte event payload. The value of data events is sent
+with its JSON type, hence --string-value is needed to quote it for interfaces whose values are strings.
+Tweak the template to your needs before installing the trigger.
+
+No request is sent to Astarte: the trigger is printed, or saved to --output-file.`,
+	Example: `  astartectl realm-management triggers generate my_webhook --type http --event incoming-data --url https://example.com/hook --mustache
+  astartectl realm-management triggers generate connections --type amqp --event device-connected --routing-key connections -o connections.json`,
+	Args:              cobra.ExactArgs(1),
+	PersistentPreRunE: triggersGeneratePersistentPreRunE,
+	RunE:              triggersGenerateF,
+}
+
+// triggerEvents maps the events accepted by --event to the type of simple trigger and its "on" value
+var triggerEvents = map[string]struct {
+	Type triggers.AstarteTriggerType
+	On   triggers.AstarteTriggerOn
+}{
+	"device-connected":     {triggers.DeviceType, triggers.DeviceConnected},
+	"device-disconnected":  {triggers.DeviceType, triggers.DeviceDisconnected},
+	"device-error":         {triggers.DeviceType, triggers.DeviceError},
+	"incoming-data":        {triggers.DataType, triggers.IncomingData},
+	"value-change":         {triggers.DataType, triggers.ValueChange},
+	"value-change-applied": {triggers.DataType, triggers.ValueChangeApplied},
+	"value-stored":         {triggers.DataType, triggers.ValueStored},
+	"path-created":         {triggers.DataType, triggers.PathCreated},
+	"path-removed":         {triggers.DataType, triggers.PathRemoved},
+}
+
+// generatedTrigger is the definition of a trigger, as accepted by Realm Management API. Unlike
+// triggers.AstarteTrigger, it also supports AMQP actions.
+type generatedTrigger struct {
+	Name           string                   `json:"name"`
+	Action         interface{}              `json:"action"`
+	SimpleTriggers []generatedSimpleTrigger `json:"simple_triggers"`
+}
+
+type generatedHTTPAction struct {
+	HTTPURL           string            `json:"http_url"`
+	HTTPMethod        string            `json:"http_method"`
+	HTTPStaticHeaders map[string]string `json:"http_static_headers,omitempty"`
+	IgnoreSSLErrors   bool              `json:"ignore_ssl_errors,omitempty"`
+	TemplateType      string            `json:"template_type,omitempty"`
+	Template          string            `json:"template,omitempty"`
+}
+
+type generatedAMQPAction struct {
+	AMQPExchange            string            `json:"amqp_exchange"`
+	AMQPRoutingKey          string            `json:"amqp_routing_key,omitempty"`
+	AMQPMessageExpirationMs int               `json:"amqp_message_expiration_ms"`
+	AMQPMessagePersistent   bool              `json:"amqp_message_persistent"`
+	AMQPStaticHeaders       map[string]string `json:"amqp_static_headers,omitempty"`
+}
+
+type generatedSimpleTrigger struct {
+	Type               triggers.AstarteTriggerType `json:"type"`
+	On                 triggers.AstarteTriggerOn   `json:"on"`
+	DeviceID           string                      `json:"device_id,omitempty"`
+	GroupName          string                      `json:"group_name,omitempty"`
+	InterfaceName      string                      `json:"interface_name,omitempty"`
+	InterfaceMajor     *int                        `json:"interface_major,omitempty"`
+	MatchPath          string                      `json:"match_path,omitempty"`
+	ValueMatchOperator string                      `json:"value_match_operator,omitempty"`
+}
+
+const (
+	// Triple braces keep mustache from HTML-escaping values. The value of data events is left unquoted, so that
+	// numbers, booleans and arrays keep their JSON type, unless --string-value is set.
+	dataEventTemplate = `{"realm": "{{{ realm }}}", "device_id": "{{{ device_id }}}", "event": "{{{ event.type }}}", ` +
+		`"interface": "{{{ event.interface }}}", "path": "{{{ event.path }}}", "value": %s, "timestamp": "{{{ timestamp }}}"}`
+	dataEventValue       = `{{{ event.value }}}`
+	dataEventStringValue = `"{{{ event.value }}}"`
+	deviceEventTemplate  = `{"realm": "{{{ realm }}}", "device_id": "{{{ device_id }}}", "event": "{{{ event.type }}}", "timestamp": "{{{ timestamp }}}"}`
+)
+
+func init() {
+	triggersGenerateCmd.Flags().String("type", "", "The type of action of the trigger (http,amqp)")
+	_ = triggersGenerateCmd.MarkFlagRequired("type")
+	triggersGenerateCmd.Flags().String("event", "incoming-data", "The event firing the trigger ("+strings.Join(sortedTriggerEvents(), ",")+")")
+	triggersGenerateCmd.Flags().String("device-id", "", "For device events, the device whose events fire the trigger. Defaults to all devices")
+	triggersGenerateCmd.Flags().String("group", "", "For device events, the group whose devices' events fire the trigger")
+	triggersGenerateCmd.Flags().String("interface", "*", "For data events, the interface whose data fires the trigger")
+	triggersGenerateCmd.Flags().Int("interface-major", 0, "For data events, the major version of --interface")
+	triggersGenerateCmd.Flags().String("path", "/*", "For data events, the path whose data fires the trigger")
+	triggersGenerateCmd.Flags().String("url", "", "For http triggers, the URL of the webhook")
+	triggersGenerateCmd.Flags().String("method", "post", "For http triggers, the HTTP method of the webhook (post,get,put,patch,delete)")
+	triggersGenerateCmd.Flags().StringArray("static-header", []string{}, "A static header to send with the event, as <name>=<value>. Can be specified multiple times")
+	triggersGenerateCmd.Flags().Bool("ignore-webhook-ssl-errors", false, "For http triggers, do not verify the certificate of the webhook")
+	triggersGenerateCmd.Flags().Bool("mustache", false, "For http triggers, send a JSON body built from a mustache template rather than the Astarte event")
+	triggersGenerateCmd.Flags().Bool("string-value", false, "With --mustache, quote the value of data events in the body, for interfaces whose values are strings")
+	triggersGenerateCmd.Flags().String("exchange", "", "For amqp triggers, the exchange to publish events to. Defaults to astarte_events_<realm_name>_default")
+	triggersGenerateCmd.Flags().String("routing-key", "", "For amqp triggers, the routing key of published events")
+	triggersGenerateCmd.Flags().Int("message-expiration-ms", 60000, "For amqp triggers, the expiration of published events, in milliseconds")
+	triggersGenerateCmd.Flags().Bool("persistent", false, "For amqp triggers, publish persistent messages")
+	triggersGenerateCmd.Flags().StringP("output-file", "o", "", "When set, the trigger is saved to this file rather than printed")
+
+	triggersCmd.AddCommand(triggersGenerateCmd)
+}
+
+func sortedTriggerEvents() []string {
+	events := []string{}
+	for e := range triggerEvents {
+		events = append(events, e)
+	}
+	sort.Strings(events)
+	return events
+}
+
+func triggersGeneratePersistentPreRunE(cmd *cobra.Command, args []string) error {
+	// No need for Realm Management API, the realm is only used for the default AMQP exchange
+	_ = viper.BindPFlag("realm.name", cmd.Flags().Lookup("realm-name"))
+	realm = viper.GetString("realm.name")
+	return nil
+}
+
+func triggersGenerateF(command *cobra.Command, args []string) error {
+	actionType, err := command.Flags().GetString("type")
+	if err != nil {
+		return err
+	}
+	eventName, err := command.Flags().GetString("event")
+	if err != nil {
+		return err
+	}
+	outputFile, err := command.Flags().GetString("output-file")
+	if err != nil {
+		return err
+	}
+	event, ok := triggerEvents[eventName]
+	if !ok {
+		return fmt.Errorf("%s is not a supported event. Supported events are %s", eventName, strings.Join(sortedTriggerEvents(), ", "))
+	}
+
+	simpleTrigger, err := generateSimpleTrigger(command, event.Type, event.On)
+	if err != nil {
+		return err
+	}
+
+	var action interface{}
+	switch actionType {
+	case "http":
+		action, err = generateHTTPAction(command, event.Type)
+	case "amqp":
+		action, err = generateAMQPAction(command)
+	default:
+		return fmt.Errorf("%s is not a supported trigger type. Supported types are http and amqp", actionType)
+	}
+	if err != nil {
+		return err
+	}
+
+	trigger := generatedTrigger{Name: args[0], Action: action, SimpleTriggers: []generatedSimpleTrigger{simpleTrigger}}
+	triggerJSON, err := json.MarshalIndent(trigger, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if outputFile == "" {
+		fmt.Println(string(triggerJSON))
+		return nil
+	}
+	if err := os.WriteFile(outputFile, append(triggerJSON, '\n'), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Trigger %s saved to %s\n", args[0], outputFile)
+	return nil
+}
+
+func generateSimpleTrigger(command *cobra.Command, triggerType triggers.AstarteTriggerType, on triggers.AstarteTriggerOn) (generatedSimpleTrigger, error) {
+	simpleTrigger := generatedSimpleTrigger{Type: triggerType, On: on}
+	deviceID, err := command.Flags().GetString("device-id")
+	if err != nil {
+		return simpleTrigger, err
+	}
+	group, err := command.Flags().GetString("group")
+	if err != nil {
+		return simpleTrigger, err
+	}
+	interfaceName, err := command.Flags().GetString("interface")
+	if err != nil {
+		return simpleTrigger, err
+	}
+	interfaceMajor, err := command.Flags().GetInt("interface-major")
+	if err != nil {
+		return simpleTrigger, err
+	}
+	matchPath, err := command.Flags().GetString("path")
+	if err != nil {
+		return simpleTrigger, err
+	}
+
+	if triggerType == triggers.DeviceType {
+		if command.Flags().Changed("interface") || command.Flags().Changed("interface-major") || command.Flags().Changed("path") {
+			return simpleTrigger, errors.New("--interface, --interface-major and --path can be used only with data events")
+		}
+		switch {
+		case deviceID != "" && group != "":
+			return simpleTrigger, errors.New("--device-id and --group are mutually exclusive")
+		case group != "":
+			simpleTrigger.GroupName = group
+		case deviceID != "":
+			simpleTrigger.DeviceID = deviceID
+		default:
+			simpleTrigger.DeviceID = "*"
+		}
+		return simpleTrigger, nil
+	}
+
+	if deviceID != "" || group != "" {
+		return simpleTrigger, errors.New("--device-id and --group can be used only with device events")
+	}
+	if interfaceName == "*" {
+		if command.Flags().Changed("interface-major") {
+			return simpleTrigger, errors.New("--interface-major requires --interface")
+		}
+		if matchPath != "/*" {
+			return simpleTrigger, errors.New("--path requires --interface, triggers on all interfaces match all paths")
+		}
+	} else {
+		if !command.Flags().Changed("interface-major") {
+			return simpleTrigger, errors.New("--interface-major is required when --interface is given")
+		}
+		simpleTrigger.InterfaceMajor = &interfaceMajor
+	}
+	if !strings.HasPrefix(matchPath, "/") {
+		return simpleTrigger, fmt.Errorf("%s is not a valid path, it must start with /", matchPath)
+	}
+	simpleTrigger.InterfaceName = interfaceName
+	simpleTrigger.MatchPath = matchPath
+	simpleTrigger.ValueMatchOperator = string(triggers.All)
+	return simpleTrigger, nil
+}
+
+func generateHTTPAction(command *cobra.Command, triggerType triggers.AstarteTriggerType) (generatedHTTPAction, error) {
+	action := generatedHTTPAction{}
+	if err := checkActionFlags(command, "exchange", "routing-key", "message-expiration-ms", "persistent"); err != nil {
+		return action, err
+	}
+	webhookURL, err := command.Flags().GetString("url")
+	if err != nil {
+		return action, err
+	}
+	method, err := command.Flags().GetString("method")
+	if err != nil {
+		return action, err
+	}
+	ignoreSSLErrors, err := command.Flags().GetBool("ignore-webhook-ssl-errors")
+	if err != nil {
+		return action, err
+	}
+	mustache, err := command.Flags().GetBool("mustache")
+	if err != nil {
+		return action, err
+	}
+	stringValue, err := command.Flags().GetBool("string-value")
+	if err != nil {
+		return action, err
+	}
+	headers, err := triggerHeadersFromFlags(command)
+	if err != nil {
+		return action, err
+	}
+
+	if webhookURL == "" {
+		return action, errors.New("--url is required for http triggers")
+	}
+	if stringValue && (!mustache || triggerType != triggers.DataType) {
+		return action, errors.New("--string-value requires --mustache and a data event")
+	}
+	method = strings.ToLower(method)
+	if err := triggers.AstarteHTTPMethod(method).IsValid(); err != nil {
+		return action, err
+	}
+
+	action.HTTPURL = webhookURL
+	action.HTTPMethod = method
+	action.HTTPStaticHeaders = headers
+	action.IgnoreSSLErrors = ignoreSSLErrors
+	if mustache {
+		action.TemplateType = string(triggers.Mustache)
+		action.Template = fmt.Sprintf(dataEventTemplate, dataEventValue)
+		if stringValue {
+			action.Template = fmt.Sprintf(dataEventTemplate, dataEventStringValue)
+		}
+		if triggerType == triggers.DeviceType {
+			action.Template = deviceEventTemplate
+		}
+		if _, ok := action.HTTPStaticHeaders["Content-Type"]; !ok {
+			if action.HTTPStaticHeaders == nil {
+				action.HTTPStaticHeaders = map[string]string{}
+			}
+			action.HTTPStaticHeaders["Content-Type"] = "application/json"
+		}
+	}
+	return action, nil
+}
+
+func generateAMQPAction(command *cobra.Command) (generatedAMQPAction, error) {
+	action := generatedAMQPAction{}
+	if err := checkActionFlags(command, "url", "method", "ignore-webhook-ssl-errors", "mustache", "string-value"); err != nil {
+		return action, err
+	}
+	exchange, err := command.Flags().GetString("exchange")
+	if err != nil {
+		return action, err
+	}
+	routingKey, err := command.Flags().GetString("routing-key")
+	if err != nil {
+		return action, err
+	}
+	expiration, err := command.Flags().GetInt("message-expiration-ms")
+	if err != nil {
+		return action, err
+	}
+	persistent, err := command.Flags().GetBool("persistent")
+	if err != nil {
+		return action, err
+	}
+	headers, err := triggerHeadersFromFlags(command)
+	if err != nil {
+		return action, err
+	}
+
+	switch {
+	case exchange == "" && realm == "":
+		return action, errors.New("--exchange is required when no realm is given")
+	case exchange == "":
+		exchange = fmt.Sprintf("astarte_events_%s_default", realm)
+	case realm != "" && !strings.HasPrefix(exchange, fmt.Sprintf("astarte_events_%s_", realm)):
+		return action, fmt.Errorf("%s is not a valid exchange, it must be named astarte_events_%s_<suffix>", exchange, realm)
+	case realm == "" && !strings.HasPrefix(exchange, "astarte_events_"):
+		return action, fmt.Errorf("%s is not a valid exchange, it must be named astarte_events_<realm_name>_<suffix>", exchange)
+	}
+	if expiration <= 0 {
+		return action, errors.New("--message-expiration-ms must be positive")
+	}
+
+	action.AMQPExchange = exchange
+	action.AMQPRoutingKey = routingKey
+	action.AMQPMessageExpirationMs = expiration
+	action.AMQPMessagePersistent = persistent
+	action.AMQPStaticHeaders = headers
+	return action, nil
+}
+
+// checkActionFlags returns an error if any of the flags, which do not apply to the chosen action, was given
+func checkActionFlags(command *cobra.Command, flags ...string) error {
+	for _, f := range flags {
+		if command.Flags().Changed(f) {
+			return fmt.Errorf("--%s cannot be used with --type %s", f, command.Flag("type").Value.String())
+		}
+	}
+	return nil
+}
+
+func triggerHeadersFromFlags(command *cobra.Command) (map[string]string, error) {
+	rawHeaders, err := command.Flags().GetStringArray("static-header")
+	if err != nil {
+		return nil, err
+	}
+	if len(rawHeaders) == 0 {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, h := range rawHeaders {
+		name, value, ok := strings.Cut(h, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("Invalid header %s. Format must be <name>=<value>", h)
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
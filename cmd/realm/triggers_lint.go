@@ -0,0 +1,329 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/triggers"
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var triggersLintCmd = &cobra.Command{
+	Use:   "lint <trigger_files> [...]",
+	Short: "Lint triggers",
+	Long: `Check the given trigger files, and report which ones would be rejected by the realm. This is
+thought to gate trigger repositories in CI pipelines, the same way 'utils interfaces validate' does
+for interfaces.
+
+Each file is checked locally first: it must be a well formed trigger, with a valid action (either
+http or amqp) and simple trigger, and trigger names must be unique among the given files.
+Astarte does not support installing a trigger in dry-run mode, hence nothing is installed: rather,
+the triggers are checked against the state of the realm. The interfaces targeted by data triggers
+must be installed in the realm with the given major version, and AMQP exchanges must be named
+astarte_events_<realm_name>_<suffix>. With --offline, the realm is not queried and only the local
+checks are performed.
+
+-o junit and -o json print a report suitable for CI systems, which is saved to --report-file when
+given. The command exits with a non-zero status if any trigger is not valid.
+This command does not support the --to-curl flag.`,
+	Example: `  astartectl realm-management triggers lint triggers/*.json
+  astartectl realm-management triggers lint triggers/*.json -o junit --report-file triggers-lint.xml
+  astartectl realm-management triggers lint triggers/*.json --offline -o json`,
+	Args:              cobra.MinimumNArgs(1),
+	PersistentPreRunE: triggersLintPersistentPreRunE,
+	RunE:              triggersLintF,
+}
+
+// triggerLintResult is the outcome of linting a trigger file
+type triggerLintResult struct {
+	File    string   `json:"file"`
+	Trigger string   `json:"trigger,omitempty"`
+	Valid   bool     `json:"valid"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func init() {
+	triggersLintCmd.Flags().Bool("offline", false, "When set, only local checks are performed and the realm is not queried")
+	triggersLintCmd.Flags().StringP("output", "o", "default", "The type of output (default,junit,json)")
+	triggersLintCmd.Flags().String("report-file", "", "When set, the junit or json report is saved to this file rather than printed")
+
+	triggersCmd.AddCommand(triggersLintCmd)
+}
+
+func triggersLintPersistentPreRunE(cmd *cobra.Command, args []string) error {
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		return err
+	}
+	if !offline {
+		return realmManagementPersistentPreRunE(cmd, args)
+	}
+	// No need for Realm Management API, the realm is only used to check AMQP exchanges
+	_ = viper.BindPFlag("realm.name", cmd.Flags().Lookup("realm-name"))
+	realm = viper.GetString("realm.name")
+	return nil
+}
+
+func triggersLintF(command *cobra.Command, args []string) error {
+	if utils.ShouldCurl() {
+		fmt.Println(`'triggers lint' does not support the --to-curl option.`)
+		os.Exit(1)
+	}
+
+	offline, err := command.Flags().GetBool("offline")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if outputType != "default" && outputType != "junit" && outputType != "json" {
+		return fmt.Errorf("%v is not a supported output type. Supported output types are default, junit and json", outputType)
+	}
+	reportFile, err := command.Flags().GetString("report-file")
+	if err != nil {
+		return err
+	}
+	if reportFile != "" && outputType == "default" {
+		return fmt.Errorf("--report-file requires either -o junit or -o json")
+	}
+
+	results := []triggerLintResult{}
+	filesByName := map[string]string{}
+	for _, f := range args {
+		result, trigger := lintTriggerFile(f)
+		if result.Trigger != "" {
+			if other, ok := filesByName[result.Trigger]; ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("trigger %s is also defined in %s", result.Trigger, other))
+			} else {
+				filesByName[result.Trigger] = f
+			}
+		}
+		if trigger != nil && !offline {
+			realmErrors, err := lintTriggerAgainstRealm(trigger)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			result.Errors = append(result.Errors, realmErrors...)
+		}
+		result.Valid = len(result.Errors) == 0
+		results = append(results, result)
+	}
+
+	failures := 0
+	for _, r := range results {
+		if !r.Valid {
+			failures++
+		}
+	}
+
+	var report []byte
+	switch outputType {
+	case "default":
+		for _, r := range results {
+			if r.Valid {
+				fmt.Printf("%s: ok\n", r.File)
+				continue
+			}
+			for _, e := range r.Errors {
+				fmt.Printf("%s: %s\n", r.File, e)
+			}
+		}
+	case "junit":
+		report, err = junitTriggersLintReport(results, failures)
+	case "json":
+		report, err = json.MarshalIndent(results, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if report != nil {
+		report = append(report, '\n')
+		if reportFile == "" {
+			fmt.Print(string(report))
+		} else if err := os.WriteFile(reportFile, report, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Linted %d triggers: %d valid, %d not valid\n", len(results), len(results)-failures, failures)
+	if failures > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// lintTriggerFile performs the local checks on a trigger file. The parsed trigger is returned
+// when the file is a well formed trigger, to be checked against the realm.
+func lintTriggerFile(path string) (triggerLintResult, map[string]interface{}) {
+	result := triggerLintResult{File: path}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, nil
+	}
+	trigger := map[string]interface{}{}
+	if err := json.Unmarshal(content, &trigger); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("not a valid JSON object: %s", err))
+		return result, nil
+	}
+	result.Trigger, _ = trigger["name"].(string)
+
+	// triggers.ParseTrigger supports only http actions: amqp ones are checked here, and replaced
+	// by a placeholder http action to check the rest of the trigger
+	action, _ := trigger["action"].(map[string]interface{})
+	if _, ok := action["amqp_exchange"]; ok {
+		exchange, _ := action["amqp_exchange"].(string)
+		if prefix := fmt.Sprintf("astarte_events_%s_", realm); realm != "" && !strings.HasPrefix(exchange, prefix) {
+			result.Errors = append(result.Errors, fmt.Sprintf("the AMQP exchange %s does not start with %s", exchange, prefix))
+		} else if !strings.HasPrefix(exchange, "astarte_events_") {
+			result.Errors = append(result.Errors, fmt.Sprintf("the AMQP exchange %s must be named astarte_events_<realm_name>_<suffix>", exchange))
+		}
+		if _, ok := action["amqp_message_expiration_ms"].(float64); !ok {
+			result.Errors = append(result.Errors, "the AMQP action must set amqp_message_expiration_ms")
+		}
+		if _, ok := action["amqp_message_persistent"].(bool); !ok {
+			result.Errors = append(result.Errors, "the AMQP action must set amqp_message_persistent")
+		}
+		placeholder := map[string]interface{}{}
+		for k, v := range trigger {
+			placeholder[k] = v
+		}
+		placeholder["action"] = map[string]interface{}{"http_url": "http://localhost", "http_method": "post"}
+		content, _ = json.Marshal(placeholder)
+	}
+
+	if _, err := triggers.ParseTrigger(content); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result, nil
+	}
+	return result, trigger
+}
+
+// lintTriggerAgainstRealm checks a trigger against the state of the realm, returning the reasons
+// the realm would reject it. An error is returned only when the realm cannot be queried.
+func lintTriggerAgainstRealm(trigger map[string]interface{}) ([]string, error) {
+	lintErrors := []string{}
+	simpleTriggers, _ := trigger["simple_triggers"].([]interface{})
+	for _, rawSimpleTrigger := range simpleTriggers {
+		simpleTrigger, _ := rawSimpleTrigger.(map[string]interface{})
+		interfaceName, _ := simpleTrigger["interface_name"].(string)
+		if simpleTrigger["type"] != string(triggers.DataType) || interfaceName == "" || interfaceName == "*" {
+			continue
+		}
+		major, err := json.Number(fmt.Sprint(simpleTrigger["interface_major"])).Int64()
+		if err != nil {
+			lintErrors = append(lintErrors, fmt.Sprintf("%v is not a valid interface major", simpleTrigger["interface_major"]))
+			continue
+		}
+
+		majors, err := installedInterfaceMajors(interfaceName)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, m := range majors {
+			if int64(m) == major {
+				found = true
+			}
+		}
+		if !found {
+			lintErrors = append(lintErrors, fmt.Sprintf("interface %s v%d is not installed in realm %s", interfaceName, major, realm))
+		}
+	}
+	return lintErrors, nil
+}
+
+var realmInterfaceNames map[string]bool
+var realmInterfaceMajors = map[string][]int{}
+
+// installedInterfaceMajors returns the major versions of interfaceName installed in the realm,
+// which are none when it is not installed at all
+func installedInterfaceMajors(interfaceName string) ([]int, error) {
+	if realmInterfaceNames == nil {
+		names, err := listInterfaces(astarteAPIClient, realm)
+		if err != nil {
+			return nil, err
+		}
+		realmInterfaceNames = map[string]bool{}
+		for _, n := range names {
+			realmInterfaceNames[n] = true
+		}
+	}
+	if !realmInterfaceNames[interfaceName] {
+		return nil, nil
+	}
+	if majors, ok := realmInterfaceMajors[interfaceName]; ok {
+		return majors, nil
+	}
+	majors, err := interfaceVersions(astarteAPIClient, realm, interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	realmInterfaceMajors[interfaceName] = majors
+	return majors, nil
+}
+
+func junitTriggersLintReport(results []triggerLintResult, failures int) ([]byte, error) {
+	suite := junitTestSuite{Name: "astartectl triggers lint", Tests: len(results), Failures: failures}
+	for _, r := range results {
+		testCase := junitTestCase{Name: r.File, ClassName: "triggers"}
+		if r.Trigger != "" {
+			testCase.ClassName = "triggers." + r.Trigger
+		}
+		if !r.Valid {
+			testCase.Failure = &junitFailure{Message: r.Errors[0], Text: strings.Join(r.Errors, "\n")}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	report, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), report...), nil
+}
@@ -0,0 +1,145 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/triggers"
+	"github.com/astarte-platform/astartectl/utils"
+)
+
+// triggerScope is the set of devices a trigger is evaluated for, either a device, a group or all devices
+type triggerScope struct {
+	deviceID  string
+	groupName string
+}
+
+// simpleTriggerScope returns the scope of a simple trigger. Triggers without a device nor a group,
+// or with the "*" device, apply to all the devices of the realm.
+func simpleTriggerScope(t triggers.AstarteSimpleTrigger) triggerScope {
+	if t.GroupName != "" {
+		return triggerScope{groupName: t.GroupName}
+	}
+	if t.DeviceID != "*" {
+		return triggerScope{deviceID: t.DeviceID}
+	}
+	return triggerScope{}
+}
+
+func (s triggerScope) allDevices() bool {
+	return s.deviceID == "" && s.groupName == ""
+}
+
+// matchesDevice tells whether the scope includes deviceID, which belongs to deviceGroups
+func (s triggerScope) matchesDevice(deviceID string, deviceGroups map[string]bool) bool {
+	return s.allDevices() || s.deviceID == deviceID || deviceGroups[s.groupName]
+}
+
+// matchesGroup tells whether the scope includes the devices of groupName
+func (s triggerScope) matchesGroup(groupName string) bool {
+	return s.allDevices() || s.groupName == groupName
+}
+
+// triggerMatches tells whether any of the simple triggers of trigger has a scope satisfying match
+func triggerMatches(trigger *triggers.AstarteTrigger, match func(triggerScope) bool) bool {
+	for _, t := range trigger.SimpleTriggers {
+		if match(simpleTriggerScope(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func appEngineAPIClient() (*client.Client, error) {
+	return utils.APICommandSetup(
+		map[astarteservices.AstarteService]string{astarteservices.AppEngine: "individual-urls.appengine"}, "realm.key", "realm.key-file")
+}
+
+// deviceGroups returns the groups deviceID belongs to. AppEngine does not report the groups of a device,
+// hence the devices of each group are listed.
+func deviceGroups(appEngineClient *client.Client, deviceID string) (map[string]bool, error) {
+	listGroupsCall, err := appEngineClient.ListGroups(realm)
+	if err != nil {
+		return nil, err
+	}
+	listGroupsRes, err := listGroupsCall.Run(appEngineClient)
+	if err != nil {
+		return nil, err
+	}
+	rawGroups, err := listGroupsRes.Parse()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]bool{}
+	for _, g := range rawGroups.([]string) {
+		groupDevices, err := listGroupDevices(appEngineClient, g)
+		if err != nil {
+			return nil, err
+		}
+		if groupDevices[deviceID] {
+			ret[g] = true
+		}
+	}
+	return ret, nil
+}
+
+// describeTriggerScope describes the devices in scope, resolving the aliases of a device and the size of a group.
+// Resolution failures are reported in the description, as the trigger might target a device or a group
+// which does not exist (yet).
+func describeTriggerScope(appEngineClient *client.Client, scope triggerScope) string {
+	switch {
+	case scope.allDevices():
+		return "all devices"
+	case scope.groupName != "":
+		groupDevices, err := listGroupDevices(appEngineClient, scope.groupName)
+		if err != nil {
+			return fmt.Sprintf("devices in group %s (could not list its devices: %s)", scope.groupName, oneLineError(err))
+		}
+		return fmt.Sprintf("devices in group %s (%d devices)", scope.groupName, len(groupDevices))
+	}
+
+	call, err := appEngineClient.GetDeviceDetails(realm, scope.deviceID, client.AstarteDeviceID)
+	if err != nil {
+		return fmt.Sprintf("device %s (%s)", scope.deviceID, oneLineError(err))
+	}
+	res, err := call.Run(appEngineClient)
+	if err != nil {
+		return fmt.Sprintf("device %s (could not be found: %s)", scope.deviceID, oneLineError(err))
+	}
+	rawDetails, err := res.Parse()
+	if err != nil {
+		return fmt.Sprintf("device %s (could not be found: %s)", scope.deviceID, oneLineError(err))
+	}
+	details := rawDetails.(client.DeviceDetails)
+	if len(details.Aliases) == 0 {
+		return fmt.Sprintf("device %s", scope.deviceID)
+	}
+	aliases := []string{}
+	for tag, alias := range details.Aliases {
+		aliases = append(aliases, tag+"="+alias)
+	}
+	sort.Strings(aliases)
+	return fmt.Sprintf("device %s (aliases: %s)", scope.deviceID, strings.Join(aliases, ", "))
+}
+
+// oneLineError collapses errors reported by Astarte as indented JSON into a single line
+func oneLineError(err error) string {
+	return strings.Join(strings.Fields(err.Error()), " ")
+}
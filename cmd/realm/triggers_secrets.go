@@ -0,0 +1,188 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realm
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// sensitiveNamePattern matches the names of headers and query parameters holding secrets
+	sensitiveNamePattern = regexp.MustCompile(`(?i)auth|token|secret|passw|key|cookie|credential|signature`)
+	// triggerSecretPlaceholderPattern matches the placeholders of redacted secrets, e.g. ${my_trigger.http_static_headers.Authorization}
+	triggerSecretPlaceholderPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+)
+
+// triggerSecretPlaceholder returns the placeholder replacing the secret identified by key
+func triggerSecretPlaceholder(key string) string {
+	return "${" + key + "}"
+}
+
+// redactTriggerSecrets replaces the secrets in the action of trigger with placeholders, and returns
+// them by placeholder key. Secrets are the password in the http_url, and the values of query parameters,
+// http_static_headers and amqp_static_headers whose name suggests they hold credentials.
+func redactTriggerSecrets(trigger map[string]interface{}) (map[string]string, error) {
+	secrets := map[string]string{}
+	name, _ := trigger["name"].(string)
+	action, _ := trigger["action"].(map[string]interface{})
+
+	for _, field := range []string{"http_static_headers", "amqp_static_headers"} {
+		headers, _ := action[field].(map[string]interface{})
+		for header, rawValue := range headers {
+			value, ok := rawValue.(string)
+			if !ok || value == "" || !sensitiveNamePattern.MatchString(header) {
+				continue
+			}
+			key := fmt.Sprintf("%s.%s.%s", name, field, header)
+			secrets[key] = value
+			headers[header] = triggerSecretPlaceholder(key)
+		}
+	}
+
+	rawURL, _ := action["http_url"].(string)
+	if rawURL == "" {
+		return secrets, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("trigger %s has an invalid http_url: %w", name, err)
+	}
+	redacted := false
+	// Placeholders are added to the URL as they are, as escaping would break them
+	query := []string{}
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		paramName, paramValue, _ := strings.Cut(param, "=")
+		if unescapedName, err := url.QueryUnescape(paramName); err == nil && paramValue != "" && sensitiveNamePattern.MatchString(unescapedName) {
+			key := fmt.Sprintf("%s.http_url.query.%s", name, unescapedName)
+			if secrets[key], err = url.QueryUnescape(paramValue); err != nil {
+				return nil, fmt.Errorf("trigger %s has an invalid http_url: %w", name, err)
+			}
+			param = paramName + "=" + triggerSecretPlaceholder(key)
+			redacted = true
+		}
+		query = append(query, param)
+	}
+	u.RawQuery = ""
+	password, hasPassword := "", false
+	if u.User != nil {
+		password, hasPassword = u.User.Password()
+	}
+	username := ""
+	if hasPassword && password != "" {
+		username = u.User.Username()
+		u.User = nil
+		redacted = true
+	}
+	if !redacted {
+		return secrets, nil
+	}
+
+	redactedURL := u.String()
+	if hasPassword && password != "" {
+		key := fmt.Sprintf("%s.http_url.password", name)
+		secrets[key] = password
+		scheme := u.Scheme + "://"
+		redactedURL = scheme + url.User(username).String() + ":" + triggerSecretPlaceholder(key) + "@" + strings.TrimPrefix(redactedURL, scheme)
+	}
+	if len(query) > 0 && query[0] != "" {
+		// Keep the fragment, if any, after the query
+		base, fragment, hasFragment := strings.Cut(redactedURL, "#")
+		redactedURL = base + "?" + strings.Join(query, "&")
+		if hasFragment {
+			redactedURL += "#" + fragment
+		}
+	}
+	action["http_url"] = redactedURL
+	return secrets, nil
+}
+
+// injectTriggerSecrets replaces the placeholders in the action of trigger with the values of the
+// secrets they stand for. Values injected in the http_url are escaped. An error listing the missing
+// values is returned when any placeholder has no value.
+func injectTriggerSecrets(trigger map[string]interface{}, values map[string]string) error {
+	action, _ := trigger["action"].(map[string]interface{})
+	missing := map[string]bool{}
+	inject := func(s string, escape func(string) string) string {
+		return triggerSecretPlaceholderPattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+			key := triggerSecretPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+			value, ok := values[key]
+			if !ok {
+				missing[key] = true
+				return placeholder
+			}
+			return escape(value)
+		})
+	}
+
+	for _, field := range []string{"http_static_headers", "amqp_static_headers"} {
+		headers, _ := action[field].(map[string]interface{})
+		for header, rawValue := range headers {
+			if value, ok := rawValue.(string); ok {
+				headers[header] = inject(value, func(v string) string { return v })
+			}
+		}
+	}
+	if rawURL, ok := action["http_url"].(string); ok {
+		action["http_url"] = triggerSecretPlaceholderPattern.ReplaceAllStringFunc(rawURL, func(placeholder string) string {
+			escape := url.QueryEscape
+			if strings.HasSuffix(placeholder, ".http_url.password}") {
+				escape = func(v string) string { return strings.TrimPrefix(url.UserPassword("", v).String(), ":") }
+			}
+			return inject(placeholder, escape)
+		})
+	}
+
+	if len(missing) > 0 {
+		keys := []string{}
+		for k := range missing {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		name, _ := trigger["name"].(string)
+		return fmt.Errorf("trigger %s has redacted secrets with no value: %s", name, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// loadTriggerSecretValues reads the values of redacted secrets from a YAML (or JSON) file mapping
+// placeholder keys to values
+func loadTriggerSecretValues(valuesFile string) (map[string]string, error) {
+	contents, err := os.ReadFile(valuesFile)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return nil, fmt.Errorf("%s is not a valid values file: %w", valuesFile, err)
+	}
+	return values, nil
+}
+
+// saveTriggerSecretValues writes secrets to valuesFile, in the format read by loadTriggerSecretValues.
+// As it holds credentials, the file is readable by its owner only.
+func saveTriggerSecretValues(valuesFile string, secrets map[string]string) error {
+	contents, err := yaml.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(valuesFile, contents, 0600)
+}
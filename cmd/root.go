@@ -18,21 +18,27 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/astarte-platform/astartectl/cmd/appengine"
 	"github.com/astarte-platform/astartectl/cmd/cluster"
 	configcmd "github.com/astarte-platform/astartectl/cmd/config"
+	"github.com/astarte-platform/astartectl/cmd/flow"
 	"github.com/astarte-platform/astartectl/cmd/housekeeping"
 	"github.com/astarte-platform/astartectl/cmd/pairing"
 	"github.com/astarte-platform/astartectl/cmd/realm"
 	"github.com/astarte-platform/astartectl/cmd/utils"
 	"github.com/astarte-platform/astartectl/config"
+	astartectlutils "github.com/astarte-platform/astartectl/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var cfgContext string
+var (
+	cfgContext string
+	cfgCluster string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -49,7 +55,10 @@ See below for usage details`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	astartectlutils.FlushCurlScript()
+	astartectlutils.StopPager()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -61,16 +70,54 @@ func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
-	rootCmd.PersistentFlags().String("config-dir", "", fmt.Sprintf("config directory (default is %s)", config.GetDefaultConfigDir()))
-	rootCmd.PersistentFlags().StringVar(&cfgContext, "context", "", "Configuration context to use. When not specified, defaults to current context.")
+	rootCmd.PersistentFlags().String("config-dir", "", fmt.Sprintf("config directory (default is %s). Several directories separated by %q are stacked: entries missing from the first one are looked for in the following ones.", config.GetDefaultConfigDir(), string(os.PathListSeparator)))
+	rootCmd.PersistentFlags().String("config-profile", "", fmt.Sprintf("Configuration profile to use, with its own clusters and contexts in %s/<profile>", config.GetConfigProfilesDir()))
+	_ = rootCmd.RegisterFlagCompletionFunc("config-profile", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		profiles, _ := config.ListConfigProfiles()
+		return profiles, cobra.ShellCompDirectiveNoFileComp
+	})
+	rootCmd.PersistentFlags().StringVar(&cfgContext, "context", "", "Configuration context to use. When not specified, defaults to current context. The current context is not changed.")
+	_ = rootCmd.RegisterFlagCompletionFunc("context", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Positional arguments are not relevant to the flag
+		return astartectlutils.ContextNamesCompletion(cmd, nil, toComplete)
+	})
+	rootCmd.PersistentFlags().StringVar(&cfgCluster, "use-cluster", "", "Configuration cluster to use, rather than the one of the context. It can be used without any context, e.g. for Housekeeping commands.")
+	_ = rootCmd.RegisterFlagCompletionFunc("use-cluster", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return astartectlutils.ClusterNamesCompletion(cmd, nil, toComplete)
+	})
 	rootCmd.PersistentFlags().StringP("astarte-url", "u", "", "Base url for your Astarte deployment (e.g. https://api.astarte.example.com)")
 	rootCmd.PersistentFlags().StringP("token", "t", "", "Token for authenticating against Astarte APIs. When set, it takes precedence over any private key setting. Claims in the token have to match the permissions needed for the individual command.")
 	rootCmd.PersistentFlags().Bool("ignore-ssl-errors", false, "When set, ignore SSL errors towards the Astarte APIs.")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "The maximum time for each request to the Astarte APIs, including its retries and the download of the response. 0 means no timeout, which suits long downloads and streams.")
+	rootCmd.PersistentFlags().Int("retries", 3, "How many times failed read-only requests to the Astarte APIs are retried, when the failure may be transient (connection errors, 5xx).")
+	rootCmd.PersistentFlags().Duration("retry-backoff", 500*time.Millisecond, "The time to wait before the first retry. It doubles at each retry, with some random jitter.")
+	rootCmd.PersistentFlags().Float64("max-rps", 0, "The maximum number of requests per second to the Astarte APIs, useful for bulk operations on large realms. 0 means no limit.")
+	rootCmd.PersistentFlags().Bool("debug-http", false, "Log each request to the Astarte APIs, with its status and duration, to stderr. The values of headers which may hold credentials (e.g. Authorization, API keys, cookies) are redacted.")
+	rootCmd.PersistentFlags().StringSlice("header", nil, "A header added to each request to the Astarte APIs, in the form key=value, e.g. for API gateways requiring tenant IDs or API keys. Can be specified multiple times.")
+	rootCmd.PersistentFlags().String("user-agent", "", "The User-Agent of requests to the Astarte APIs.")
+	rootCmd.PersistentFlags().Bool("no-pager", false, "Do not pipe long output through $PAGER, even when stdout is a terminal.")
+	rootCmd.PersistentFlags().String("time-zone", "", "The time zone timestamps are rendered in: utc, local or a time zone name such as Europe/Rome. When not set, timestamps are rendered as returned by Astarte.")
+	rootCmd.PersistentFlags().String("time-format", "", "The format of rendered timestamps: rfc3339, rfc3339nano, unix, unixmilli or a Go time layout. When not set, each output uses its own format.")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Print lists (e.g. of devices, interfaces, triggers) as one item per line, for use in shell pipelines.")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Answer yes to all questions, and use default values rather than prompting for them, to run commands unattended.")
+	rootCmd.PersistentFlags().String("config-storage", "", "Where contexts and clusters are stored. Either directory or kubernetes-secret (default is directory)")
+	rootCmd.PersistentFlags().String("config-secret-namespace", "", "The namespace of the Secret holding the configuration, when using kubernetes-secret config storage (default is default)")
+	rootCmd.PersistentFlags().String("config-secret-name", "", "The name of the Secret holding the configuration, when using kubernetes-secret config storage (default is astartectl-config)")
 
 	if err := viper.BindPFlag("config-dir", rootCmd.PersistentFlags().Lookup("config-dir")); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	for _, flag := range []string{"no-pager", "quiet", "time-zone", "time-format", "yes", "config-profile", "config-storage", "config-secret-namespace", "config-secret-name", "timeout", "retries", "retry-backoff", "max-rps", "debug-http", "user-agent"} {
+		if err := viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if err := viper.BindPFlag("headers", rootCmd.PersistentFlags().Lookup("header")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	if err := viper.BindPFlag("url", rootCmd.PersistentFlags().Lookup("astarte-url")); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -91,11 +138,21 @@ func init() {
 	rootCmd.AddCommand(appengine.AppEngineCmd)
 	rootCmd.AddCommand(cluster.ClusterCmd)
 	rootCmd.AddCommand(configcmd.ConfigCmd)
+	rootCmd.AddCommand(flow.FlowCmd)
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	if err := config.ConfigureViper(cfgContext); err != nil {
+	if err := config.ValidateConfigProfile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := config.ConfigureViper(cfgContext, cfgCluster); err != nil {
+		// A context or cluster given explicitly must exist, or the command would run against the wrong one
+		if cfgContext != "" || cfgCluster != "" {
+			fmt.Fprintf(os.Stderr, "Error while loading configuration: %s\n", err.Error())
+			os.Exit(1)
+		}
 		// If the config does not exist, do not warn - it's simply not there.
 		if _, ok := err.(*os.PathError); !ok {
 			fmt.Fprintf(os.Stderr, "warn: Error while loading configuration: %s\n", err.Error())
@@ -106,4 +163,51 @@ func initConfig() {
 	viper.SetEnvKeyReplacer(replacer)
 	viper.SetEnvPrefix("astartectl")
 	viper.AutomaticEnv() // read in environment variables that match
+	if err := config.BindEnvironment(); err != nil {
+		fmt.Fprintf(os.Stderr, "warn: Error while binding environment variables: %s\n", err.Error())
+	}
+	applyContextDefaults()
+
+	if err := astartectlutils.ValidateTimestampSettings(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := astartectlutils.ValidateCustomHeaders(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// applyContextDefaults sets the flags of the command being run which were not given on the command line
+// to the defaults of the current context, if any. Flags which are not defined by the command are ignored,
+// so that defaults can be shared by commands having only some of them.
+// Defaults are meant for commands working with the context, hence they are not applied to config and
+// cluster commands, where some flags have a different meaning (e.g. --output is a file).
+func applyContextDefaults() {
+	defaults := viper.GetStringMapString("defaults")
+	if len(defaults) == 0 {
+		return
+	}
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil {
+		return
+	}
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		if c == configcmd.ConfigCmd || c == cluster.ClusterCmd {
+			return
+		}
+	}
+	for name, value := range defaults {
+		// Defaults stored before some flags were rejected by set-default are ignored
+		if !configcmd.CanHaveDefault(name) {
+			continue
+		}
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			fmt.Fprintf(os.Stderr, "warn: Invalid default %s for --%s in the current context: %s\n", value, name, err)
+		}
+	}
 }
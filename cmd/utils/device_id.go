@@ -15,9 +15,11 @@
 package utils
 
 import (
+	"bufio"
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/astarte-platform/astarte-go/deviceid"
 
@@ -79,6 +81,23 @@ This command is guaranteed to return always the same ID upon providing the same
 	RunE:    computeDeviceIDFromBytesF,
 }
 
+var generateDeviceIDFromNameCmd = &cobra.Command{
+	Use:   "generate-from-name <namespace_uuid> <name> [name]...",
+	Short: "Generates deterministic Astarte device IDs from names, such as serial numbers",
+	Long: `Generates a deterministic Astarte device ID for each name, such as a serial number, using a namespace.
+
+This is the same as compute-from-string, meant for provisioning pipelines: a UUIDv5 is generated from the
+namespace and each name, and it's then encoded into a valid Astarte Device ID, hence the same name always results
+in the same ID. Device IDs are printed one per line, in the same order as names.
+
+When name is -, names are read from stdin, one per line. With --with-names, each line is in the form
+<name>,<device_id>.`,
+	Example: `  astartectl utils device-id generate-from-name f79ad91f-c638-4889-ae74-9d001a3b4cf8 SN-000123
+  cat serials.txt | astartectl utils device-id generate-from-name f79ad91f-c638-4889-ae74-9d001a3b4cf8 - --with-names`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: generateDeviceIDFromNameF,
+}
+
 var toUUIDDeviceIDCmd = &cobra.Command{
 	Use:   "to-uuid <device_id>",
 	Short: "Prints the UUID representation of a device ID",
@@ -90,9 +109,9 @@ This is useful to interact with Cassandra, where the Device ID is saved as UUID.
 }
 
 var fromUUIDDeviceIDCmd = &cobra.Command{
-	Use:   "from-uuid <device_id>",
+	Use:   "from-uuid <uuid>",
 	Short: "Prints the Device ID representation of the given UUID",
-	Long: `Prints the Device ID representation of the given UUID",
+	Long: `Prints the Device ID representation of the given UUID.
 This is useful to interact with Cassandra, where the Device ID is saved as UUID.`,
 	Example: `  astartectl utils device-id from-uuid d93067fa-3344-4aeb-876a-6136668d5a9c`,
 	Args:    cobra.ExactArgs(1),
@@ -100,6 +119,8 @@ This is useful to interact with Cassandra, where the Device ID is saved as UUID.
 }
 
 func init() {
+	generateDeviceIDFromNameCmd.Flags().Bool("with-names", false, "When set, prints each device ID along with its name, as <name>,<device_id>.")
+
 	UtilsCmd.AddCommand(deviceIDCmd)
 
 	deviceIDCmd.AddCommand(
@@ -107,6 +128,7 @@ func init() {
 		generateRandomDeviceIDCmd,
 		computeDeviceIDFromStringCmd,
 		computeDeviceIDFromBytesCmd,
+		generateDeviceIDFromNameCmd,
 		toUUIDDeviceIDCmd,
 		fromUUIDDeviceIDCmd,
 	)
@@ -163,6 +185,48 @@ func computeDeviceIDFromBytesF(command *cobra.Command, args []string) error {
 	return nil
 }
 
+func generateDeviceIDFromNameF(command *cobra.Command, args []string) error {
+	namespaceUUID := args[0]
+	if _, err := uuid.Parse(namespaceUUID); err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not a valid UUID\n", namespaceUUID)
+		os.Exit(1)
+	}
+	withNames, err := command.Flags().GetBool("with-names")
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, name := range args[1:] {
+		if name != "-" {
+			names = append(names, name)
+			continue
+		}
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				names = append(names, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		deviceID, err := deviceid.Generate(namespaceUUID, []byte(name))
+		if err != nil {
+			return err
+		}
+		if withNames {
+			fmt.Printf("%s,%s\n", name, deviceID)
+		} else {
+			fmt.Println(deviceID)
+		}
+	}
+	return nil
+}
+
 func toUUIDDeviceIDF(command *cobra.Command, args []string) error {
 	deviceID := args[0]
 	if !deviceid.IsValid(deviceID) {
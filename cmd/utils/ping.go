@@ -0,0 +1,134 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astarte-platform/astartectl/utils"
+	"github.com/spf13/cobra"
+)
+
+var pingCmd = &cobra.Command{
+	Use:   "ping",
+	Short: "Checks whether Astarte APIs are up",
+	Long: `Checks whether the Astarte APIs of the current context are up, by querying their health endpoint, and
+reports the status and latency of each one of them. Services which are not reachable are reported as down.
+
+Returns 0 if all services are healthy, 1 otherwise.`,
+	Example: `  astartectl utils ping`,
+	Args:    cobra.NoArgs,
+	RunE:    pingF,
+}
+
+// pingedServices maps Astarte services to their individual URL setting and their path under the Astarte URL
+var pingedServices = []struct {
+	Name          string
+	URLVariable   string
+	DefaultPrefix string
+}{
+	{"appengine", "individual-urls.appengine", "appengine"},
+	{"realm-management", "individual-urls.realm-management", "realmmanagement"},
+	{"pairing", "individual-urls.pairing", "pairing"},
+	{"housekeeping", "individual-urls.housekeeping", "housekeeping"},
+	{"flow", "individual-urls.flow", "flow"},
+}
+
+// serviceHealth is the result of pinging a service
+type serviceHealth struct {
+	Service   string `json:"service"`
+	URL       string `json:"url"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Healthy   bool   `json:"healthy"`
+}
+
+func init() {
+	pingCmd.Flags().Duration("probe-timeout", 5*time.Second, "The maximum time to wait for each service. Requests are never retried.")
+	pingCmd.Flags().StringP("output", "o", "default", "The type of output (default,json)")
+
+	UtilsCmd.AddCommand(pingCmd)
+}
+
+func pingF(command *cobra.Command, args []string) error {
+	timeout, err := command.Flags().GetDuration("probe-timeout")
+	if err != nil {
+		return err
+	}
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	if outputType != "default" && outputType != "json" {
+		return fmt.Errorf("%s is not a supported output type. Supported output types are default and json", outputType)
+	}
+
+	httpClient := utils.NewProbeHTTPClient(timeout)
+
+	results := []serviceHealth{}
+	allHealthy := true
+	for _, service := range pingedServices {
+		serviceURL, err := utils.ServiceURL(service.URLVariable, service.DefaultPrefix)
+		if err != nil {
+			return err
+		}
+		serviceURL.Path = path.Join(serviceURL.Path, "health")
+		result := serviceHealth{Service: service.Name, URL: serviceURL.String()}
+
+		start := time.Now()
+		res, err := httpClient.Get(serviceURL.String())
+		result.LatencyMs = time.Since(start).Milliseconds()
+		if urlErr := (*url.Error)(nil); errors.As(err, &urlErr) {
+			// The URL is already reported
+			result.Status = fmt.Sprintf("down (%s)", urlErr.Err)
+		} else if err != nil {
+			result.Status = fmt.Sprintf("down (%s)", err)
+		} else {
+			res.Body.Close()
+			result.Status = res.Status
+			result.Healthy = res.StatusCode == http.StatusOK
+		}
+		allHealthy = allHealthy && result.Healthy
+		results = append(results, result)
+	}
+
+	if outputType == "json" {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tURL\tSTATUS\tLATENCY")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%dms\n", r.Service, r.URL, r.Status, r.LatencyMs)
+		}
+		w.Flush()
+	}
+
+	if !allHealthy {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astarte-go/deviceid"
+	"github.com/astarte-platform/astarte-go/interfaces"
+	"github.com/astarte-platform/astartectl/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var simulateDeviceCmd = &cobra.Command{
+	Use:   "simulate-device --interfaces-dir <directory>",
+	Short: "Simulate a device publishing synthetic data",
+	Long: `Register a temporary device, connect it to the broker of the realm through mutual TLS with credentials
+obtained from Pairing API, and publish synthetic data on its device-owned interfaces every --interval: an end
+to end smoke test of the whole ingestion path.
+
+Interfaces are read from the JSON files in --interfaces-dir, and they must be installed in the realm. By
+default, data is published on all device-owned interfaces, use --interface to select some of them.
+The device is registered with a random Device ID, which is printed on startup. It is unregistered when the
+simulation stops, also when it is interrupted or fails, unless --keep-device is set.`,
+	Example: `  astartectl utils simulate-device --interfaces-dir ./interfaces --interval 5s
+  astartectl utils simulate-device --interfaces-dir ./interfaces --interface com.example.Sensors --count 10`,
+	Args: cobra.NoArgs,
+	RunE: simulateDeviceF,
+}
+
+var endpointParameterRegexp = regexp.MustCompile(`%{[^}]+}`)
+
+func init() {
+	simulateDeviceCmd.Flags().String("interfaces-dir", "", "The directory containing the interfaces of the device.")
+	_ = simulateDeviceCmd.MarkFlagRequired("interfaces-dir")
+	_ = simulateDeviceCmd.MarkFlagDirname("interfaces-dir")
+	simulateDeviceCmd.Flags().StringSlice("interface", nil, "The device-owned interfaces to publish data on. Defaults to all of them.")
+	simulateDeviceCmd.Flags().Duration("interval", 5*time.Second, "The interval between data publications.")
+	simulateDeviceCmd.Flags().Int("count", 0, "How many times data is published before stopping. 0 means until interrupted.")
+	simulateDeviceCmd.Flags().Bool("keep-device", false, "When set, the device is not unregistered when the simulation stops, so that it can be inspected afterwards.")
+	simulateDeviceCmd.Flags().StringP("realm-name", "r", "", "The name of the realm the device is registered in")
+	simulateDeviceCmd.Flags().StringP("realm-key", "k", "", "Path to realm private key used to register the device")
+	_ = simulateDeviceCmd.MarkFlagFilename("realm-key")
+	_ = simulateDeviceCmd.RegisterFlagCompletionFunc("realm-name", utils.RealmNamesCompletion)
+
+	UtilsCmd.AddCommand(simulateDeviceCmd)
+}
+
+func simulateDeviceF(command *cobra.Command, args []string) error {
+	interfacesDir, err := command.Flags().GetString("interfaces-dir")
+	if err != nil {
+		return err
+	}
+	selectedInterfaces, err := command.Flags().GetStringSlice("interface")
+	if err != nil {
+		return err
+	}
+	interval, err := command.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	count, err := command.Flags().GetInt("count")
+	if err != nil {
+		return err
+	}
+	keepDevice, err := command.Flags().GetBool("keep-device")
+	if err != nil {
+		return err
+	}
+	_ = viper.BindPFlag("realm.name", command.Flags().Lookup("realm-name"))
+	_ = viper.BindPFlag("realm.key-file", command.Flags().Lookup("realm-key"))
+	realm := viper.GetString("realm.name")
+	if realm == "" {
+		return errors.New("realm is required")
+	}
+
+	simulatedInterfaces, err := loadSimulatedInterfaces(interfacesDir, selectedInterfaces)
+	if err != nil {
+		return err
+	}
+
+	// Registration
+	pairingClient, err := utils.APICommandSetup(
+		map[astarteservices.AstarteService]string{astarteservices.Pairing: "individual-urls.pairing"}, "realm.key", "realm.key-file")
+	if err != nil {
+		return err
+	}
+	deviceID, err := deviceid.GenerateRandom()
+	if err != nil {
+		return err
+	}
+	registerDeviceCall, err := pairingClient.RegisterDevice(realm, deviceID)
+	if err != nil {
+		return err
+	}
+	registerDeviceRes, err := registerDeviceCall.Run(pairingClient)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	credentialsSecret, err := registerDeviceRes.Parse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Registered device %s in realm %s\n", deviceID, realm)
+
+	// From now on, the device is unregistered however the simulation ends
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	simulationErr := simulateDevice(ctx, realm, deviceID, fmt.Sprintf("%v", credentialsSecret), simulatedInterfaces, interval, count)
+	if simulationErr != nil {
+		fmt.Fprintln(os.Stderr, simulationErr)
+	}
+	if !keepDevice {
+		if err := unregisterSimulatedDevice(pairingClient, realm, deviceID); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not unregister device %s: %s\n", deviceID, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Unregistered device %s\n", deviceID)
+	}
+	if simulationErr != nil {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// simulateDevice connects the registered device deviceID to its broker and publishes synthetic data on
+// simulatedInterfaces every interval, count times or until ctx is done
+func simulateDevice(ctx context.Context, realm, deviceID, credentialsSecret string, simulatedInterfaces []interfaces.AstarteInterface,
+	interval time.Duration, count int) error {
+	// Credentials
+	deviceClient, err := utils.NewDevicePairingClient(credentialsSecret)
+	if err != nil {
+		return err
+	}
+	privateKey, certificate, err := utils.ObtainDeviceCertificate(deviceClient, realm, deviceID)
+	if err != nil {
+		return err
+	}
+	keyPair, err := tls.X509KeyPair(certificate, privateKey)
+	if err != nil {
+		return err
+	}
+	brokerURL, err := utils.DeviceBrokerURL(deviceClient, realm, deviceID)
+	if err != nil {
+		return err
+	}
+
+	// Connection
+	topicRoot := path.Join(realm, deviceID)
+	mqttOptions := mqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(topicRoot).
+		SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{keyPair}, InsecureSkipVerify: viper.GetBool("ignore-ssl-errors")}).
+		SetConnectTimeout(10 * time.Second).
+		SetAutoReconnect(false)
+	mqttClient := mqtt.NewClient(mqttOptions)
+	if err := waitMQTT(mqttClient.Connect()); err != nil {
+		return fmt.Errorf("Could not connect to %s: %w", brokerURL, err)
+	}
+	defer mqttClient.Disconnect(250)
+	fmt.Printf("Connected to %s\n", brokerURL)
+
+	introspection := []string{}
+	for _, i := range simulatedInterfaces {
+		introspection = append(introspection, fmt.Sprintf("%s:%d:%d", i.Name, i.MajorVersion, i.MinorVersion))
+	}
+	if err := waitMQTT(mqttClient.Publish(topicRoot, 2, false, strings.Join(introspection, ";"))); err != nil {
+		return fmt.Errorf("Could not publish the introspection: %w", err)
+	}
+	if err := waitMQTT(mqttClient.Publish(topicRoot+"/control/emptyCache", 2, false, "1")); err != nil {
+		return fmt.Errorf("Could not publish emptyCache: %w", err)
+	}
+
+	// Publication
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 0; count == 0 || n < count; n++ {
+		if n > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				fmt.Println("Simulation stopped")
+				return nil
+			}
+		}
+		for _, i := range simulatedInterfaces {
+			for _, m := range simulatedMessages(i, n) {
+				payload, err := bson.Marshal(m.payload)
+				if err != nil {
+					return err
+				}
+				if err := waitMQTT(mqttClient.Publish(topicRoot+"/"+i.Name+m.path, m.qos, false, payload)); err != nil {
+					return fmt.Errorf("Could not publish on %s%s: %w", i.Name, m.path, err)
+				}
+				fmt.Printf("%s %s%s %v\n", time.Now().Format(time.RFC3339), i.Name, m.path, m.payload["v"])
+			}
+		}
+	}
+	return nil
+}
+
+func unregisterSimulatedDevice(pairingClient *client.Client, realm, deviceID string) error {
+	unregisterDeviceCall, err := pairingClient.UnregisterDevice(realm, deviceID)
+	if err != nil {
+		return err
+	}
+	unregisterDeviceRes, err := unregisterDeviceCall.Run(pairingClient)
+	if err != nil {
+		return err
+	}
+	_, err = unregisterDeviceRes.Parse()
+	return err
+}
+
+// loadSimulatedInterfaces returns the device-owned interfaces in dir, restricted to selected when it is not empty
+func loadSimulatedInterfaces(dir string, selected []string) ([]interfaces.AstarteInterface, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	ret := []interfaces.AstarteInterface{}
+	found := map[string]bool{}
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var iface interfaces.AstarteInterface
+		if err := json.Unmarshal(content, &iface); err != nil || iface.Name == "" {
+			fmt.Fprintf(os.Stderr, "warn: %s is not a valid interface, skipping it\n", f)
+			continue
+		}
+		if iface.Ownership != interfaces.DeviceOwnership {
+			continue
+		}
+		if len(selected) > 0 && !contains(selected, iface.Name) {
+			continue
+		}
+		found[iface.Name] = true
+		ret = append(ret, iface)
+	}
+
+	for _, s := range selected {
+		if !found[s] {
+			return nil, fmt.Errorf("No device-owned interface %s found in %s", s, dir)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("No device-owned interfaces found in %s", dir)
+	}
+	return ret, nil
+}
+
+type simulatedMessage struct {
+	path    string
+	qos     byte
+	payload bson.M
+}
+
+// simulatedMessages returns the messages published on iface at the n-th iteration. Endpoint parameters
+// are replaced with "sim", and object aggregated interfaces are published as a single object.
+func simulatedMessages(iface interfaces.AstarteInterface, n int) []simulatedMessage {
+	if len(iface.Mappings) == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	if iface.Aggregation == interfaces.ObjectAggregation {
+		object := bson.M{}
+		basePath := ""
+		for _, m := range iface.Mappings {
+			endpoint := endpointParameterRegexp.ReplaceAllString(m.Endpoint, "sim")
+			basePath = path.Dir(endpoint)
+			object[path.Base(endpoint)] = simulatedValue(m.Type, n)
+		}
+		if basePath == "/" {
+			basePath = ""
+		}
+		first := iface.Mappings[0]
+		payload := bson.M{"v": object}
+		if first.ExplicitTimestamp {
+			payload["t"] = now
+		}
+		return []simulatedMessage{{path: basePath, qos: reliabilityQoS(first.Reliability), payload: payload}}
+	}
+
+	ret := []simulatedMessage{}
+	for _, m := range iface.Mappings {
+		payload := bson.M{"v": simulatedValue(m.Type, n)}
+		qos := byte(2)
+		if iface.Type == interfaces.DatastreamType {
+			qos = reliabilityQoS(m.Reliability)
+			if m.ExplicitTimestamp {
+				payload["t"] = now
+			}
+		}
+		ret = append(ret, simulatedMessage{
+			path:    endpointParameterRegexp.ReplaceAllString(m.Endpoint, "sim"),
+			qos:     qos,
+			payload: payload,
+		})
+	}
+	return ret
+}
+
+func reliabilityQoS(reliability interfaces.AstarteMappingReliability) byte {
+	switch reliability {
+	case interfaces.GuaranteedReliability:
+		return 1
+	case interfaces.UniqueReliability:
+		return 2
+	}
+	return 0
+}
+
+// simulatedValue returns a synthetic value of the given type for the n-th iteration: numbers follow a
+// sine wave, so that they are easy to recognize on a chart
+func simulatedValue(mappingType interfaces.AstarteMappingType, n int) interface{} {
+	wave := math.Sin(float64(n) / 5)
+	switch mappingType {
+	case interfaces.Double:
+		return math.Round((20+5*wave)*100) / 100
+	case interfaces.Integer:
+		return int32(math.Round(50 + 50*wave))
+	case interfaces.LongInteger:
+		return int64(n)
+	case interfaces.Boolean:
+		return n%2 == 0
+	case interfaces.String:
+		return fmt.Sprintf("sample-%d", n)
+	case interfaces.BinaryBlob:
+		return []byte(fmt.Sprintf("sample-%d", n))
+	case interfaces.DateTime:
+		return time.Now()
+	}
+
+	// Arrays hold a few values of the element type
+	if elementType := interfaces.AstarteMappingType(strings.TrimSuffix(string(mappingType), "array")); elementType != mappingType {
+		ret := []interface{}{}
+		for i := 0; i < 3; i++ {
+			ret = append(ret, simulatedValue(elementType, n+i))
+		}
+		return ret
+	}
+	return nil
+}
+
+func waitMQTT(token mqtt.Token) error {
+	if !token.WaitTimeout(30 * time.Second) {
+		return errors.New("timed out")
+	}
+	return token.Error()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -19,8 +19,8 @@ import (
 
 	"github.com/astarte-platform/astarte-go/astarteservices"
 	"github.com/astarte-platform/astarte-go/auth"
-	"github.com/astarte-platform/astartectl/config"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -229,33 +229,18 @@ func genJwtF(command *cobra.Command, args []string) error {
 	}
 
 	if privateKey == "" {
-		// In this case, retrieve the key from the context
-		c, err := config.LoadBaseConfiguration(config.GetConfigDir())
-		if err != nil {
-			return err
-		}
-
-		context, err := config.LoadContextConfiguration(config.GetConfigDir(), c.CurrentContext)
-		if err != nil {
-			return err
-		}
-
+		// In this case, retrieve the key from the context in use and its cluster
 		var loadedKey string
 		if !shouldUseHousekeepingKey {
-			if context.Realm.Key == "" {
+			loadedKey = viper.GetString("realm.key")
+			if loadedKey == "" {
 				return errors.New("private key not provided, and current context doesn't have a private realm key")
 			}
-			loadedKey = context.Realm.Key
 		} else {
-			cluster, err := config.LoadClusterConfiguration(config.GetConfigDir(), context.Cluster)
-			if err != nil {
-				return err
-			}
-
-			if cluster.Housekeeping.Key == "" {
+			loadedKey = viper.GetString("housekeeping.key")
+			if loadedKey == "" {
 				return errors.New("private key not provided, and current context doesn't have a private housekeeping key")
 			}
-			loadedKey = cluster.Housekeeping.Key
 		}
 
 		decoded, err := base64.StdEncoding.DecodeString(loadedKey)
@@ -16,8 +16,6 @@ package config
 
 import (
 	"gopkg.in/yaml.v2"
-	"os"
-	"path"
 )
 
 const baseConfigName = "astartectl"
@@ -26,16 +24,16 @@ const baseConfigName = "astartectl"
 type BaseConfigFile struct {
 	// CurrentContext represents the context which should be used when no context is explicitly specified
 	CurrentContext string `yaml:"context" json:"context"`
+	// PreviousContext is the context which was current before CurrentContext, to switch back to it
+	PreviousContext string `yaml:"previous-context,omitempty" json:"previous-context,omitempty"`
+	// CredentialStore is where private keys and tokens are kept, either plaintext or keyring. Defaults to plaintext
+	CredentialStore string `yaml:"credential-store,omitempty" json:"credential-store,omitempty"`
 }
 
 // LoadBaseConfiguration loads the base configuration from a config directory
 func LoadBaseConfiguration(configDir string) (BaseConfigFile, error) {
-	if configDir == "" {
-		configDir = GetDefaultConfigDir()
-	}
-
 	config := BaseConfigFile{}
-	contents, err := loadYamlFile(configDir, baseConfigName)
+	contents, err := GetStorage(configDir).Load(RootSection, baseConfigName)
 	if err != nil {
 		return config, err
 	}
@@ -45,18 +43,10 @@ func LoadBaseConfiguration(configDir string) (BaseConfigFile, error) {
 
 // SaveBaseConfiguration saves the base configuration in a config directory
 func SaveBaseConfiguration(configDir string, configuration BaseConfigFile) error {
-	if configDir == "" {
-		configDir = GetDefaultConfigDir()
-	}
-
-	if err := ensureConfigDirectoryStructure(configDir); err != nil {
-		return err
-	}
-
 	contents, err := yaml.Marshal(configuration)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path.Join(configDir, baseConfigName+".yaml"), contents, 0644)
+	return GetStorage(configDir).Save(RootSection, baseConfigName, contents, true)
 }
@@ -14,6 +14,10 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 // Bundle represents a bundle encapsulating all configuration files
 type Bundle struct {
 	// BaseConfig is the base config for astartectl
@@ -114,8 +118,60 @@ func LoadBundleToDirectory(bundle Bundle, configDir string, clusters, contexts [
 		}
 	}
 
-	// Then main conf
-	return SaveBaseConfiguration(configDir, bundle.BaseConfig)
+	// Then main conf. The credential store is a local setting, hence it is kept as is
+	baseConfig := bundle.BaseConfig
+	baseConfig.CredentialStore = ""
+	if existingBaseConfig, err := LoadBaseConfiguration(configDir); err == nil {
+		baseConfig.CredentialStore = existingBaseConfig.CredentialStore
+	}
+	return SaveBaseConfiguration(configDir, baseConfig)
+}
+
+// CreateContextsBundle returns a bundle holding the given contexts, together with the clusters they
+// refer to. The base configuration is left empty. When stripSecrets is true, private keys and tokens
+// are removed from both contexts and clusters
+func CreateContextsBundle(configDir string, contexts []string, stripSecrets bool) (Bundle, error) {
+	bundle := Bundle{
+		BaseConfig: BaseConfigFile{},
+		Clusters:   map[string]ClusterFile{},
+		Contexts:   map[string]ContextFile{},
+	}
+
+	for _, context := range contexts {
+		contextConfiguration, err := LoadContextConfiguration(configDir, context)
+		if err != nil {
+			return bundle, fmt.Errorf("Could not load context %s: %w", context, err)
+		}
+		bundle.Contexts[context] = contextConfiguration
+
+		if _, ok := bundle.Clusters[contextConfiguration.Cluster]; ok {
+			continue
+		}
+		clusterConfiguration, err := LoadClusterConfiguration(configDir, contextConfiguration.Cluster)
+		if err != nil {
+			return bundle, fmt.Errorf("Could not load cluster %s of context %s: %w", contextConfiguration.Cluster, context, err)
+		}
+		bundle.Clusters[contextConfiguration.Cluster] = clusterConfiguration
+	}
+
+	if stripSecrets {
+		bundle.StripSecrets()
+	}
+
+	return bundle, nil
+}
+
+// StripSecrets removes all private keys and tokens from the bundle
+func (b *Bundle) StripSecrets() {
+	for name, cluster := range b.Clusters {
+		cluster.Housekeeping = HousekeepingConfiguration{}
+		b.Clusters[name] = cluster
+	}
+	for name, context := range b.Contexts {
+		context.Realm.Key = ""
+		context.Realm.Token = ""
+		b.Contexts[name] = context
+	}
 }
 
 func existsInStringSlice(match string, list []string) bool {
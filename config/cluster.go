@@ -15,9 +15,6 @@
 package config
 
 import (
-	"os"
-	"path"
-
 	"gopkg.in/yaml.v2"
 )
 
@@ -58,49 +55,63 @@ type ClusterFile struct {
 
 // ListClusterConfigurations returns a list of available cluster configurations
 func ListClusterConfigurations(configDir string) ([]string, error) {
-	return listYamlNames(clustersDirFromConfigDir(configDir))
+	return GetStorage(configDir).List(ClustersSection)
 }
 
 // LoadClusterConfiguration loads a cluster configuration from the config directory
 func LoadClusterConfiguration(configDir, clusterName string) (ClusterFile, error) {
 	cluster := ClusterFile{}
-	contents, err := loadYamlFile(clustersDirFromConfigDir(configDir), clusterName)
+	contents, err := GetStorage(configDir).Load(ClustersSection, clusterName)
 	if err != nil {
 		return cluster, err
 	}
-	err = yaml.Unmarshal(contents, &cluster)
+	if err = yaml.Unmarshal(contents, &cluster); err != nil {
+		return cluster, err
+	}
+	dir := loadedSecretsDir(configDir, ClustersSection, clusterName)
+	if cluster.Housekeeping.Key, err = resolveSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-key"), cluster.Housekeeping.Key); err != nil {
+		return cluster, err
+	}
+	cluster.Housekeeping.Token, err = resolveSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-token"), cluster.Housekeeping.Token)
 	return cluster, err
 }
 
 // SaveClusterConfiguration saves a cluster configuration in the config directory
 func SaveClusterConfiguration(configDir, clusterName string, configuration ClusterFile, overwrite bool) error {
-	configPath := path.Join(clustersDirFromConfigDir(configDir), clusterName+".yaml")
-
 	if !overwrite {
-		if _, err := os.Stat(configPath); err == nil {
-			// Don't overwrite, don't fail
+		if existing, err := ListClusterConfigurations(configDir); err == nil && existsInStringSlice(clusterName, existing) {
+			// Don't overwrite, don't fail, and don't touch the credential store
 			return nil
 		}
 	}
 
-	if err := ensureConfigDirectoryStructure(configDir); err != nil {
+	var err error
+	dir := secretsDir(configDir)
+	if configuration.Housekeeping.Key, err = storeSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-key"), configuration.Housekeeping.Key); err != nil {
+		return err
+	}
+	if configuration.Housekeeping.Token, err = storeSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-token"), configuration.Housekeeping.Token); err != nil {
 		return err
 	}
-
 	contents, err := yaml.Marshal(configuration)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(configPath, contents, 0644)
+	return GetStorage(configDir).Save(ClustersSection, clusterName, contents, overwrite)
 }
 
 // DeleteClusterConfiguration deletes a cluster configuration in the config directory. It will return
 // an error if the cluster does not exist. The operation cannot be reverted
 func DeleteClusterConfiguration(configDir, clusterName string) error {
-	fileName, err := getYamlFilename(clustersDirFromConfigDir(configDir), clusterName)
-	if err != nil {
-		return err
+	// Don't leave secrets behind in the credential store. Entries found only in stacked config
+	// directories are not deleted, and their secrets are not looked for
+	dir := secretsDir(configDir)
+	if contents, err := GetStorage(configDir).Load(ClustersSection, clusterName); err == nil {
+		cluster := ClusterFile{}
+		if yaml.Unmarshal(contents, &cluster) == nil {
+			_ = deleteSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-key"), cluster.Housekeeping.Key)
+			_ = deleteSecret(dir, secretID(dir, ClustersSection, clusterName, "housekeeping-token"), cluster.Housekeeping.Token)
+		}
 	}
-
-	return os.Remove(fileName)
+	return GetStorage(configDir).Delete(ClustersSection, clusterName)
 }
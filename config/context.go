@@ -15,9 +15,6 @@
 package config
 
 import (
-	"os"
-	"path"
-
 	"gopkg.in/yaml.v2"
 )
 
@@ -37,53 +34,69 @@ type ContextFile struct {
 	Cluster string `yaml:"cluster" json:"cluster"`
 	// Realm is the realm object. In case the Context refers to Housekeeping only, can be omitted
 	Realm RealmConfiguration `yaml:"realm,omitempty" json:"realm,omitempty"`
+	// Defaults are the values of command line flags to be used with this context, when the flags are not given
+	Defaults map[string]string `yaml:"defaults,omitempty" json:"defaults,omitempty"`
 }
 
 // ListContextConfigurations returns a list of available context configurations
 func ListContextConfigurations(configDir string) ([]string, error) {
-	return listYamlNames(contextsDirFromConfigDir(configDir))
+	return GetStorage(configDir).List(ContextsSection)
 }
 
 // LoadContextConfiguration loads a context configuration from the config directory
 func LoadContextConfiguration(configDir, contextName string) (ContextFile, error) {
 	context := ContextFile{}
-	contents, err := loadYamlFile(contextsDirFromConfigDir(configDir), contextName)
+	contents, err := GetStorage(configDir).Load(ContextsSection, contextName)
 	if err != nil {
 		return context, err
 	}
-	err = yaml.Unmarshal(contents, &context)
+	if err = yaml.Unmarshal(contents, &context); err != nil {
+		return context, err
+	}
+	dir := loadedSecretsDir(configDir, ContextsSection, contextName)
+	if context.Realm.Key, err = resolveSecret(dir, secretID(dir, ContextsSection, contextName, "realm-key"), context.Realm.Key); err != nil {
+		return context, err
+	}
+	context.Realm.Token, err = resolveSecret(dir, secretID(dir, ContextsSection, contextName, "realm-token"), context.Realm.Token)
 	return context, err
 }
 
 // SaveContextConfiguration saves a context configuration in the config directory
 func SaveContextConfiguration(configDir, contextName string, configuration ContextFile, overwrite bool) error {
-	configPath := path.Join(contextsDirFromConfigDir(configDir), contextName+".yaml")
-
 	if !overwrite {
-		if _, err := os.Stat(configPath); err == nil {
-			// Don't overwrite, don't fail
+		if existing, err := ListContextConfigurations(configDir); err == nil && existsInStringSlice(contextName, existing) {
+			// Don't overwrite, don't fail, and don't touch the credential store
 			return nil
 		}
 	}
 
-	if err := ensureConfigDirectoryStructure(configDir); err != nil {
+	var err error
+	dir := secretsDir(configDir)
+	if configuration.Realm.Key, err = storeSecret(dir, secretID(dir, ContextsSection, contextName, "realm-key"), configuration.Realm.Key); err != nil {
+		return err
+	}
+	if configuration.Realm.Token, err = storeSecret(dir, secretID(dir, ContextsSection, contextName, "realm-token"), configuration.Realm.Token); err != nil {
 		return err
 	}
-
 	contents, err := yaml.Marshal(configuration)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(configPath, contents, 0644)
+	return GetStorage(configDir).Save(ContextsSection, contextName, contents, overwrite)
 }
 
 // DeleteContextConfiguration deletes a context configuration in the config directory. It will return
 // an error if the context does not exist. The operation cannot be reverted
 func DeleteContextConfiguration(configDir, contextName string) error {
-	fileName, err := getYamlFilename(contextsDirFromConfigDir(configDir), contextName)
-	if err != nil {
-		return err
+	// Don't leave secrets behind in the credential store. Entries found only in stacked config
+	// directories are not deleted, and their secrets are not looked for
+	dir := secretsDir(configDir)
+	if contents, err := GetStorage(configDir).Load(ContextsSection, contextName); err == nil {
+		context := ContextFile{}
+		if yaml.Unmarshal(contents, &context) == nil {
+			_ = deleteSecret(dir, secretID(dir, ContextsSection, contextName, "realm-key"), context.Realm.Key)
+			_ = deleteSecret(dir, secretID(dir, ContextsSection, contextName, "realm-token"), context.Realm.Token)
+		}
 	}
-
-	return os.Remove(fileName)
+	return GetStorage(configDir).Delete(ContextsSection, contextName)
 }
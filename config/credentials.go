@@ -0,0 +1,341 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	// PlaintextCredentialStore keeps private keys and tokens in configuration files. This is the default
+	PlaintextCredentialStore = "plaintext"
+	// KeyringCredentialStore keeps private keys and tokens in the OS keychain, falling back to a
+	// passphrase-encrypted file when no keychain is available
+	KeyringCredentialStore = "keyring"
+
+	// secretReference replaces secrets in configuration files when they are kept in the keyring.
+	// It can't be mistaken for a real secret, as it is not valid base64
+	secretReference = "<keyring>"
+
+	keyringService           = "astartectl"
+	encryptedFileName        = "credentials.enc"
+	credentialsPassphraseEnv = "ASTARTECTL_CREDENTIALS_PASSPHRASE"
+)
+
+var (
+	credentialsPassphrase     []byte
+	credentialsPassphraseLock sync.Mutex
+)
+
+// encryptedCredentialsFile is the fallback for systems without a keychain: secrets are encrypted
+// with AES-GCM, using a key derived from a passphrase with scrypt
+type encryptedCredentialsFile struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// GetCredentialStore returns the credential store configured in the base configuration
+func GetCredentialStore(configDir string) string {
+	baseConfig, err := LoadBaseConfiguration(configDir)
+	if err != nil || baseConfig.CredentialStore == "" {
+		return PlaintextCredentialStore
+	}
+	return baseConfig.CredentialStore
+}
+
+// IsValidCredentialStore returns whether store is a known credential store
+func IsValidCredentialStore(store string) bool {
+	return store == PlaintextCredentialStore || store == KeyringCredentialStore
+}
+
+// secretID returns the id of a secret of the entry name of section in the credential store. Ids are
+// namespaced by dir, the configuration directory holding the entry (or by the Kubernetes Secret holding the
+// configuration), so that entries with the same name in different profiles or config directories don't share
+// their secrets.
+func secretID(dir, section, name, field string) string {
+	if s, ok := GetStorage(dir).(*KubernetesSecretStorage); ok {
+		return path.Join(KubernetesSecretStorageType, s.Namespace, s.Name, section, name, field)
+	}
+	return path.Join(dir, section, name, field)
+}
+
+// secretsDir returns the configuration directory keeping the secrets of entries saved to configDir, as
+// an absolute path
+func secretsDir(configDir string) string {
+	dir := encryptedFileDir(configDir)
+	if absDir, err := filepath.Abs(dir); err == nil {
+		return absDir
+	}
+	return dir
+}
+
+// loadedSecretsDir is the same as secretsDir, for the existing entry name of section: with stacked config
+// directories, it is the directory the entry is loaded from
+func loadedSecretsDir(configDir, section, name string) string {
+	if s, ok := GetStorage(configDir).(DirectoryStorage); ok {
+		return secretsDir(s.entryDir(section, name))
+	}
+	return secretsDir(configDir)
+}
+
+// storeSecret returns what has to be written in a configuration file for value. When using the keyring
+// credential store, value is moved to the keyring and a reference to it is returned
+func storeSecret(configDir, id, value string) (string, error) {
+	if value == "" || value == secretReference || GetCredentialStore(configDir) != KeyringCredentialStore {
+		return value, nil
+	}
+	if err := keyring.Set(keyringService, id, value); err == nil {
+		return secretReference, nil
+	}
+	// No keychain available, use the encrypted file
+	secrets, err := loadEncryptedCredentials(configDir)
+	if err != nil {
+		return "", err
+	}
+	secrets[id] = value
+	if err := saveEncryptedCredentials(configDir, secrets); err != nil {
+		return "", err
+	}
+	return secretReference, nil
+}
+
+// resolveSecret returns the actual secret for a value read from a configuration file
+func resolveSecret(configDir, id, value string) (string, error) {
+	if value != secretReference {
+		return value, nil
+	}
+	if secret, err := keyring.Get(keyringService, id); err == nil {
+		return secret, nil
+	}
+	secrets, err := loadEncryptedCredentials(configDir)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[id]
+	if !ok {
+		return "", fmt.Errorf("Could not find %s in the credential store", id)
+	}
+	return secret, nil
+}
+
+// deleteSecret removes a secret from the keyring, if it is there
+func deleteSecret(configDir, id, value string) error {
+	if value != secretReference {
+		return nil
+	}
+	if err := keyring.Delete(keyringService, id); err == nil {
+		return nil
+	}
+	encryptedFile := path.Join(encryptedFileDir(configDir), encryptedFileName)
+	if _, err := os.Stat(encryptedFile); err != nil {
+		return nil
+	}
+	secrets, err := loadEncryptedCredentials(configDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[id]; !ok {
+		return nil
+	}
+	delete(secrets, id)
+	return saveEncryptedCredentials(configDir, secrets)
+}
+
+func encryptedFileDir(configDir string) string {
+	if configDir == "" {
+		return GetConfigDir()
+	}
+	return configDir
+}
+
+func getCredentialsPassphrase() ([]byte, error) {
+	credentialsPassphraseLock.Lock()
+	defer credentialsPassphraseLock.Unlock()
+
+	if credentialsPassphrase != nil {
+		return credentialsPassphrase, nil
+	}
+	if passphrase, ok := os.LookupEnv(credentialsPassphraseEnv); ok && passphrase != "" {
+		credentialsPassphrase = []byte(passphrase)
+		return credentialsPassphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("No OS keychain available. Set %s to use the encrypted credentials file", credentialsPassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "No OS keychain available, enter the passphrase of the encrypted credentials file: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("The passphrase can't be empty")
+	}
+	credentialsPassphrase = passphrase
+	return credentialsPassphrase, nil
+}
+
+func credentialsCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadEncryptedCredentials(configDir string) (map[string]string, error) {
+	secrets := map[string]string{}
+	contents, err := os.ReadFile(path.Join(encryptedFileDir(configDir), encryptedFileName))
+	if os.IsNotExist(err) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file := encryptedCredentialsFile{}
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+	passphrase, err := getCredentialsPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := credentialsCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("Could not decrypt the credentials file, is the passphrase correct?")
+	}
+	err = json.Unmarshal(plaintext, &secrets)
+	return secrets, err
+}
+
+func saveEncryptedCredentials(configDir string, secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	passphrase, err := getCredentialsPassphrase()
+	if err != nil {
+		return err
+	}
+
+	file := encryptedCredentialsFile{Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	aead, err := credentialsCipher(passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+
+	contents, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(encryptedFileDir(configDir), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(encryptedFileDir(configDir), encryptedFileName), contents, 0600)
+}
+
+// MigrateCredentials sets the credential store in the base configuration, and moves the private keys
+// and tokens of all contexts and clusters to it
+func MigrateCredentials(configDir, store string) error {
+	previousStore := GetCredentialStore(configDir)
+
+	// Load everything with the previous store, before switching
+	clusters, err := ListClusterConfigurations(configDir)
+	if err != nil {
+		return err
+	}
+	clusterConfigurations := map[string]ClusterFile{}
+	for _, name := range clusters {
+		if clusterConfigurations[name], err = LoadClusterConfiguration(configDir, name); err != nil {
+			return fmt.Errorf("Could not load cluster %s: %w", name, err)
+		}
+	}
+	contexts, err := ListContextConfigurations(configDir)
+	if err != nil {
+		return err
+	}
+	contextConfigurations := map[string]ContextFile{}
+	for _, name := range contexts {
+		if contextConfigurations[name], err = LoadContextConfiguration(configDir, name); err != nil {
+			return fmt.Errorf("Could not load context %s: %w", name, err)
+		}
+	}
+
+	baseConfig, err := LoadBaseConfiguration(configDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	baseConfig.CredentialStore = store
+	if err := SaveBaseConfiguration(configDir, baseConfig); err != nil {
+		return err
+	}
+
+	// Saving stores secrets according to the new store
+	for name, configuration := range clusterConfigurations {
+		if err := SaveClusterConfiguration(configDir, name, configuration, true); err != nil {
+			return fmt.Errorf("Could not migrate cluster %s: %w", name, err)
+		}
+	}
+	for name, configuration := range contextConfigurations {
+		if err := SaveContextConfiguration(configDir, name, configuration, true); err != nil {
+			return fmt.Errorf("Could not migrate context %s: %w", name, err)
+		}
+	}
+
+	// Clean up the keyring when leaving it
+	if previousStore == KeyringCredentialStore && store != KeyringCredentialStore {
+		dir := secretsDir(configDir)
+		for name := range clusterConfigurations {
+			_ = deleteSecret(dir, secretID(dir, ClustersSection, name, "housekeeping-key"), secretReference)
+			_ = deleteSecret(dir, secretID(dir, ClustersSection, name, "housekeeping-token"), secretReference)
+		}
+		for name := range contextConfigurations {
+			_ = deleteSecret(dir, secretID(dir, ContextsSection, name, "realm-key"), secretReference)
+			_ = deleteSecret(dir, secretID(dir, ContextsSection, name, "realm-token"), secretReference)
+		}
+	}
+
+	return nil
+}
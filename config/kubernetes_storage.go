@@ -0,0 +1,197 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultConfigSecretNamespace = "default"
+	defaultConfigSecretName      = "astartectl-config"
+)
+
+// GetConfigSecretNamespace returns the namespace of the Secret used by KubernetesSecretStorage
+func GetConfigSecretNamespace() string {
+	if namespace := viper.GetString("config-secret-namespace"); namespace != "" {
+		return namespace
+	} else if namespaceFromEnv, ok := os.LookupEnv("ASTARTE_CONFIG_SECRET_NAMESPACE"); ok && namespaceFromEnv != "" {
+		return namespaceFromEnv
+	}
+	return defaultConfigSecretNamespace
+}
+
+// GetConfigSecretName returns the name of the Secret used by KubernetesSecretStorage
+func GetConfigSecretName() string {
+	if name := viper.GetString("config-secret-name"); name != "" {
+		return name
+	} else if nameFromEnv, ok := os.LookupEnv("ASTARTE_CONFIG_SECRET_NAME"); ok && nameFromEnv != "" {
+		return nameFromEnv
+	}
+	return defaultConfigSecretName
+}
+
+// KubernetesSecretStorage stores configuration in a Kubernetes Secret, so that it can be shared
+// among ephemeral environments such as CI runners or bastion pods. Each entry is stored in a
+// dedicated key of the Secret, in the form <section>.<name>.yaml.
+// The Kubernetes cluster is selected through the usual kubeconfig loading rules (KUBECONFIG,
+// ~/.kube/config), falling back to the in-cluster configuration.
+type KubernetesSecretStorage struct {
+	Namespace string
+	Name      string
+
+	client kubernetes.Interface
+}
+
+// NewKubernetesSecretStorage returns a KubernetesSecretStorage for the given Secret. The
+// Secret is created upon the first Save, if needed.
+func NewKubernetesSecretStorage(namespace, name string) *KubernetesSecretStorage {
+	return &KubernetesSecretStorage{Namespace: namespace, Name: name}
+}
+
+func (s *KubernetesSecretStorage) secrets() (typedcorev1.SecretInterface, error) {
+	if s.client == nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		if s.client, err = kubernetes.NewForConfig(restConfig); err != nil {
+			return nil, err
+		}
+	}
+	return s.client.CoreV1().Secrets(s.Namespace), nil
+}
+
+// getSecret returns the configuration Secret. When it does not exist, an empty, not yet
+// created Secret is returned and exists is false
+func (s *KubernetesSecretStorage) getSecret() (secret *corev1.Secret, exists bool, err error) {
+	secrets, err := s.secrets()
+	if err != nil {
+		return nil, false, err
+	}
+	secret, err = secrets.Get(context.Background(), s.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+			Type:       corev1.SecretTypeOpaque,
+		}, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return secret, true, nil
+}
+
+func (s *KubernetesSecretStorage) putSecret(secret *corev1.Secret, exists bool) error {
+	secrets, err := s.secrets()
+	if err != nil {
+		return err
+	}
+	if exists {
+		_, err = secrets.Update(context.Background(), secret, metav1.UpdateOptions{})
+	} else {
+		_, err = secrets.Create(context.Background(), secret, metav1.CreateOptions{})
+	}
+	return err
+}
+
+func secretKey(section, name string) string {
+	if section == RootSection {
+		return name + ".yaml"
+	}
+	return section + "." + name + ".yaml"
+}
+
+// List returns the names of all entries in a section
+func (s *KubernetesSecretStorage) List(section string) ([]string, error) {
+	secret, _, err := s.getSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for key := range secret.Data {
+		if section == RootSection {
+			if strings.Count(key, ".") == 1 {
+				names = append(names, strings.TrimSuffix(key, ".yaml"))
+			}
+			continue
+		}
+		if strings.HasPrefix(key, section+".") && strings.HasSuffix(key, ".yaml") {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(key, section+"."), ".yaml"))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Load returns the contents of an entry
+func (s *KubernetesSecretStorage) Load(section, name string) ([]byte, error) {
+	secret, _, err := s.getSecret()
+	if err != nil {
+		return nil, err
+	}
+	contents, ok := secret.Data[secretKey(section, name)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return contents, nil
+}
+
+// Save stores the contents of an entry
+func (s *KubernetesSecretStorage) Save(section, name string, contents []byte, overwrite bool) error {
+	secret, exists, err := s.getSecret()
+	if err != nil {
+		return err
+	}
+	key := secretKey(section, name)
+	if _, ok := secret.Data[key]; ok && !overwrite {
+		// Don't overwrite, don't fail
+		return nil
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[key] = contents
+
+	return s.putSecret(secret, exists)
+}
+
+// Delete removes an entry
+func (s *KubernetesSecretStorage) Delete(section, name string) error {
+	secret, exists, err := s.getSecret()
+	if err != nil {
+		return err
+	}
+	key := secretKey(section, name)
+	if _, ok := secret.Data[key]; !ok || !exists {
+		return os.ErrNotExist
+	}
+	delete(secret.Data, key)
+
+	return s.putSecret(secret, exists)
+}
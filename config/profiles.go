@@ -0,0 +1,104 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// configProfilesDirName is the directory, in the default configuration directory, holding profiles
+const configProfilesDirName = "profiles"
+
+// GetConfigProfile returns the configuration profile set through --config-profile (or the
+// ASTARTECTL_CONFIG_PROFILE environment variable), if any. A profile is a configuration directory of its own,
+// e.g. to keep work and personal, or production and staging, clusters and contexts apart.
+func GetConfigProfile() string {
+	if profile := viper.GetString("config-profile"); profile != "" {
+		return profile
+	}
+	return os.Getenv("ASTARTECTL_CONFIG_PROFILE")
+}
+
+// ValidateConfigProfile checks that the configuration profile in use, if any, has a valid name
+func ValidateConfigProfile() error {
+	profile := GetConfigProfile()
+	if profile != "" && (profile != filepath.Base(profile) || profile == "." || profile == "..") {
+		return fmt.Errorf("%s is not a valid configuration profile name", profile)
+	}
+	return nil
+}
+
+// GetConfigProfilesDir returns the directory holding configuration profiles
+func GetConfigProfilesDir() string {
+	return path.Join(GetDefaultConfigDir(), configProfilesDirName)
+}
+
+// GetConfigProfileDir returns the configuration directory of profile
+func GetConfigProfileDir(profile string) string {
+	return path.Join(GetConfigProfilesDir(), profile)
+}
+
+// ListConfigProfiles returns the names of the configuration profiles, sorted
+func ListConfigProfiles() ([]string, error) {
+	entries, err := os.ReadDir(GetConfigProfilesDir())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	profiles := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			profiles = append(profiles, e.Name())
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// ConfigDirSummary returns the number of clusters and contexts in the configuration directory dir, and
+// its current context. Unlike the Storage, it does not create missing directories.
+func ConfigDirSummary(dir string) (int, int, string, error) {
+	storage := DirectoryStorage{Dir: dir}
+	counts := []int{}
+	for _, section := range []string{ClustersSection, ContextsSection} {
+		if _, err := os.Stat(storage.sectionDir(section)); os.IsNotExist(err) {
+			counts = append(counts, 0)
+			continue
+		}
+		names, err := storage.List(section)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		counts = append(counts, len(names))
+	}
+
+	currentContext := ""
+	if contents, err := storage.Load(RootSection, baseConfigName); err == nil {
+		baseConfig := BaseConfigFile{}
+		if err := yaml.Unmarshal(contents, &baseConfig); err != nil {
+			return 0, 0, "", err
+		}
+		currentContext = baseConfig.CurrentContext
+	}
+	return counts[0], counts[1], currentContext, nil
+}
@@ -0,0 +1,135 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// RenameContextConfiguration renames a context, updating the current and previous context of the base
+// configuration when they refer to it. The new context is written before anything else is touched, and
+// the changes made so far are reverted when a step fails, so that references are never left dangling.
+func RenameContextConfiguration(configDir, oldName, newName string) error {
+	contexts, err := ListContextConfigurations(configDir)
+	if err != nil {
+		return err
+	}
+	if existsInStringSlice(newName, contexts) {
+		return fmt.Errorf("Context %s already exists", newName)
+	}
+	context, err := LoadContextConfiguration(configDir, oldName)
+	if err != nil {
+		return fmt.Errorf("Could not load context %s: %w", oldName, err)
+	}
+
+	if err := SaveContextConfiguration(configDir, newName, context, false); err != nil {
+		return err
+	}
+
+	baseConfig, err := LoadBaseConfiguration(configDir)
+	hasBaseConfig := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = DeleteContextConfiguration(configDir, newName)
+		return err
+	}
+	if hasBaseConfig && (baseConfig.CurrentContext == oldName || baseConfig.PreviousContext == oldName) {
+		renamed := baseConfig
+		if renamed.CurrentContext == oldName {
+			renamed.CurrentContext = newName
+		}
+		if renamed.PreviousContext == oldName {
+			renamed.PreviousContext = newName
+		}
+		if err := SaveBaseConfiguration(configDir, renamed); err != nil {
+			_ = DeleteContextConfiguration(configDir, newName)
+			return err
+		}
+	}
+
+	if err := DeleteContextConfiguration(configDir, oldName); err != nil {
+		if hasBaseConfig {
+			_ = SaveBaseConfiguration(configDir, baseConfig)
+		}
+		_ = DeleteContextConfiguration(configDir, newName)
+		return err
+	}
+	return nil
+}
+
+// RenameClusterConfiguration renames a cluster, updating all the contexts referring to it, whose names
+// are returned. As with RenameContextConfiguration, the changes made so far are reverted when a step fails.
+func RenameClusterConfiguration(configDir, oldName, newName string) ([]string, error) {
+	clusters, err := ListClusterConfigurations(configDir)
+	if err != nil {
+		return nil, err
+	}
+	if existsInStringSlice(newName, clusters) {
+		return nil, fmt.Errorf("Cluster %s already exists", newName)
+	}
+	cluster, err := LoadClusterConfiguration(configDir, oldName)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load cluster %s: %w", oldName, err)
+	}
+
+	// Load all the contexts beforehand: a context which can't be read could be referring to the cluster
+	contextNames, err := ListContextConfigurations(configDir)
+	if err != nil {
+		return nil, err
+	}
+	referring := map[string]ContextFile{}
+	for _, c := range contextNames {
+		context, err := LoadContextConfiguration(configDir, c)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load context %s: %w", c, err)
+		}
+		if context.Cluster == oldName {
+			referring[c] = context
+		}
+	}
+
+	if err := SaveClusterConfiguration(configDir, newName, cluster, false); err != nil {
+		return nil, err
+	}
+
+	updated := []string{}
+	revert := func() {
+		for _, c := range updated {
+			_ = SaveContextConfiguration(configDir, c, referring[c], true)
+		}
+		_ = DeleteClusterConfiguration(configDir, newName)
+	}
+	for _, c := range contextNames {
+		context, ok := referring[c]
+		if !ok {
+			continue
+		}
+		context.Cluster = newName
+		if err := SaveContextConfiguration(configDir, c, context, true); err != nil {
+			revert()
+			return nil, fmt.Errorf("Could not update context %s: %w", c, err)
+		}
+		updated = append(updated, c)
+	}
+
+	if err := DeleteClusterConfiguration(configDir, oldName); err != nil {
+		revert()
+		return nil, err
+	}
+	sort.Strings(updated)
+	return updated, nil
+}
@@ -0,0 +1,165 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Setting is a configuration setting which can be set, in order of precedence, through a flag,
+// an environment variable, the current context or its cluster
+type Setting struct {
+	// Key is the Viper key of the setting
+	Key string
+	// Flag is the name of the global flag setting it, if any
+	Flag string
+	// EnvVars are the environment variables setting it, besides the ASTARTECTL_ prefixed one
+	EnvVars []string
+	// Secret settings are never printed
+	Secret bool
+}
+
+// Settings are the settings resolved by astartectl for API commands
+var Settings = []Setting{
+	{Key: "url", Flag: "astarte-url", EnvVars: []string{"ASTARTE_URL"}},
+	{Key: "individual-urls.appengine"},
+	{Key: "individual-urls.flow"},
+	{Key: "individual-urls.housekeeping"},
+	{Key: "individual-urls.pairing"},
+	{Key: "individual-urls.realm-management"},
+	{Key: "realm.name", EnvVars: []string{"ASTARTE_REALM"}},
+	{Key: "realm.key", Secret: true},
+	{Key: "realm.key-file", EnvVars: []string{"ASTARTE_REALM_KEY"}},
+	{Key: "realm.token", Secret: true},
+	{Key: "housekeeping.key", Secret: true},
+	{Key: "housekeeping.key-file", EnvVars: []string{"ASTARTE_HOUSEKEEPING_KEY"}},
+	{Key: "housekeeping.token", Secret: true},
+	{Key: "token", Flag: "token", EnvVars: []string{"ASTARTE_TOKEN"}, Secret: true},
+	{Key: "ignore-ssl-errors", Flag: "ignore-ssl-errors"},
+}
+
+var legacyEnvReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+func (s Setting) envVars() []string {
+	return append(append([]string{}, s.EnvVars...), "ASTARTECTL_"+strings.ToUpper(legacyEnvReplacer.Replace(s.Key)))
+}
+
+// BindEnvironment makes Viper honour the environment variables of all Settings
+func BindEnvironment() error {
+	for _, s := range Settings {
+		if err := viper.BindEnv(append([]string{s.Key}, s.envVars()...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CurrentContextName returns the name of the context in use, together with where it comes from.
+// contextOverride is the value of the --context flag
+func CurrentContextName(configDir, contextOverride string) (string, string) {
+	if contextOverride != "" {
+		return contextOverride, "flag --context"
+	}
+	if contextFromEnv, ok := os.LookupEnv("ASTARTE_CONTEXT"); ok && contextFromEnv != "" {
+		return contextFromEnv, "env ASTARTE_CONTEXT"
+	}
+	if baseConfig, err := LoadBaseConfiguration(configDir); err == nil && baseConfig.CurrentContext != "" {
+		return baseConfig.CurrentContext, "current context"
+	}
+	return "", ""
+}
+
+// ClusterOverrideName returns the name of the cluster to be used instead of the one of the context in use,
+// together with where it comes from. Both are empty when the cluster of the context is used.
+// clusterOverride is the value of the --use-cluster flag
+func ClusterOverrideName(clusterOverride string) (string, string) {
+	if clusterOverride != "" {
+		return clusterOverride, "flag --use-cluster"
+	}
+	if clusterFromEnv, ok := os.LookupEnv("ASTARTE_CLUSTER"); ok && clusterFromEnv != "" {
+		return clusterFromEnv, "env ASTARTE_CLUSTER"
+	}
+	return "", ""
+}
+
+// SettingSource returns where the effective value of a setting comes from: a flag in flags, an
+// environment variable, the context or the cluster settings. It returns an empty string if the
+// setting is not set at all
+func SettingSource(s Setting, flags *pflag.FlagSet, contextName string, contextSettings map[string]interface{},
+	clusterName string, clusterSettings map[string]interface{}) string {
+	if s.Flag != "" && flags != nil {
+		if flag := flags.Lookup(s.Flag); flag != nil && flag.Changed {
+			return "flag --" + s.Flag
+		}
+	}
+	for _, env := range s.envVars() {
+		if _, ok := os.LookupEnv(env); ok {
+			return "env " + env
+		}
+	}
+	if nestedSetting(contextSettings, s.Key) != nil {
+		return "context " + contextName
+	}
+	if nestedSetting(clusterSettings, s.Key) != nil {
+		return "cluster " + clusterName
+	}
+	return ""
+}
+
+// LoadContextSettings returns the raw settings of a context and of its cluster, as merged in Viper.
+// When clusterName is set, it is used rather than the cluster of the context, and contextName may be empty.
+func LoadContextSettings(configDir, contextName, clusterName string) (map[string]interface{}, string, map[string]interface{}, error) {
+	storage := GetStorage(configDir)
+	contextSettings := map[string]interface{}{}
+	if contextName != "" {
+		var err error
+		if contextSettings, err = loadSettings(storage, ContextsSection, contextName); err != nil {
+			return nil, "", nil, fmt.Errorf("Could not load context %s: %w", contextName, err)
+		}
+	}
+	if clusterName == "" {
+		clusterName, _ = contextSettings["cluster"].(string)
+	}
+	if clusterName == "" {
+		return contextSettings, "", nil, nil
+	}
+	clusterSettings, err := loadSettings(storage, ClustersSection, clusterName)
+	if err != nil {
+		return contextSettings, clusterName, nil, fmt.Errorf("Could not load cluster %s: %w", clusterName, err)
+	}
+	return contextSettings, clusterName, clusterSettings, nil
+}
+
+func nestedSetting(settings map[string]interface{}, key string) interface{} {
+	var current interface{} = settings
+	for _, k := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if current, ok = m[k]; !ok {
+			return nil
+		}
+	}
+	if s, ok := current.(string); ok && s == "" {
+		return nil
+	}
+	return current
+}
@@ -0,0 +1,197 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// RootSection is the storage section holding the base configuration
+	RootSection = ""
+	// ClustersSection is the storage section holding clusters
+	ClustersSection = "clusters"
+	// ContextsSection is the storage section holding contexts
+	ContextsSection = "contexts"
+
+	// DirectoryStorageType stores configuration in a local directory. This is the default
+	DirectoryStorageType = "directory"
+	// KubernetesSecretStorageType stores configuration in a Kubernetes Secret
+	KubernetesSecretStorageType = "kubernetes-secret"
+)
+
+var kubernetesStorage *KubernetesSecretStorage
+
+// Storage is a backend for astartectl configuration. Each configuration entry is a YAML document
+// identified by its name and by the section it belongs to (see RootSection, ClustersSection and
+// ContextsSection).
+type Storage interface {
+	// List returns the names of all entries in a section
+	List(section string) ([]string, error)
+	// Load returns the contents of an entry. It returns os.ErrNotExist if the entry does not exist
+	Load(section, name string) ([]byte, error)
+	// Save stores the contents of an entry. When overwrite is false and the entry already exists,
+	// Save does nothing and does not fail
+	Save(section, name string, contents []byte, overwrite bool) error
+	// Delete removes an entry. It returns an error if the entry does not exist
+	Delete(section, name string) error
+}
+
+// GetStorage returns the Storage configured through the config-storage setting (or the
+// ASTARTE_CONFIG_STORAGE environment variable). When the configuration is stored in a directory,
+// configDir is used as the directory.
+func GetStorage(configDir string) Storage {
+	storageType := viper.GetString("config-storage")
+	if storageType == "" {
+		storageType = os.Getenv("ASTARTE_CONFIG_STORAGE")
+	}
+
+	switch storageType {
+	case KubernetesSecretStorageType:
+		// Reuse the same storage, to avoid building a Kubernetes client at each access
+		namespace, name := GetConfigSecretNamespace(), GetConfigSecretName()
+		if kubernetesStorage == nil || kubernetesStorage.Namespace != namespace || kubernetesStorage.Name != name {
+			kubernetesStorage = NewKubernetesSecretStorage(namespace, name)
+		}
+		return kubernetesStorage
+	case DirectoryStorageType, "":
+	default:
+		fmt.Fprintf(os.Stderr, "warn: Unknown config storage %s, falling back to %s\n", storageType, DirectoryStorageType)
+	}
+	storage := DirectoryStorage{Dir: configDir}
+	// Directories stacked after the configuration directory in use are looked for too
+	if stack := GetConfigDirStack(); configDir == "" || configDir == stack[0] {
+		storage.Stacked = stack[1:]
+	}
+	return storage
+}
+
+// DirectoryStorage stores configuration as YAML files in a local directory, with clusters and
+// contexts in dedicated subdirectories.
+type DirectoryStorage struct {
+	// Dir is the configuration directory. When empty, the default one is used
+	Dir string
+	// Stacked are configuration directories where entries missing from Dir are looked for. They are never written
+	Stacked []string
+}
+
+func (s DirectoryStorage) sectionDir(section string) string {
+	switch section {
+	case ClustersSection:
+		return clustersDirFromConfigDir(s.Dir)
+	case ContextsSection:
+		return contextsDirFromConfigDir(s.Dir)
+	}
+	if s.Dir == "" {
+		return GetDefaultConfigDir()
+	}
+	return s.Dir
+}
+
+// List returns the names of all entries in a section
+func (s DirectoryStorage) List(section string) ([]string, error) {
+	names, err := listYamlNames(s.sectionDir(section))
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, name := range names {
+		found[name] = true
+	}
+	for _, dir := range s.Stacked {
+		stackedDir := DirectoryStorage{Dir: dir}.sectionDir(section)
+		if _, err := os.Stat(stackedDir); err != nil {
+			continue
+		}
+		stackedNames, err := listYamlNames(stackedDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range stackedNames {
+			if !found[name] {
+				found[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// Load returns the contents of an entry
+func (s DirectoryStorage) Load(section, name string) ([]byte, error) {
+	contents, err := loadYamlFile(s.sectionDir(section), name)
+	if !errors.Is(err, os.ErrNotExist) {
+		return contents, err
+	}
+	for _, dir := range s.Stacked {
+		if contents, err := loadYamlFile(DirectoryStorage{Dir: dir}.sectionDir(section), name); !errors.Is(err, os.ErrNotExist) {
+			return contents, err
+		}
+	}
+	return nil, err
+}
+
+// Save stores the contents of an entry
+func (s DirectoryStorage) Save(section, name string, contents []byte, overwrite bool) error {
+	configPath := path.Join(s.sectionDir(section), name+".yaml")
+
+	if !overwrite {
+		if _, err := os.Stat(configPath); err == nil {
+			// Don't overwrite, don't fail
+			return nil
+		}
+	}
+
+	if err := ensureConfigDirectoryStructure(s.Dir); err != nil {
+		return err
+	}
+
+	return os.WriteFile(configPath, contents, 0644)
+}
+
+// entryDir returns the configuration directory holding the entry name of section, which is Dir unless
+// the entry is found only in a stacked directory
+func (s DirectoryStorage) entryDir(section, name string) string {
+	if _, err := getYamlFilename(s.sectionDir(section), name); err != nil {
+		for _, dir := range s.Stacked {
+			if _, err := getYamlFilename(DirectoryStorage{Dir: dir}.sectionDir(section), name); err == nil {
+				return dir
+			}
+		}
+	}
+	return s.Dir
+}
+
+// Delete removes an entry
+func (s DirectoryStorage) Delete(section, name string) error {
+	fileName, err := getYamlFilename(s.sectionDir(section), name)
+	if errors.Is(err, os.ErrNotExist) {
+		for _, dir := range s.Stacked {
+			if _, stackedErr := getYamlFilename(DirectoryStorage{Dir: dir}.sectionDir(section), name); stackedErr == nil {
+				return fmt.Errorf("%s is defined in the stacked config directory %s, which is never modified", name, dir)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(fileName)
+}
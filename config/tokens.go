@@ -0,0 +1,128 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	tokenCacheFileName = "tokens.json"
+	// tokenCacheSection is the section of the token cache in the credential store
+	tokenCacheSection = "tokens"
+)
+
+// CachedToken is a token minted from a private key, cached to be reused by subsequent invocations
+type CachedToken struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// tokenCache maps private key fingerprints to the tokens minted from them
+type tokenCache map[string]CachedToken
+
+func tokenCachePath(configDir string) string {
+	if configDir == "" {
+		configDir = GetDefaultConfigDir()
+	}
+	return path.Join(configDir, tokenCacheFileName)
+}
+
+// tokenCacheSecretID returns the id of the token cache in the credential store
+func tokenCacheSecretID(configDir string) string {
+	dir := secretsDir(configDir)
+	return secretID(dir, tokenCacheSection, "", "cache")
+}
+
+// loadTokenCache reads the token cache from the configuration directory or, when using the keyring
+// credential store, from the credential store
+func loadTokenCache(configDir string) tokenCache {
+	cache := tokenCache{}
+	var contents []byte
+	if GetCredentialStore(configDir) == KeyringCredentialStore {
+		secret, err := resolveSecret(secretsDir(configDir), tokenCacheSecretID(configDir), secretReference)
+		if err != nil {
+			return cache
+		}
+		contents = []byte(secret)
+	} else {
+		var err error
+		if contents, err = os.ReadFile(tokenCachePath(configDir)); err != nil {
+			return cache
+		}
+	}
+	// A corrupted cache is as good as an empty one
+	if err := json.Unmarshal(contents, &cache); err != nil {
+		return tokenCache{}
+	}
+	return cache
+}
+
+// GetCachedToken returns the token cached for the private key identified by fingerprint, if any
+func GetCachedToken(configDir, fingerprint string) (CachedToken, bool) {
+	token, ok := loadTokenCache(configDir)[fingerprint]
+	return token, ok
+}
+
+// SaveCachedToken caches token for the private key identified by fingerprint, dropping expired tokens.
+// Nothing is cached when the configuration directory does not exist. When using the keyring credential
+// store, tokens are cached in the credential store rather than in a plaintext file.
+func SaveCachedToken(configDir, fingerprint string, token CachedToken) error {
+	cachePath := tokenCachePath(configDir)
+	if _, err := os.Stat(path.Dir(cachePath)); err != nil {
+		return err
+	}
+
+	cache := loadTokenCache(configDir)
+	for k, v := range cache {
+		if time.Now().After(v.Expiry) {
+			delete(cache, k)
+		}
+	}
+	cache[fingerprint] = token
+
+	contents, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if GetCredentialStore(configDir) == KeyringCredentialStore {
+		// Don't leave a plaintext cache behind, e.g. from before switching to the keyring
+		if err := os.Remove(cachePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		_, err := storeSecret(secretsDir(configDir), tokenCacheSecretID(configDir), string(contents))
+		return err
+	}
+	// Tokens are credentials, keep them private
+	return os.WriteFile(cachePath, contents, 0600)
+}
+
+// PurgeTokenCache removes all cached tokens, returning how many of them were removed
+func PurgeTokenCache(configDir string) (int, error) {
+	cache := loadTokenCache(configDir)
+	if err := os.Remove(tokenCachePath(configDir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if GetCredentialStore(configDir) == KeyringCredentialStore {
+		if err := deleteSecret(secretsDir(configDir), tokenCacheSecretID(configDir), secretReference); err != nil {
+			return 0, err
+		}
+	}
+	return len(cache), nil
+}
@@ -15,10 +15,12 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/shibukawa/configdir"
@@ -27,79 +29,161 @@ import (
 
 // ConfigureViper sets up Viper to behave correctly with regards to both context and
 // configuration directory, taking into account all environment variables and parameters.
-// Order of precedence is: override, environment variables, defaults
-func ConfigureViper(contextOverride string) error {
+// Order of precedence is: override, environment variables, defaults.
+// clusterOverride, when set, replaces the cluster of the context, and it is enough to configure
+// Viper without any context (e.g. for Housekeeping commands).
+func ConfigureViper(contextOverride, clusterOverride string) error {
 	// Get configuration directory, first of all
 	configDir := GetConfigDir()
-	// Check if it exists
-	if _, err := os.Stat(configDir); err != nil {
-		return err
-	}
-
-	// Load base config first of all
-	viper.SetConfigName(baseConfigName)
-	viper.AddConfigPath(configDir)
-	if err := viper.ReadInConfig(); err != nil {
-		return err
+	storage := GetStorage(configDir)
+	// Check if it exists, in any of the stacked directories
+	if directoryStorage, ok := storage.(DirectoryStorage); ok {
+		_, err := os.Stat(configDir)
+		for _, dir := range directoryStorage.Stacked {
+			if err == nil {
+				break
+			}
+			_, err = os.Stat(dir)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	// Now, get the current context
-	currentContextInterface := viper.Get("context")
-	currentContext := ""
-	//in case of empty file, the following check used to fail, now it defaults to empty context and enable file rewrite
-	if currentContextInterface != nil {
-		currentContext = currentContextInterface.(string)
-	}
+	// Get the current context and cluster, taking overrides into account
+	currentContext, _ := CurrentContextName(configDir, contextOverride)
+	cluster, _ := ClusterOverrideName(clusterOverride)
 
-	// Check overrides
-	if contextOverride != "" {
-		currentContext = contextOverride
-	} else if contextFromEnv, ok := os.LookupEnv("ASTARTE_CONTEXT"); ok && contextFromEnv != "" {
-		currentContext = contextFromEnv
+	// Load base config first of all. It is not needed when the context or the cluster are given explicitly
+	viper.SetConfigType("yaml")
+	baseContents, err := storage.Load(RootSection, baseConfigName)
+	switch {
+	case err == nil:
+		if err := viper.ReadConfig(bytes.NewReader(baseContents)); err != nil {
+			return err
+		}
+	case currentContext == "" && cluster == "":
+		return err
 	}
 
-	if currentContext == "" {
+	if currentContext == "" && cluster == "" {
 		return errors.New("No current context defined")
 	}
 
 	// Load the current context
-	contextViper := viper.New()
-	contextViper.SetConfigName(currentContext)
-	contextViper.AddConfigPath(contextsDirFromConfigDir(configDir))
-	if err := contextViper.ReadInConfig(); err != nil {
-		return err
-	}
-	if err := viper.MergeConfigMap(contextViper.AllSettings()); err != nil {
-		return err
+	if currentContext != "" {
+		contextSettings, err := loadSettings(storage, ContextsSection, currentContext)
+		if err != nil {
+			return fmt.Errorf("Could not load context %s: %w", currentContext, err)
+		}
+		if err := viper.MergeConfigMap(contextSettings); err != nil {
+			return err
+		}
 	}
 
 	// Now, get the corresponding cluster
-	cluster := viper.Get("cluster").(string)
 	if cluster == "" {
-		return errors.New("No cluster defined in context - something is wrong")
+		cluster = viper.GetString("cluster")
+		if cluster == "" {
+			return errors.New("No cluster defined in context - something is wrong")
+		}
 	}
 
 	// Load the corresponding cluster
-	clusterViper := viper.New()
-	clusterViper.SetConfigName(cluster)
-	clusterViper.AddConfigPath(clustersDirFromConfigDir(configDir))
-	if err := clusterViper.ReadInConfig(); err != nil {
+	clusterSettings, err := loadSettings(storage, ClustersSection, cluster)
+	if err != nil {
+		return fmt.Errorf("Could not load cluster %s: %w", cluster, err)
+	}
+	clusterSettings["cluster"] = cluster
+
+	if err := viper.MergeConfigMap(clusterSettings); err != nil {
 		return err
 	}
 
-	// Done loading
-	return viper.MergeConfigMap(clusterViper.AllSettings())
+	// Finally, resolve secrets kept in the credential store
+	contextDir := loadedSecretsDir(configDir, ContextsSection, currentContext)
+	clusterDir := loadedSecretsDir(configDir, ClustersSection, cluster)
+	secrets := map[string][2]string{
+		"realm.key":          {contextDir, secretID(contextDir, ContextsSection, currentContext, "realm-key")},
+		"realm.token":        {contextDir, secretID(contextDir, ContextsSection, currentContext, "realm-token")},
+		"housekeeping.key":   {clusterDir, secretID(clusterDir, ClustersSection, cluster, "housekeeping-key")},
+		"housekeeping.token": {clusterDir, secretID(clusterDir, ClustersSection, cluster, "housekeeping-token")},
+	}
+	for setting, secretLocation := range secrets {
+		if viper.GetString(setting) != secretReference {
+			continue
+		}
+		secret, err := resolveSecret(secretLocation[0], secretLocation[1], secretReference)
+		if err != nil {
+			return err
+		}
+		viper.Set(setting, secret)
+	}
+
+	return nil
+}
+
+// loadSettings reads a configuration entry from storage as Viper settings
+func loadSettings(storage Storage, section, name string) (map[string]interface{}, error) {
+	contents, err := storage.Load(section, name)
+	if err != nil {
+		return nil, err
+	}
+	sectionViper := viper.New()
+	sectionViper.SetConfigType("yaml")
+	if err := sectionViper.ReadConfig(bytes.NewReader(contents)); err != nil {
+		return nil, err
+	}
+	return sectionViper.AllSettings(), nil
 }
 
-// GetConfigDir returns the Config Dir based on the current status
+// GetConfigDir returns the Config Dir based on the current status. When several directories are
+// stacked, it is the first one, where configuration is saved.
 func GetConfigDir() string {
-	configDir := GetDefaultConfigDir()
-	if configDirOverride := viper.GetString("config-dir"); configDirOverride != "" {
-		configDir = configDirOverride
-	} else if dirFromEnv, ok := os.LookupEnv("ASTARTE_CONFIG_DIR"); ok && dirFromEnv != "" {
-		configDir = dirFromEnv
+	return GetConfigDirStack()[0]
+}
+
+// GetConfigDirStack returns the configuration directories, in order of precedence. Several directories
+// can be given as a list separated by os.PathListSeparator (e.g. ~/prod-astarte:~/.config/astarte):
+// clusters, contexts and the base configuration which are not found in a directory are looked for in the
+// following ones, while configuration is always saved to the first one.
+func GetConfigDirStack() []string {
+	dirs, _ := configDirSetting()
+	ret := []string{}
+	for _, d := range filepath.SplitList(dirs) {
+		if d != "" {
+			ret = append(ret, d)
+		}
+	}
+	if len(ret) == 0 {
+		return []string{GetDefaultConfigDir()}
+	}
+	return ret
+}
+
+// GetConfigDirSource returns where the configuration directories come from, e.g. --config-dir
+func GetConfigDirSource() string {
+	_, source := configDirSetting()
+	return source
+}
+
+// configDirSetting returns the configuration directories and their source. In order of precedence, they
+// are --config-dir (or ASTARTECTL_CONFIG_DIR), the directory of --config-profile (or ASTARTECTL_CONFIG_PROFILE),
+// ASTARTE_CONFIG_DIR and the default one.
+func configDirSetting() (string, string) {
+	if dirs := viper.GetString("config-dir"); dirs != "" {
+		return dirs, "--config-dir"
+	}
+	if dirs := os.Getenv("ASTARTECTL_CONFIG_DIR"); dirs != "" {
+		return dirs, "ASTARTECTL_CONFIG_DIR"
 	}
-	return configDir
+	if profile := GetConfigProfile(); profile != "" {
+		return GetConfigProfileDir(profile), "profile " + profile
+	}
+	if dirs := os.Getenv("ASTARTE_CONFIG_DIR"); dirs != "" {
+		return dirs, "ASTARTE_CONFIG_DIR"
+	}
+	return "", ""
 }
 
 // GetDefaultConfigDir returns the default config directory
@@ -187,7 +271,7 @@ func ensureConfigDirectoryStructure(configDir string) error {
 	dirsToEnsure := []string{configDir, clustersDirFromConfigDir(configDir), contextsDirFromConfigDir(configDir)}
 	for _, d := range dirsToEnsure {
 		if _, err := os.Stat(d); os.IsNotExist(err) {
-			if err := os.Mkdir(d, os.ModePerm); err != nil {
+			if err := os.MkdirAll(d, os.ModePerm); err != nil {
 				return err
 			}
 		}
@@ -221,6 +305,9 @@ func UpdateBaseConfigWithContext(configDir, context string) BaseConfigFile {
 		// Now set the current context to the new one
 	}
 
+	if baseConfig.CurrentContext != context && baseConfig.CurrentContext != "" {
+		baseConfig.PreviousContext = baseConfig.CurrentContext
+	}
 	baseConfig.CurrentContext = context
 
 	if err := SaveBaseConfiguration(configDir, baseConfig); err != nil {
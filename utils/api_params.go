@@ -0,0 +1,125 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	apiParams          = url.Values{}
+	apiParamsPathMatch *regexp.Regexp
+	validAPIParamKey   = regexp.MustCompile(`^[a-zA-Z0-9_\-\.\[\]]+$`)
+
+	nextRequestParams          = url.Values{}
+	nextRequestParamsPathMatch *regexp.Regexp
+	nextRequestParamsLock      sync.Mutex
+)
+
+// ParseAPIParams parses a list of key=value strings into query parameters which will be passed
+// verbatim to Astarte API. astartectl does not know anything about these parameters: a warning
+// is emitted for every parameter which overrides one of the managedParams, or looks suspicious.
+func ParseAPIParams(rawParams []string, managedParams []string) (url.Values, error) {
+	ret := url.Values{}
+	for _, rawParam := range rawParams {
+		s := strings.SplitN(rawParam, "=", 2)
+		if len(s) != 2 || s[0] == "" {
+			return url.Values{}, fmt.Errorf("Invalid API parameter %s, it must be in the form key=value", rawParam)
+		}
+		key, value := s[0], s[1]
+
+		if !validAPIParamKey.MatchString(key) {
+			fmt.Fprintf(os.Stderr, "warn: API parameter %s contains unusual characters, it might be rejected by Astarte\n", key)
+		}
+		for _, managedParam := range managedParams {
+			if key == managedParam {
+				fmt.Fprintf(os.Stderr, "warn: API parameter %s is already managed by astartectl, overriding it might lead to unexpected results\n", key)
+			}
+		}
+		if value == "" {
+			fmt.Fprintf(os.Stderr, "warn: API parameter %s has an empty value\n", key)
+		}
+
+		ret.Add(key, value)
+	}
+
+	return ret, nil
+}
+
+// SetAPIParams makes all subsequent Astarte API requests whose path matches pathMatch carry params
+// in their query string. Params set here take precedence over the ones set by astartectl.
+func SetAPIParams(params url.Values, pathMatch *regexp.Regexp) {
+	apiParams = params
+	apiParamsPathMatch = pathMatch
+}
+
+// SetNextRequestAPIParams is the same as SetAPIParams, but params are added only to the next request
+// whose path matches pathMatch. This allows to resume a paginated call, starting from a given page.
+func SetNextRequestAPIParams(params url.Values, pathMatch *regexp.Regexp) {
+	nextRequestParamsLock.Lock()
+	defer nextRequestParamsLock.Unlock()
+	nextRequestParams = params
+	nextRequestParamsPathMatch = pathMatch
+}
+
+// takeNextRequestParams returns the params set with SetNextRequestAPIParams if path matches them,
+// clearing them.
+func takeNextRequestParams(path string) url.Values {
+	nextRequestParamsLock.Lock()
+	defer nextRequestParamsLock.Unlock()
+	if len(nextRequestParams) == 0 || nextRequestParamsPathMatch == nil || !nextRequestParamsPathMatch.MatchString(path) {
+		return nil
+	}
+	ret := nextRequestParams
+	nextRequestParams = url.Values{}
+	return ret
+}
+
+// apiParamsTransport is an http.RoundTripper which adds the parameters set with SetAPIParams and
+// SetNextRequestAPIParams to matching requests.
+type apiParamsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *apiParamsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	params := url.Values{}
+	for k, v := range takeNextRequestParams(req.URL.Path) {
+		params[k] = v
+	}
+	if len(apiParams) > 0 && apiParamsPathMatch != nil && apiParamsPathMatch.MatchString(req.URL.Path) {
+		for k, v := range apiParams {
+			params[k] = v
+		}
+	}
+	if len(params) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the original request
+	newReq := req.Clone(req.Context())
+	query := newReq.URL.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	newReq.URL.RawQuery = query.Encode()
+
+	return t.base.RoundTrip(newReq)
+}
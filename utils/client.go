@@ -20,29 +20,74 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/astarte-platform/astarte-go/astarteservices"
 	"github.com/astarte-platform/astarte-go/client"
+	"github.com/astarte-platform/astartectl/config"
 	"github.com/spf13/viper"
 )
 
 // APICommandSetup is a helper for setting up a generic command using Astarte API.
 // individualURLs must contain the service->variable association.
 func APICommandSetup(individualURLVariables map[astarteservices.AstarteService]string, keyVariable, keyFileVariable string) (*client.Client, error) {
-	var clientConfig = []client.Option{}
+	return newAPIClient(viper.GetViper(), individualURLVariables, keyVariable, keyFileVariable)
+}
 
-	httpConfig := setupHTTP()
-	clientConfig = append(clientConfig, httpConfig...)
+// ContextAPIClient returns a client for the realm of the given context, together with the name of
+// the realm, regardless of the context in use. It is meant for commands working with several realms.
+// The client is set up as in APICommandSetup, with the settings of the context and of its cluster.
+func ContextAPIClient(contextName string, individualURLVariables map[astarteservices.AstarteService]string) (*client.Client, string, error) {
+	configDir := config.GetConfigDir()
+	context, err := config.LoadContextConfiguration(configDir, contextName)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not load context %s: %w", contextName, err)
+	}
+	if context.Realm.Name == "" {
+		return nil, "", fmt.Errorf("Context %s has no realm", contextName)
+	}
+	if context.Realm.Key == "" && context.Realm.Token == "" {
+		return nil, "", fmt.Errorf("Context %s has no realm key or token", contextName)
+	}
+	cluster, err := config.LoadClusterConfiguration(configDir, context.Cluster)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not load cluster %s of context %s: %w", context.Cluster, contextName, err)
+	}
 
-	authConfig, err := setupAuth(keyVariable, keyFileVariable)
+	settings := viper.New()
+	settings.Set("url", cluster.URL)
+	settings.Set("individual-urls.appengine", cluster.IndividualURLs.AppEngine)
+	settings.Set("individual-urls.flow", cluster.IndividualURLs.Flow)
+	settings.Set("individual-urls.housekeeping", cluster.IndividualURLs.Housekeeping)
+	settings.Set("individual-urls.pairing", cluster.IndividualURLs.Pairing)
+	settings.Set("individual-urls.realm-management", cluster.IndividualURLs.RealmManagement)
+	settings.Set("realm.key", context.Realm.Key)
+	settings.Set("token", context.Realm.Token)
+
+	astarteAPIClient, err := newAPIClient(settings, individualURLVariables, "realm.key", "realm.key-file")
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not set up a client for context %s: %w", contextName, err)
+	}
+	return astarteAPIClient, context.Realm.Name, nil
+}
+
+// newAPIClient returns a client for Astarte API, with authentication and URLs taken from settings
+func newAPIClient(settings *viper.Viper, individualURLVariables map[astarteservices.AstarteService]string,
+	keyVariable, keyFileVariable string) (*client.Client, error) {
+	var clientConfig = []client.Option{}
+
+	tokens, authConfig, err := setupAuth(settings, keyVariable, keyFileVariable)
 	if err != nil {
 		return nil, err
 	}
 	clientConfig = append(clientConfig, authConfig...)
 
-	URLConfig, err := setupURLs(individualURLVariables)
+	httpConfig := setupHTTP(tokens)
+	clientConfig = append(clientConfig, httpConfig...)
+
+	URLConfig, err := setupURLs(settings, individualURLVariables)
 	if err != nil {
 		return nil, err
 	}
@@ -56,57 +101,116 @@ func APICommandSetup(individualURLVariables map[astarteservices.AstarteService]s
 	return astarteAPIClient, nil
 }
 
-func setupHTTP() []client.Option {
+func setupHTTP(tokens *tokenSource) []client.Option {
 	var ret = []client.Option{}
+	ret = append(ret, client.WithHTTPClient(newHTTPClient(tokens, true)))
+	// The user agent is set on requests too, so that it shows up in --to-curl output
+	if userAgent := viper.GetString("user-agent"); userAgent != "" {
+		ret = append(ret, client.WithUserAgent(userAgent))
+	}
+	return ret
+}
+
+// NewHTTPClient returns an HTTP client sharing the settings of Astarte API clients (e.g. --ignore-ssl-errors),
+// for requests which need no authentication.
+func NewHTTPClient() *http.Client {
+	return newHTTPClient(nil, true)
+}
+
+// NewProbeHTTPClient is the same as NewHTTPClient, but requests are never retried and time out after
+// timeout, for checks which must report failures and latencies as they are.
+func NewProbeHTTPClient(timeout time.Duration) *http.Client {
+	httpClient := newHTTPClient(nil, false)
+	httpClient.Timeout = timeout
+	return httpClient
+}
+
+// newHTTPClient returns the HTTP client for Astarte API requests. When tokens is not nil, requests are
+// authenticated with its tokens. When retry is set, failed idempotent requests are retried according to --retries.
+func newHTTPClient(tokens *tokenSource, retry bool) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
 	ignoreSSLErrors := viper.GetBool("ignore-ssl-errors")
 	if ignoreSSLErrors {
-		httpClient := &http.Client{
-			Timeout: time.Second * 30,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: ignoreSSLErrors,
-				},
+		transport = &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: ignoreSSLErrors,
 			},
 		}
-		ret = append(ret, client.WithHTTPClient(httpClient))
 	}
-	return ret
+	// Each attempt of a retried request is traced
+	if logger := sharedHTTPLogger(); logger != nil {
+		headers, _ := customHeaders()
+		transport = &debugHTTPTransport{base: transport, logger: logger, customHeaders: headers}
+	}
+	// Custom headers are added last, after the authentication ones, so that they show up (redacted) in traces
+	transport = newCustomHeadersTransport(transport)
+	if limiter := sharedRateLimiter(); limiter != nil {
+		transport = &rateLimitTransport{base: transport, limiter: limiter}
+	}
+	if retry {
+		transport = newRetryTransport(transport)
+	}
+	transport = &apiParamsTransport{base: transport}
+	if tokens != nil {
+		transport = &tokenTransport{base: transport, tokens: tokens}
+	}
+	return &http.Client{
+		Timeout:   viper.GetDuration("timeout"),
+		Transport: transport,
+	}
 }
 
-func setupAuth(keyVariable, keyFileVariable string) ([]client.Option, error) {
-	var ret = []client.Option{}
+func setupAuth(settings *viper.Viper, keyVariable, keyFileVariable string) (*tokenSource, []client.Option, error) {
+	explicitToken, tokens, err := authFromSettings(settings, keyVariable, keyFileVariable)
+	if err != nil {
+		return nil, nil, err
+	}
+	if explicitToken != "" {
+		return nil, []client.Option{client.WithJWT(explicitToken)}, nil
+	}
 
-	// Setup auth
-	privateKeyFile := viper.GetString(keyFileVariable)
-	privateKey := viper.GetString(keyVariable)
-	explicitToken := viper.GetString("token")
+	// The initial token is used when building requests (and shows up in --to-curl output), then the
+	// HTTP client renews it if needed
+	token, err := tokens.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, []client.Option{client.WithJWT(token)}, nil
+}
+
+// authFromSettings returns either the token set explicitly, or a tokenSource minting tokens from the
+// private key in keyVariable or keyFileVariable.
+func authFromSettings(settings *viper.Viper, keyVariable, keyFileVariable string) (string, *tokenSource, error) {
+	privateKeyFile := settings.GetString(keyFileVariable)
+	privateKey := settings.GetString(keyVariable)
+	explicitToken := settings.GetString("token")
 	if privateKey == "" && privateKeyFile == "" && explicitToken == "" {
-		return nil, fmt.Errorf("%s or token is required", strings.Replace(keyFileVariable, ".", "-", -1))
-	}
-	if explicitToken == "" {
-		// 1 minute TTL is more than enough for our purposes
-		if privateKeyFile != "" {
-			ret = append(ret, client.WithPrivateKey(privateKeyFile), client.WithExpiry(60))
-		} else {
-			decoded, err := base64.StdEncoding.DecodeString(privateKey)
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, client.WithPrivateKey(decoded), client.WithExpiry(60))
-		}
+		return "", nil, fmt.Errorf("%s or token is required", strings.Replace(keyFileVariable, ".", "-", -1))
+	}
+	if explicitToken != "" {
+		return explicitToken, nil, nil
+	}
+
+	var key []byte
+	var err error
+	if privateKeyFile != "" {
+		key, err = os.ReadFile(privateKeyFile)
 	} else {
-		ret = append(ret, client.WithJWT(explicitToken))
+		key, err = base64.StdEncoding.DecodeString(privateKey)
 	}
-	return ret, nil
+	if err != nil {
+		return "", nil, err
+	}
+	return "", newTokenSource(key), nil
 }
 
-func setupURLs(individualURLVariables map[astarteservices.AstarteService]string) ([]client.Option, error) {
+func setupURLs(settings *viper.Viper, individualURLVariables map[astarteservices.AstarteService]string) ([]client.Option, error) {
 	var ret = []client.Option{}
 
-	astarteURL := viper.GetString("url")
+	astarteURL := settings.GetString("url")
 	individualURLs := map[astarteservices.AstarteService]string{}
 	for k, v := range individualURLVariables {
-		urlOverride := viper.GetString(v)
+		urlOverride := settings.GetString(v)
 		if urlOverride != "" {
 			individualURLs[k] = urlOverride
 		}
@@ -6,10 +6,37 @@ import (
 	"os"
 	"strings"
 
-	"github.com/astarte-platform/astarte-go/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// AddNonInteractiveFlag adds the --non-interactive flag, which predates the global --yes flag and is kept
+// as a deprecated alias of it.
+func AddNonInteractiveFlag(flags *pflag.FlagSet) {
+	flags.Bool("non-interactive", false, "Non-interactive mode. Will answer yes by default to all questions.")
+	_ = flags.MarkDeprecated("non-interactive", "use --yes instead")
+}
+
+// NonInteractive returns whether command must not prompt the user, as either the global --yes flag or
+// the --non-interactive flag of command is set.
+func NonInteractive(command *cobra.Command) bool {
+	if viper.GetBool("yes") {
+		return true
+	}
+	nonInteractive, _ := command.Flags().GetBool("non-interactive")
+	return nonInteractive
+}
+
+// Confirm asks the user if they want to continue, unless command is non-interactive: in that case,
+// the answer is yes.
+func Confirm(command *cobra.Command, question string) (bool, error) {
+	if NonInteractive(command) {
+		return true, nil
+	}
+	return AskForConfirmation(question)
+}
+
 // AskForConfirmation asks the user if he wants to continue.
 func AskForConfirmation(s string) (bool, error) {
 	reader := bufio.NewReader(os.Stdin)
@@ -73,14 +100,3 @@ func PromptChoice(question string, defaultValue string, allowEmpty, nonInteracti
 		return response, nil
 	}
 }
-
-func MaybeCurlAndExit(req client.AstarteRequest, client *client.Client) {
-	if ShouldCurl() {
-		fmt.Println(req.ToCurl(client))
-		os.Exit(0)
-	}
-}
-
-func ShouldCurl() bool {
-	return viper.GetBool("appengine-to-curl") || viper.GetBool("housekeeping-to-curl") || viper.GetBool("pairing-to-curl") || viper.GetBool("realmmanagement-to-curl")
-}
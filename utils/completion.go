@@ -0,0 +1,116 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/astarte-platform/astartectl/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Completions hit the network at each keypress, a short cache keeps them snappy
+const completionCacheTTL = 30 * time.Second
+
+type completionCacheEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Values    []string  `json:"values"`
+}
+
+// CachedCompletions returns the completions of a kind of resource (e.g. "interfaces"), fetching them
+// with fetch only if they were not fetched recently for the current Astarte URL and realm. Errors are
+// not reported, as there is no way to show them while completing.
+func CachedCompletions(kind string, fetch func() ([]string, error)) []string {
+	hash := sha256.Sum256([]byte(viper.GetString("url") + "\x00" + viper.GetString("realm.name") + "\x00" + kind))
+	cacheFile := ""
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		cacheFile = filepath.Join(cacheDir, "astartectl", "completions", hex.EncodeToString(hash[:])+".json")
+	}
+
+	if cacheFile != "" {
+		entry := completionCacheEntry{}
+		if content, err := os.ReadFile(cacheFile); err == nil && json.Unmarshal(content, &entry) == nil &&
+			time.Since(entry.Timestamp) < completionCacheTTL {
+			return entry.Values
+		}
+	}
+
+	values, err := fetch()
+	if err != nil {
+		return nil
+	}
+	sort.Strings(values)
+
+	if cacheFile != "" {
+		if content, err := json.Marshal(completionCacheEntry{Timestamp: time.Now(), Values: values}); err == nil {
+			if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err == nil {
+				_ = os.WriteFile(cacheFile, content, 0600)
+			}
+		}
+	}
+	return values
+}
+
+// ContextNamesCompletion completes the first argument with the names of the configured contexts
+func ContextNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	contexts, err := config.ListContextConfigurations(config.GetConfigDir())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return contexts, cobra.ShellCompDirectiveNoFileComp
+}
+
+// ClusterNamesCompletion completes the first argument with the names of the configured clusters
+func ClusterNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	clusters, err := config.ListClusterConfigurations(config.GetConfigDir())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return clusters, cobra.ShellCompDirectiveNoFileComp
+}
+
+// RealmNamesCompletion completes a realm name with the realms of the configured contexts
+func RealmNamesCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	configDir := config.GetConfigDir()
+	contexts, err := config.ListContextConfigurations(configDir)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	realms := map[string]bool{}
+	for _, c := range contexts {
+		if context, err := config.LoadContextConfiguration(configDir, c); err == nil && context.Realm.Name != "" {
+			realms[context.Realm.Name] = true
+		}
+	}
+	ret := []string{}
+	for r := range realms {
+		ret = append(ret, r)
+	}
+	sort.Strings(ret)
+	return ret, cobra.ShellCompDirectiveNoFileComp
+}
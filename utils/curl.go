@@ -0,0 +1,100 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/astarte-platform/astarte-go/client"
+	"github.com/spf13/viper"
+)
+
+var (
+	curlScriptLock    sync.Mutex
+	curlScript        []string
+	curlScriptEnabled bool
+	curlScriptStdout  *os.File
+)
+
+// MaybeCurlAndExit prints the curl command equivalent to req, including the headers set with --header,
+// and exits, when --to-curl is set. If
+// StartCurlScript was called, the command is collected instead, and the caller goes on performing req.
+func MaybeCurlAndExit(req client.AstarteRequest, client *client.Client) {
+	if !ShouldCurl() {
+		return
+	}
+
+	curlScriptLock.Lock()
+	curlScript = append(curlScript, curlWithCustomHeaders(req.ToCurl(client)))
+	enabled := curlScriptEnabled
+	curlScriptLock.Unlock()
+
+	if !enabled {
+		FlushCurlScript()
+		os.Exit(0)
+	}
+}
+
+// ShouldCurl returns whether --to-curl was set for the running command
+func ShouldCurl() bool {
+	return viper.GetBool("appengine-to-curl") || viper.GetBool("housekeeping-to-curl") || viper.GetBool("pairing-to-curl") || viper.GetBool("realmmanagement-to-curl")
+}
+
+// StartCurlScript is meant for commands making several API calls, which may depend on the results of
+// the previous ones (e.g. the pages of a list). When --to-curl is set, the calls passed to MaybeCurlAndExit
+// are performed and collected, rather than exiting at the first one, and they are printed in order as a
+// shell script by FlushCurlScript. Meanwhile, the regular output of the command is discarded. As calls
+// are actually performed, it must be used only by commands which do not modify the state of Astarte.
+func StartCurlScript() {
+	if !ShouldCurl() || curlScriptEnabled {
+		return
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+
+	curlScriptLock.Lock()
+	defer curlScriptLock.Unlock()
+	curlScriptEnabled = true
+	curlScriptStdout = os.Stdout
+	os.Stdout = devNull
+}
+
+// FlushCurlScript prints the curl commands collected by MaybeCurlAndExit, if any, restoring the
+// output discarded by StartCurlScript.
+func FlushCurlScript() {
+	curlScriptLock.Lock()
+	defer curlScriptLock.Unlock()
+
+	if curlScriptStdout != nil {
+		os.Stdout.Close()
+		os.Stdout = curlScriptStdout
+		curlScriptStdout = nil
+	}
+
+	if curlScriptEnabled {
+		fmt.Println("#!/bin/sh")
+		fmt.Println("set -e")
+		fmt.Println()
+	}
+	for _, c := range curlScript {
+		fmt.Println(c)
+	}
+	curlScript = nil
+	curlScriptEnabled = false
+}
@@ -0,0 +1,87 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	httpLogger     *slog.Logger
+	httpLoggerOnce sync.Once
+	// sensitiveHeaderPattern matches the names of headers whose values are redacted in traces
+	sensitiveHeaderPattern = regexp.MustCompile(`(?i)auth|token|key|secret|cookie`)
+)
+
+// sharedHTTPLogger returns the logger tracing the requests to Astarte APIs when --debug-http is set,
+// shared by all clients so that the requests of commands using several of them are traced together.
+// It returns nil when tracing is disabled.
+func sharedHTTPLogger() *slog.Logger {
+	httpLoggerOnce.Do(func() {
+		if viper.GetBool("debug-http") {
+			httpLogger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		}
+	})
+	return httpLogger
+}
+
+// debugHTTPTransport is an http.RoundTripper logging each request to Astarte APIs along with its
+// outcome and duration, to find out which of the many requests of a command is slow or failing.
+// The values of the headers set with --header are redacted, as they usually carry API keys.
+type debugHTTPTransport struct {
+	base          http.RoundTripper
+	logger        *slog.Logger
+	customHeaders http.Header
+}
+
+func (t *debugHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := []any{}
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if _, custom := t.customHeaders[name]; custom || isSensitiveHeader(name) {
+			value = "REDACTED"
+		}
+		headers = append(headers, slog.String(name, value))
+	}
+	attrs := []any{slog.String("method", req.Method), slog.String("url", req.URL.String()), slog.Group("headers", headers...)}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		t.logger.Error("HTTP request failed", append(attrs, slog.String("error", err.Error()))...)
+		return res, err
+	}
+	t.logger.Debug("HTTP request", append(attrs, slog.Int("status", res.StatusCode))...)
+	return res, err
+}
+
+// isSensitiveHeader returns whether the value of the header name may hold credentials, and must not be traced
+func isSensitiveHeader(name string) bool {
+	return sensitiveHeaderPattern.MatchString(name)
+}
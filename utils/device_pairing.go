@@ -0,0 +1,125 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/astarte-platform/astarte-go/client"
+)
+
+// NewDevicePairingClient returns a client performing Pairing API requests on behalf of a device, authenticated
+// with its Credentials Secret
+func NewDevicePairingClient(credentialsSecret string) (*client.Client, error) {
+	pairingURL, err := ServiceURL("individual-urls.pairing", "pairing")
+	if err != nil {
+		return nil, err
+	}
+	return client.New(
+		client.WithPairingURL(pairingURL.String()),
+		client.WithJWT(credentialsSecret),
+		client.WithHTTPClient(NewHTTPClient()),
+	)
+}
+
+// NewDeviceRawAPIClient returns a RawAPIClient performing requests on behalf of a device, authenticated
+// with its Credentials Secret
+func NewDeviceRawAPIClient(credentialsSecret string) *RawAPIClient {
+	return &RawAPIClient{httpClient: NewHTTPClient(), token: credentialsSecret}
+}
+
+// ObtainDeviceCertificate generates a private key for the device, and requests to Pairing API a
+// certificate for it. Both are returned PEM encoded.
+func ObtainDeviceCertificate(deviceClient *client.Client, realm, deviceID string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: fmt.Sprintf("%s/%s", realm, deviceID)},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificateCall, err := deviceClient.ObtainNewMQTTv1CertificateForDevice(realm, deviceID,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})))
+	if err != nil {
+		return nil, nil, err
+	}
+	certificateRes, err := certificateCall.Run(deviceClient)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := certificateRes.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	if certificate == "" {
+		return nil, nil, errors.New("Pairing API returned no certificate")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), []byte(fmt.Sprintf("%v", certificate)), nil
+}
+
+// DeviceBrokerURL returns the URL of the broker the device has to connect to
+func DeviceBrokerURL(deviceClient *client.Client, realm, deviceID string) (string, error) {
+	infoCall, err := deviceClient.GetMQTTv1ProtocolInformationForDevice(realm, deviceID)
+	if err != nil {
+		return "", err
+	}
+	infoRes, err := infoCall.Run(deviceClient)
+	if err != nil {
+		return "", err
+	}
+	// The broker URL is nested in the protocols of the device, read it from the raw response
+	ret := infoRes.Raw(func(res *http.Response) any {
+		var info struct {
+			Data struct {
+				Protocols struct {
+					AstarteMQTTv1 struct {
+						BrokerURL string `json:"broker_url"`
+					} `json:"astarte_mqtt_v1"`
+				} `json:"protocols"`
+			} `json:"data"`
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &info); err != nil {
+			return err
+		}
+		return info.Data.Protocols.AstarteMQTTv1.BrokerURL
+	})
+	if err, ok := ret.(error); ok {
+		return "", err
+	}
+	return fmt.Sprintf("%v", ret), nil
+}
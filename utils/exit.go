@@ -0,0 +1,38 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import "os"
+
+var exitHooks []func()
+
+// OnExit registers f to be called by Exit before terminating, e.g. to close a compressed file being
+// written, which would be left corrupt otherwise. Hooks are called in reverse order of registration.
+func OnExit(f func()) {
+	exitHooks = append(exitHooks, f)
+}
+
+// Exit terminates astartectl with code, after calling the hooks registered with OnExit, printing the curl
+// script collected since StartCurlScript and stopping the pager started by StartPager, if any. Commands which
+// may have started either of them must exit through Exit rather than os.Exit, which would lose the script,
+// or leave the pager running on a half-written output and the terminal in a broken state.
+func Exit(code int) {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	FlushCurlScript()
+	StopPager()
+	os.Exit(code)
+}
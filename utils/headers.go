@@ -0,0 +1,122 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// customHeadersTransport adds the headers set with --header and --user-agent to each request, e.g.
+// for Astarte APIs behind gateways requiring tenant IDs or API keys
+type customHeadersTransport struct {
+	base      http.RoundTripper
+	headers   http.Header
+	userAgent string
+}
+
+func (t *customHeadersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ValidateCustomHeaders ensures the headers set with --header are in the form key=value
+func ValidateCustomHeaders() error {
+	_, err := customHeaders()
+	return err
+}
+
+// customHeaders returns the headers set with --header. Headers set by astartectl, such as Authorization,
+// can be overridden, but a warning is emitted.
+func customHeaders() (http.Header, error) {
+	ret := http.Header{}
+	for _, rawHeader := range viper.GetStringSlice("headers") {
+		s := strings.SplitN(rawHeader, "=", 2)
+		key := strings.TrimSpace(s[0])
+		if len(s) != 2 || key == "" || strings.ContainsAny(key, " \t:") {
+			return nil, fmt.Errorf("Invalid header %s, it must be in the form key=value", rawHeader)
+		}
+		ret.Add(textproto.CanonicalMIMEHeaderKey(key), s[1])
+	}
+	return ret, nil
+}
+
+// newCustomHeadersTransport wraps base with a customHeadersTransport, unless no custom headers are set
+func newCustomHeadersTransport(base http.RoundTripper) http.RoundTripper {
+	headers, err := customHeaders()
+	if err != nil {
+		// Already reported by ValidateCustomHeaders
+		headers = http.Header{}
+	}
+	userAgent := viper.GetString("user-agent")
+	if len(headers) == 0 && userAgent == "" {
+		return base
+	}
+	for _, managed := range []string{"Authorization", "Content-Type", "Accept"} {
+		if _, ok := headers[managed]; ok {
+			fmt.Fprintf(os.Stderr, "warn: Header %s is already managed by astartectl, overriding it might lead to unexpected results\n", managed)
+		}
+	}
+	return &customHeadersTransport{base: base, headers: headers, userAgent: userAgent}
+}
+
+// curlWithCustomHeaders adds the headers set with --header to command, a curl command generated by
+// astarte-go, replacing the headers they override
+func curlWithCustomHeaders(command string) string {
+	headers, err := customHeaders()
+	if err != nil || len(headers) == 0 {
+		return command
+	}
+	method := regexp.MustCompile(`^curl -X '[^']*'`).FindString(command)
+	if method == "" {
+		return command
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	options := []string{method}
+	for _, key := range keys {
+		overridden := regexp.MustCompile(` -H '` + regexp.QuoteMeta(key) + `: (?:[^']|'\\'')*'`)
+		command = overridden.ReplaceAllString(command, "")
+		for _, value := range headers[key] {
+			options = append(options, "-H", shellQuote(fmt.Sprintf("%s: %s", key, value)))
+		}
+	}
+	return strings.Join(options, " ") + strings.TrimPrefix(command, method)
+}
+
+// shellQuote quotes s for a POSIX shell, the same way astarte-go does in curl commands
+func shellQuote(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `'\''`) + `'`
+}
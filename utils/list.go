@@ -0,0 +1,34 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// PrintList prints a list of identifiers (e.g. device IDs, interface names). When --quiet is set,
+// they are printed one per line, to be consumed by other tools, rather than in brackets.
+func PrintList(items []string) {
+	if viper.GetBool("quiet") {
+		if len(items) > 0 {
+			fmt.Println(strings.Join(items, "\n"))
+		}
+		return
+	}
+	fmt.Println(items)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	goTemplateOutputPrefix = "go-template="
+	jsonPathOutputPrefix   = "jsonpath="
+)
+
+// TemplateOutputTypes are the output types rendering data with a user provided template, as shown in help messages
+var TemplateOutputTypes = []string{goTemplateOutputPrefix + "<template>", jsonPathOutputPrefix + "<expression>"}
+
+// TemplateOutput renders data with the Go template or the JSONPath expression given with
+// --output go-template=<template> or --output jsonpath=<expression>, as kubectl does.
+type TemplateOutput struct {
+	goTemplate *template.Template
+	jsonPath   *jsonpath.JSONPath
+}
+
+// IsTemplateOutput returns whether outputType is a go-template or a jsonpath output
+func IsTemplateOutput(outputType string) bool {
+	return strings.HasPrefix(outputType, goTemplateOutputPrefix) || strings.HasPrefix(outputType, jsonPathOutputPrefix)
+}
+
+// NewTemplateOutput parses the template or the expression of outputType, which must satisfy IsTemplateOutput.
+func NewTemplateOutput(outputType string) (*TemplateOutput, error) {
+	switch {
+	case strings.HasPrefix(outputType, goTemplateOutputPrefix):
+		t, err := template.New("output").Option("missingkey=zero").Parse(strings.TrimPrefix(outputType, goTemplateOutputPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+		return &TemplateOutput{goTemplate: t}, nil
+	case strings.HasPrefix(outputType, jsonPathOutputPrefix):
+		expression := strings.TrimPrefix(outputType, jsonPathOutputPrefix)
+		// Same as kubectl, .device_id is a shorthand for {.device_id}
+		if !strings.Contains(expression, "{") {
+			expression = "{" + expression + "}"
+		}
+		j := jsonpath.New("output").AllowMissingKeys(true)
+		if err := j.Parse(expression); err != nil {
+			return nil, fmt.Errorf("invalid jsonpath: %w", err)
+		}
+		return &TemplateOutput{jsonPath: j}, nil
+	}
+	return nil, fmt.Errorf("%s is not a go-template or jsonpath output", outputType)
+}
+
+// Write renders item to w, followed by a newline unless the rendered text already ends with one.
+// Go templates are executed on item as is, hence they refer to the fields of its Go type (e.g. {{.DeviceID}}),
+// while JSONPath expressions are evaluated on its JSON representation (e.g. {.device_id}).
+func (o *TemplateOutput) Write(w io.Writer, item interface{}) error {
+	var b bytes.Buffer
+	if o.goTemplate != nil {
+		if err := o.goTemplate.Execute(&b, item); err != nil {
+			return err
+		}
+	} else {
+		marshaled, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		var jsonItem interface{}
+		if err := json.Unmarshal(marshaled, &jsonItem); err != nil {
+			return err
+		}
+		if err := o.jsonPath.Execute(&b, jsonItem); err != nil {
+			return err
+		}
+	}
+	if !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteAll renders each element of data with Write when data is a slice, and data itself otherwise.
+// This way, the template is applied to each listed item, which is what scripts usually need.
+func (o *TemplateOutput) WriteAll(w io.Writer, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return o.Write(w, data)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := o.Write(w, v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutputFlagHelp returns the help of an --output flag accepting outputTypes, as well as go-template and jsonpath outputs
+func OutputFlagHelp(outputTypes ...string) string {
+	return fmt.Sprintf("The type of output (%s)", strings.Join(append(outputTypes, TemplateOutputTypes...), ","))
+}
+
+// OutputFromFlags returns the --output of command, which must be either one of outputTypes or a go-template or
+// jsonpath output. In the latter case, its parsed template is returned too, so that invalid templates are
+// reported before calling Astarte.
+func OutputFromFlags(command *cobra.Command, outputTypes ...string) (string, *TemplateOutput, error) {
+	outputType, err := command.Flags().GetString("output")
+	if err != nil {
+		return "", nil, err
+	}
+	if IsTemplateOutput(outputType) {
+		templateOutput, err := NewTemplateOutput(outputType)
+		return outputType, templateOutput, err
+	}
+	for _, t := range outputTypes {
+		if outputType == t {
+			return outputType, nil, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%s is not a supported output type. Supported output types are %s",
+		outputType, strings.Join(append(outputTypes, TemplateOutputTypes...), ", "))
+}
+
+// PrintTemplateOutput renders data to stdout as WriteAll does, exiting when the template cannot be executed
+func PrintTemplateOutput(templateOutput *TemplateOutput, data interface{}) {
+	if err := templateOutput.WriteAll(os.Stdout, data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		Exit(1)
+	}
+}
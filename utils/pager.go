@@ -0,0 +1,93 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const defaultPager = "less"
+
+var (
+	pagerCmd       *exec.Cmd
+	originalStdout *os.File
+)
+
+// StartPager redirects stdout through the user's $PAGER (less by default), when stdout is a terminal
+// and --no-pager is not set. As less is run with -F (unless $LESS is already set), output fitting in
+// a single screen is printed as is. It should be called only by commands which do not prompt the user.
+// When --to-curl is set, the output is short enough and no pager is started.
+func StartPager() {
+	if pagerCmd != nil || viper.GetBool("no-pager") || ShouldCurl() || !isTerminal(os.Stdout) {
+		return
+	}
+
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = defaultPager
+	}
+	pagerArgs := strings.Fields(pager)
+	if len(pagerArgs) == 0 || pagerArgs[0] == "cat" {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(pagerArgs[0], pagerArgs[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// Same as git: quit if one screen, keep colors, don't clear the screen
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := cmd.Start(); err != nil {
+		// No pager available, just go on without it
+		r.Close()
+		w.Close()
+		return
+	}
+	r.Close()
+
+	pagerCmd = cmd
+	originalStdout = os.Stdout
+	os.Stdout = w
+}
+
+// StopPager flushes the output to the pager started by StartPager, if any, and waits for the
+// user to quit it.
+func StopPager() {
+	if pagerCmd == nil {
+		return
+	}
+	os.Stdout.Close()
+	os.Stdout = originalStdout
+	_ = pagerCmd.Wait()
+	pagerCmd = nil
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
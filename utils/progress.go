@@ -0,0 +1,60 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Progress reports on stderr how many of a known number of items have been processed, e.g. while
+// fetching hundreds of interfaces. It is updated in place, hence it is shown only when stderr is a
+// terminal. It is safe for concurrent use.
+type Progress struct {
+	mu      sync.Mutex
+	label   string
+	done    int
+	total   int
+	enabled bool
+}
+
+// NewProgress returns a Progress for total items, described by label (e.g. "Downloading interfaces")
+func NewProgress(label string, total int) *Progress {
+	p := &Progress{label: label, total: total, enabled: isTerminal(os.Stderr) && total > 0}
+	p.print()
+	return p
+}
+
+// Increment marks an item as processed
+func (p *Progress) Increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.print()
+}
+
+// Done ends the progress line, it must be called once all items have been processed
+func (p *Progress) Done() {
+	if p.enabled {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (p *Progress) print() {
+	if p.enabled {
+		fmt.Fprintf(os.Stderr, "\r%s: %d/%d", p.label, p.done, p.total)
+	}
+}
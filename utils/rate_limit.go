@@ -0,0 +1,55 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+var (
+	rateLimiter     *rate.Limiter
+	rateLimiterOnce sync.Once
+)
+
+// sharedRateLimiter returns the token bucket limiting the requests to Astarte APIs to --max-rps per
+// second, shared by all clients so that bulk commands using several of them are limited as a whole.
+// It returns nil when no limit is set.
+func sharedRateLimiter() *rate.Limiter {
+	rateLimiterOnce.Do(func() {
+		if maxRPS := viper.GetFloat64("max-rps"); maxRPS > 0 {
+			rateLimiter = rate.NewLimiter(rate.Limit(maxRPS), 1)
+		}
+	})
+	return rateLimiter
+}
+
+// rateLimitTransport is an http.RoundTripper waiting for the shared rate limiter before each request,
+// so that commands performing many requests (e.g. listing devices with details or saving all interfaces)
+// don't hammer Astarte and trip API gateway limits.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,173 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/viper"
+)
+
+// RawAPIClient performs requests to Astarte APIs which are not (yet) supported by astarte-go,
+// sharing HTTP and authentication settings with the clients built by APICommandSetup.
+type RawAPIClient struct {
+	httpClient *http.Client
+	token      string
+	tokens     *tokenSource
+}
+
+// RawAPIError is returned by RawAPIClient when Astarte answers with an unexpected status code
+type RawAPIError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *RawAPIError) Error() string {
+	return e.message
+}
+
+// RawAPICommandSetup is the RawAPIClient counterpart of APICommandSetup.
+func RawAPICommandSetup(keyVariable, keyFileVariable string) (*RawAPIClient, error) {
+	token, tokens, err := authFromSettings(viper.GetViper(), keyVariable, keyFileVariable)
+	if err != nil {
+		return nil, err
+	}
+	return &RawAPIClient{httpClient: newHTTPClient(nil, true), token: token, tokens: tokens}, nil
+}
+
+// ServiceURL returns the URL of service, which is either the one in individualURLVariable, when set,
+// or the Astarte base URL joined with servicePath.
+func ServiceURL(individualURLVariable, servicePath string) (*url.URL, error) {
+	if individualURL := viper.GetString(individualURLVariable); individualURL != "" {
+		return url.Parse(individualURL)
+	}
+	astarteURL := viper.GetString("url")
+	if astarteURL == "" {
+		return nil, errors.New("Either astarte-url or an individual API URL have to be specified")
+	}
+	ret, err := url.Parse(astarteURL)
+	if err != nil {
+		return nil, err
+	}
+	ret.Path = path.Join(ret.Path, servicePath)
+	return ret, nil
+}
+
+func (c *RawAPIClient) getJWT() (string, error) {
+	if c.token != "" {
+		return c.token, nil
+	}
+	return c.tokens.Token()
+}
+
+// Do performs a request to Astarte API. When payload is not nil, it is sent as JSON wrapped in a
+// "data" object, as expected by Astarte. Unless the response has the expected status code, an error
+// is returned with the errors reported by Astarte. The "data" object of the response, if any, is returned.
+func (c *RawAPIClient) Do(method string, callURL *url.URL, payload interface{}, expectedStatus int) (json.RawMessage, error) {
+	if payload == nil {
+		return c.DoWithEnvelope(method, callURL, nil, expectedStatus)
+	}
+	return c.DoWithEnvelope(method, callURL, map[string]interface{}{"data": payload}, expectedStatus)
+}
+
+// DoWithEnvelope is the same as Do, but envelope is sent as is, for requests carrying more than a "data" object.
+func (c *RawAPIClient) DoWithEnvelope(method string, callURL *url.URL, envelope map[string]interface{}, expectedStatus int) (json.RawMessage, error) {
+	return c.do(method, callURL, envelope, "application/json", expectedStatus)
+}
+
+// MergePatch performs a PATCH request to Astarte API with payload as a JSON merge patch, as required
+// e.g. to update the aliases and attributes of a device.
+func (c *RawAPIClient) MergePatch(callURL *url.URL, payload interface{}, expectedStatus int) (json.RawMessage, error) {
+	return c.do(http.MethodPatch, callURL, map[string]interface{}{"data": payload}, "application/merge-patch+json", expectedStatus)
+}
+
+func (c *RawAPIClient) do(method string, callURL *url.URL, envelope map[string]interface{}, contentType string, expectedStatus int) (json.RawMessage, error) {
+	var body io.Reader
+	if envelope != nil {
+		b, err := json.Marshal(envelope)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, callURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	token, err := c.getJWT()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if envelope != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != expectedStatus {
+		var errorBody struct {
+			Errors map[string]interface{} `json:"errors"`
+		}
+		if err := json.Unmarshal(resBody, &errorBody); err != nil || errorBody.Errors == nil {
+			return nil, &RawAPIError{StatusCode: res.StatusCode,
+				message: fmt.Sprintf("Received unexpected status code %d, expected %d", res.StatusCode, expectedStatus)}
+		}
+		errJSON, _ := json.MarshalIndent(&errorBody, "", "  ")
+		return nil, &RawAPIError{StatusCode: res.StatusCode, message: string(errJSON)}
+	}
+
+	if len(resBody) == 0 {
+		return nil, nil
+	}
+	var data struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resBody, &data); err != nil {
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// ServiceVersion returns the version of the Astarte service answering at versionURL (e.g.
+// <appengine>/v1/<realm>/version). Astarte versions before 1.1 do not report their version, and
+// an error is returned.
+func (c *RawAPIClient) ServiceVersion(versionURL *url.URL) (*semver.Version, error) {
+	data, err := c.Do(http.MethodGet, versionURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var version string
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, err
+	}
+	return semver.NewVersion(version)
+}
@@ -0,0 +1,78 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// retryTransport is an http.RoundTripper retrying idempotent requests which fail with a connection
+// error or a 5xx status code, waiting an exponentially growing, jittered backoff between attempts.
+// Requests with side effects are never retried, as they might have been processed anyway.
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+	return &retryTransport{base: base, retries: viper.GetInt("retries"), backoff: viper.GetDuration("retry-backoff")}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := t.base.RoundTrip(req)
+		if attempt >= t.retries || !shouldRetry(res, err) || req.Context().Err() != nil {
+			return res, err
+		}
+		if res != nil {
+			// Drain the body, so that the connection can be reused
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(t.backoffFor(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// backoffFor returns the time to wait after the given attempt: the backoff doubles at each attempt, and
+// a random jitter of up to half of it spreads retries from concurrent requests
+func (t *retryTransport) backoffFor(attempt int) time.Duration {
+	backoff := t.backoff << attempt
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= http.StatusInternalServerError && res.StatusCode != http.StatusNotImplemented
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ValidateTimestampSettings ensures --time-zone and --time-format hold valid values
+func ValidateTimestampSettings() error {
+	_, err := timestampLocation()
+	return err
+}
+
+// timestampLocation returns the location set with --time-zone, which is either utc, local or an IANA
+// time zone name (e.g. Europe/Rome). It returns nil when no time zone is set, in which case timestamps
+// are rendered in the time zone they were received in.
+func timestampLocation() (*time.Location, error) {
+	timeZone := viper.GetString("time-zone")
+	switch strings.ToLower(timeZone) {
+	case "":
+		return nil, nil
+	case "utc":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid time zone: %w", timeZone, err)
+	}
+	return location, nil
+}
+
+// FormatTimestamp renders t for human readable and CSV outputs, in the time zone set with --time-zone and
+// with the layout set with --time-format. --time-format is either rfc3339, rfc3339nano, unix, unixmilli or a
+// Go time layout. When --time-format is not set, defaultLayout is used, or time.Time.String when it is empty.
+func FormatTimestamp(t time.Time, defaultLayout string) string {
+	if location, err := timestampLocation(); err == nil && location != nil {
+		t = t.In(location)
+	}
+
+	layout := defaultLayout
+	switch format := viper.GetString("time-format"); strings.ToLower(format) {
+	case "":
+	case "rfc3339":
+		layout = time.RFC3339
+	case "rfc3339nano":
+		layout = time.RFC3339Nano
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		layout = format
+	}
+
+	if layout == "" {
+		return t.String()
+	}
+	return t.Format(layout)
+}
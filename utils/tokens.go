@@ -0,0 +1,107 @@
+// Copyright © 2024 SECO Mind Srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astarte-platform/astarte-go/astarteservices"
+	"github.com/astarte-platform/astarte-go/auth"
+	"github.com/astarte-platform/astartectl/config"
+)
+
+const (
+	// mintedTokenTTL is the validity of tokens minted from private keys
+	mintedTokenTTL = 10 * time.Minute
+	// tokenRenewalMargin is how long before expiry a token is renewed, so that it does not expire mid-request
+	tokenRenewalMargin = 2 * time.Minute
+)
+
+// tokenSource mints tokens from a private key, caching them in the configuration directory so that
+// subsequent invocations reuse them until they are about to expire.
+type tokenSource struct {
+	privateKey  []byte
+	fingerprint string
+
+	mu    sync.Mutex
+	token config.CachedToken
+}
+
+func newTokenSource(privateKey []byte) *tokenSource {
+	hash := sha256.Sum256(privateKey)
+	return &tokenSource{privateKey: privateKey, fingerprint: hex.EncodeToString(hash[:])}
+}
+
+func isTokenFresh(token config.CachedToken) bool {
+	return token.Token != "" && time.Until(token.Expiry) > tokenRenewalMargin
+}
+
+// Token returns a valid token, minting a new one only when the cached one is about to expire
+func (s *tokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if isTokenFresh(s.token) {
+		return s.token.Token, nil
+	}
+	configDir := config.GetConfigDir()
+	if cached, ok := config.GetCachedToken(configDir, s.fingerprint); ok && isTokenFresh(cached) {
+		s.token = cached
+		return s.token.Token, nil
+	}
+
+	// Same as astarte-go: all services
+	servicesAndClaims := map[astarteservices.AstarteService][]string{
+		astarteservices.AppEngine:       {},
+		astarteservices.Channels:        {},
+		astarteservices.Flow:            {},
+		astarteservices.Housekeeping:    {},
+		astarteservices.Pairing:         {},
+		astarteservices.RealmManagement: {},
+	}
+	expiry := time.Now().Add(mintedTokenTTL)
+	token, err := auth.GenerateAstarteJWTFromPEMKey(s.privateKey, servicesAndClaims, int64(mintedTokenTTL.Seconds()))
+	if err != nil {
+		return "", err
+	}
+	s.token = config.CachedToken{Token: token, Expiry: expiry}
+	// Failing to cache is not a problem, the token will just be minted again next time
+	_ = config.SaveCachedToken(configDir, s.fingerprint, s.token)
+	return s.token.Token, nil
+}
+
+// tokenTransport is an http.RoundTripper which authenticates requests with the tokens of a tokenSource,
+// renewing them when needed by long running commands.
+type tokenTransport struct {
+	base   http.RoundTripper
+	tokens *tokenSource
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the original request
+	newReq := req.Clone(req.Context())
+	newReq.Header.Set("Authorization", "Bearer "+token)
+
+	return t.base.RoundTrip(newReq)
+}